@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/spf13/viper"
+)
+
+// alertCache is the active alerts within their display window, refreshed when an admin edits an alert
+// and periodically so edits made on other replicas and scheduled start and end times are picked up
+type alertCache struct {
+	// refresh serializes refreshes so the change check compares consecutive loads
+	refresh sync.Mutex
+
+	mu      sync.RWMutex
+	alerts  []*database.Alert
+	version string
+	loaded  bool
+}
+
+// list gets the cached alerts
+func (c *alertCache) list() []*database.Alert {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.alerts
+}
+
+// alertsVersion identifies a set of alerts by their ids and last update, so any create, edit, delete, start or expiry changes it
+func alertsVersion(Alerts []*database.Alert) string {
+	var version string
+	for _, a := range Alerts {
+		version = version + a.AlertID + "@" + a.UpdatedDate + ";"
+	}
+
+	return version
+}
+
+// refreshAlerts reloads the active alerts, pushing the alerts shown to each open websocket session when they changed
+func (s *server) refreshAlerts(ctx context.Context) {
+	s.alerts.refresh.Lock()
+	defer s.alerts.refresh.Unlock()
+
+	Alerts, err := s.database.GetActiveAlerts(ctx)
+	if err != nil {
+		return
+	}
+
+	version := alertsVersion(Alerts)
+	s.alerts.mu.Lock()
+	changed := s.alerts.loaded && version != s.alerts.version
+	s.alerts.alerts = Alerts
+	s.alerts.version = version
+	s.alerts.loaded = true
+	s.alerts.mu.Unlock()
+
+	if changed {
+		s.pushAlerts(ctx, Alerts)
+	}
+}
+
+// runAlertRefresh refreshes the active alerts every alert.refresh_interval until the server shuts down
+func (s *server) runAlertRefresh() {
+	if s.config.AlertRefreshInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.AlertRefreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.refreshAlerts(context.Background())
+	}
+}
+
+// alertAudience gets who the alerts are shown to for a user, users without a locale see the default locales alerts
+func alertAudience(Audience *database.AlertAudience) *database.AlertAudience {
+	if Audience != nil && Audience.Locale == "" {
+		Audience.Locale = viper.GetString("config.default_locale")
+	}
+
+	return Audience
+}
+
+// targetAlerts filters the alerts to the ones shown to the audience
+func targetAlerts(Alerts []*database.Alert, Audience *database.AlertAudience) []*database.Alert {
+	targeted := make([]*database.Alert, 0)
+	for _, a := range Alerts {
+		if a.Targets(Audience) {
+			targeted = append(targeted, a)
+		}
+	}
+
+	return targeted
+}
+
+// userAlerts gets the cached alerts shown to the user, or to a visitor without a session when UserID is empty
+func (s *server) userAlerts(ctx context.Context, UserID string) []*database.Alert {
+	var Audience *database.AlertAudience
+	if UserID != "" {
+		if Audiences, err := s.database.GetAlertAudiences(ctx, []string{UserID}); err == nil {
+			Audience = alertAudience(Audiences[UserID])
+		}
+	}
+
+	return targetAlerts(s.alerts.list(), Audience)
+}
+
+// pushAlerts sends each user with an open websocket session the alerts now shown to them
+func (s *server) pushAlerts(ctx context.Context, Alerts []*database.Alert) {
+	UserIDs := h.connectedUsers()
+	if len(UserIDs) == 0 {
+		return
+	}
+
+	Audiences, err := s.database.GetAlertAudiences(ctx, UserIDs)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting alert audiences", "error", err)
+		return
+	}
+
+	events := make(map[string][]byte)
+	for UserID, Audience := range Audiences {
+		targeted, _ := json.Marshal(targetAlerts(Alerts, alertAudience(Audience)))
+		events[UserID] = CreateSocketEvent("alerts_updated", string(targeted), "")
+	}
+
+	h.direct <- events
+}
+
+// sessionUserID gets the user of the requests session cookie, empty for visitors without one
+func (s *server) sessionUserID(r *http.Request) string {
+	cookie, err := r.Cookie(s.config.SecureCookieName)
+	if err != nil {
+		return ""
+	}
+
+	var UserID string
+	if err := s.cookie.Decode(s.config.SecureCookieName, cookie.Value, &UserID); err != nil {
+		return ""
+	}
+
+	return UserID
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	ldap "github.com/go-ldap/ldap/v3"
 	"github.com/spf13/viper"
 )
@@ -31,29 +33,53 @@ func (s *server) createCookie(userID string) *http.Cookie {
 	return NewCookie
 }
 
-func (s *server) authUserDatabase(userEmail string, userPassword string) (*database.User, error) {
-	authedUser, err := s.database.AuthUser(userEmail, userPassword)
+// impersonationCookieName is the name of the cookie carrying an admins "view as user" session
+func (s *server) impersonationCookieName() string {
+	return s.config.SecureCookieName + "_impersonation"
+}
+
+// createImpersonationCookie creates the cookie carrying an admins "view as user" session until it expires
+func (s *server) createImpersonationCookie(ImpersonationID string, ExpireDate time.Time) *http.Cookie {
+	encoded, err := s.cookie.Encode(s.impersonationCookieName(), ImpersonationID)
+	if err != nil {
+		return nil
+	}
+
+	return &http.Cookie{
+		Name:     s.impersonationCookieName(),
+		Value:    encoded,
+		Path:     s.config.PathPrefix + "/",
+		HttpOnly: true,
+		Domain:   s.config.AppDomain,
+		MaxAge:   int(time.Until(ExpireDate).Seconds()),
+		Secure:   s.config.SecureCookieFlag,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func (s *server) authUserDatabase(ctx context.Context, userEmail string, userPassword string) (*database.User, error) {
+	authedUser, err := s.database.AuthUser(ctx, userEmail, userPassword)
 	if err != nil {
-		log.Println("Failed authenticating user", userEmail)
+		logging.FromContext(ctx).Error("Failed authenticating user", "error", userEmail)
 	} else if authedUser == nil {
-		log.Println("Unknown user", userEmail)
+		logging.Error("Unknown user", "error", userEmail)
 	}
 	return authedUser, err
 }
 
 // Authenticate using LDAP and if user does not exist, automatically add warror as a verified user
-func (s *server) authAndCreateUserLdap(userUsername string, userPassword string) (*database.User, error) {
+func (s *server) authAndCreateUserLdap(ctx context.Context, userUsername string, userPassword string) (*database.User, error) {
 	var authedUser *database.User
 	l, err := ldap.DialURL(viper.GetString("auth.ldap.url"))
 	if err != nil {
-		log.Println("Failed connecting to ldap server at", viper.GetString("auth.ldap.url"))
+		logging.Error("Failed connecting to ldap server", "url", viper.GetString("auth.ldap.url"), "error", err)
 		return authedUser, err
 	}
 	defer l.Close()
 	if viper.GetBool("auth.ldap.use_tls") {
 		err = l.StartTLS(&tls.Config{InsecureSkipVerify: true})
 		if err != nil {
-			log.Println("Failed securing ldap connection", err)
+			logging.Error("Failed securing ldap connection", "error", err)
 			return authedUser, err
 		}
 	}
@@ -61,7 +87,7 @@ func (s *server) authAndCreateUserLdap(userUsername string, userPassword string)
 	if viper.GetString("auth.ldap.bindname") != "" {
 		err = l.Bind(viper.GetString("auth.ldap.bindname"), viper.GetString("auth.ldap.bindpass"))
 		if err != nil {
-			log.Println("Failed binding for authentication:", err)
+			logging.Error("Failed binding for authentication", "error", err)
 			return authedUser, err
 		}
 	}
@@ -75,12 +101,12 @@ func (s *server) authAndCreateUserLdap(userUsername string, userPassword string)
 
 	sr, err := l.Search(searchRequest)
 	if err != nil {
-		log.Println("Failed performing ldap search query for", userUsername, ":", err)
+		logging.Error("Failed performing ldap search query", "username", userUsername, "error", err)
 		return authedUser, err
 	}
 
 	if len(sr.Entries) != 1 {
-		log.Println("User", userUsername, "does not exist or too many entries returned")
+		logging.Warn("User does not exist or too many entries returned", "username", userUsername)
 		return authedUser, errors.New("user not found")
 	}
 
@@ -90,21 +116,21 @@ func (s *server) authAndCreateUserLdap(userUsername string, userPassword string)
 
 	err = l.Bind(userdn, userPassword)
 	if err != nil {
-		log.Println("Failed authenticating user ", userUsername)
+		logging.Error("Failed authenticating user", "error", userUsername)
 		return authedUser, err
 	}
 
-	authedUser, err = s.database.GetUserByEmail(useremail)
+	authedUser, err = s.database.GetUserByEmail(ctx, useremail)
 	if authedUser == nil {
-		log.Println("User", useremail, "does not exist in database, auto-recruit")
-		newUser, verifyID, err := s.database.CreateUserRegistered(usercn, useremail, "", "")
+		logging.Info("User does not exist in database, auto-recruit", "email", useremail)
+		newUser, verifyID, err := s.database.CreateUserRegistered(ctx, usercn, useremail, "", "")
 		if err != nil {
-			log.Println("Failed auto-creating new user", err)
+			logging.Error("Failed auto-creating new user", "error", err)
 			return authedUser, err
 		}
-		err = s.database.VerifyUserAccount(verifyID)
+		err = s.database.VerifyUserAccount(ctx, verifyID)
 		if err != nil {
-			log.Println("Failed verifying new user", err)
+			logging.Error("Failed verifying new user", "error", err)
 			return authedUser, err
 		}
 		authedUser = newUser
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -37,6 +41,18 @@ type connection struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// The user the connection belongs to.
+	userID string
+
+	// The admin impersonation the connection was opened by, empty for the users own connections.
+	impersonationID string
+
+	// Close frame payload written when send is closed, set before closing send.
+	closeMessage []byte
+
+	// Closed once the writePump has stopped writing to the connection.
+	done chan struct{}
 }
 
 // SocketEvent is the event structure used for socket messages
@@ -44,6 +60,8 @@ type SocketEvent struct {
 	EventType  string `json:"type"`
 	EventValue string `json:"value"`
 	EventUser  string `json:"userId"`
+	EventSeq   uint64 `json:"seq,omitempty"`
+	EventKey   string `json:"key,omitempty"`
 }
 
 // CreateSocketEvent makes a SocketEvent struct and turns it into json []byte
@@ -67,23 +85,26 @@ func (s subscription) readPump(srv *server) {
 		RetrospectiveID := s.arena
 		UserID := s.userID
 
-		Users := srv.database.RetreatUser(RetrospectiveID, UserID)
-		updatedUsers, _ := json.Marshal(Users)
+		if !s.readOnly {
+			Users := srv.database.RetreatUser(s.ctx, RetrospectiveID, UserID)
+			updatedUsers, _ := json.Marshal(Users)
 
-		retreatEvent := CreateSocketEvent("user_retreated", string(updatedUsers), UserID)
-		m := message{retreatEvent, RetrospectiveID}
-		h.broadcast <- m
+			retreatEvent := CreateSocketEvent("user_retreated", string(updatedUsers), UserID)
+			m := message{retreatEvent, RetrospectiveID}
+			h.broadcast <- m
+		}
 
 		h.unregister <- s
 		if forceClosed {
 			cm := websocket.FormatCloseMessage(4002, "abandoned")
 			if err := c.ws.WriteControl(websocket.CloseMessage, cm, time.Now().Add(writeWait)); err != nil {
-				log.Printf("abandon error: %v", err)
+				s.logger.Error("abandon error", "error", err)
 			}
 		}
 		if err := c.ws.Close(); err != nil {
-			log.Printf("close error: %v", err)
+			s.logger.Error("close error", "error", err)
 		}
+		s.logger.Info("websocket session ended")
 	}()
 	c.ws.SetReadLimit(maxMessageSize)
 	c.ws.SetReadDeadline(time.Now().Add(pongWait))
@@ -92,11 +113,16 @@ func (s subscription) readPump(srv *server) {
 		_, msg, err := c.ws.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
-				log.Printf("error: %v", err)
+				s.logger.Warn("websocket closed unexpectedly", "error", err)
 			}
 			break
 		}
 
+		if s.readOnly {
+			s.logger.Warn("websocket event rejected for read only session")
+			continue
+		}
+
 		var badEvent bool
 		var targetedEvent bool
 		keyVal := make(map[string]string)
@@ -104,6 +130,18 @@ func (s subscription) readPump(srv *server) {
 		userID := s.userID
 		retrospectiveID := s.arena
 
+		// events carrying an idempotency key are only applied once, retries get a targeted duplicate notice
+		eventKey := keyVal["key"]
+		if eventKey != "" {
+			eventKey = retrospectiveID + ":" + userID + ":" + eventKey
+			if !idempotencyKeys.claim(eventKey) {
+				h.targeted <- targetedMessage{c, s.arena, CreateSocketEvent("event_duplicate", keyVal["key"], userID)}
+				continue
+			}
+		}
+
+		s.logger.Debug("websocket event", "type", keyVal["type"])
+
 		switch keyVal["type"] {
 		case "create_item_worked":
 			var rs struct {
@@ -112,7 +150,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, err := srv.database.CreateRetrospectiveItemWorked(retrospectiveID, userID, rs.Content)
+			items, err := srv.database.CreateRetrospectiveItemWorked(s.ctx, retrospectiveID, userID, rs.Content)
 			if err != nil {
 				badEvent = true
 				break
@@ -131,7 +169,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, err := srv.database.CreateRetrospectiveItemImprove(retrospectiveID, userID, rs.Content)
+			items, err := srv.database.CreateRetrospectiveItemImprove(s.ctx, retrospectiveID, userID, rs.Content)
 			if err != nil {
 				badEvent = true
 				break
@@ -150,7 +188,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, err := srv.database.CreateRetrospectiveItemQuestion(retrospectiveID, userID, rs.Content)
+			items, err := srv.database.CreateRetrospectiveItemQuestion(s.ctx, retrospectiveID, userID, rs.Content)
 			if err != nil {
 				badEvent = true
 				break
@@ -169,7 +207,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, _, _, err := srv.database.NestRetrospectiveItem(retrospectiveID, userID, rs.ItemID, rs.ParentID)
+			items, _, _, err := srv.database.NestRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID, rs.ParentID)
 			if err != nil {
 				badEvent = true
 				break
@@ -183,7 +221,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, _, _, err := srv.database.UnNestRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			items, _, _, err := srv.database.UnNestRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -197,7 +235,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, _, _, err := srv.database.VoteRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			items, _, _, err := srv.database.VoteRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -212,7 +250,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, items, _, err := srv.database.NestRetrospectiveItem(retrospectiveID, userID, rs.ItemID, rs.ParentID)
+			_, items, _, err := srv.database.NestRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID, rs.ParentID)
 			if err != nil {
 				badEvent = true
 				break
@@ -226,7 +264,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, items, _, err := srv.database.UnNestRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			_, items, _, err := srv.database.UnNestRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -240,7 +278,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, items, _, err := srv.database.VoteRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			_, items, _, err := srv.database.VoteRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -255,7 +293,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, _, items, err := srv.database.NestRetrospectiveItem(retrospectiveID, userID, rs.ItemID, rs.ParentID)
+			_, _, items, err := srv.database.NestRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID, rs.ParentID)
 			if err != nil {
 				badEvent = true
 				break
@@ -269,7 +307,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, _, items, err := srv.database.UnNestRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			_, _, items, err := srv.database.UnNestRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -283,7 +321,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, _, items, err := srv.database.VoteRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			_, _, items, err := srv.database.VoteRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -298,7 +336,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			items, _, _, err := srv.database.DeleteRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			items, _, _, err := srv.database.DeleteRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -317,7 +355,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, items, _, err := srv.database.DeleteRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			_, items, _, err := srv.database.DeleteRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -336,7 +374,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			_, _, items, err := srv.database.DeleteRetrospectiveItem(retrospectiveID, userID, rs.ItemID)
+			_, _, items, err := srv.database.DeleteRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID)
 			if err != nil {
 				badEvent = true
 				break
@@ -348,13 +386,73 @@ func (s subscription) readPump(srv *server) {
 
 			updatedItems, _ := json.Marshal(items)
 			msg = CreateSocketEvent("item_question_updated", string(updatedItems), "")
+		case "update_item":
+			var rs struct {
+				ItemID  string `json:"id"`
+				Content string `json:"content"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			itemType, items, err := srv.database.UpdateRetrospectiveItem(s.ctx, retrospectiveID, userID, rs.ItemID, rs.Content)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedItems, _ := json.Marshal(items)
+			msg = CreateSocketEvent("item_"+itemType+"_updated", string(updatedItems), "")
+		case "create_item_comment":
+			var rs struct {
+				ItemID   string `json:"itemId"`
+				ParentID string `json:"parentId"`
+				Content  string `json:"content"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			itemType, items, err := srv.database.CreateRetrospectiveItemComment(s.ctx, retrospectiveID, userID, rs.ItemID, rs.ParentID, rs.Content)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedItems, _ := json.Marshal(items)
+			msg = CreateSocketEvent("item_"+itemType+"_updated", string(updatedItems), "")
+		case "delete_item_comment":
+			var rs struct {
+				CommentID string `json:"id"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			itemType, items, err := srv.database.DeleteRetrospectiveItemComment(s.ctx, retrospectiveID, userID, rs.CommentID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedItems, _ := json.Marshal(items)
+			msg = CreateSocketEvent("item_"+itemType+"_updated", string(updatedItems), "")
+		case "react_item":
+			var rs struct {
+				ItemID string `json:"itemId"`
+				Emoji  string `json:"emoji"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			itemType, items, err := srv.database.ToggleRetrospectiveItemReaction(s.ctx, retrospectiveID, userID, rs.ItemID, rs.Emoji)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedItems, _ := json.Marshal(items)
+			msg = CreateSocketEvent("item_"+itemType+"_updated", string(updatedItems), "")
 		case "create_action":
 			var rs struct {
 				Content string `json:"content"`
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			actions, err := srv.database.CreateRetrospectiveAction(retrospectiveID, userID, rs.Content)
+			actions, err := srv.database.CreateRetrospectiveAction(s.ctx, retrospectiveID, userID, rs.Content)
 			if err != nil {
 				badEvent = true
 				break
@@ -364,13 +462,13 @@ func (s subscription) readPump(srv *server) {
 			msg = CreateSocketEvent("action_updated", string(updatedActions), "")
 		case "update_action":
 			var rs struct {
-				ActionID  string `json:"id"`
-				Completed bool   `json:"completed"`
+				ActionID string `json:"id"`
+				database.RetrospectiveActionUpdate
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			actions, err := srv.database.UpdatedRetrospectiveAction(retrospectiveID, userID, rs.ActionID, rs.Completed)
-			if err != nil {
+			actions, err := srv.database.UpdateRetrospectiveAction(s.ctx, retrospectiveID, userID, rs.ActionID, &rs.RetrospectiveActionUpdate)
+			if err != nil || actions == nil {
 				badEvent = true
 				break
 			}
@@ -383,7 +481,7 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			actions, err := srv.database.DeleteRetrospectiveAction(retrospectiveID, userID, rs.ActionID)
+			actions, err := srv.database.DeleteRetrospectiveAction(s.ctx, retrospectiveID, userID, rs.ActionID)
 			if err != nil {
 				badEvent = true
 				break
@@ -397,16 +495,159 @@ func (s subscription) readPump(srv *server) {
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &rs)
 
-			retro, err := srv.database.RetrospectiveAdvancePhase(retrospectiveID, userID, rs.Phase)
+			retro, err := srv.database.RetrospectiveAdvancePhase(s.ctx, retrospectiveID, userID, rs.Phase)
 			if err != nil {
 				badEvent = true
 				break
 			}
 
+			go srv.notifyRetrospectivePhase(logging.WithRequestID(context.Background(), logging.RequestID(s.ctx)), retrospectiveID, rs.Phase)
+
 			updatedRetrospective, _ := json.Marshal(retro)
 			msg = CreateSocketEvent("retrospective_updated", string(updatedRetrospective), "")
 		case "promote_owner":
-			retrospective, err := srv.database.SetRetrospectiveOwner(retrospectiveID, userID, keyVal["value"])
+			retrospective, err := srv.database.SetRetrospectiveOwner(s.ctx, retrospectiveID, userID, keyVal["value"])
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedRetrospective, _ := json.Marshal(retrospective)
+			msg = CreateSocketEvent("retrospective_updated", string(updatedRetrospective), "")
+		case "set_user_role":
+			var rs struct {
+				UserID string `json:"id"`
+				Role   string `json:"role"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			users, err := srv.database.SetRetrospectiveUserRole(s.ctx, retrospectiveID, userID, rs.UserID, rs.Role)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedUsers, _ := json.Marshal(users)
+			msg = CreateSocketEvent("user_role_updated", string(updatedUsers), rs.UserID)
+		case "create_group":
+			var rs struct {
+				Title   string   `json:"title"`
+				ItemIDs []string `json:"itemIds"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			board, err := srv.database.CreateRetrospectiveGroup(s.ctx, retrospectiveID, userID, rs.Title, rs.ItemIDs)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedBoard, _ := json.Marshal(board)
+			msg = CreateSocketEvent("items_updated", string(updatedBoard), "")
+		case "update_group":
+			var rs struct {
+				GroupID string `json:"id"`
+				Title   string `json:"title"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			board, err := srv.database.UpdateRetrospectiveGroupTitle(s.ctx, retrospectiveID, userID, rs.GroupID, rs.Title)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedBoard, _ := json.Marshal(board)
+			msg = CreateSocketEvent("items_updated", string(updatedBoard), "")
+		case "move_items":
+			var rs struct {
+				GroupID string   `json:"groupId"`
+				ItemIDs []string `json:"itemIds"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			board, err := srv.database.MoveRetrospectiveItems(s.ctx, retrospectiveID, userID, rs.GroupID, rs.ItemIDs)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedBoard, _ := json.Marshal(board)
+			msg = CreateSocketEvent("items_updated", string(updatedBoard), "")
+		case "merge_groups":
+			var rs struct {
+				GroupID        string   `json:"id"`
+				SourceGroupIDs []string `json:"sourceIds"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			board, err := srv.database.MergeRetrospectiveGroups(s.ctx, retrospectiveID, userID, rs.GroupID, rs.SourceGroupIDs)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedBoard, _ := json.Marshal(board)
+			msg = CreateSocketEvent("items_updated", string(updatedBoard), "")
+		case "delete_group":
+			var rs struct {
+				GroupID string `json:"id"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			board, err := srv.database.DeleteRetrospectiveGroup(s.ctx, retrospectiveID, userID, rs.GroupID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedBoard, _ := json.Marshal(board)
+			msg = CreateSocketEvent("items_updated", string(updatedBoard), "")
+		case "set_focus":
+			var rs struct {
+				ItemID string `json:"id"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			discussion, err := srv.database.SetRetrospectiveFocus(s.ctx, retrospectiveID, userID, rs.ItemID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedDiscussion, _ := json.Marshal(discussion)
+			msg = CreateSocketEvent("focus_changed", string(updatedDiscussion), "")
+		case "advance_focus":
+			discussion, err := srv.database.AdvanceRetrospectiveFocus(s.ctx, retrospectiveID, userID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedDiscussion, _ := json.Marshal(discussion)
+			msg = CreateSocketEvent("focus_changed", string(updatedDiscussion), "")
+		case "mark_discussed":
+			var rs struct {
+				ItemID    string `json:"id"`
+				Discussed bool   `json:"discussed"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			discussion, err := srv.database.SetRetrospectiveItemDiscussed(s.ctx, retrospectiveID, userID, rs.ItemID, rs.Discussed)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			updatedDiscussion, _ := json.Marshal(discussion)
+			msg = CreateSocketEvent("focus_changed", string(updatedDiscussion), "")
+		case "set_anonymous":
+			var rs struct {
+				Anonymous bool `json:"anonymous"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &rs)
+
+			retrospective, err := srv.database.SetRetrospectiveAnonymous(s.ctx, retrospectiveID, userID, rs.Anonymous)
 			if err != nil {
 				badEvent = true
 				break
@@ -415,14 +656,14 @@ func (s subscription) readPump(srv *server) {
 			updatedRetrospective, _ := json.Marshal(retrospective)
 			msg = CreateSocketEvent("retrospective_updated", string(updatedRetrospective), "")
 		case "concede_retrospective":
-			err := srv.database.DeleteRetrospective(retrospectiveID, userID)
+			err := srv.database.DeleteRetrospective(s.ctx, retrospectiveID, userID)
 			if err != nil {
 				badEvent = true
 				break
 			}
 			msg = CreateSocketEvent("retrospective_conceded", "", "")
 		case "abandon_retrospective":
-			_, err := srv.database.AbandonRetrospective(retrospectiveID, userID)
+			_, err := srv.database.AbandonRetrospective(s.ctx, retrospectiveID, userID)
 			if err != nil {
 				badEvent = true
 				break
@@ -432,13 +673,25 @@ func (s subscription) readPump(srv *server) {
 		default:
 		}
 
+		if badEvent {
+			s.logger.Warn("websocket event rejected", "type", keyVal["type"])
+		}
+
+		if eventKey != "" {
+			if badEvent {
+				idempotencyKeys.release(eventKey)
+			} else {
+				msg = stampSocketEvent(msg, 0, keyVal["key"])
+			}
+		}
+
 		if !badEvent && !targetedEvent {
 			m := message{msg, s.arena}
 			h.broadcast <- m
 		}
 
 		if targetedEvent {
-			c.write(websocket.TextMessage, msg)
+			h.targeted <- targetedMessage{c, s.arena, msg}
 		}
 
 		if forceClosed {
@@ -453,6 +706,16 @@ func (c *connection) write(mt int, payload []byte) error {
 	return c.ws.WriteMessage(mt, payload)
 }
 
+// waitClosed waits for the writePump to stop writing to the connection, false when ctx is done first.
+func (c *connection) waitClosed(ctx context.Context) bool {
+	select {
+	case <-c.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 func (s *subscription) writePump() {
 	c := s.conn
@@ -460,12 +723,17 @@ func (s *subscription) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.ws.Close()
+		close(c.done)
 	}()
 	for {
 		select {
 		case message, ok := <-c.send:
 			if !ok {
-				c.write(websocket.CloseMessage, []byte{})
+				closeMessage := c.closeMessage
+				if closeMessage == nil {
+					closeMessage = []byte{}
+				}
+				c.write(websocket.CloseMessage, closeMessage)
 				return
 			}
 			if err := c.write(websocket.TextMessage, message); err != nil {
@@ -488,7 +756,18 @@ func (s *server) serveWs() http.HandlerFunc {
 		// upgrade to WebSocket connection
 		ws, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("websocket upgrade failed", "error", err)
+			return
+		}
+
+		// new connections are turned away while shutting down so clients reconnect to another instance
+		if atomic.LoadInt32(&s.shuttingDown) == 1 {
+			if err := ws.WriteMessage(websocket.CloseMessage, closeServerRestarting); err != nil {
+				logging.FromContext(r.Context()).Error("restarting close error", "error", err)
+			}
+			if err := ws.Close(); err != nil {
+				logging.FromContext(r.Context()).Error("close error", "error", err)
+			}
 			return
 		}
 
@@ -497,38 +776,51 @@ func (s *server) serveWs() http.HandlerFunc {
 		if cookieErr != nil {
 			cm := websocket.FormatCloseMessage(4001, "unauthorized")
 			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
-				log.Printf("unauthorized close error: %v", err)
+				logging.FromContext(r.Context()).Error("unauthorized close error", "error", err)
 			}
 			if err := ws.Close(); err != nil {
-				log.Printf("close error: %v", err)
+				logging.FromContext(r.Context()).Error("close error", "error", err)
 			}
 			return
 		}
 
-		// make sure retrospective is legit
-		b, retrospectiveErr := s.database.GetRetrospective(retrospectiveID)
-		if retrospectiveErr != nil {
+		// an admin viewing as a user gets a read only session as them, suspended users are turned away
+		var Impersonation *database.UserImpersonation
+		if Impersonation = s.impersonatedUser(w, r, userID); Impersonation != nil {
+			userID = Impersonation.UserID
+		} else if err := s.database.ConfirmUserActive(r.Context(), userID); err == database.ErrUserSuspended {
+			if err := ws.WriteMessage(websocket.CloseMessage, closeUserSuspended); err != nil {
+				logging.FromContext(r.Context()).Error("suspended close error", "error", err)
+			}
+			if err := ws.Close(); err != nil {
+				logging.FromContext(r.Context()).Error("close error", "error", err)
+			}
+			return
+		}
+
+		// make sure retrospective is legit, force closed retrospectives can't be joined until an admin reopens them
+		if openErr := s.database.ConfirmRetrospectiveOpen(r.Context(), retrospectiveID); openErr != nil {
 			cm := websocket.FormatCloseMessage(4004, "retrospective not found")
+			if openErr == database.ErrRetrospectiveClosed {
+				cm = closeRetrospectiveClosed
+			}
 			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
-				log.Printf("not found close error: %v", err)
+				logging.FromContext(r.Context()).Error("not found close error", "error", err)
 			}
 			if err := ws.Close(); err != nil {
-				log.Printf("close error: %v", err)
+				logging.FromContext(r.Context()).Error("close error", "error", err)
 			}
 			return
 		}
-		// if b.Phase == 1 {
-		// 	b.WorkedItems = s.database.FilterItemsByUser(userID, b.WorkedItems)
-		// 	b.ImproveItems = s.database.FilterItemsByUser(userID, b.ImproveItems)
-		// 	b.QuestionItems = s.database.FilterItemsByUser(userID, b.QuestionItems)
-		// }
-		retrospective, _ := json.Marshal(b)
 
-		// make sure user exists
-		_, userErr := s.database.GetRetrospectiveUser(retrospectiveID, userID)
+		// make sure user exists, an admin viewing as the user doesn't count as their session
+		var userErr error
+		if Impersonation == nil {
+			_, userErr = s.database.GetRetrospectiveUser(r.Context(), retrospectiveID, userID)
+		}
 
 		if userErr != nil {
-			log.Println("error finding user : " + userErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user", "error", userErr)
 			cm := websocket.FormatCloseMessage(4003, "duplicate session")
 
 			if fmt.Sprint(userErr) == "User Not found" {
@@ -537,27 +829,83 @@ func (s *server) serveWs() http.HandlerFunc {
 			}
 
 			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
-				log.Printf("unauthorized close error: %v", err)
+				logging.FromContext(r.Context()).Error("unauthorized close error", "error", err)
 			}
 			if err := ws.Close(); err != nil {
-				log.Printf("close error: %v", err)
+				logging.FromContext(r.Context()).Error("close error", "error", err)
 			}
 			return
 		}
 
-		c := &connection{send: make(chan []byte, 256), ws: ws}
-		ss := subscription{c, retrospectiveID, userID}
+		// a reconnecting client sends the last sequence number it saw to receive only the events it missed
+		lastSeq, seqErr := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+
+		c := &connection{send: make(chan []byte, 256), ws: ws, userID: userID, done: make(chan struct{})}
+		ss := subscription{
+			conn:       c,
+			arena:      retrospectiveID,
+			userID:     userID,
+			readOnly:   Impersonation != nil,
+			resume:     seqErr == nil,
+			lastSeq:    lastSeq,
+			registered: make(chan registration, 1),
+			logger:     logging.FromContext(r.Context()).With("retrospective_id", retrospectiveID, "user_id", userID),
+			ctx:        logging.WithRequestID(context.Background(), logging.RequestID(r.Context())),
+		}
+		if Impersonation != nil {
+			c.impersonationID = Impersonation.ImpersonationID
+			ss.logger = ss.logger.With("impersonation_id", Impersonation.ImpersonationID, "admin_id", Impersonation.AdminID)
+		}
 		h.register <- ss
+		reg := <-ss.registered
+		ss.logger.Info("websocket session started", "resumed", reg.replayed)
+
+		if Impersonation != nil {
+			ImpersonationID := Impersonation.ImpersonationID
+			time.AfterFunc(time.Until(Impersonation.ExpireDate), func() {
+				h.disconnect <- disconnection{impersonationID: ImpersonationID, closeMessage: closeImpersonationEnded}
+			})
+		}
 
-		Users, _ := s.database.AddUserToRetrospective(ss.arena, userID)
-		updatedUsers, _ := json.Marshal(Users)
+		if reg.replayed {
+			resumedEvent := CreateSocketEvent("resumed", strconv.FormatUint(lastSeq, 10), userID)
+			_ = c.write(websocket.TextMessage, resumedEvent)
+		} else {
+			// the snapshot is taken after registering, events broadcast since reg.seq are queued to the connection
+			// and sent after it instead of being lost
+			b, retrospectiveErr := s.database.GetRetrospective(r.Context(), retrospectiveID)
+			if retrospectiveErr != nil {
+				h.unregister <- ss
+				cm := websocket.FormatCloseMessage(4004, "retrospective not found")
+				if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
+					logging.FromContext(r.Context()).Error("not found close error", "error", err)
+				}
+				if err := ws.Close(); err != nil {
+					logging.FromContext(r.Context()).Error("close error", "error", err)
+				}
+				// there is no writePump for the connection
+				close(c.done)
+				return
+			}
+			// if b.Phase == 1 {
+			// 	b.WorkedItems = s.database.FilterItemsByUser(userID, b.WorkedItems)
+			// 	b.ImproveItems = s.database.FilterItemsByUser(userID, b.ImproveItems)
+			// 	b.QuestionItems = s.database.FilterItemsByUser(userID, b.QuestionItems)
+			// }
+			retrospective, _ := json.Marshal(b)
+
+			initEvent := stampSocketEvent(CreateSocketEvent("init", string(retrospective), userID), reg.seq, "")
+			_ = c.write(websocket.TextMessage, initEvent)
+		}
 
-		initEvent := CreateSocketEvent("init", string(retrospective), userID)
-		_ = c.write(websocket.TextMessage, initEvent)
+		if Impersonation == nil {
+			Users, _ := s.database.AddUserToRetrospective(r.Context(), ss.arena, userID)
+			updatedUsers, _ := json.Marshal(Users)
 
-		joinedEvent := CreateSocketEvent("user_joined", string(updatedUsers), userID)
-		m := message{joinedEvent, ss.arena}
-		h.broadcast <- m
+			joinedEvent := CreateSocketEvent("user_joined", string(updatedUsers), userID)
+			m := message{joinedEvent, ss.arena}
+			h.broadcast <- m
+		}
 
 		go ss.writePump()
 		go ss.readPump(s)
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"log"
-
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/spf13/viper"
 )
 
@@ -22,21 +21,44 @@ func InitConfig() {
 	viper.SetDefault("http.frontend_cookie_name", "user")
 	viper.SetDefault("http.domain", "wakita.dev")
 	viper.SetDefault("http.path_prefix", "")
+	viper.SetDefault("http.shutdown_timeout", 30)
+
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", "text")
 
 	viper.SetDefault("analytics.enabled", true)
 	viper.SetDefault("analytics.id", "G-43J3W0QC6P")
 
+	viper.SetDefault("db.driver", "postgres")
 	viper.SetDefault("db.host", "db")
 	viper.SetDefault("db.port", 5432)
 	viper.SetDefault("db.user", "thor")
 	viper.SetDefault("db.pass", "odinson")
 	viper.SetDefault("db.name", "wakita")
 	viper.SetDefault("db.sslmode", "disable")
+	viper.SetDefault("db.query_timeout", 10)
+	viper.SetDefault("db.url", "")
+	viper.SetDefault("db.replica_url", "")
+	viper.SetDefault("db.max_open_conns", 25)
+	viper.SetDefault("db.max_idle_conns", 25)
+	viper.SetDefault("db.conn_max_lifetime", 300)
+	viper.SetDefault("db.connect_retries", 5)
 
 	viper.SetDefault("smtp.host", "localhost")
 	viper.SetDefault("smtp.port", "25")
 	viper.SetDefault("smtp.secure", true)
 	viper.SetDefault("smtp.sender", "no-reply@wakita.dev")
+	viper.SetDefault("email.transport", "smtp")
+	viper.SetDefault("email.file_dir", "mail")
+	viper.SetDefault("email.max_attempts", 5)
+	viper.SetDefault("email.outbox_interval", 10)
+
+	viper.SetDefault("chat.timeout", 10)
+	viper.SetDefault("tracker.timeout", 10)
+	viper.SetDefault("tracker.sync_interval", 300)
+	viper.SetDefault("alert.refresh_interval", 30)
+	viper.SetDefault("admin.impersonation_timeout", 30)
+	viper.SetDefault("admin.close_check_interval", 10)
 
 	viper.SetDefault("config.avatar_service", "goadorable")
 	viper.SetDefault("config.toast_timeout", 1000)
@@ -65,17 +87,31 @@ func InitConfig() {
 	viper.BindEnv("http.frontend_cookie_name", "FRONTEND_COOKIE_NAME")
 	viper.BindEnv("http.domain", "APP_DOMAIN")
 	viper.BindEnv("http.path_prefix", "PATH_PREFIX")
+	viper.BindEnv("http.shutdown_timeout", "HTTP_SHUTDOWN_TIMEOUT")
+
+	viper.BindEnv("log.level", "LOG_LEVEL")
+	viper.BindEnv("log.format", "LOG_FORMAT")
 
 	viper.BindEnv("analytics.enabled", "ANALYTICS_ENABLED")
 	viper.BindEnv("analytics.id", "ANALYTICS_ID")
 	viper.BindEnv("admin.email", "ADMIN_EMAIL")
+	viper.BindEnv("admin.impersonation_timeout", "ADMIN_IMPERSONATION_TIMEOUT")
+	viper.BindEnv("admin.close_check_interval", "ADMIN_CLOSE_CHECK_INTERVAL")
 
+	viper.BindEnv("db.driver", "DB_DRIVER")
 	viper.BindEnv("db.host", "DB_HOST")
 	viper.BindEnv("db.port", "DB_PORT")
 	viper.BindEnv("db.user", "DB_USER")
 	viper.BindEnv("db.pass", "DB_PASS")
 	viper.BindEnv("db.name", "DB_NAME")
 	viper.BindEnv("db.sslmode", "DB_SSLMODE")
+	viper.BindEnv("db.query_timeout", "DB_QUERY_TIMEOUT")
+	viper.BindEnv("db.url", "DB_URL")
+	viper.BindEnv("db.replica_url", "DB_REPLICA_URL")
+	viper.BindEnv("db.max_open_conns", "DB_MAX_OPEN_CONNS")
+	viper.BindEnv("db.max_idle_conns", "DB_MAX_IDLE_CONNS")
+	viper.BindEnv("db.conn_max_lifetime", "DB_CONN_MAX_LIFETIME")
+	viper.BindEnv("db.connect_retries", "DB_CONNECT_RETRIES")
 
 	viper.BindEnv("smtp.host", "SMTP_HOST")
 	viper.BindEnv("smtp.port", "SMTP_PORT")
@@ -84,6 +120,14 @@ func InitConfig() {
 	viper.BindEnv("smtp.user", "SMTP_USER")
 	viper.BindEnv("smtp.pass", "SMTP_PASS")
 	viper.BindEnv("smtp.sender", "SMTP_SENDER")
+	viper.BindEnv("email.transport", "EMAIL_TRANSPORT")
+	viper.BindEnv("email.file_dir", "EMAIL_FILE_DIR")
+	viper.BindEnv("email.max_attempts", "EMAIL_MAX_ATTEMPTS")
+	viper.BindEnv("email.outbox_interval", "EMAIL_OUTBOX_INTERVAL")
+	viper.BindEnv("chat.timeout", "CHAT_TIMEOUT")
+	viper.BindEnv("tracker.timeout", "TRACKER_TIMEOUT")
+	viper.BindEnv("tracker.sync_interval", "TRACKER_SYNC_INTERVAL")
+	viper.BindEnv("alert.refresh_interval", "ALERT_REFRESH_INTERVAL")
 
 	viper.BindEnv("config.avatar_service", "CONFIG_AVATAR_SERVICE")
 	viper.BindEnv("config.toast_timeout", "CONFIG_TOAST_TIMEOUT")
@@ -108,7 +152,7 @@ func InitConfig() {
 	err := viper.ReadInConfig()
 	if err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			log.Fatal(err)
+			logging.Fatal("InitConfig failed", "error", err)
 		}
 	}
 }
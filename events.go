@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of broadcast events kept per retrospective for replaying to reconnecting clients.
+	eventHistorySize = 200
+
+	// Time a retrospectives event history is kept after its last event.
+	eventHistoryTTL = 10 * time.Minute
+
+	// Time an idempotency key is remembered, retries within this window are not applied twice.
+	idempotencyTTL = 5 * time.Minute
+)
+
+// eventHistory is the sequence numbered broadcast events of a retrospective, kept in the memory of the replica
+// its websockets are connected to, a client reconnecting to another replica (or after a restart) gets a full init
+type eventHistory struct {
+	seq     uint64
+	events  [][]byte
+	updated time.Time
+}
+
+// newEventHistory starts the sequence from the current time in milliseconds (scaled up),
+// so sequence numbers seen before a restart or an expired history are never reused
+// while staying within the integer precision of javascript clients
+func newEventHistory() *eventHistory {
+	return &eventHistory{
+		seq:     uint64(time.Now().UnixNano()/int64(time.Millisecond)) * 1000,
+		events:  make([][]byte, 0),
+		updated: time.Now(),
+	}
+}
+
+// add stamps the event with the next sequence number and keeps it for replay
+func (eh *eventHistory) add(event []byte) []byte {
+	eh.seq = eh.seq + 1
+	stamped := stampSocketEvent(event, eh.seq, "")
+
+	eh.events = append(eh.events, stamped)
+	if len(eh.events) > eventHistorySize {
+		eh.events = eh.events[len(eh.events)-eventHistorySize:]
+	}
+	eh.updated = time.Now()
+
+	return stamped
+}
+
+// since gets the events after lastSeq, ok is false when some of those events are no longer kept
+func (eh *eventHistory) since(lastSeq uint64) (events [][]byte, ok bool) {
+	if lastSeq > eh.seq {
+		return nil, false
+	}
+
+	missed := int(eh.seq - lastSeq)
+	if missed > len(eh.events) {
+		return nil, false
+	}
+
+	return eh.events[len(eh.events)-missed:], true
+}
+
+// stampSocketEvent sets the sequence number and/or idempotency key on an encoded SocketEvent
+func stampSocketEvent(event []byte, seq uint64, key string) []byte {
+	var se SocketEvent
+	if err := json.Unmarshal(event, &se); err != nil {
+		return event
+	}
+
+	if seq != 0 {
+		se.EventSeq = seq
+	}
+	if key != "" {
+		se.EventKey = key
+	}
+
+	stamped, _ := json.Marshal(se)
+
+	return stamped
+}
+
+// idempotencyCache remembers the client generated keys of recently applied events, in memory so only retries
+// sent to the same replica are deduplicated
+type idempotencyCache struct {
+	mu     sync.Mutex
+	keys   map[string]time.Time
+	pruned time.Time
+}
+
+var idempotencyKeys = &idempotencyCache{
+	keys: make(map[string]time.Time),
+}
+
+// claim reserves the key, returning false if it was already claimed within the window
+func (ic *idempotencyCache) claim(key string) bool {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(ic.pruned) > time.Minute {
+		for k, claimed := range ic.keys {
+			if now.Sub(claimed) > idempotencyTTL {
+				delete(ic.keys, k)
+			}
+		}
+		ic.pruned = now
+	}
+
+	if claimed, ok := ic.keys[key]; ok && now.Sub(claimed) <= idempotencyTTL {
+		return false
+	}
+	ic.keys[key] = now
+
+	return true
+}
+
+// release forgets a claimed key so an event that failed can be retried
+func (ic *idempotencyCache) release(key string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	delete(ic.keys, key)
+}
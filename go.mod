@@ -14,6 +14,7 @@ require (
 	github.com/leodido/go-urn v1.2.0 // indirect
 	github.com/lib/pq v1.8.0
 	github.com/matcornic/hermes/v2 v2.1.0
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/o1egl/govatar v0.3.0
 	github.com/spf13/viper v1.7.1
 	golang.org/x/crypto v0.0.0-20200604202706-70a84ac30bf9
@@ -1,21 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"html/template"
 	"io/fs"
 	"io/ioutil"
-	"log"
 	"net/http"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 	"gopkg.in/go-playground/validator.v9"
 )
 
-var ActiveAlerts []interface{}
-
 type contextKey string
 
 var (
@@ -33,6 +33,11 @@ type userAccount struct {
 	Password2 string `json:"password2" validate:"required,min=6,max=72,eqfield=Password1"`
 }
 
+type userProfile struct {
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"omitempty,email"`
+}
+
 type userPassword struct {
 	Password1 string `json:"password1" validate:"required,min=6,max=72"`
 	Password2 string `json:"password2" validate:"required,min=6,max=72,eqfield=Password1"`
@@ -52,6 +57,18 @@ func ValidateUserAccount(name string, email string, pwd1 string, pwd2 string) (U
 	return name, email, pwd1, err
 }
 
+// ValidateUserProfile makes sure user name and (optional) email are valid before an admin updates them
+func ValidateUserProfile(name string, email string) (UserName string, UserEmail string, validateErr error) {
+	v := validator.New()
+	a := userProfile{
+		Name:  name,
+		Email: email,
+	}
+	err := v.Struct(a)
+
+	return name, email, err
+}
+
 // ValidateUserPassword makes sure user password is valid before updating the password
 func ValidateUserPassword(pwd1 string, pwd2 string) (UserPassword string, validateErr error) {
 	v := validator.New()
@@ -136,6 +153,21 @@ func (s *server) clearUserCookies(w http.ResponseWriter) {
 
 	http.SetCookie(w, feCookie)
 	http.SetCookie(w, beCookie)
+	s.clearImpersonationCookie(w)
+}
+
+// clearImpersonationCookie clears the cookie of an admins "view as user" session
+func (s *server) clearImpersonationCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.impersonationCookieName(),
+		Value:    "",
+		Path:     s.config.PathPrefix + "/",
+		Domain:   s.config.AppDomain,
+		Secure:   s.config.SecureCookieFlag,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
 }
 
 // validateUserCookie returns the userID from secure cookies or errors if failures getting it
@@ -147,12 +179,12 @@ func (s *server) validateUserCookie(w http.ResponseWriter, r *http.Request) (str
 		if err = s.cookie.Decode(s.config.SecureCookieName, cookie.Value, &value); err == nil {
 			userID = value
 		} else {
-			log.Println("error in reading user cookie : " + err.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error in reading user cookie", "error", err)
 			s.clearUserCookies(w)
 			return "", errors.New("invalid user cookies")
 		}
 	} else {
-		log.Println("error in reading user cookie : " + err.Error() + "\n")
+		logging.FromContext(r.Context()).Error("error in reading user cookie", "error", err)
 		s.clearUserCookies(w)
 		return "", errors.New("invalid user cookies")
 	}
@@ -160,23 +192,46 @@ func (s *server) validateUserCookie(w http.ResponseWriter, r *http.Request) (str
 	return userID, nil
 }
 
+// impersonatedUser gets the admins active "view as user" session from the impersonation cookie,
+// nil when there isn't one or it has ended
+func (s *server) impersonatedUser(w http.ResponseWriter, r *http.Request, AdminID string) *database.UserImpersonation {
+	cookie, err := r.Cookie(s.impersonationCookieName())
+	if err != nil {
+		return nil
+	}
+
+	var ImpersonationID string
+	if err := s.cookie.Decode(s.impersonationCookieName(), cookie.Value, &ImpersonationID); err != nil {
+		s.clearImpersonationCookie(w)
+		return nil
+	}
+
+	Impersonation, err := s.database.GetActiveImpersonation(r.Context(), ImpersonationID, AdminID)
+	if err != nil {
+		s.clearImpersonationCookie(w)
+		return nil
+	}
+
+	return Impersonation
+}
+
 // get the index template from embedded filesystem
 func (s *server) getIndexTemplate(FSS fs.FS) *template.Template {
 	// get the html template from dist, have it ready for requests
 	tmplContent, ioErr := fs.ReadFile(FSS, "index.html")
 	if ioErr != nil {
-		log.Println("Error opening index template")
+		logging.Error("Error opening index template")
 		if !embedUseOS {
-			log.Fatal(ioErr)
+			logging.Fatal("getIndexTemplate failed", "error", ioErr)
 		}
 	}
 
 	tmplString := string(tmplContent)
 	tmpl, tmplErr := template.New("index").Parse(tmplString)
 	if tmplErr != nil {
-		log.Println("Error parsing index template")
+		logging.Error("Error parsing index template")
 		if !embedUseOS {
-			log.Fatal(tmplErr)
+			logging.Fatal("getIndexTemplate failed", "error", tmplErr)
 		}
 	}
 
@@ -208,7 +263,7 @@ func (s *server) handleIndex(FSS fs.FS) http.HandlerFunc {
 		AnalyticsEnabled bool
 		AnalyticsID      string
 		AppConfig        AppConfig
-		ActiveAlerts     []interface{}
+		ActiveAlerts     []*database.Alert
 	}
 
 	tmpl := s.getIndexTemplate(FSS)
@@ -229,8 +284,6 @@ func (s *server) handleIndex(FSS fs.FS) http.HandlerFunc {
 		ShowActiveCountries:          viper.GetBool("config.show_active_countries"),
 	}
 
-	ActiveAlerts = s.database.GetActiveAlerts()
-
 	data := UIConfig{
 		AnalyticsEnabled: s.config.AnalyticsEnabled,
 		AnalyticsID:      s.config.AnalyticsID,
@@ -238,13 +291,14 @@ func (s *server) handleIndex(FSS fs.FS) http.HandlerFunc {
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		data.ActiveAlerts = ActiveAlerts // get latest alerts from memory
+		pageData := data
+		pageData.ActiveAlerts = s.userAlerts(r.Context(), s.sessionUserID(r)) // get latest alerts from memory
 
 		if embedUseOS {
 			tmpl = s.getIndexTemplate(FSS)
 		}
 
-		tmpl.Execute(w, data)
+		tmpl.Execute(w, pageData)
 	}
 }
 
@@ -260,7 +314,7 @@ func (s *server) handleRetrospectiveCreate() http.HandlerFunc {
 
 		body, bodyErr := ioutil.ReadAll(r.Body) // check for errors
 		if bodyErr != nil {
-			log.Println("error in reading request body: " + bodyErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error in reading request body", "error", bodyErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -270,13 +324,8 @@ func (s *server) handleRetrospectiveCreate() http.HandlerFunc {
 		}
 		json.Unmarshal(body, &keyVal) // check for errors
 
-		newRetrospective, err := s.database.CreateRetrospective(userID, keyVal.RetrospectiveName)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
 		// if retrospective created with team association
+		var createInTeam bool
 		TeamID, ok := vars["teamId"]
 		if ok {
 			OrgRole := r.Context().Value(contextKeyOrgRole)
@@ -290,14 +339,23 @@ func (s *server) handleRetrospectiveCreate() http.HandlerFunc {
 				isAdmin = true
 			}
 
-			if isAdmin == true || TeamRole != "" {
-				err := s.database.TeamAddRetrospective(TeamID, newRetrospective.RetrospectiveID)
+			createInTeam = isAdmin == true || TeamRole != ""
+		}
 
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-			}
+		var newRetrospective *database.Retrospective
+		var err error
+		if createInTeam {
+			newRetrospective, err = s.database.TeamCreateRetrospective(r.Context(), TeamID, userID, keyVal.RetrospectiveName)
+		} else {
+			newRetrospective, err = s.database.CreateRetrospective(r.Context(), userID, keyVal.RetrospectiveName)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if createInTeam {
+			go s.chat.RetrospectiveStarted(logging.WithRequestID(context.Background(), logging.RequestID(r.Context())), newRetrospective)
 		}
 
 		s.respondWithJSON(w, http.StatusOK, newRetrospective)
@@ -310,7 +368,7 @@ func (s *server) handleRetrospectiveGet() http.HandlerFunc {
 		vars := mux.Vars(r)
 		RetrospectiveID := vars["id"]
 
-		retrospective, err := s.database.GetRetrospective(RetrospectiveID)
+		retrospective, err := s.database.GetRetrospective(r.Context(), RetrospectiveID)
 
 		if err != nil {
 			http.NotFound(w, r)
@@ -326,7 +384,7 @@ func (s *server) handleRetrospectivesGet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value(contextKeyUserID).(string)
 
-		retrospectives, err := s.database.GetRetrospectivesByUser(userID)
+		retrospectives, err := s.database.GetRetrospectivesByUser(r.Context(), userID)
 
 		if err != nil {
 			http.NotFound(w, r)
@@ -336,3 +394,158 @@ func (s *server) handleRetrospectivesGet() http.HandlerFunc {
 		s.respondWithJSON(w, http.StatusOK, retrospectives)
 	}
 }
+
+// handleRetrospectiveItemUpdate handles updating a retrospective items content (author or facilitator)
+func (s *server) handleRetrospectiveItemUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(contextKeyUserID).(string)
+		vars := mux.Vars(r)
+		RetrospectiveID := vars["id"]
+		ItemID := vars["itemId"]
+
+		body, bodyErr := ioutil.ReadAll(r.Body)
+		if bodyErr != nil {
+			logging.FromContext(r.Context()).Error("error in reading request body", "error", bodyErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var keyVal struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(body, &keyVal); err != nil || keyVal.Content == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ItemType, Items, err := s.database.UpdateRetrospectiveItem(r.Context(), RetrospectiveID, userID, ItemID, keyVal.Content)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedItems, _ := json.Marshal(Items)
+		h.broadcast <- message{CreateSocketEvent("item_"+ItemType+"_updated", string(updatedItems), ""), RetrospectiveID}
+
+		s.respondWithJSON(w, http.StatusOK, Items)
+	}
+}
+
+// handleRetrospectiveItemHistory gets the edit history of a retrospective item
+func (s *server) handleRetrospectiveItemHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		History, err := s.database.GetRetrospectiveItemHistory(r.Context(), vars["id"], vars["itemId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, History)
+	}
+}
+
+// handleRetrospectiveItemClusters gets suggested groups of similar retrospective items (facilitator)
+func (s *server) handleRetrospectiveItemClusters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(contextKeyUserID).(string)
+		vars := mux.Vars(r)
+
+		Clusters, err := s.database.GetRetrospectiveItemClusters(r.Context(), vars["id"], userID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Clusters)
+	}
+}
+
+// handleRetrospectiveActionUpdate handles updating a retrospective actions content, status, assignee and/or due date (facilitator)
+func (s *server) handleRetrospectiveActionUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(contextKeyUserID).(string)
+		vars := mux.Vars(r)
+		RetrospectiveID := vars["id"]
+		ActionID := vars["actionId"]
+
+		body, bodyErr := ioutil.ReadAll(r.Body)
+		if bodyErr != nil {
+			logging.FromContext(r.Context()).Error("error in reading request body", "error", bodyErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var Update database.RetrospectiveActionUpdate
+		if err := json.Unmarshal(body, &Update); err != nil || (Update.Content == nil && Update.Completed == nil && Update.AssigneeID == nil && Update.DueDate == nil) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Actions, err := s.database.UpdateRetrospectiveAction(r.Context(), RetrospectiveID, userID, ActionID, &Update)
+		if err == database.ErrInvalidDueDate || err == database.ErrAssigneeNotUser {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedActions, _ := json.Marshal(Actions)
+		h.broadcast <- message{CreateSocketEvent("action_updated", string(updatedActions), ""), RetrospectiveID}
+
+		s.respondWithJSON(w, http.StatusOK, Actions)
+	}
+}
+
+// handleRetrospectiveActionTicket creates a ticket for the action in one of the retrospective teams issue trackers
+func (s *server) handleRetrospectiveActionTicket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(contextKeyUserID).(string)
+		vars := mux.Vars(r)
+		RetrospectiveID := vars["id"]
+		ActionID := vars["actionId"]
+
+		keyVal := s.getJSONRequestBody(r, w)
+		TrackerID, _ := keyVal["trackerId"].(string)
+
+		Actions, err := s.createActionTicket(r.Context(), RetrospectiveID, userID, ActionID, TrackerID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		updatedActions, _ := json.Marshal(Actions)
+		h.broadcast <- message{CreateSocketEvent("action_updated", string(updatedActions), ""), RetrospectiveID}
+
+		s.respondWithJSON(w, http.StatusOK, Actions)
+	}
+}
+
+// handleRetrospectiveTrackers gets the issue trackers action items of the retrospective can be turned into tickets in
+func (s *server) handleRetrospectiveTrackers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Trackers := s.database.GetRetrospectiveTrackers(r.Context(), vars["id"])
+
+		s.respondWithJSON(w, http.StatusOK, Trackers)
+	}
+}
+
+// handleRetrospectiveActionHistory gets the edit history of a retrospective action
+func (s *server) handleRetrospectiveActionHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		History, err := s.database.GetRetrospectiveActionHistory(r.Context(), vars["id"], vars["actionId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, History)
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 )
@@ -12,7 +15,7 @@ import (
 // handleAppStats gets the applications stats
 func (s *server) handleAppStats() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		AppStats, err := s.database.GetAppStats()
+		AppStats, err := s.database.GetAppStats(r.Context())
 		if err != nil {
 			http.NotFound(w, r)
 			return
@@ -30,14 +33,17 @@ func (s *server) handleAppStats() http.HandlerFunc {
 	}
 }
 
-// handleGetRegisteredUsers gets a list of registered users
+// handleGetRegisteredUsers gets a list of registered users, optionally searched by the search query param
+// (name, email or company) and of the type query param (GUEST, REGISTERED, ADMIN)
 func (s *server) handleGetRegisteredUsers() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
+		Search := r.URL.Query().Get("search")
+		UserType := strings.ToUpper(r.URL.Query().Get("type"))
 
-		Users := s.database.GetRegisteredUsers(Limit, Offset)
+		Users := s.database.SearchUsers(r.Context(), Search, UserType, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Users)
 	}
@@ -60,7 +66,7 @@ func (s *server) handleUserCreate() http.HandlerFunc {
 			return
 		}
 
-		newUser, VerifyID, err := s.database.CreateUserRegistered(UserName, UserEmail, UserPassword, "")
+		newUser, VerifyID, err := s.database.CreateUserRegistered(r.Context(), UserName, UserEmail, UserPassword, "")
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -77,7 +83,7 @@ func (s *server) handleUserPromote() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyVal := s.getJSONRequestBody(r, w)
 
-		err := s.database.PromoteUser(keyVal["userId"].(string))
+		err := s.database.PromoteUser(r.Context(), keyVal["userId"].(string))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -92,7 +98,7 @@ func (s *server) handleUserDemote() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyVal := s.getJSONRequestBody(r, w)
 
-		err := s.database.DemoteUser(keyVal["userId"].(string))
+		err := s.database.DemoteUser(r.Context(), keyVal["userId"].(string))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -102,12 +108,183 @@ func (s *server) handleUserDemote() http.HandlerFunc {
 	}
 }
 
+// handleAdminUserUpdate handles an admin updating a users name and email by ID
+func (s *server) handleAdminUserUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		vars := mux.Vars(r)
+		UserEmail, _ := keyVal["userEmail"].(string)
+
+		UserName, UserEmail, validateErr := ValidateUserProfile(
+			keyVal["userName"].(string),
+			strings.ToLower(UserEmail),
+		)
+		if validateErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := s.database.AdminUpdateUser(r.Context(), vars["id"], UserName, UserEmail)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		User, err := s.database.GetUser(r.Context(), vars["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, User)
+	}
+}
+
+// handleUserSuspend handles suspending a user by ID, closing their open websocket sessions
+func (s *server) handleUserSuspend() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		AdminID := r.Context().Value(contextKeyUserID).(string)
+		UserID := keyVal["userId"].(string)
+
+		if UserID == AdminID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := s.database.SuspendUser(r.Context(), UserID, true)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		h.disconnect <- disconnection{userID: UserID, closeMessage: closeUserSuspended}
+		logging.FromContext(r.Context()).Info("user suspended", "admin_id", AdminID, "user_id", UserID)
+
+		return
+	}
+}
+
+// handleUserUnsuspend handles unsuspending a user by ID
+func (s *server) handleUserUnsuspend() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		AdminID := r.Context().Value(contextKeyUserID).(string)
+		UserID := keyVal["userId"].(string)
+
+		err := s.database.SuspendUser(r.Context(), UserID, false)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		logging.FromContext(r.Context()).Info("user unsuspended", "admin_id", AdminID, "user_id", UserID)
+
+		return
+	}
+}
+
+// handleUserResendVerification handles sending an unverified user a new verification email by ID
+func (s *server) handleUserResendVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		VerifyID, UserName, UserEmail, err := s.database.UserVerifyRequest(r.Context(), vars["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.email.SendWelcome(UserName, UserEmail, VerifyID)
+
+		return
+	}
+}
+
+// handleUserImpersonate starts the admins read only "view as user" session by user ID, lasting admin.impersonation_timeout
+func (s *server) handleUserImpersonate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		vars := mux.Vars(r)
+		AdminID := r.Context().Value(contextKeyUserID).(string)
+		UserID := vars["id"]
+		Reason, _ := keyVal["reason"].(string)
+
+		ExpireDate := time.Now().Add(s.config.ImpersonationTimeout)
+		ImpersonationID, err := s.database.ImpersonationCreate(r.Context(), AdminID, UserID, strings.TrimSpace(Reason), s.config.ImpersonationTimeout)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		cookie := s.createImpersonationCookie(ImpersonationID, ExpireDate)
+		if cookie == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, cookie)
+
+		logging.FromContext(r.Context()).Info("admin impersonation started",
+			"impersonation_id", ImpersonationID, "admin_id", AdminID, "user_id", UserID, "reason", Reason,
+		)
+
+		User, err := s.database.GetUser(r.Context(), UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"id":         ImpersonationID,
+			"user":       User,
+			"expireDate": ExpireDate.UTC(),
+		})
+	}
+}
+
+// handleImpersonationEnd ends the admins "view as user" session, closing its websocket sessions
+func (s *server) handleImpersonationEnd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		AdminID := r.Context().Value(contextKeyUserID).(string)
+
+		if Impersonation := s.impersonatedUser(w, r, AdminID); Impersonation != nil {
+			err := s.database.ImpersonationEnd(r.Context(), Impersonation.ImpersonationID, AdminID)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			h.disconnect <- disconnection{impersonationID: Impersonation.ImpersonationID, closeMessage: closeImpersonationEnded}
+			logging.FromContext(r.Context()).Info("admin impersonation ended",
+				"impersonation_id", Impersonation.ImpersonationID, "admin_id", AdminID, "user_id", Impersonation.UserID,
+			)
+		}
+
+		s.clearImpersonationCookie(w)
+
+		return
+	}
+}
+
+// handleGetImpersonations gets the admin impersonation audit log
+func (s *server) handleGetImpersonations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		Limit, _ := strconv.Atoi(vars["limit"])
+		Offset, _ := strconv.Atoi(vars["offset"])
+
+		Impersonations := s.database.ImpersonationList(r.Context(), Limit, Offset)
+
+		s.respondWithJSON(w, http.StatusOK, Impersonations)
+	}
+}
+
 // handleCleanRetrospectives handles cleaning up old retrospectives (ADMIN Manaually Triggered)
 func (s *server) handleCleanRetrospectives() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		DaysOld := viper.GetInt("config.cleanup_retrospectives_days_old")
 
-		err := s.database.CleanRetrospectives(DaysOld)
+		err := s.database.CleanRetrospectives(r.Context(), DaysOld)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -122,7 +299,7 @@ func (s *server) handleCleanGuests() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		DaysOld := viper.GetInt("config.cleanup_guests_days_old")
 
-		err := s.database.CleanGuests(DaysOld)
+		err := s.database.CleanGuests(r.Context(), DaysOld)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -139,7 +316,7 @@ func (s *server) handleGetOrganizations() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Organizations := s.database.OrganizationList(Limit, Offset)
+		Organizations := s.database.OrganizationList(r.Context(), Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Organizations)
 	}
@@ -152,12 +329,210 @@ func (s *server) handleGetTeams() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.TeamList(Limit, Offset)
+		Teams := s.database.TeamList(r.Context(), Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
 }
 
+// handleAdminOrganizationUpdate handles renaming an organization
+func (s *server) handleAdminOrganizationUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		vars := mux.Vars(r)
+		OrgName, _ := keyVal["name"].(string)
+		if OrgName = strings.TrimSpace(OrgName); OrgName == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Organization, err := s.database.OrganizationUpdate(r.Context(), vars["orgId"], OrgName)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Organization)
+	}
+}
+
+// handleAdminOrganizationDelete handles deleting an organization along with its departments and teams
+func (s *server) handleAdminOrganizationDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := s.database.OrganizationDelete(r.Context(), vars["orgId"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		return
+	}
+}
+
+// handleAdminGetDepartments gets a list of an organizations departments
+func (s *server) handleAdminGetDepartments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		Limit, _ := strconv.Atoi(vars["limit"])
+		Offset, _ := strconv.Atoi(vars["offset"])
+
+		Departments := s.database.OrganizationDepartmentList(r.Context(), vars["orgId"], Limit, Offset)
+
+		s.respondWithJSON(w, http.StatusOK, Departments)
+	}
+}
+
+// handleAdminDepartmentUpdate handles renaming a department
+func (s *server) handleAdminDepartmentUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		vars := mux.Vars(r)
+		DepartmentName, _ := keyVal["name"].(string)
+		if DepartmentName = strings.TrimSpace(DepartmentName); DepartmentName == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Department, err := s.database.DepartmentUpdate(r.Context(), vars["departmentId"], DepartmentName)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Department)
+	}
+}
+
+// handleAdminDepartmentDelete handles deleting a department along with its teams
+func (s *server) handleAdminDepartmentDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := s.database.DepartmentDelete(r.Context(), vars["departmentId"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		return
+	}
+}
+
+// handleAdminTeamUpdate handles renaming a team
+func (s *server) handleAdminTeamUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		vars := mux.Vars(r)
+		TeamName, _ := keyVal["name"].(string)
+		if TeamName = strings.TrimSpace(TeamName); TeamName == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Team, err := s.database.TeamUpdate(r.Context(), vars["teamId"], TeamName)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Team)
+	}
+}
+
+// handleAdminTeamDelete handles deleting a team
+func (s *server) handleAdminTeamDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := s.database.TeamDelete(r.Context(), vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// handleGetRetrospectives gets a list of retrospectives, optionally searched by the search query param
+// (retrospective or owner name) and only the live ones (with active users) when the active query param is true
+func (s *server) handleGetRetrospectives() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		Limit, _ := strconv.Atoi(vars["limit"])
+		Offset, _ := strconv.Atoi(vars["offset"])
+		Search := r.URL.Query().Get("search")
+		Active, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+
+		Retrospectives := s.database.AdminRetrospectiveList(r.Context(), Search, Active, Limit, Offset)
+
+		s.respondWithJSON(w, http.StatusOK, Retrospectives)
+	}
+}
+
+// handleAdminRetrospectiveOwner handles transferring a retrospective to a new owner,
+// updating the retrospective for its connected users
+func (s *server) handleAdminRetrospectiveOwner() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+		vars := mux.Vars(r)
+		RetrospectiveID := vars["id"]
+		OwnerID, _ := keyVal["ownerId"].(string)
+
+		Retrospective, err := s.database.AdminSetRetrospectiveOwner(r.Context(), RetrospectiveID, OwnerID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		updatedRetrospective, _ := json.Marshal(Retrospective)
+		h.broadcast <- message{CreateSocketEvent("retrospective_updated", string(updatedRetrospective), ""), RetrospectiveID}
+
+		s.respondWithJSON(w, http.StatusOK, Retrospective)
+	}
+}
+
+// handleAdminRetrospectiveClose handles force closing a live retrospective, disconnecting its users
+func (s *server) handleAdminRetrospectiveClose() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		AdminID := r.Context().Value(contextKeyUserID).(string)
+		RetrospectiveID := vars["id"]
+
+		err := s.database.RetrospectiveClose(r.Context(), RetrospectiveID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		h.disconnect <- disconnection{arena: RetrospectiveID, closeMessage: closeRetrospectiveClosed}
+		logging.FromContext(r.Context()).Info("retrospective closed", "admin_id", AdminID, "retrospective_id", RetrospectiveID)
+
+		return
+	}
+}
+
+// handleAdminRetrospectiveReopen handles reopening a force closed retrospective
+func (s *server) handleAdminRetrospectiveReopen() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		AdminID := r.Context().Value(contextKeyUserID).(string)
+		RetrospectiveID := vars["id"]
+
+		err := s.database.RetrospectiveReopen(r.Context(), RetrospectiveID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		logging.FromContext(r.Context()).Info("retrospective reopened", "admin_id", AdminID, "retrospective_id", RetrospectiveID)
+
+		return
+	}
+}
+
 // handleGetAPIKeys gets a list of APIKeys
 func (s *server) handleGetAPIKeys() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -165,8 +540,50 @@ func (s *server) handleGetAPIKeys() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.GetAPIKeys(Limit, Offset)
+		Teams := s.database.GetAPIKeys(r.Context(), Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
 }
+
+// handleGetEmailOutbox gets a list of queued emails, optionally filtered by the status query param (PENDING, SENT, FAILED)
+func (s *server) handleGetEmailOutbox() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		Limit, _ := strconv.Atoi(vars["limit"])
+		Offset, _ := strconv.Atoi(vars["offset"])
+		Status := strings.ToUpper(r.URL.Query().Get("status"))
+
+		Messages := s.database.EmailOutboxList(r.Context(), Status, Limit, Offset)
+
+		s.respondWithJSON(w, http.StatusOK, Messages)
+	}
+}
+
+// handleEmailOutboxRetry queues a failed email to be sent again
+func (s *server) handleEmailOutboxRetry() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := s.database.EmailOutboxRetry(r.Context(), vars["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		return
+	}
+}
+
+// handleEmailOutboxRetryFailed queues all failed emails to be sent again
+func (s *server) handleEmailOutboxRetryFailed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Count, err := s.database.EmailOutboxRetryFailed(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, map[string]int64{"retried": Count})
+	}
+}
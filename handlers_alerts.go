@@ -3,10 +3,26 @@ package main
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// alertDate gets an optional RFC 3339 alert start or end date from the request body, nil when not set
+func alertDate(keyVal map[string]interface{}, Key string) (*time.Time, error) {
+	Value, _ := keyVal[Key].(string)
+	if Value == "" {
+		return nil, nil
+	}
+
+	Date, err := time.Parse(time.RFC3339, Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Date, nil
+}
+
 // handleGetAlerts gets a list of alerts
 func (s *server) handleGetAlerts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -14,16 +30,26 @@ func (s *server) handleGetAlerts() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Alerts := s.database.AlertsList(Limit, Offset)
+		Alerts := s.database.AlertsList(r.Context(), Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Alerts)
 	}
 }
 
+// handleGetUserAlerts gets the active alerts shown to the current user
+func (s *server) handleGetUserAlerts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID := r.Context().Value(contextKeyUserID).(string)
+
+		s.respondWithJSON(w, http.StatusOK, s.userAlerts(r.Context(), UserID))
+	}
+}
+
 // handleAlertCreate creates a new alert
 func (s *server) handleAlertCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyVal := s.getJSONRequestBody(r, w)
+		UserID := r.Context().Value(contextKeyUserID).(string)
 
 		Name := keyVal["name"].(string)
 		Type := keyVal["type"].(string)
@@ -31,16 +57,25 @@ func (s *server) handleAlertCreate() http.HandlerFunc {
 		Active := keyVal["active"].(bool)
 		AllowDismiss := keyVal["allowDismiss"].(bool)
 		RegisteredOnly := keyVal["registeredOnly"].(bool)
+		OrganizationID, _ := keyVal["organizationId"].(string)
+		Locale, _ := keyVal["locale"].(string)
+		UserType, _ := keyVal["userType"].(string)
+		StartDate, startErr := alertDate(keyVal, "startDate")
+		EndDate, endErr := alertDate(keyVal, "endDate")
+		if startErr != nil || endErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		err := s.database.AlertsCreate(Name, Type, Content, Active, AllowDismiss, RegisteredOnly)
+		err := s.database.AlertsCreate(r.Context(), Name, Type, Content, Active, AllowDismiss, RegisteredOnly, StartDate, EndDate, OrganizationID, Locale, UserType)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		ActiveAlerts = s.database.GetActiveAlerts()
+		s.refreshAlerts(r.Context())
 
-		s.respondWithJSON(w, http.StatusOK, ActiveAlerts)
+		s.respondWithJSON(w, http.StatusOK, s.userAlerts(r.Context(), UserID))
 	}
 }
 
@@ -49,6 +84,7 @@ func (s *server) handleAlertUpdate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyVal := s.getJSONRequestBody(r, w)
 		vars := mux.Vars(r)
+		UserID := r.Context().Value(contextKeyUserID).(string)
 
 		ID := vars["id"]
 		Name := keyVal["name"].(string)
@@ -57,16 +93,25 @@ func (s *server) handleAlertUpdate() http.HandlerFunc {
 		Active := keyVal["active"].(bool)
 		AllowDismiss := keyVal["allowDismiss"].(bool)
 		RegisteredOnly := keyVal["registeredOnly"].(bool)
+		OrganizationID, _ := keyVal["organizationId"].(string)
+		Locale, _ := keyVal["locale"].(string)
+		UserType, _ := keyVal["userType"].(string)
+		StartDate, startErr := alertDate(keyVal, "startDate")
+		EndDate, endErr := alertDate(keyVal, "endDate")
+		if startErr != nil || endErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		err := s.database.AlertsUpdate(ID, Name, Type, Content, Active, AllowDismiss, RegisteredOnly)
+		err := s.database.AlertsUpdate(r.Context(), ID, Name, Type, Content, Active, AllowDismiss, RegisteredOnly, StartDate, EndDate, OrganizationID, Locale, UserType)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		ActiveAlerts = s.database.GetActiveAlerts()
+		s.refreshAlerts(r.Context())
 
-		s.respondWithJSON(w, http.StatusOK, ActiveAlerts)
+		s.respondWithJSON(w, http.StatusOK, s.userAlerts(r.Context(), UserID))
 	}
 }
 
@@ -74,16 +119,17 @@ func (s *server) handleAlertUpdate() http.HandlerFunc {
 func (s *server) handleAlertDelete() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyVal := s.getJSONRequestBody(r, w)
+		UserID := r.Context().Value(contextKeyUserID).(string)
 		AlertID := keyVal["id"].(string)
 
-		err := s.database.AlertDelete(AlertID)
+		err := s.database.AlertDelete(r.Context(), AlertID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		ActiveAlerts = s.database.GetActiveAlerts()
+		s.refreshAlerts(r.Context())
 
-		s.respondWithJSON(w, http.StatusOK, ActiveAlerts)
+		s.respondWithJSON(w, http.StatusOK, s.userAlerts(r.Context(), UserID))
 	}
 }
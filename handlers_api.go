@@ -1,9 +1,9 @@
 package main
 
 import (
-	"log"
 	"net/http"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/gorilla/mux"
 )
 
@@ -21,9 +21,9 @@ func (s *server) handleAPIKeyGenerate() http.HandlerFunc {
 			return
 		}
 
-		APIKey, keyErr := s.database.GenerateAPIKey(UserID, APIKeyName)
+		APIKey, keyErr := s.database.GenerateAPIKey(r.Context(), UserID, APIKeyName)
 		if keyErr != nil {
-			log.Println("error attempting to generate api key : " + keyErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error attempting to generate api key", "error", keyErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -44,9 +44,9 @@ func (s *server) handleUserAPIKeys() http.HandlerFunc {
 			return
 		}
 
-		APIKeys, keysErr := s.database.GetUserAPIKeys(UserID)
+		APIKeys, keysErr := s.database.GetUserAPIKeys(r.Context(), UserID)
 		if keysErr != nil {
-			log.Println("error retrieving api keys : " + keysErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error retrieving api keys", "error", keysErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -70,9 +70,9 @@ func (s *server) handleUserAPIKeyUpdate() http.HandlerFunc {
 		keyVal := s.getJSONRequestBody(r, w)
 		active := keyVal["active"].(bool)
 
-		APIKeys, keysErr := s.database.UpdateUserAPIKey(UserID, APK, active)
+		APIKeys, keysErr := s.database.UpdateUserAPIKey(r.Context(), UserID, APK, active)
 		if keysErr != nil {
-			log.Println("error updating api key : " + keysErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error updating api key", "error", keysErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -94,9 +94,9 @@ func (s *server) handleUserAPIKeyDelete() http.HandlerFunc {
 		}
 		APK := vars["keyID"]
 
-		APIKeys, keysErr := s.database.DeleteUserAPIKey(UserID, APK)
+		APIKeys, keysErr := s.database.DeleteUserAPIKey(r.Context(), UserID, APK)
 		if keysErr != nil {
-			log.Println("error deleting api key : " + keysErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error deleting api key", "error", keysErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"log"
 	"net/http"
 	"strings"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/spf13/viper"
 )
 
@@ -15,17 +16,22 @@ func (s *server) handleLogin() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["userEmail"].(string))
 		UserPassword := keyVal["userPassword"].(string)
 
-		authedUser, err := s.authUserDatabase(UserEmail, UserPassword)
+		authedUser, err := s.authUserDatabase(r.Context(), UserEmail, UserPassword)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
+		if s.database.ConfirmUserActive(r.Context(), authedUser.UserID) == database.ErrUserSuspended {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
 		cookie := s.createCookie(authedUser.UserID)
 		if cookie != nil {
 			http.SetCookie(w, cookie)
 		} else {
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("handleLogin failed", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -42,17 +48,22 @@ func (s *server) handleLdapLogin() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["userEmail"].(string))
 		UserPassword := keyVal["userPassword"].(string)
 
-		authedUser, err := s.authAndCreateUserLdap(UserEmail, UserPassword)
+		authedUser, err := s.authAndCreateUserLdap(r.Context(), UserEmail, UserPassword)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
+		if s.database.ConfirmUserActive(r.Context(), authedUser.UserID) == database.ErrUserSuspended {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
 		cookie := s.createCookie(authedUser.UserID)
 		if cookie != nil {
 			http.SetCookie(w, cookie)
 		} else {
-			log.Println(err)
+			logging.FromContext(r.Context()).Error("handleLdapLogin failed", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -81,7 +92,7 @@ func (s *server) handleUserRecruit() http.HandlerFunc {
 
 		UserName := keyVal["userName"].(string)
 
-		newUser, err := s.database.CreateUserGuest(UserName)
+		newUser, err := s.database.CreateUserGuest(r.Context(), UserName)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -118,7 +129,7 @@ func (s *server) handleUserEnlist() http.HandlerFunc {
 			return
 		}
 
-		newUser, VerifyID, err := s.database.CreateUserRegistered(UserName, UserEmail, UserPassword, ActiveUserID)
+		newUser, VerifyID, err := s.database.CreateUserRegistered(r.Context(), UserName, UserEmail, UserPassword, ActiveUserID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -138,7 +149,7 @@ func (s *server) handleForgotPassword() http.HandlerFunc {
 		keyVal := s.getJSONRequestBody(r, w)
 		UserEmail := strings.ToLower(keyVal["userEmail"].(string))
 
-		ResetID, UserName, resetErr := s.database.UserResetRequest(UserEmail)
+		ResetID, UserName, resetErr := s.database.UserResetRequest(r.Context(), UserEmail)
 		if resetErr == nil {
 			s.email.SendForgotPassword(UserName, UserEmail, ResetID)
 		}
@@ -164,9 +175,9 @@ func (s *server) handleResetPassword() http.HandlerFunc {
 			return
 		}
 
-		UserName, UserEmail, resetErr := s.database.UserResetPassword(ResetID, UserPassword)
+		UserName, UserEmail, resetErr := s.database.UserResetPassword(r.Context(), ResetID, UserPassword)
 		if resetErr != nil {
-			log.Println("error attempting to reset user password : " + resetErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error attempting to reset user password", "error", resetErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
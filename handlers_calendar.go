@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/ical"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// how many runs of each schedule are listed in calendar feeds
+	calendarScheduleOccurrences = 6
+	// scheduled retrospectives are shown as meetings of this length
+	calendarRetrospectiveDuration = time.Hour
+)
+
+type calendarURLResponse struct {
+	URL string `json:"url"`
+}
+
+// calendarURL is the subscribable url of a calendar feed
+func (s *server) calendarURL(Kind string, Token string) string {
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + "/api/calendar/" + Kind + "/" + Token + ".ics"
+}
+
+// calendarEvents builds the calendar events of a feed, each schedules upcoming runs linking to the team (and its previous
+// run linking to the retrospective it created) and an all day event on the due date of each open action item
+func (s *server) calendarEvents(Feed *database.CalendarFeed) []*ical.Event {
+	AppURL := "https://" + s.config.AppDomain + s.config.PathPrefix + "/"
+	var events = make([]*ical.Event, 0)
+
+	for _, schedule := range Feed.Schedules {
+		interval := time.Duration(schedule.IntervalWeeks) * 7 * 24 * time.Hour
+		TeamURL := AppURL + "team/" + schedule.TeamID
+
+		Start := schedule.NextRunDate
+		if schedule.LastRetrospectiveID != "" {
+			Start = Start.Add(-interval)
+		}
+		for i := 0; i < calendarScheduleOccurrences; i++ {
+			URL := TeamURL
+			if Start.Before(schedule.NextRunDate) {
+				URL = AppURL + "retrospective/" + schedule.LastRetrospectiveID
+			}
+
+			events = append(events, &ical.Event{
+				UID:          "schedule-" + schedule.ScheduleID + "-" + Start.UTC().Format("20060102") + "@" + s.config.AppDomain,
+				Summary:      schedule.Name + " (" + schedule.TeamName + ")",
+				Description:  "Scheduled retrospective of the team " + schedule.TeamName + ", join at " + URL,
+				URL:          URL,
+				Start:        Start,
+				End:          Start.Add(calendarRetrospectiveDuration),
+				LastModified: schedule.UpdatedDate,
+			})
+			Start = Start.Add(interval)
+		}
+	}
+
+	for _, action := range Feed.Actions {
+		DueDate := time.Date(action.DueDate.Year(), action.DueDate.Month(), action.DueDate.Day(), 0, 0, 0, 0, time.UTC)
+		URL := AppURL + "retrospective/" + action.RetrospectiveID
+
+		Description := action.Content + "\n\nFrom the retrospective " + action.RetrospectiveName
+		if action.AssigneeName != "" {
+			Description += ", assigned to " + action.AssigneeName
+		}
+		Description += "\n" + URL
+
+		Summary := strings.TrimSpace(strings.SplitN(action.Content, "\n", 2)[0])
+		if runes := []rune(Summary); len(runes) > ticketTitleMaxLength {
+			Summary = string(runes[:ticketTitleMaxLength-3]) + "..."
+		}
+
+		events = append(events, &ical.Event{
+			UID:          "action-" + action.ActionID + "@" + s.config.AppDomain,
+			Summary:      "Action due: " + Summary,
+			Description:  Description,
+			URL:          URL,
+			Start:        DueDate,
+			End:          DueDate.AddDate(0, 0, 1),
+			AllDay:       true,
+			LastModified: action.UpdatedDate,
+		})
+	}
+
+	return events
+}
+
+// respondWithCalendar writes the feed as an iCalendar file, timed events are in the ?tz= IANA time zone (UTC by default)
+func (s *server) respondWithCalendar(w http.ResponseWriter, r *http.Request, Feed *database.CalendarFeed) {
+	Location := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		if Location, err = time.LoadLocation(tz); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	Calendar := &ical.Calendar{
+		Name:     Feed.Name + " - Wakita",
+		Location: Location,
+		Events:   s.calendarEvents(Feed),
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="wakita.ics"`)
+	w.Write(Calendar.Bytes(time.Now()))
+}
+
+// handleUserCalendarFeed serves the iCalendar feed of the user owning the secret token in the url, without logging in
+// so calendar apps can subscribe to it
+func (s *server) handleUserCalendarFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Feed, err := s.database.GetUserCalendar(r.Context(), vars["token"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s.respondWithCalendar(w, r, Feed)
+	}
+}
+
+// handleTeamCalendarFeed serves the iCalendar feed of the team owning the secret token in the url, without logging in
+// so calendar apps can subscribe to it
+func (s *server) handleTeamCalendarFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Feed, err := s.database.GetTeamCalendar(r.Context(), vars["token"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s.respondWithCalendar(w, r, Feed)
+	}
+}
+
+// handleUserCalendar gets the users calendar feed url, POST replaces it with a new one (the previous url stops working)
+func (s *server) handleUserCalendar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		UserID := vars["id"]
+
+		userCookieID := r.Context().Value(contextKeyUserID).(string)
+		if UserID != userCookieID {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var Token string
+		var err error
+		if r.Method == http.MethodPost {
+			Token, err = s.database.RegenerateUserCalendarToken(r.Context(), UserID)
+		} else {
+			Token, err = s.database.GetUserCalendarToken(r.Context(), UserID)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("error getting user calendar token", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, &calendarURLResponse{URL: s.calendarURL("user", Token)})
+	}
+}
+
+// handleTeamCalendar gets the teams calendar feed url, POST replaces it with a new one (the previous url stops working)
+func (s *server) handleTeamCalendar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		var Token string
+		var err error
+		if r.Method == http.MethodPost {
+			Token, err = s.database.RegenerateTeamCalendarToken(r.Context(), TeamID)
+		} else {
+			Token, err = s.database.GetTeamCalendarToken(r.Context(), TeamID)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("error getting team calendar token", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, &calendarURLResponse{URL: s.calendarURL("team", Token)})
+	}
+}
@@ -17,7 +17,7 @@ func (s *server) handleGetOrganizationDepartments() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.OrganizationDepartmentList(OrgID, Limit, Offset)
+		Teams := s.database.OrganizationDepartmentList(r.Context(), OrgID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
@@ -38,13 +38,13 @@ func (s *server) handleGetDepartmentByUser() http.HandlerFunc {
 		OrgID := vars["orgId"]
 		DepartmentID := vars["departmentId"]
 
-		Organization, err := s.database.OrganizationGet(OrgID)
+		Organization, err := s.database.OrganizationGet(r.Context(), OrgID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		Department, err := s.database.DepartmentGet(DepartmentID)
+		Department, err := s.database.DepartmentGet(r.Context(), DepartmentID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -72,7 +72,7 @@ func (s *server) handleCreateDepartment() http.HandlerFunc {
 
 		OrgName := keyVal["name"].(string)
 		OrgID := vars["orgId"]
-		DepartmentID, err := s.database.DepartmentCreate(OrgID, OrgName)
+		DepartmentID, err := s.database.DepartmentCreate(r.Context(), OrgID, OrgName)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -94,7 +94,7 @@ func (s *server) handleGetDepartmentTeams() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.DepartmentTeamList(DepartmentID, Limit, Offset)
+		Teams := s.database.DepartmentTeamList(r.Context(), DepartmentID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
@@ -108,7 +108,7 @@ func (s *server) handleGetDepartmentUsers() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.DepartmentUserList(DepartmentID, Limit, Offset)
+		Teams := s.database.DepartmentUserList(r.Context(), DepartmentID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
@@ -127,7 +127,7 @@ func (s *server) handleCreateDepartmentTeam() http.HandlerFunc {
 
 		TeamName := keyVal["name"].(string)
 		DepartmentID := vars["departmentId"]
-		TeamID, err := s.database.DepartmentTeamCreate(DepartmentID, TeamName)
+		TeamID, err := s.database.DepartmentTeamCreate(r.Context(), DepartmentID, TeamName)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -151,13 +151,13 @@ func (s *server) handleDepartmentAddUser() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["email"].(string))
 		Role := keyVal["role"].(string)
 
-		User, UserErr := s.database.GetUserByEmail(UserEmail)
+		User, UserErr := s.database.GetUserByEmail(r.Context(), UserEmail)
 		if UserErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		_, err := s.database.DepartmentAddUser(DepartmentId, User.UserID, Role)
+		_, err := s.database.DepartmentAddUser(r.Context(), DepartmentId, User.UserID, Role)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -176,7 +176,7 @@ func (s *server) handleDepartmentRemoveUser() http.HandlerFunc {
 		DepartmentID := vars["departmentId"]
 		UserID := keyVal["id"].(string)
 
-		err := s.database.DepartmentRemoveUser(DepartmentID, UserID)
+		err := s.database.DepartmentRemoveUser(r.Context(), DepartmentID, UserID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -198,19 +198,19 @@ func (s *server) handleDepartmentTeamAddUser() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["email"].(string))
 		Role := keyVal["role"].(string)
 
-		User, UserErr := s.database.GetUserByEmail(UserEmail)
+		User, UserErr := s.database.GetUserByEmail(r.Context(), UserEmail)
 		if UserErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		_, DepartmentRole, roleErr := s.database.DepartmentUserRole(User.UserID, OrgID, DepartmentID)
+		_, DepartmentRole, roleErr := s.database.DepartmentUserRole(r.Context(), User.UserID, OrgID, DepartmentID)
 		if DepartmentRole == "" || roleErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		_, err := s.database.TeamAddUser(TeamID, User.UserID, Role)
+		_, err := s.database.TeamAddUser(r.Context(), TeamID, User.UserID, Role)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -239,19 +239,19 @@ func (s *server) handleDepartmentTeamByUser() http.HandlerFunc {
 		DepartmentID := vars["departmentId"]
 		TeamID := vars["teamId"]
 
-		Organization, err := s.database.OrganizationGet(OrgID)
+		Organization, err := s.database.OrganizationGet(r.Context(), OrgID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		Department, err := s.database.DepartmentGet(DepartmentID)
+		Department, err := s.database.DepartmentGet(r.Context(), DepartmentID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		Team, err := s.database.TeamGet(TeamID)
+		Team, err := s.database.TeamGet(r.Context(), TeamID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -267,3 +267,19 @@ func (s *server) handleDepartmentTeamByUser() http.HandlerFunc {
 		})
 	}
 }
+
+// handleGetDepartmentAnalytics gets a trend report across the retrospectives of the departments teams
+func (s *server) handleGetDepartmentAnalytics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		DepartmentID := vars["departmentId"]
+
+		Analytics, err := s.database.DepartmentAnalytics(r.Context(), DepartmentID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Analytics)
+	}
+}
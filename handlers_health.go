@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
+)
+
+// how long each readiness dependency check may take
+const healthCheckTimeout = 3 * time.Second
+
+// healthCheck is the result of checking a single dependency
+type healthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// runHealthCheck times the check, marking it down if it errors or exceeds the timeout
+func runHealthCheck(ctx context.Context, check func(ctx context.Context) error) *healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := &healthCheck{
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// pingLdap checks the configured ldap server is accepting connections
+func pingLdap(ctx context.Context) error {
+	dialer := &net.Dialer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	l, err := ldap.DialURL(viper.GetString("auth.ldap.url"), ldap.DialWithDialer(dialer))
+	if err != nil {
+		return err
+	}
+	l.Close()
+
+	return nil
+}
+
+// handleLiveness reports the process is up and serving requests
+func (s *server) handleLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// handleReadiness reports whether the instance can take traffic, checking the database pool and schema
+// along with the smtp and ldap servers when they are configured
+func (s *server) handleReadiness() http.HandlerFunc {
+	type ReadinessResponse struct {
+		Status string                  `json:"status"`
+		Checks map[string]*healthCheck `json:"checks"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		checks := map[string]*healthCheck{
+			"database":   runHealthCheck(ctx, s.database.Ping),
+			"migrations": runHealthCheck(ctx, s.database.CheckSchema),
+		}
+		if viper.GetString("email.transport") == "smtp" && viper.GetString("smtp.host") != "" {
+			checks["smtp"] = runHealthCheck(ctx, s.email.Ping)
+		}
+		if viper.GetString("auth.method") == "ldap" {
+			checks["ldap"] = runHealthCheck(ctx, pingLdap)
+		}
+
+		var response = &ReadinessResponse{
+			Status: "ok",
+			Checks: checks,
+		}
+		for _, check := range checks {
+			if check.Status != "ok" {
+				response.Status = "unavailable"
+			}
+		}
+		if atomic.LoadInt32(&s.shuttingDown) == 1 {
+			response.Status = "shutting down"
+		}
+
+		StatusCode := http.StatusOK
+		if response.Status != "ok" {
+			StatusCode = http.StatusServiceUnavailable
+		}
+
+		s.respondWithJSON(w, StatusCode, response)
+	}
+}
+
+// handleBuildInfo gets the application version, go version and enabled features
+func (s *server) handleBuildInfo() http.HandlerFunc {
+	type BuildInfoResponse struct {
+		Version   string          `json:"version"`
+		GoVersion string          `json:"goVersion"`
+		Features  map[string]bool `json:"features"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respondWithJSON(w, http.StatusOK, &BuildInfoResponse{
+			Version:   s.config.Version,
+			GoVersion: runtime.Version(),
+			Features: map[string]bool{
+				"allowGuests":         viper.GetBool("config.allow_guests"),
+				"allowRegistration":   viper.GetBool("config.allow_registration") && viper.GetString("auth.method") == "normal",
+				"allowExternalApi":    viper.GetBool("config.allow_external_api"),
+				"showActiveCountries": viper.GetBool("config.show_active_countries"),
+				"analytics":           viper.GetBool("analytics.enabled"),
+				"ldapAuth":            viper.GetString("auth.method") == "ldap",
+			},
+		})
+	}
+}
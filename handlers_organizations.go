@@ -17,7 +17,7 @@ func (s *server) handleGetOrganizationsByUser() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Organizations := s.database.OrganizationListByUser(UserID, Limit, Offset)
+		Organizations := s.database.OrganizationListByUser(r.Context(), UserID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Organizations)
 	}
@@ -34,7 +34,7 @@ func (s *server) handleGetOrganizationByUser() http.HandlerFunc {
 		vars := mux.Vars(r)
 		OrgID := vars["orgId"]
 
-		Organization, err := s.database.OrganizationGet(OrgID)
+		Organization, err := s.database.OrganizationGet(r.Context(), OrgID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -58,7 +58,7 @@ func (s *server) handleCreateOrganization() http.HandlerFunc {
 		keyVal := s.getJSONRequestBody(r, w)
 
 		OrgName := keyVal["name"].(string)
-		OrgId, err := s.database.OrganizationCreate(UserID, OrgName)
+		OrgId, err := s.database.OrganizationCreate(r.Context(), UserID, OrgName)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -80,7 +80,7 @@ func (s *server) handleGetOrganizationTeams() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.OrganizationTeamList(OrgID, Limit, Offset)
+		Teams := s.database.OrganizationTeamList(r.Context(), OrgID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
@@ -94,7 +94,7 @@ func (s *server) handleGetOrganizationUsers() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.OrganizationUserList(OrgID, Limit, Offset)
+		Teams := s.database.OrganizationUserList(r.Context(), OrgID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
@@ -113,7 +113,7 @@ func (s *server) handleCreateOrganizationTeam() http.HandlerFunc {
 
 		TeamName := keyVal["name"].(string)
 		OrgID := vars["orgId"]
-		TeamID, err := s.database.OrganizationTeamCreate(OrgID, TeamName)
+		TeamID, err := s.database.OrganizationTeamCreate(r.Context(), OrgID, TeamName)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -137,13 +137,13 @@ func (s *server) handleOrganizationAddUser() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["email"].(string))
 		Role := keyVal["role"].(string)
 
-		User, UserErr := s.database.GetUserByEmail(UserEmail)
+		User, UserErr := s.database.GetUserByEmail(r.Context(), UserEmail)
 		if UserErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		_, err := s.database.OrganizationAddUser(OrgID, User.UserID, Role)
+		_, err := s.database.OrganizationAddUser(r.Context(), OrgID, User.UserID, Role)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -162,7 +162,7 @@ func (s *server) handleOrganizationRemoveUser() http.HandlerFunc {
 		OrgID := vars["orgId"]
 		UserID := keyVal["id"].(string)
 
-		err := s.database.OrganizationRemoveUser(OrgID, UserID)
+		err := s.database.OrganizationRemoveUser(r.Context(), OrgID, UserID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -187,13 +187,13 @@ func (s *server) handleGetOrganizationTeamByUser() http.HandlerFunc {
 		OrgID := vars["orgId"]
 		TeamID := vars["teamId"]
 
-		Organization, err := s.database.OrganizationGet(OrgID)
+		Organization, err := s.database.OrganizationGet(r.Context(), OrgID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		Team, err := s.database.TeamGet(TeamID)
+		Team, err := s.database.TeamGet(r.Context(), TeamID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -219,19 +219,19 @@ func (s *server) handleOrganizationTeamAddUser() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["email"].(string))
 		Role := keyVal["role"].(string)
 
-		User, UserErr := s.database.GetUserByEmail(UserEmail)
+		User, UserErr := s.database.GetUserByEmail(r.Context(), UserEmail)
 		if UserErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		OrgRole, roleErr := s.database.OrganizationUserRole(User.UserID, OrgID)
+		OrgRole, roleErr := s.database.OrganizationUserRole(r.Context(), User.UserID, OrgID)
 		if OrgRole == "" || roleErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		_, err := s.database.TeamAddUser(TeamID, User.UserID, Role)
+		_, err := s.database.TeamAddUser(r.Context(), TeamID, User.UserID, Role)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -240,3 +240,19 @@ func (s *server) handleOrganizationTeamAddUser() http.HandlerFunc {
 		return
 	}
 }
+
+// handleGetOrganizationAnalytics gets a trend report across the retrospectives of the organizations teams
+func (s *server) handleGetOrganizationAnalytics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		OrgID := vars["orgId"]
+
+		Analytics, err := s.database.OrganizationAnalytics(r.Context(), OrgID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Analytics)
+	}
+}
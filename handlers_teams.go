@@ -1,11 +1,18 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/tracker"
 	"github.com/gorilla/mux"
 )
 
@@ -20,7 +27,7 @@ func (s *server) handleGetTeamByUser() http.HandlerFunc {
 		TeamRole := r.Context().Value(contextKeyTeamRole).(string)
 		TeamID := vars["teamId"]
 
-		Team, err := s.database.TeamGet(TeamID)
+		Team, err := s.database.TeamGet(r.Context(), TeamID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -41,7 +48,7 @@ func (s *server) handleGetTeamsByUser() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Organizations := s.database.TeamListByUser(UserID, Limit, Offset)
+		Organizations := s.database.TeamListByUser(r.Context(), UserID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Organizations)
 	}
@@ -55,7 +62,7 @@ func (s *server) handleGetTeamUsers() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Teams := s.database.TeamUserList(TeamID, Limit, Offset)
+		Teams := s.database.TeamUserList(r.Context(), TeamID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Teams)
 	}
@@ -72,7 +79,7 @@ func (s *server) handleCreateTeam() http.HandlerFunc {
 		keyVal := s.getJSONRequestBody(r, w)
 
 		TeamName := keyVal["name"].(string)
-		TeamID, err := s.database.TeamCreate(UserID, TeamName)
+		TeamID, err := s.database.TeamCreate(r.Context(), UserID, TeamName)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -96,13 +103,13 @@ func (s *server) handleTeamAddUser() http.HandlerFunc {
 		UserEmail := strings.ToLower(keyVal["email"].(string))
 		Role := keyVal["role"].(string)
 
-		User, UserErr := s.database.GetUserByEmail(UserEmail)
+		User, UserErr := s.database.GetUserByEmail(r.Context(), UserEmail)
 		if UserErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		_, err := s.database.TeamAddUser(TeamID, User.UserID, Role)
+		_, err := s.database.TeamAddUser(r.Context(), TeamID, User.UserID, Role)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -121,7 +128,7 @@ func (s *server) handleTeamRemoveUser() http.HandlerFunc {
 		TeamID := vars["teamId"]
 		UserID := keyVal["id"].(string)
 
-		err := s.database.TeamRemoveUser(TeamID, UserID)
+		err := s.database.TeamRemoveUser(r.Context(), TeamID, UserID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -139,7 +146,7 @@ func (s *server) handleGetTeamRetrospectives() http.HandlerFunc {
 		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
-		Retrospectives := s.database.TeamRetrospectiveList(TeamID, Limit, Offset)
+		Retrospectives := s.database.TeamRetrospectiveList(r.Context(), TeamID, Limit, Offset)
 
 		s.respondWithJSON(w, http.StatusOK, Retrospectives)
 	}
@@ -154,7 +161,7 @@ func (s *server) handleTeamRemoveRetrospective() http.HandlerFunc {
 		TeamID := vars["teamId"]
 		RetrospectiveID := keyVal["id"].(string)
 
-		err := s.database.TeamRemoveRetrospective(TeamID, RetrospectiveID)
+		err := s.database.TeamRemoveRetrospective(r.Context(), TeamID, RetrospectiveID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -170,7 +177,7 @@ func (s *server) handleDeleteTeam() http.HandlerFunc {
 		keyVal := s.getJSONRequestBody(r, w)
 		TeamID := keyVal["id"].(string)
 
-		err := s.database.TeamDelete(TeamID)
+		err := s.database.TeamDelete(r.Context(), TeamID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -179,3 +186,331 @@ func (s *server) handleDeleteTeam() http.HandlerFunc {
 		return
 	}
 }
+
+// handleGetTeamSchedules gets a list of recurring retrospective schedules for the team
+func (s *server) handleGetTeamSchedules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		Schedules := s.database.TeamScheduleList(r.Context(), TeamID)
+
+		s.respondWithJSON(w, http.StatusOK, Schedules)
+	}
+}
+
+// handleTeamScheduleCreate handles creating a recurring retrospective schedule owned by the current user
+func (s *server) handleTeamScheduleCreate() http.HandlerFunc {
+	type CreateScheduleResponse struct {
+		ScheduleID string `json:"id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID := r.Context().Value(contextKeyUserID).(string)
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		body, bodyErr := ioutil.ReadAll(r.Body)
+		if bodyErr != nil {
+			logging.FromContext(r.Context()).Error("error in reading request body", "error", bodyErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var keyVal struct {
+			Name          string    `json:"name"`
+			IntervalWeeks int       `json:"intervalWeeks"`
+			StartDate     time.Time `json:"startDate"`
+		}
+		if err := json.Unmarshal(body, &keyVal); err != nil || keyVal.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ScheduleID, err := s.database.TeamScheduleCreate(r.Context(), TeamID, UserID, keyVal.Name, keyVal.IntervalWeeks, keyVal.StartDate)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var NewSchedule = &CreateScheduleResponse{
+			ScheduleID: ScheduleID,
+		}
+
+		s.respondWithJSON(w, http.StatusOK, NewSchedule)
+	}
+}
+
+// handleTeamScheduleUpdate handles pausing or resuming a teams recurring retrospective schedule
+func (s *server) handleTeamScheduleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		ScheduleID, _ := keyVal["id"].(string)
+		Active, ok := keyVal["active"].(bool)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := s.database.TeamScheduleUpdateActive(r.Context(), TeamID, ScheduleID, Active)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// handleTeamScheduleDelete handles deleting a teams recurring retrospective schedule
+func (s *server) handleTeamScheduleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		ScheduleID := keyVal["id"].(string)
+
+		err := s.database.TeamScheduleDelete(r.Context(), TeamID, ScheduleID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// handleGetTeamIntegrations gets a list of the teams chat integrations
+func (s *server) handleGetTeamIntegrations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		Integrations := s.database.TeamIntegrationList(r.Context(), TeamID)
+
+		s.respondWithJSON(w, http.StatusOK, Integrations)
+	}
+}
+
+// handleTeamIntegrationCreate handles adding a chat incoming webhook to the team
+func (s *server) handleTeamIntegrationCreate() http.HandlerFunc {
+	type CreateIntegrationResponse struct {
+		IntegrationID string `json:"id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		WebhookURL, _ := keyVal["webhookUrl"].(string)
+		Format, _ := keyVal["format"].(string)
+
+		IntegrationID, err := s.database.TeamIntegrationCreate(r.Context(), TeamID, WebhookURL, Format)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var NewIntegration = &CreateIntegrationResponse{
+			IntegrationID: IntegrationID,
+		}
+
+		s.respondWithJSON(w, http.StatusOK, NewIntegration)
+	}
+}
+
+// handleTeamIntegrationUpdate handles updating a teams chat integration webhook url, format or pausing it
+func (s *server) handleTeamIntegrationUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		IntegrationID, _ := keyVal["id"].(string)
+		WebhookURL, _ := keyVal["webhookUrl"].(string)
+		Format, _ := keyVal["format"].(string)
+		Active, ok := keyVal["active"].(bool)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := s.database.TeamIntegrationUpdate(r.Context(), TeamID, IntegrationID, WebhookURL, Format, Active)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+}
+
+// handleTeamIntegrationDelete handles deleting a teams chat integration
+func (s *server) handleTeamIntegrationDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		IntegrationID, _ := keyVal["id"].(string)
+
+		err := s.database.TeamIntegrationDelete(r.Context(), TeamID, IntegrationID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// handleGetTeamTrackers gets a list of the teams issue trackers
+func (s *server) handleGetTeamTrackers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		Trackers := s.database.TeamTrackerList(r.Context(), TeamID)
+
+		s.respondWithJSON(w, http.StatusOK, Trackers)
+	}
+}
+
+// handleTeamTrackerCreate handles adding an issue tracker project to the team
+func (s *server) handleTeamTrackerCreate() http.HandlerFunc {
+	type CreateTrackerResponse struct {
+		TrackerID string `json:"id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		Provider, _ := keyVal["provider"].(string)
+		BaseURL, _ := keyVal["baseUrl"].(string)
+		Project, _ := keyVal["project"].(string)
+		Username, _ := keyVal["username"].(string)
+		Token, _ := keyVal["token"].(string)
+
+		TrackerID, err := s.database.TeamTrackerCreate(r.Context(), TeamID, Provider, BaseURL, Project, Username, Token)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var NewTracker = &CreateTrackerResponse{
+			TrackerID: TrackerID,
+		}
+
+		s.respondWithJSON(w, http.StatusOK, NewTracker)
+	}
+}
+
+// handleTeamTrackerUpdate handles updating or pausing a teams issue tracker, the token is only changed when given
+// and must be given when the provider or base url changes
+func (s *server) handleTeamTrackerUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		TrackerID, _ := keyVal["id"].(string)
+		Provider, _ := keyVal["provider"].(string)
+		BaseURL, _ := keyVal["baseUrl"].(string)
+		Project, _ := keyVal["project"].(string)
+		Username, _ := keyVal["username"].(string)
+		Token, _ := keyVal["token"].(string)
+		Active, ok := keyVal["active"].(bool)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := s.database.TeamTrackerUpdate(r.Context(), TeamID, TrackerID, Provider, BaseURL, Project, Username, Token, Active)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+}
+
+// handleTeamTrackerDelete handles deleting a teams issue tracker
+func (s *server) handleTeamTrackerDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyVal := s.getJSONRequestBody(r, w)
+
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		TrackerID, _ := keyVal["id"].(string)
+
+		err := s.database.TeamTrackerDelete(r.Context(), TeamID, TrackerID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// handleTrackerWebhook handles issue tracker webhook events, completing the actions of closed tickets,
+// events are authenticated by the trackers webhook secret instead of a user session
+func (s *server) handleTrackerWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TrackerID := vars["trackerId"]
+
+		body, bodyErr := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if bodyErr != nil {
+			logging.FromContext(r.Context()).Error("error in reading request body", "error", bodyErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		provider := s.trackerProvider(r.Context(), TrackerID)
+		if provider == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		Key, Closed, err := provider.ParseWebhook(r, body)
+		if errors.Is(err, tracker.ErrUnauthorized) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if Closed && Key != "" {
+			s.completeTrackerTicket(r.Context(), TrackerID, Key)
+		}
+
+		return
+	}
+}
+
+// handleGetTeamAnalytics gets a trend report across the teams retrospectives
+func (s *server) handleGetTeamAnalytics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		Analytics, err := s.database.TeamAnalytics(r.Context(), TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.respondWithJSON(w, http.StatusOK, Analytics)
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"bytes"
+	"html/template"
 	"image"
 	"image/png"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/anthonynsimon/bild/transform"
 	"github.com/gorilla/mux"
 	"github.com/ipsn/go-adorable"
@@ -31,9 +32,9 @@ func (s *server) handleUpdatePassword() http.HandlerFunc {
 			return
 		}
 
-		UserName, UserEmail, updateErr := s.database.UserUpdatePassword(userID, UserPassword)
+		UserName, UserEmail, updateErr := s.database.UserUpdatePassword(r.Context(), userID, UserPassword)
 		if updateErr != nil {
-			log.Println("error attempting to update user password : " + updateErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error attempting to update user password", "error", updateErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -56,12 +57,13 @@ func (s *server) handleUserProfile() http.HandlerFunc {
 			return
 		}
 
-		user, warErr := s.database.GetUser(UserID)
+		user, warErr := s.database.GetUser(r.Context(), UserID)
 		if warErr != nil {
-			log.Println("error finding user : " + warErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user", "error", warErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		user.Notifications, _ = s.database.GetUserNotificationPreferences(r.Context(), UserID)
 
 		s.respondWithJSON(w, http.StatusOK, user)
 	}
@@ -86,26 +88,97 @@ func (s *server) handleUserProfileUpdate() http.HandlerFunc {
 			return
 		}
 
-		updateErr := s.database.UpdateUserProfile(UserID, UserName, UserAvatar, Country, Locale, Company, JobTitle)
+		updateErr := s.database.UpdateUserProfile(r.Context(), UserID, UserName, UserAvatar, Country, Locale, Company, JobTitle)
 		if updateErr != nil {
-			log.Println("error attempting to update user profile : " + updateErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error attempting to update user profile", "error", updateErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		// notification preferences are optional so older clients keep their preferences,
+		// preferences missing from notifications are left unchanged
+		if Notifications, ok := keyVal["notifications"].(map[string]interface{}); ok {
+			Preferences, err := s.database.GetUserNotificationPreferences(r.Context(), UserID)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			for key, preference := range map[string]*bool{
+				"invites":        &Preferences.Invites,
+				"retroSummary":   &Preferences.RetroSummary,
+				"actionAssigned": &Preferences.ActionAssigned,
+				"actionDue":      &Preferences.ActionDue,
+				"teamDigest":     &Preferences.TeamDigest,
+			} {
+				if value, ok := Notifications[key].(bool); ok {
+					*preference = value
+				}
+			}
+			if DigestFrequency, ok := Notifications["digestFrequency"].(string); ok {
+				Preferences.DigestFrequency = DigestFrequency
+			}
+
+			if err := s.database.UpdateUserNotificationPreferences(r.Context(), UserID, Preferences); err != nil {
+				logging.FromContext(r.Context()).Error("error attempting to update user notification preferences", "error", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
 		return
 	}
 }
 
+// unsubscribeConfirmTemplate is the page of the unsubscribe link, following a link must not change anything
+// since mail scanners and link previews open them, so the page posts the same one-click unsubscribe as mail clients
+var unsubscribeConfirmTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribe - Wakita</title></head>
+<body>
+<form method="POST" action="{{.}}">
+<p>Unsubscribe from these Wakita emails? You can change your notification preferences in your Wakita profile at any time.</p>
+<input type="hidden" name="List-Unsubscribe" value="One-Click">
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// handleUnsubscribe turns off a notification email (all of them without ?notification=) for the owner of the
+// unsubscribe token in the emails link, without logging in, GET renders a confirmation page
+// and POST (the RFC 8058 one-click unsubscribe of mail clients) unsubscribes
+func (s *server) handleUnsubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := unsubscribeConfirmTemplate.Execute(w, r.URL.RequestURI()); err != nil {
+				logging.FromContext(r.Context()).Error("error rendering unsubscribe confirmation", "error", err)
+			}
+			return
+		}
+
+		vars := mux.Vars(r)
+		Notification := r.URL.Query().Get("notification")
+
+		if err := s.database.UserUnsubscribe(r.Context(), vars["token"], Notification); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("You have been unsubscribed, you can change your notification preferences in your Wakita profile."))
+	}
+}
+
 // handleAccountVerification attempts to verify a users account
 func (s *server) handleAccountVerification() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyVal := s.getJSONRequestBody(r, w)
 		VerifyID := keyVal["verifyId"].(string)
 
-		verifyErr := s.database.VerifyUserAccount(VerifyID)
+		verifyErr := s.database.VerifyUserAccount(r.Context(), VerifyID)
 		if verifyErr != nil {
-			log.Println("error attempting to verify user account : " + verifyErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error attempting to verify user account", "error", verifyErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -126,9 +199,9 @@ func (s *server) handleUserDelete() http.HandlerFunc {
 			return
 		}
 
-		updateErr := s.database.DeleteUser(UserID)
+		updateErr := s.database.DeleteUser(r.Context(), UserID)
 		if updateErr != nil {
-			log.Println("error attempting to delete user : " + updateErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error attempting to delete user", "error", updateErr)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -161,7 +234,7 @@ func (s *server) handleUserAvatar() http.HandlerFunc {
 			var err error
 			avatar, _, err = image.Decode(bytes.NewReader(adorable.PseudoRandom([]byte(UserID))))
 			if err != nil {
-				log.Fatalln(err)
+				logging.FromContext(r.Context()).Error("unable to render avatar", "error", err)
 			}
 		}
 
@@ -169,7 +242,7 @@ func (s *server) handleUserAvatar() http.HandlerFunc {
 		buffer := new(bytes.Buffer)
 
 		if err := png.Encode(buffer, img); err != nil {
-			log.Println("unable to encode image.")
+			logging.FromContext(r.Context()).Error("unable to encode image")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -178,7 +251,7 @@ func (s *server) handleUserAvatar() http.HandlerFunc {
 		w.Header().Set("Content-Length", strconv.Itoa(len(buffer.Bytes())))
 
 		if _, err := w.Write(buffer.Bytes()); err != nil {
-			log.Println("unable to write image.")
+			logging.FromContext(r.Context()).Error("unable to write image")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -188,7 +261,7 @@ func (s *server) handleUserAvatar() http.HandlerFunc {
 // handleGetActiveCountries gets a list of registered users countries
 func (s *server) handleGetActiveCountries() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		countries, err := s.database.GetActiveCountries()
+		countries, err := s.database.GetActiveCountries(r.Context())
 
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
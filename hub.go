@@ -1,14 +1,55 @@
 package main
 
+import (
+	"context"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/gorilla/websocket"
+)
+
 type message struct {
 	data  []byte
 	arena string
 }
 
+// targetedMessage is a message for a single connection to an arena, outside of the arena event history
+type targetedMessage struct {
+	conn  *connection
+	arena string
+	data  []byte
+}
+
 type subscription struct {
 	conn   *connection
 	arena  string
 	userID string
+
+	// logger for the websocket session, carrying the request id of the upgrade request
+	logger *logging.Logger
+
+	// ctx for database calls made by the session, outliving the upgrade request
+	ctx context.Context
+
+	// readOnly sessions (an admin viewing as the user) only receive events, they can't send them
+	// and don't join or retreat the user
+	readOnly bool
+
+	// resume requests the events broadcast after lastSeq instead of a full init
+	resume  bool
+	lastSeq uint64
+
+	// registered receives the result of registering the subscription
+	registered chan registration
+}
+
+// registration is the result of registering a subscription with the hub
+type registration struct {
+	// replayed is true when the missed events were queued to the connection
+	replayed bool
+
+	// seq is the last sequence number broadcast to the arena
+	seq uint64
 }
 
 // hub maintains the set of active connections and broadcasts messages to the
@@ -25,6 +66,54 @@ type hub struct {
 
 	// Unregister requests from connections.
 	unregister chan subscription
+
+	// Recent broadcast events by arena, replayed to reconnecting connections.
+	histories map[string]*eventHistory
+
+	// Drain requests, closes every connection and replies with the subscriptions that were closed.
+	drain chan chan []subscription
+
+	// Whether the hub has been drained, connections registered afterwards are closed immediately.
+	draining bool
+
+	// Messages for specific users by user id, sent to every connection of the user outside of the arena event history.
+	direct chan map[string][]byte
+
+	// Messages for a single connection, sent only while the connection is registered so the writePump stays its only writer.
+	targeted chan targetedMessage
+
+	// Connected user requests, replies with the ids of the users with a connection.
+	users chan chan []string
+
+	// Disconnect requests, closes the matching connections.
+	disconnect chan disconnection
+
+	// Connected arena requests, replies with the ids of the arenas with a connection.
+	arenaIDs chan chan []string
+}
+
+// disconnection closes the connections to an arena, a users own connections, an impersonation sessions connections
+// or a combination of them with closeMessage
+type disconnection struct {
+	arena           string
+	userID          string
+	impersonationID string
+	closeMessage    []byte
+}
+
+// matches reports whether the connection to the arena is closed by the disconnection
+func (d disconnection) matches(arena string, c *connection) bool {
+	if d.arena != "" && d.arena != arena {
+		return false
+	}
+	if d.impersonationID != "" {
+		return c.impersonationID == d.impersonationID
+	}
+	if d.userID != "" {
+		return c.userID == d.userID && c.impersonationID == ""
+	}
+
+	return d.arena != ""
 }
 
 var h = hub{
@@ -32,9 +121,31 @@ var h = hub{
 	register:   make(chan subscription),
 	unregister: make(chan subscription),
 	arenas:     make(map[string]map[*connection]bool),
+	histories:  make(map[string]*eventHistory),
+	drain:      make(chan chan []subscription),
+	direct:     make(chan map[string][]byte),
+	targeted:   make(chan targetedMessage),
+	users:      make(chan chan []string),
+	disconnect: make(chan disconnection),
+	arenaIDs:   make(chan chan []string),
 }
 
+// closeServerRestarting is sent to connections closed by draining the hub so clients reconnect with backoff
+var closeServerRestarting = websocket.FormatCloseMessage(4005, "server restarting")
+
+// closeUserSuspended is sent to the connections of a user when they are suspended
+var closeUserSuspended = websocket.FormatCloseMessage(4006, "user suspended")
+
+// closeImpersonationEnded is sent to an admins "view as user" connections when the impersonation ends or expires
+var closeImpersonationEnded = websocket.FormatCloseMessage(4007, "impersonation ended")
+
+// closeRetrospectiveClosed is sent to the connections of a retrospective force closed by an admin
+var closeRetrospectiveClosed = websocket.FormatCloseMessage(4008, "retrospective closed")
+
 func (h *hub) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case s := <-h.register:
@@ -44,6 +155,34 @@ func (h *hub) run() {
 				h.arenas[s.arena] = connections
 			}
 			h.arenas[s.arena][s.conn] = true
+
+			var r registration
+			if h.draining {
+				delete(connections, s.conn)
+				if len(connections) == 0 {
+					delete(h.arenas, s.arena)
+				}
+				s.conn.closeMessage = closeServerRestarting
+				close(s.conn.send)
+				if s.registered != nil {
+					s.registered <- r
+				}
+				continue
+			}
+			if history, ok := h.histories[s.arena]; ok {
+				r.seq = history.seq
+				if s.resume {
+					if events, ok := history.since(s.lastSeq); ok && len(events) < cap(s.conn.send) {
+						for _, event := range events {
+							s.conn.send <- event
+						}
+						r.replayed = true
+					}
+				}
+			}
+			if s.registered != nil {
+				s.registered <- r
+			}
 		case s := <-h.unregister:
 			connections := h.arenas[s.arena]
 			if connections != nil {
@@ -56,10 +195,17 @@ func (h *hub) run() {
 				}
 			}
 		case m := <-h.broadcast:
+			history, ok := h.histories[m.arena]
+			if !ok {
+				history = newEventHistory()
+				h.histories[m.arena] = history
+			}
+			data := history.add(m.data)
+
 			connections := h.arenas[m.arena]
 			for c := range connections {
 				select {
-				case c.send <- m.data:
+				case c.send <- data:
 				default:
 					close(c.send)
 					delete(connections, c)
@@ -68,6 +214,104 @@ func (h *hub) run() {
 					}
 				}
 			}
+		case reply := <-h.drain:
+			h.draining = true
+			drained := make([]subscription, 0)
+			for arena, connections := range h.arenas {
+				for c := range connections {
+					c.closeMessage = closeServerRestarting
+					close(c.send)
+					drained = append(drained, subscription{conn: c, arena: arena, userID: c.userID, readOnly: c.impersonationID != ""})
+				}
+				delete(h.arenas, arena)
+			}
+			reply <- drained
+		case messages := <-h.direct:
+			for arena, connections := range h.arenas {
+				for c := range connections {
+					data, ok := messages[c.userID]
+					if !ok {
+						continue
+					}
+					select {
+					case c.send <- data:
+					default:
+						close(c.send)
+						delete(connections, c)
+						if len(connections) == 0 {
+							delete(h.arenas, arena)
+						}
+					}
+				}
+			}
+		case m := <-h.targeted:
+			connections := h.arenas[m.arena]
+			if _, ok := connections[m.conn]; !ok {
+				continue
+			}
+			select {
+			case m.conn.send <- m.data:
+			default:
+				close(m.conn.send)
+				delete(connections, m.conn)
+				if len(connections) == 0 {
+					delete(h.arenas, m.arena)
+				}
+			}
+		case reply := <-h.users:
+			seen := make(map[string]bool)
+			userIDs := make([]string, 0)
+			for _, connections := range h.arenas {
+				for c := range connections {
+					if !seen[c.userID] {
+						seen[c.userID] = true
+						userIDs = append(userIDs, c.userID)
+					}
+				}
+			}
+			reply <- userIDs
+		case d := <-h.disconnect:
+			for arena, connections := range h.arenas {
+				for c := range connections {
+					if !d.matches(arena, c) {
+						continue
+					}
+					c.closeMessage = d.closeMessage
+					close(c.send)
+					delete(connections, c)
+				}
+				if len(connections) == 0 {
+					delete(h.arenas, arena)
+				}
+			}
+		case reply := <-h.arenaIDs:
+			arenaIDs := make([]string, 0, len(h.arenas))
+			for arena := range h.arenas {
+				arenaIDs = append(arenaIDs, arena)
+			}
+			reply <- arenaIDs
+		case <-ticker.C:
+			for arena, history := range h.histories {
+				if _, active := h.arenas[arena]; !active && time.Since(history.updated) > eventHistoryTTL {
+					delete(h.histories, arena)
+				}
+			}
 		}
 	}
 }
+
+// connectedUsers gets the ids of the users with an open connection
+func (h *hub) connectedUsers() []string {
+	reply := make(chan []string)
+	h.users <- reply
+
+	return <-reply
+}
+
+// connectedArenas gets the ids of the arenas with an open connection
+func (h *hub) connectedArenas() []string {
+	reply := make(chan []string)
+	h.arenaIDs <- reply
+
+	return <-reply
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/spf13/viper"
+)
+
+// Retrospective event types posted to team chat integrations
+const (
+	EventRetrospectiveStarted  = "RETROSPECTIVE_STARTED"
+	EventRetrospectivePhase    = "RETROSPECTIVE_PHASE"
+	EventRetrospectiveFinished = "RETROSPECTIVE_FINISHED"
+)
+
+// phaseNames are the retrospective phases, indexed by phase number
+var phaseNames = map[int]string{
+	1: "Brainstorm",
+	2: "Group & Vote",
+	3: "Discuss & Action Items",
+	4: "Finished",
+}
+
+// Event is a retrospective event posted to a teams chat integration
+type Event struct {
+	Type              string
+	TeamName          string
+	RetrospectiveName string
+	Phase             int
+	// link to the retrospective
+	URL     string
+	Actions []*database.RetrospectiveAction
+}
+
+// Config contains the chat integration values
+type Config struct {
+	AppURL string
+}
+
+// Store is the database team integrations are looked up from, implemented by database.Database
+type Store interface {
+	GetRetrospectiveIntegrations(ctx context.Context, RetrospectiveID string) []*database.TeamIntegration
+}
+
+// Chat posts retrospective events to the incoming webhooks of the teams the retrospective belongs to
+type Chat struct {
+	config *Config
+	store  Store
+	sender Sender
+}
+
+// New creates a new instance of Chat, payloads are posted to the webhooks over http
+func New(AppDomain string, PathPrefix string, store Store) *Chat {
+	var AppURL string = "https://" + AppDomain + PathPrefix + "/"
+
+	return NewWithSender(AppURL, store, NewHTTPSender(time.Duration(viper.GetInt("chat.timeout"))*time.Second))
+}
+
+// NewWithSender creates a new instance of Chat that delivers payloads with sender
+func NewWithSender(AppURL string, store Store, sender Sender) *Chat {
+	return &Chat{
+		config: &Config{
+			AppURL: AppURL,
+		},
+		store:  store,
+		sender: sender,
+	}
+}
+
+// RetrospectiveStarted posts a link to the newly started retrospective
+func (c *Chat) RetrospectiveStarted(ctx context.Context, Retrospective *database.Retrospective) {
+	c.post(ctx, Retrospective, EventRetrospectiveStarted)
+}
+
+// RetrospectivePhase posts the retrospective's new phase
+func (c *Chat) RetrospectivePhase(ctx context.Context, Retrospective *database.Retrospective) {
+	c.post(ctx, Retrospective, EventRetrospectivePhase)
+}
+
+// RetrospectiveFinished posts a summary of the finished retrospective with its action items
+func (c *Chat) RetrospectiveFinished(ctx context.Context, Retrospective *database.Retrospective) {
+	c.post(ctx, Retrospective, EventRetrospectiveFinished)
+}
+
+// post formats and sends the event to each of the retrospective's team integrations,
+// failures are logged and don't stop delivery to the other integrations
+func (c *Chat) post(ctx context.Context, Retrospective *database.Retrospective, EventType string) {
+	for _, Integration := range c.store.GetRetrospectiveIntegrations(ctx, Retrospective.RetrospectiveID) {
+		event := &Event{
+			Type:              EventType,
+			TeamName:          Integration.TeamName,
+			RetrospectiveName: Retrospective.RetrospectiveName,
+			Phase:             Retrospective.Phase,
+			URL:               c.config.AppURL + "retrospective/" + Retrospective.RetrospectiveID,
+			Actions:           Retrospective.ActionItems,
+		}
+
+		if err := c.Send(ctx, Integration, event); err != nil {
+			logging.FromContext(ctx).Error("error posting chat integration event",
+				"integration_id", Integration.IntegrationID,
+				"team_id", Integration.TeamID,
+				"event", EventType,
+				"error", err,
+			)
+		}
+	}
+}
+
+// Send formats the event for the integration and posts it to its webhook
+func (c *Chat) Send(ctx context.Context, Integration *database.TeamIntegration, e *Event) error {
+	formatter, err := NewFormatter(Integration.Format)
+	if err != nil {
+		return err
+	}
+
+	payload, err := formatter.Format(e)
+	if err != nil {
+		return err
+	}
+
+	return c.sender.Send(ctx, Integration.WebhookURL, payload)
+}
@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/outbound"
+)
+
+// webhookRequest is a request received by the fake webhook
+type webhookRequest struct {
+	method      string
+	contentType string
+	body        []byte
+}
+
+// newWebhook starts a fake incoming webhook responding with status, its requests are sent to the returned channel while it has room
+func newWebhook(t *testing.T, status int) (*httptest.Server, chan webhookRequest) {
+	requests := make(chan webhookRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		select {
+		case requests <- webhookRequest{method: r.Method, contentType: r.Header.Get("Content-Type"), body: body}:
+		default:
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, requests
+}
+
+func TestChatSendFormats(t *testing.T) {
+	event := &Event{
+		Type:              EventRetrospectiveFinished,
+		TeamName:          "R&D",
+		RetrospectiveName: "Sprint *42*",
+		Phase:             4,
+		URL:               "https://wakita.test/retrospective/42",
+		Actions: []*database.RetrospectiveAction{
+			{Content: "Fix <flaky> tests", AssigneeName: "Thor", DueDate: "2026-11-02"},
+			{Content: "Pair more"},
+		},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: database.IntegrationFormatSlack,
+			want: `{
+				"text": "R&amp;D retrospective Sprint *42* has finished with 2 action items",
+				"blocks": [
+					{"type": "section", "text": {"type": "mrkdwn", "text": "*R&amp;D* retrospective *Sprint *42** has finished with 2 action items"}},
+					{"type": "section", "text": {"type": "mrkdwn", "text": "• Fix &lt;flaky&gt; tests _Thor, due 2026-11-02_\n• Pair more _Unassigned_\n"}},
+					{"type": "actions", "elements": [
+						{"type": "button", "text": {"type": "plain_text", "text": "View retrospective"}, "url": "https://wakita.test/retrospective/42"}
+					]}
+				]
+			}`,
+		},
+		{
+			format: database.IntegrationFormatTeams,
+			want: `{
+				"@type": "MessageCard",
+				"@context": "https://schema.org/extensions",
+				"summary": "R&D retrospective Sprint *42* has finished with 2 action items",
+				"themeColor": "22BC66",
+				"text": "**R&D** retrospective **Sprint \\*42\\*** has finished with 2 action items",
+				"sections": [
+					{"facts": [
+						{"name": "Fix \\<flaky\\> tests", "value": "Thor, due 2026-11-02"},
+						{"name": "Pair more", "value": "Unassigned"}
+					]}
+				],
+				"potentialAction": [
+					{"@type": "OpenUri", "name": "View retrospective", "targets": [{"os": "default", "uri": "https://wakita.test/retrospective/42"}]}
+				]
+			}`,
+		},
+		{
+			format: database.IntegrationFormatMattermost,
+			want: `{
+				"username": "Wakita",
+				"text": "**R&D** retrospective **Sprint \\*42\\*** has finished with 2 action items\n- Fix \\<flaky\\> tests _Thor, due 2026-11-02_\n- Pair more _Unassigned_\n[View retrospective](https://wakita.test/retrospective/42)"
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			srv, requests := newWebhook(t, http.StatusOK)
+			c := NewWithSender("https://wakita.test/", nil, &HTTPSender{client: srv.Client()})
+
+			if err := c.Send(context.Background(), &database.TeamIntegration{Format: tt.format, WebhookURL: srv.URL}, event); err != nil {
+				t.Fatalf("Send() = %v", err)
+			}
+
+			req := <-requests
+			if req.method != http.MethodPost || req.contentType != "application/json" {
+				t.Errorf("webhook request = %s %s, want POST application/json", req.method, req.contentType)
+			}
+
+			var got, want interface{}
+			if err := json.Unmarshal(req.body, &got); err != nil {
+				t.Fatalf("payload %s is not json: %v", req.body, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("payload = %s, want %s", req.body, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatSendUnsupportedFormat(t *testing.T) {
+	srv, requests := newWebhook(t, http.StatusOK)
+	c := NewWithSender("https://wakita.test/", nil, &HTTPSender{client: srv.Client()})
+
+	if err := c.Send(context.Background(), &database.TeamIntegration{Format: "IRC", WebhookURL: srv.URL}, &Event{}); err == nil {
+		t.Errorf("Send() of an unsupported format succeeded")
+	}
+	if len(requests) != 0 {
+		t.Errorf("Send() of an unsupported format posted to the webhook")
+	}
+}
+
+func TestHTTPSenderStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		ok     bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusNoContent, true},
+		{http.StatusBadRequest, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		srv, requests := newWebhook(t, tt.status)
+		sender := &HTTPSender{client: srv.Client()}
+
+		err := sender.Send(context.Background(), srv.URL, []byte(`{"text":"hi"}`))
+		if (err == nil) != tt.ok {
+			t.Errorf("Send() to a webhook responding %d = %v, want ok %v", tt.status, err, tt.ok)
+		}
+		if req := <-requests; string(req.body) != `{"text":"hi"}` {
+			t.Errorf("webhook responding %d received %s", tt.status, req.body)
+		}
+	}
+}
+
+func TestHTTPSenderErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		sender *HTTPSender
+		url    string
+		is     error
+	}{
+		{name: "timeout", sender: &HTTPSender{client: &http.Client{Timeout: 50 * time.Millisecond}}, url: slow.URL},
+		{name: "connection refused", sender: &HTTPSender{client: &http.Client{}}, url: closed.URL},
+		{name: "invalid url", sender: &HTTPSender{client: &http.Client{}}, url: "://hooks"},
+		{name: "loopback address", sender: NewHTTPSender(time.Second), url: slow.URL, is: outbound.ErrBlockedAddress},
+	}
+
+	for _, tt := range tests {
+		err := tt.sender.Send(context.Background(), tt.url, []byte(`{}`))
+		if err == nil {
+			t.Errorf("Send() with a %s succeeded", tt.name)
+			continue
+		}
+		if tt.is != nil && !errors.Is(err, tt.is) {
+			t.Errorf("Send() with a %s = %v, want %v", tt.name, err, tt.is)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+)
+
+// Formatter renders an event as a chat incoming webhook payload
+type Formatter interface {
+	Format(e *Event) ([]byte, error)
+}
+
+// NewFormatter gets the Formatter of a team integration format
+func NewFormatter(Format string) (Formatter, error) {
+	switch Format {
+	case database.IntegrationFormatSlack:
+		return slackFormatter{}, nil
+	case database.IntegrationFormatTeams:
+		return teamsFormatter{}, nil
+	case database.IntegrationFormatMattermost:
+		return mattermostFormatter{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported chat integration format %q", Format)
+}
+
+// message is the chat service independent content of an event
+type message struct {
+	// summary with two %s verbs, for the team and retrospective names which formatters emphasize
+	template string
+	team     string
+	name     string
+	items    []messageItem
+	linkText string
+	url      string
+}
+
+// messageItem is an action item listed in a message
+type messageItem struct {
+	text   string
+	detail string
+}
+
+// newMessage builds the content posted for the event
+func newMessage(e *Event) *message {
+	m := &message{
+		team: e.TeamName,
+		name: e.RetrospectiveName,
+		url:  e.URL,
+	}
+
+	switch e.Type {
+	case EventRetrospectiveStarted:
+		m.template = "%s retrospective %s has started"
+		m.linkText = "Join retrospective"
+	case EventRetrospectiveFinished:
+		m.template = "%s retrospective %s has finished with " + strconv.Itoa(len(e.Actions)) + " action items"
+		m.linkText = "View retrospective"
+		for _, action := range e.Actions {
+			detail := action.AssigneeName
+			if detail == "" {
+				detail = "Unassigned"
+			}
+			if action.DueDate != "" {
+				detail = detail + ", due " + action.DueDate
+			}
+			m.items = append(m.items, messageItem{text: action.Content, detail: detail})
+		}
+	default:
+		phase, ok := phaseNames[e.Phase]
+		if !ok {
+			phase = "phase " + strconv.Itoa(e.Phase)
+		}
+		m.template = "%s retrospective %s moved to " + strings.Replace(phase, "%", "%%", -1)
+		m.linkText = "Open retrospective"
+	}
+
+	return m
+}
+
+// summary renders the message summary escaped with escape, emphasizing the team and retrospective names with emphasize
+func (m *message) summary(escape func(string) string, emphasize func(string) string) string {
+	return fmt.Sprintf(escape(m.template), emphasize(m.team), emphasize(m.name))
+}
+
+// plain leaves text as is
+func plain(text string) string {
+	return text
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackFormatter renders Slack Block Kit messages
+type slackFormatter struct{}
+
+func (slackFormatter) Format(e *Event) ([]byte, error) {
+	m := newMessage(e)
+
+	type text struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type element struct {
+		Type string `json:"type"`
+		Text text   `json:"text"`
+		URL  string `json:"url"`
+	}
+	type block struct {
+		Type     string    `json:"type"`
+		Text     *text     `json:"text,omitempty"`
+		Elements []element `json:"elements,omitempty"`
+	}
+
+	blocks := []block{
+		{Type: "section", Text: &text{Type: "mrkdwn", Text: m.summary(slackEscaper.Replace, func(s string) string {
+			return "*" + slackEscaper.Replace(s) + "*"
+		})}},
+	}
+
+	if len(m.items) > 0 {
+		var list strings.Builder
+		for _, item := range m.items {
+			list.WriteString("• " + slackEscaper.Replace(item.text) + " _" + slackEscaper.Replace(item.detail) + "_\n")
+		}
+		blocks = append(blocks, block{Type: "section", Text: &text{Type: "mrkdwn", Text: list.String()}})
+	}
+
+	blocks = append(blocks, block{Type: "actions", Elements: []element{
+		{Type: "button", Text: text{Type: "plain_text", Text: m.linkText}, URL: m.url},
+	}})
+
+	return json.Marshal(struct {
+		Text   string  `json:"text"`
+		Blocks []block `json:"blocks"`
+	}{
+		// fallback for notifications and clients that can't render blocks
+		Text:   m.summary(slackEscaper.Replace, slackEscaper.Replace),
+		Blocks: blocks,
+	})
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+)
+
+// teamsFormatter renders Microsoft Teams (Office 365 connector) MessageCards
+type teamsFormatter struct{}
+
+func (teamsFormatter) Format(e *Event) ([]byte, error) {
+	m := newMessage(e)
+
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type section struct {
+		Facts []fact `json:"facts"`
+	}
+	type target struct {
+		OS  string `json:"os"`
+		URI string `json:"uri"`
+	}
+	type action struct {
+		Type    string   `json:"@type"`
+		Name    string   `json:"name"`
+		Targets []target `json:"targets"`
+	}
+
+	var sections = make([]section, 0)
+	if len(m.items) > 0 {
+		var facts []fact
+		for _, item := range m.items {
+			facts = append(facts, fact{Name: markdownEscaper.Replace(item.text), Value: markdownEscaper.Replace(item.detail)})
+		}
+		sections = append(sections, section{Facts: facts})
+	}
+
+	return json.Marshal(struct {
+		Type            string    `json:"@type"`
+		Context         string    `json:"@context"`
+		Summary         string    `json:"summary"`
+		ThemeColor      string    `json:"themeColor"`
+		Text            string    `json:"text"`
+		Sections        []section `json:"sections"`
+		PotentialAction []action  `json:"potentialAction"`
+	}{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    m.summary(plain, plain),
+		ThemeColor: "22BC66",
+		Text: m.summary(markdownEscaper.Replace, func(s string) string {
+			return "**" + markdownEscaper.Replace(s) + "**"
+		}),
+		Sections: sections,
+		PotentialAction: []action{
+			{Type: "OpenUri", Name: m.linkText, Targets: []target{{OS: "default", URI: m.url}}},
+		},
+	})
+}
+
+// mattermostFormatter renders Mattermost markdown messages
+type mattermostFormatter struct{}
+
+func (mattermostFormatter) Format(e *Event) ([]byte, error) {
+	m := newMessage(e)
+
+	var text strings.Builder
+	text.WriteString(m.summary(markdownEscaper.Replace, func(s string) string {
+		return "**" + markdownEscaper.Replace(s) + "**"
+	}))
+	text.WriteString("\n")
+	for _, item := range m.items {
+		text.WriteString("- " + markdownEscaper.Replace(item.text) + " _" + markdownEscaper.Replace(item.detail) + "_\n")
+	}
+	text.WriteString("[" + m.linkText + "](" + m.url + ")")
+
+	return json.Marshal(struct {
+		Username string `json:"username"`
+		Text     string `json:"text"`
+	}{
+		Username: "Wakita",
+		Text:     text.String(),
+	})
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/outbound"
+)
+
+// Sender delivers a formatted payload to a chat incoming webhook
+type Sender interface {
+	Send(ctx context.Context, WebhookURL string, Payload []byte) error
+}
+
+// HTTPSender posts payloads to incoming webhooks as json
+type HTTPSender struct {
+	client *http.Client
+}
+
+// NewHTTPSender creates a Sender that gives up on webhooks not responding within timeout,
+// webhooks can't reach private or loopback addresses
+func NewHTTPSender(timeout time.Duration) *HTTPSender {
+	return &HTTPSender{
+		client: outbound.NewClient(timeout),
+	}
+}
+
+// Send posts the payload, any non 2xx response is an error
+func (s *HTTPSender) Send(ctx context.Context, WebhookURL string, Payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, WebhookURL, bytes.NewReader(Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
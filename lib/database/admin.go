@@ -1,17 +1,23 @@
 package database
 
 import (
+	"context"
 	"errors"
-	"log"
 	"strings"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
 // ConfirmAdmin confirms whether the user is infact a ADMIN
-func (d *Database) ConfirmAdmin(AdminID string) error {
+func (d *Database) ConfirmAdmin(ctx context.Context, AdminID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var userType string
-	e := d.db.QueryRow("SELECT coalesce(type, '') FROM users WHERE id = $1;", AdminID).Scan(&userType)
+	var Suspended bool
+	e := d.db.QueryRowContext(ctx, "SELECT coalesce(type, ''), suspended FROM users WHERE id = $1;", AdminID).Scan(&userType, &Suspended)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "ConfirmAdmin", "error", e)
 		return errors.New("could not find users type")
 	}
 
@@ -19,14 +25,21 @@ func (d *Database) ConfirmAdmin(AdminID string) error {
 		return errors.New(("user is not an admin"))
 	}
 
+	if Suspended {
+		return ErrUserSuspended
+	}
+
 	return nil
 }
 
 // GetAppStats gets counts of users (registered and unregistered), and retrospectives
-func (d *Database) GetAppStats() (*ApplicationStats, error) {
+func (d *Database) GetAppStats(ctx context.Context) (*ApplicationStats, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var Appstats ApplicationStats
 
-	statsErr := d.db.QueryRow(`
+	statsErr := d.read.QueryRowContext(ctx, `
 		SELECT
 			unregistered_user_count,
 			registered_user_count,
@@ -47,7 +60,7 @@ func (d *Database) GetAppStats() (*ApplicationStats, error) {
 		&Appstats.APIKeyCount,
 	)
 	if statsErr != nil {
-		log.Println("Unable to get application stats: ", statsErr)
+		logging.FromContext(ctx).Error("Unable to get application stats", "error", statsErr)
 		return nil, statsErr
 	}
 
@@ -55,12 +68,15 @@ func (d *Database) GetAppStats() (*ApplicationStats, error) {
 }
 
 // PromoteUser promotes a user to ADMIN type
-func (d *Database) PromoteUser(UserID string) error {
-	if _, err := d.db.Exec(
+func (d *Database) PromoteUser(ctx context.Context, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`call promote_user($1);`,
 		UserID,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "PromoteUser", "user_id", UserID, "error", err)
 		return errors.New("error attempting to promote user to ADMIN")
 	}
 
@@ -68,12 +84,15 @@ func (d *Database) PromoteUser(UserID string) error {
 }
 
 // DemoteUser demotes a user to REGISTERED type
-func (d *Database) DemoteUser(UserID string) error {
-	if _, err := d.db.Exec(
+func (d *Database) DemoteUser(ctx context.Context, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`call demote_user($1);`,
 		UserID,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "DemoteUser", "user_id", UserID, "error", err)
 		return errors.New("error attempting to demote user to REGISTERED")
 	}
 
@@ -81,12 +100,15 @@ func (d *Database) DemoteUser(UserID string) error {
 }
 
 // CleanRetrospectives deletes retrospectives older than X days
-func (d *Database) CleanRetrospectives(DaysOld int) error {
-	if _, err := d.db.Exec(
+func (d *Database) CleanRetrospectives(ctx context.Context, DaysOld int) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`call clean_retrospectives($1);`,
 		DaysOld,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "CleanRetrospectives", "error", err)
 		return errors.New("error attempting to clean retrospectives")
 	}
 
@@ -94,12 +116,15 @@ func (d *Database) CleanRetrospectives(DaysOld int) error {
 }
 
 // CleanGuests deletes guest users older than X days
-func (d *Database) CleanGuests(DaysOld int) error {
-	if _, err := d.db.Exec(
+func (d *Database) CleanGuests(ctx context.Context, DaysOld int) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`call clean_guest_users($1);`,
 		DaysOld,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "CleanGuests", "error", err)
 		return errors.New("error attempting to clean Guest Warriors")
 	}
 
@@ -107,9 +132,12 @@ func (d *Database) CleanGuests(DaysOld int) error {
 }
 
 // OrganizationList gets a list of organizations
-func (d *Database) OrganizationList(Limit int, Offset int) []*Organization {
+func (d *Database) OrganizationList(ctx context.Context, Limit int, Offset int) []*Organization {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var organizations = make([]*Organization, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM organization_list($1, $2);`,
 		Limit,
 		Offset,
@@ -126,22 +154,25 @@ func (d *Database) OrganizationList(Limit int, Offset int) []*Organization {
 				&org.CreatedDate,
 				&org.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "OrganizationList", "error", err)
 			} else {
 				organizations = append(organizations, &org)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationList", "error", err)
 	}
 
 	return organizations
 }
 
 // TeamList gets a list of teams
-func (d *Database) TeamList(Limit int, Offset int) []*Team {
+func (d *Database) TeamList(ctx context.Context, Limit int, Offset int) []*Team {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var teams = make([]*Team, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM team_list($1, $2);`,
 		Limit,
 		Offset,
@@ -158,22 +189,25 @@ func (d *Database) TeamList(Limit int, Offset int) []*Team {
 				&team.CreatedDate,
 				&team.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamList", "error", err)
 			} else {
 				teams = append(teams, &team)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamList", "error", err)
 	}
 
 	return teams
 }
 
 // GetAPIKeys gets a list of api keys
-func (d *Database) GetAPIKeys(Limit int, Offset int) []*APIKey {
+func (d *Database) GetAPIKeys(ctx context.Context, Limit int, Offset int) []*APIKey {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var APIKeys = make([]*APIKey, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT apk.id, apk.name, u.email, apk.active, apk.created_date, apk.updated_date
 		FROM api_keys apk
 		LEFT JOIN users u ON apk.user_id = u.id
@@ -197,7 +231,7 @@ func (d *Database) GetAPIKeys(Limit int, Offset int) []*APIKey {
 				&ak.CreatedDate,
 				&ak.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "GetAPIKeys", "error", err)
 			} else {
 				splitKey := strings.Split(key, ".")
 				ak.Prefix = splitKey[0]
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
+)
+
+// ErrRetrospectiveClosed is returned for retrospectives force closed by an admin, which can't be joined until reopened
+var ErrRetrospectiveClosed = errors.New("retrospective is closed")
+
+// AdminRetrospectiveList gets the retrospectives whose name or owners name contains Search (case insensitive),
+// only the ones with active users when Active is set, most recently active first
+func (d *Database) AdminRetrospectiveList(ctx context.Context, Search string, Active bool, Limit int, Offset int) []*AdminRetrospective {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var Pattern string
+	if Search = strings.TrimSpace(Search); Search != "" {
+		Pattern = "%" + likeEscaper.Replace(strings.ToLower(Search)) + "%"
+	}
+
+	var retrospectives = make([]*AdminRetrospective, 0)
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT r.id, COALESCE(r.name, ''), r.owner_id, COALESCE(u.name, ''), r.phase, r.created_date, r.closed_date,
+			(SELECT COUNT(*) FROM retrospective_user ru WHERE ru.retrospective_id = r.id) AS participant_count,
+			(SELECT COUNT(*) FROM retrospective_user ru WHERE ru.retrospective_id = r.id AND ru.active = true) AS active_count,
+			(SELECT MAX(activity.activity_date) FROM (
+				SELECT r.updated_date AS activity_date
+				UNION ALL
+				SELECT MAX(ri.updated_date) FROM retrospective_item ri WHERE ri.retrospective_id = r.id
+				UNION ALL
+				SELECT MAX(ra.updated_date) FROM retrospective_action ra WHERE ra.retrospective_id = r.id
+			) activity) AS last_activity
+		FROM retrospective r
+		LEFT JOIN users u ON u.id = r.owner_id
+		WHERE ($1 = '' OR LOWER(r.name) LIKE $1 ESCAPE '\' OR LOWER(u.name) LIKE $1 ESCAPE '\')
+			AND ($2 = false OR EXISTS (SELECT 1 FROM retrospective_user ru WHERE ru.retrospective_id = r.id AND ru.active = true))
+		ORDER BY last_activity DESC
+		LIMIT $3
+		OFFSET $4;`,
+		Pattern,
+		Active,
+		Limit,
+		Offset,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "AdminRetrospectiveList", "error", err)
+		return retrospectives
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r AdminRetrospective
+		var OwnerID sql.NullString
+		var ClosedDate sql.NullTime
+		var LastActivity sql.NullTime
+
+		if err := rows.Scan(
+			&r.RetrospectiveID,
+			&r.RetrospectiveName,
+			&OwnerID,
+			&r.OwnerName,
+			&r.Phase,
+			&r.CreatedDate,
+			&ClosedDate,
+			&r.ParticipantCount,
+			&r.ActiveCount,
+			&LastActivity,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "AdminRetrospectiveList", "error", err)
+		} else {
+			if ClosedDate.Valid {
+				r.ClosedDate = &ClosedDate.Time
+			}
+			r.OwnerID = OwnerID.String
+			r.LastActivity = LastActivity.Time
+			retrospectives = append(retrospectives, &r)
+		}
+	}
+
+	return retrospectives
+}
+
+// AdminSetRetrospectiveOwner transfers the retrospective to a new owner, the previous owner stays on as a facilitator
+func (d *Database) AdminSetRetrospectiveOwner(ctx context.Context, RetrospectiveID string, OwnerID string) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var UserExists bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1);`,
+		OwnerID,
+	).Scan(&UserExists); err != nil || !UserExists {
+		return nil, errors.New("User Not found")
+	}
+
+	if _, err := d.GetRetrospective(ctx, RetrospectiveID); err != nil {
+		return nil, errors.New("retrospective not found")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`call set_retrospective_owner($1, $2);`, RetrospectiveID, OwnerID); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "AdminSetRetrospectiveOwner", "retrospective_id", RetrospectiveID, "owner_id", OwnerID, "error", err)
+		return nil, errors.New("Unable to transfer owner")
+	}
+
+	return d.GetRetrospective(ctx, RetrospectiveID)
+}
+
+// RetrospectiveClose force closes the retrospective, marking its users inactive, it can't be joined until reopened
+func (d *Database) RetrospectiveClose(ctx context.Context, RetrospectiveID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE retrospective SET closed_date = NOW() WHERE id = $1 AND closed_date IS NULL;`,
+			RetrospectiveID,
+		)
+		if err != nil {
+			return err
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE retrospective_user SET active = false WHERE retrospective_id = $1;`,
+			RetrospectiveID,
+		)
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return errors.New("retrospective not found or already closed")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveClose", "retrospective_id", RetrospectiveID, "error", err)
+		return errors.New("error closing retrospective")
+	}
+
+	return nil
+}
+
+// RetrospectiveReopen reopens a force closed retrospective
+func (d *Database) RetrospectiveReopen(ctx context.Context, RetrospectiveID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective SET closed_date = NULL WHERE id = $1 AND closed_date IS NOT NULL;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveReopen", "retrospective_id", RetrospectiveID, "error", err)
+		return errors.New("error reopening retrospective")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("retrospective not found or not closed")
+	}
+
+	return nil
+}
+
+// ConfirmRetrospectiveOpen returns ErrRetrospectiveClosed when the retrospective has been force closed
+func (d *Database) ConfirmRetrospectiveOpen(ctx context.Context, RetrospectiveID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var Closed bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT closed_date IS NOT NULL FROM retrospective WHERE id = $1;`,
+		RetrospectiveID,
+	).Scan(&Closed); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ConfirmRetrospectiveOpen", "retrospective_id", RetrospectiveID, "error", err)
+		return errors.New("retrospective not found")
+	}
+
+	if Closed {
+		return ErrRetrospectiveClosed
+	}
+
+	return nil
+}
+
+// GetClosedRetrospectives gets which of the retrospectives have been force closed
+func (d *Database) GetClosedRetrospectives(ctx context.Context, RetrospectiveIDs []string) ([]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var closed = make([]string, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id FROM retrospective WHERE id = ANY($1) AND closed_date IS NOT NULL;`,
+		pq.Array(RetrospectiveIDs),
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetClosedRetrospectives", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var RetrospectiveID string
+		if err := rows.Scan(&RetrospectiveID); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "GetClosedRetrospectives", "error", err)
+			return nil, err
+		}
+		closed = append(closed, RetrospectiveID)
+	}
+
+	return closed, rows.Err()
+}
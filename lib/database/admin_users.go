@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// ErrUserSuspended is returned for suspended users, who can't log in or use their sessions and api keys
+var ErrUserSuspended = errors.New("user is suspended")
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SearchUsers gets the users whose name, email or company contains Search (case insensitive), only users of
+// UserType when set or otherwise registered users (with an email), oldest first
+func (d *Database) SearchUsers(ctx context.Context, Search string, UserType string, Limit int, Offset int) []*User {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var Pattern string
+	if Search = strings.TrimSpace(Search); Search != "" {
+		Pattern = "%" + likeEscaper.Replace(strings.ToLower(Search)) + "%"
+	}
+
+	var users = make([]*User, 0)
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, name, email, type, avatar, verified, country, locale, company, job_title, suspended
+		FROM users
+		WHERE (($2 = '' AND email IS NOT NULL) OR type = $2)
+			AND ($1 = '' OR LOWER(name) LIKE $1 ESCAPE '\' OR LOWER(email) LIKE $1 ESCAPE '\' OR LOWER(company) LIKE $1 ESCAPE '\')
+		ORDER BY created_date
+		LIMIT $3
+		OFFSET $4
+		`,
+		Pattern,
+		UserType,
+		Limit,
+		Offset,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SearchUsers", "error", err)
+		return users
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w User
+		var UserName sql.NullString
+		var userEmail sql.NullString
+		var UserCountry sql.NullString
+		var UserLocale sql.NullString
+		var UserCompany sql.NullString
+		var UserJobTitle sql.NullString
+
+		if err := rows.Scan(&w.UserID,
+			&UserName,
+			&userEmail,
+			&w.UserType,
+			&w.UserAvatar,
+			&w.Verified,
+			&UserCountry,
+			&UserLocale,
+			&UserCompany,
+			&UserJobTitle,
+			&w.Suspended,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "SearchUsers", "error", err)
+		} else {
+			w.UserName = UserName.String
+			w.UserEmail = userEmail.String
+			w.Country = UserCountry.String
+			w.Locale = UserLocale.String
+			w.Company = UserCompany.String
+			w.JobTitle = UserJobTitle.String
+			users = append(users, &w)
+		}
+	}
+
+	return users
+}
+
+// ConfirmUserActive confirms the user exists and isn't suspended, returning ErrUserSuspended when they are
+func (d *Database) ConfirmUserActive(ctx context.Context, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var Suspended bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT suspended FROM users WHERE id = $1;`,
+		UserID,
+	).Scan(&Suspended); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ConfirmUserActive", "user_id", UserID, "error", err)
+		return errors.New("User Not found")
+	}
+
+	if Suspended {
+		return ErrUserSuspended
+	}
+
+	return nil
+}
+
+// SuspendUser suspends or unsuspends a user
+func (d *Database) SuspendUser(ctx context.Context, UserID string, Suspended bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE users SET suspended = $2, updated_date = NOW() WHERE id = $1;`,
+		UserID,
+		Suspended,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SuspendUser", "user_id", UserID, "error", err)
+		return errors.New("error attempting to suspend user")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("User Not found")
+	}
+
+	return nil
+}
+
+// AdminUpdateUser updates a users name and email, the email is only changed when given (guests don't have one)
+// and a changed email has to be verified again
+func (d *Database) AdminUpdateUser(ctx context.Context, UserID string, UserName string, UserEmail string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE users
+		SET name = $2,
+			verified = CASE WHEN $3 = '' OR email IS NULL OR email = $3 THEN verified ELSE false END,
+			email = CASE WHEN email IS NULL THEN email ELSE COALESCE(NULLIF($3, ''), email) END,
+			updated_date = NOW()
+		WHERE id = $1;`,
+		UserID,
+		UserName,
+		strings.ToLower(UserEmail),
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "AdminUpdateUser", "user_id", UserID, "error", err)
+		return errors.New("a user with that email already exists")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return errors.New("User Not found")
+	}
+
+	return nil
+}
+
+// UserVerifyRequest creates a new email verification for an unverified registered user
+func (d *Database) UserVerifyRequest(ctx context.Context, UserID string) (VerifyID string, UserName string, UserEmail string, verifyErr error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		var Verified bool
+		var Name, Email sql.NullString
+		if err := tx.QueryRowContext(ctx,
+			`SELECT name, email, verified FROM users WHERE id = $1;`,
+			UserID,
+		).Scan(&Name, &Email, &Verified); err != nil {
+			return err
+		}
+		if !Email.Valid || Verified {
+			return errors.New("user has no email to verify")
+		}
+		UserName, UserEmail = Name.String, Email.String
+
+		return tx.QueryRowContext(ctx,
+			`INSERT INTO user_verify (user_id) VALUES ($1) RETURNING verify_id;`,
+			UserID,
+		).Scan(&VerifyID)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UserVerifyRequest", "user_id", UserID, "error", err)
+		return "", "", "", errors.New("unable to create email verification")
+	}
+
+	return VerifyID, UserName, UserEmail, nil
+}
+
+// ImpersonationCreate starts an admins read only session as another user, lasting for Timeout or until it is ended,
+// the expiry is computed by the database so it compares with NOW() regardless of the servers clock and time zone
+func (d *Database) ImpersonationCreate(ctx context.Context, AdminID string, UserID string, Reason string, Timeout time.Duration) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if AdminID == UserID {
+		return "", errors.New("admins can't impersonate themselves")
+	}
+
+	var ImpersonationID string
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO user_impersonation (admin_id, user_id, reason, expire_date)
+		SELECT $1, u.id, $3, NOW() + $4 * interval '1 second' FROM users u WHERE u.id = $2
+		RETURNING id;`,
+		AdminID,
+		UserID,
+		Reason,
+		int(Timeout.Seconds()),
+	).Scan(&ImpersonationID)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ImpersonationCreate", "admin_id", AdminID, "user_id", UserID, "error", err)
+		return "", errors.New("User Not found")
+	}
+
+	return ImpersonationID, nil
+}
+
+// GetActiveImpersonation gets the admins impersonation when it hasn't expired or ended and the admin is still an active ADMIN
+func (d *Database) GetActiveImpersonation(ctx context.Context, ImpersonationID string, AdminID string) (*UserImpersonation, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var ui UserImpersonation
+	err := d.db.QueryRowContext(ctx,
+		`SELECT ui.id, ui.admin_id, ui.user_id, ui.reason, ui.created_date, ui.expire_date
+		FROM user_impersonation ui
+		JOIN users a ON a.id = ui.admin_id
+		WHERE ui.id = $1 AND ui.admin_id = $2 AND ui.ended_date IS NULL AND ui.expire_date > NOW()
+			AND a.type = 'ADMIN' AND a.suspended = false;`,
+		ImpersonationID,
+		AdminID,
+	).Scan(&ui.ImpersonationID, &ui.AdminID, &ui.UserID, &ui.Reason, &ui.CreatedDate, &ui.ExpireDate)
+	if err != nil {
+		return nil, errors.New("impersonation not found")
+	}
+
+	return &ui, nil
+}
+
+// ImpersonationEnd ends the admins impersonation
+func (d *Database) ImpersonationEnd(ctx context.Context, ImpersonationID string, AdminID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE user_impersonation SET ended_date = NOW() WHERE id = $1 AND admin_id = $2 AND ended_date IS NULL;`,
+		ImpersonationID,
+		AdminID,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ImpersonationEnd", "impersonation_id", ImpersonationID, "error", err)
+		return errors.New("error attempting to end impersonation")
+	}
+
+	return nil
+}
+
+// ImpersonationList gets the impersonation audit log, newest first
+func (d *Database) ImpersonationList(ctx context.Context, Limit int, Offset int) []*UserImpersonation {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var impersonations = make([]*UserImpersonation, 0)
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT ui.id, ui.admin_id, COALESCE(a.name, ''), ui.user_id, COALESCE(u.name, ''), ui.reason,
+			ui.created_date, ui.expire_date, ui.ended_date
+		FROM user_impersonation ui
+		JOIN users a ON a.id = ui.admin_id
+		JOIN users u ON u.id = ui.user_id
+		ORDER BY ui.created_date DESC
+		LIMIT $1
+		OFFSET $2;`,
+		Limit,
+		Offset,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ImpersonationList", "error", err)
+		return impersonations
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ui UserImpersonation
+		var EndedDate sql.NullTime
+		if err := rows.Scan(
+			&ui.ImpersonationID,
+			&ui.AdminID,
+			&ui.AdminName,
+			&ui.UserID,
+			&ui.UserName,
+			&ui.Reason,
+			&ui.CreatedDate,
+			&ui.ExpireDate,
+			&EndedDate,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "ImpersonationList", "error", err)
+		} else {
+			if EndedDate.Valid {
+				ui.EndedDate = &EndedDate.Time
+			}
+			impersonations = append(impersonations, &ui)
+		}
+	}
+
+	return impersonations
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestImpersonationExpiry(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		admin, _, _ := d.CreateUserRegistered(ctx, "Admin", testEmail("admin"), "password1", "")
+		if err := d.PromoteUser(ctx, admin.UserID); err != nil {
+			t.Fatalf("PromoteUser() = %v", err)
+		}
+		user, _ := d.CreateUserGuest(ctx, "Loki")
+
+		activeID, err := d.ImpersonationCreate(ctx, admin.UserID, user.UserID, "support", time.Hour)
+		if err != nil {
+			t.Fatalf("ImpersonationCreate() = %v", err)
+		}
+		impersonation, err := d.GetActiveImpersonation(ctx, activeID, admin.UserID)
+		if err != nil {
+			t.Fatalf("GetActiveImpersonation() = %v", err)
+		}
+		if left := time.Until(impersonation.ExpireDate); left < 59*time.Minute || left > 61*time.Minute {
+			t.Errorf("GetActiveImpersonation() expires in %v, want an hour", left)
+		}
+
+		expiredID, err := d.ImpersonationCreate(ctx, admin.UserID, user.UserID, "support", 0)
+		if err != nil {
+			t.Fatalf("ImpersonationCreate() = %v", err)
+		}
+		if _, err := d.GetActiveImpersonation(ctx, expiredID, admin.UserID); err == nil {
+			t.Errorf("GetActiveImpersonation() of an expired impersonation succeeded")
+		}
+
+		if _, err := d.ImpersonationCreate(ctx, admin.UserID, admin.UserID, "support", time.Hour); err == nil {
+			t.Errorf("ImpersonationCreate() of the admin themselves succeeded")
+		}
+	})
+}
@@ -1,48 +1,204 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"log"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
 )
 
-// GetActiveAlerts gets alerts from db for UI display
-func (d *Database) GetActiveAlerts() []interface{} {
-	Alerts := make([]interface{}, 0)
+const (
+	// AlertUserTypeGuest targets an alert to guest users
+	AlertUserTypeGuest = "GUEST"
+	// AlertUserTypeRegistered targets an alert to registered users (including admins)
+	AlertUserTypeRegistered = "REGISTERED"
+)
 
-	rows, err := d.db.Query(
-		`SELECT id, name, type, content, active, allow_dismiss, registered_only FROM alert WHERE active IS TRUE;`,
-	)
+// validateAlert checks the alerts targeting and display window, RegisteredOnly is kept in sync with the registered user type
+func validateAlert(RegisteredOnly bool, StartDate *time.Time, EndDate *time.Time, Locale string, UserType string) (bool, string, string, error) {
+	if RegisteredOnly && UserType == "" {
+		UserType = AlertUserTypeRegistered
+	}
+	if UserType != "" && UserType != AlertUserTypeGuest && UserType != AlertUserTypeRegistered {
+		return false, "", "", errors.New("user type must be one of GUEST or REGISTERED")
+	}
 
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var a Alert
-
-			if err := rows.Scan(
-				&a.AlertID,
-				&a.Name,
-				&a.Type,
-				&a.Content,
-				&a.Active,
-				&a.AllowDismiss,
-				&a.RegisteredOnly,
-			); err != nil {
-				log.Println(err)
-			} else {
-				Alerts = append(Alerts, &a)
+	Locale = strings.ToLower(strings.TrimSpace(Locale))
+	if Locale != "" && len(Locale) != 2 {
+		return false, "", "", errors.New("locale must be a two letter language code")
+	}
+
+	if StartDate != nil && EndDate != nil && !EndDate.After(*StartDate) {
+		return false, "", "", errors.New("end date must be after the start date")
+	}
+
+	return UserType == AlertUserTypeRegistered, Locale, UserType, nil
+}
+
+// Targets reports whether the alert is shown to the audience, a nil audience is a visitor without a session
+// who only sees alerts that aren't targeted
+func (a *Alert) Targets(Audience *AlertAudience) bool {
+	UserType := a.UserType
+	if UserType == "" && a.RegisteredOnly {
+		UserType = AlertUserTypeRegistered
+	}
+
+	if Audience == nil {
+		return UserType == "" && a.Locale == "" && a.OrganizationID == ""
+	}
+
+	switch UserType {
+	case AlertUserTypeGuest:
+		if Audience.UserType != "GUEST" {
+			return false
+		}
+	case AlertUserTypeRegistered:
+		if Audience.UserType == "GUEST" {
+			return false
+		}
+	}
+
+	if a.Locale != "" && a.Locale != Audience.Locale {
+		return false
+	}
+
+	if a.OrganizationID != "" {
+		for _, OrganizationID := range Audience.OrganizationIDs {
+			if OrganizationID == a.OrganizationID {
+				return true
 			}
 		}
+		return false
 	}
 
-	return Alerts
+	return true
+}
+
+// alertColumns are the alert columns read by scanAlert
+const alertColumns = `id, name, type, content, active, allow_dismiss, registered_only, created_date, updated_date,
+	start_date, end_date, organization_id, locale, user_type`
+
+// scanAlert scans an alert selected with alertColumns
+func scanAlert(rows *sql.Rows) (*Alert, error) {
+	var a Alert
+	var StartDate, EndDate sql.NullTime
+	var OrganizationID sql.NullString
+
+	if err := rows.Scan(
+		&a.AlertID,
+		&a.Name,
+		&a.Type,
+		&a.Content,
+		&a.Active,
+		&a.AllowDismiss,
+		&a.RegisteredOnly,
+		&a.CreatedDate,
+		&a.UpdatedDate,
+		&StartDate,
+		&EndDate,
+		&OrganizationID,
+		&a.Locale,
+		&a.UserType,
+	); err != nil {
+		return nil, err
+	}
+	if StartDate.Valid {
+		a.StartDate = &StartDate.Time
+	}
+	if EndDate.Valid {
+		a.EndDate = &EndDate.Time
+	}
+	a.OrganizationID = OrganizationID.String
+
+	return &a, nil
+}
+
+// GetActiveAlerts gets the active alerts within their display window from db for UI display
+func (d *Database) GetActiveAlerts(ctx context.Context) ([]*Alert, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	Alerts := make([]*Alert, 0)
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT `+alertColumns+` FROM alert
+		WHERE active IS TRUE
+			AND (start_date IS NULL OR start_date <= NOW())
+			AND (end_date IS NULL OR end_date > NOW())
+		ORDER BY created_date;`,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetActiveAlerts", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "GetActiveAlerts", "error", err)
+			return nil, err
+		}
+		Alerts = append(Alerts, a)
+	}
+
+	return Alerts, rows.Err()
+}
+
+// GetAlertAudiences gets the alert audience of each of the users
+func (d *Database) GetAlertAudiences(ctx context.Context, UserIDs []string) (map[string]*AlertAudience, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	Audiences := make(map[string]*AlertAudience)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT u.id, COALESCE(u.type, 'GUEST'), COALESCE(u.locale, ''), ou.organization_id
+		FROM users u
+		LEFT JOIN organization_user ou ON ou.user_id = u.id
+		WHERE u.id = ANY($1);`,
+		pq.Array(UserIDs),
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetAlertAudiences", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var UserID, UserType, Locale string
+		var OrganizationID sql.NullString
+		if err := rows.Scan(&UserID, &UserType, &Locale, &OrganizationID); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "GetAlertAudiences", "error", err)
+			return nil, err
+		}
+
+		Audience, ok := Audiences[UserID]
+		if !ok {
+			Audience = &AlertAudience{UserType: UserType, Locale: Locale, OrganizationIDs: make([]string, 0)}
+			Audiences[UserID] = Audience
+		}
+		if OrganizationID.Valid {
+			Audience.OrganizationIDs = append(Audience.OrganizationIDs, OrganizationID.String)
+		}
+	}
+
+	return Audiences, rows.Err()
 }
 
 // AlertsList gets alerts from db for admin listing
-func (d *Database) AlertsList(Limit int, Offset int) []interface{} {
+func (d *Database) AlertsList(ctx context.Context, Limit int, Offset int) []interface{} {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	Alerts := make([]interface{}, 0)
 
-	rows, err := d.db.Query(
-		`SELECT id, name, type, content, active, allow_dismiss, registered_only, created_date, updated_date
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT `+alertColumns+`
 		FROM alert
 		LIMIT $1
 		OFFSET $2;
@@ -54,22 +210,11 @@ func (d *Database) AlertsList(Limit int, Offset int) []interface{} {
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var a Alert
-
-			if err := rows.Scan(
-				&a.AlertID,
-				&a.Name,
-				&a.Type,
-				&a.Content,
-				&a.Active,
-				&a.AllowDismiss,
-				&a.RegisteredOnly,
-				&a.CreatedDate,
-				&a.UpdatedDate,
-			); err != nil {
-				log.Println(err)
+			a, err := scanAlert(rows)
+			if err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "AlertsList", "error", err)
 			} else {
-				Alerts = append(Alerts, &a)
+				Alerts = append(Alerts, a)
 			}
 		}
 	}
@@ -78,10 +223,18 @@ func (d *Database) AlertsList(Limit int, Offset int) []interface{} {
 }
 
 // AlertsCreate creates
-func (d *Database) AlertsCreate(Name string, Type string, Content string, Active bool, AllowDismiss bool, RegisteredOnly bool) error {
-	if _, err := d.db.Exec(
-		`INSERT INTO alert (name, type, content, active, allow_dismiss, registered_only)
-		VALUES ($1, $2, $3, $4, $5, $6);
+func (d *Database) AlertsCreate(ctx context.Context, Name string, Type string, Content string, Active bool, AllowDismiss bool, RegisteredOnly bool, StartDate *time.Time, EndDate *time.Time, OrganizationID string, Locale string, UserType string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	RegisteredOnly, Locale, UserType, err := validateAlert(RegisteredOnly, StartDate, EndDate, Locale, UserType)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT INTO alert (name, type, content, active, allow_dismiss, registered_only, start_date, end_date, organization_id, locale, user_type)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
 		`,
 		Name,
 		Type,
@@ -89,8 +242,13 @@ func (d *Database) AlertsCreate(Name string, Type string, Content string, Active
 		Active,
 		AllowDismiss,
 		RegisteredOnly,
+		StartDate,
+		EndDate,
+		sql.NullString{String: OrganizationID, Valid: OrganizationID != ""},
+		Locale,
+		UserType,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "AlertsCreate", "error", err)
 		return errors.New("error attempting to add new alert")
 	}
 
@@ -98,11 +256,20 @@ func (d *Database) AlertsCreate(Name string, Type string, Content string, Active
 }
 
 // AlertsUpdate updates an alert
-func (d *Database) AlertsUpdate(ID string, Name string, Type string, Content string, Active bool, AllowDismiss bool, RegisteredOnly bool) error {
-	if _, err := d.db.Exec(
+func (d *Database) AlertsUpdate(ctx context.Context, ID string, Name string, Type string, Content string, Active bool, AllowDismiss bool, RegisteredOnly bool, StartDate *time.Time, EndDate *time.Time, OrganizationID string, Locale string, UserType string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	RegisteredOnly, Locale, UserType, err := validateAlert(RegisteredOnly, StartDate, EndDate, Locale, UserType)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.db.ExecContext(ctx,
 		`
 		UPDATE alert
-		SET name = $2, type = $3, content = $4, active = $5, allow_dismiss = $6, registered_only = $7
+		SET name = $2, type = $3, content = $4, active = $5, allow_dismiss = $6, registered_only = $7,
+			start_date = $8, end_date = $9, organization_id = $10, locale = $11, user_type = $12, updated_date = NOW()
 		WHERE id = $1;
 		`,
 		ID,
@@ -112,8 +279,13 @@ func (d *Database) AlertsUpdate(ID string, Name string, Type string, Content str
 		Active,
 		AllowDismiss,
 		RegisteredOnly,
+		StartDate,
+		EndDate,
+		sql.NullString{String: OrganizationID, Valid: OrganizationID != ""},
+		Locale,
+		UserType,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "AlertsUpdate", "error", err)
 		return errors.New("error attempting to update alert")
 	}
 
@@ -121,14 +293,17 @@ func (d *Database) AlertsUpdate(ID string, Name string, Type string, Content str
 }
 
 // AlertDelete deletes an alert
-func (d *Database) AlertDelete(AlertID string) error {
-	_, err := d.db.Exec(
+func (d *Database) AlertDelete(ctx context.Context, AlertID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`DELETE FROM alert WHERE id = $1;`,
 		AlertID,
 	)
 
 	if err != nil {
-		log.Println("Unable to delete alert: ", err)
+		logging.FromContext(ctx).Error("Unable to delete alert", "alert_id", AlertID, "error", err)
 		return err
 	}
 
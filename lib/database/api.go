@@ -1,17 +1,19 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"log"
 	"strings"
 	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
 // HashAPIKey hashes the API key using SHA256 (not reversible)
-func (d *Database) HashAPIKey(apikey string) string {
+func (d *Database) HashAPIKey(ctx context.Context, apikey string) string {
 	data := []byte(apikey)
 	hash := sha256.Sum256(data)
 	result := hex.EncodeToString(hash[:])
@@ -36,20 +38,23 @@ func random(length int) (string, error) {
 }
 
 // GenerateAPIKey generates a new API key for a User
-func (d *Database) GenerateAPIKey(UserID string, KeyName string) (*APIKey, error) {
+func (d *Database) GenerateAPIKey(ctx context.Context, UserID string, KeyName string) (*APIKey, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	apiPrefix, prefixErr := random(8)
 	if prefixErr != nil {
 		err := errors.New("error generating api prefix")
-		log.Println(err)
-		log.Println(prefixErr)
+		logging.FromContext(ctx).Error("database query failed", "method", "GenerateAPIKey", "user_id", UserID, "error", err)
+		logging.FromContext(ctx).Error("database query failed", "method", "GenerateAPIKey", "user_id", UserID, "error", prefixErr)
 		return nil, err
 	}
 
 	apiSecret, secretErr := random(32)
 	if secretErr != nil {
 		err := errors.New("error generating api secret")
-		log.Println(err)
-		log.Println(secretErr)
+		logging.FromContext(ctx).Error("database query failed", "method", "GenerateAPIKey", "user_id", UserID, "error", err)
+		logging.FromContext(ctx).Error("database query failed", "method", "GenerateAPIKey", "user_id", UserID, "error", secretErr)
 		return nil, err
 	}
 
@@ -61,17 +66,17 @@ func (d *Database) GenerateAPIKey(UserID string, KeyName string) (*APIKey, error
 		Active:      true,
 		CreatedDate: time.Now(),
 	}
-	hashedKey := d.HashAPIKey(APIKEY.Key)
+	hashedKey := d.HashAPIKey(ctx, APIKEY.Key)
 	keyID := apiPrefix + "." + hashedKey
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`INSERT INTO api_keys (id, name, user_id ) VALUES ($1, $2, $3) RETURNING created_date`,
 		keyID,
 		KeyName,
 		UserID,
 	).Scan(&APIKEY.CreatedDate)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "GenerateAPIKey", "user_id", UserID, "error", e)
 		return nil, errors.New("unable to create new api key")
 	}
 
@@ -79,9 +84,12 @@ func (d *Database) GenerateAPIKey(UserID string, KeyName string) (*APIKey, error
 }
 
 // GetUserAPIKeys gets a list of api keys for a user
-func (d *Database) GetUserAPIKeys(UserID string) ([]*APIKey, error) {
+func (d *Database) GetUserAPIKeys(ctx context.Context, UserID string) ([]*APIKey, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var APIKeys = make([]*APIKey, 0)
-	rows, err := d.db.Query(
+	rows, err := d.db.QueryContext(ctx,
 		"SELECT id, name, user_id, active, created_date, updated_date FROM api_keys WHERE user_id = $1 ORDER BY created_date",
 		UserID,
 	)
@@ -99,7 +107,7 @@ func (d *Database) GetUserAPIKeys(UserID string) ([]*APIKey, error) {
 				&ak.CreatedDate,
 				&ak.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "GetUserAPIKeys", "user_id", UserID, "error", err)
 			} else {
 				splitKey := strings.Split(key, ".")
 				ak.Prefix = splitKey[0]
@@ -113,16 +121,19 @@ func (d *Database) GetUserAPIKeys(UserID string) ([]*APIKey, error) {
 }
 
 // UpdateUserAPIKey updates a users api key (active column only)
-func (d *Database) UpdateUserAPIKey(UserID string, KeyID string, Active bool) ([]*APIKey, error) {
-	if _, err := d.db.Exec(
+func (d *Database) UpdateUserAPIKey(ctx context.Context, UserID string, KeyID string, Active bool) ([]*APIKey, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`UPDATE api_keys SET active = $3, updated_date = NOW() WHERE id = $1 AND user_id = $2;`, KeyID, UserID, Active); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateUserAPIKey", "user_id", UserID, "error", err)
 		return nil, err
 	}
 
-	keys, keysErr := d.GetUserAPIKeys(UserID)
+	keys, keysErr := d.GetUserAPIKeys(ctx, UserID)
 	if keysErr != nil {
-		log.Println(keysErr)
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateUserAPIKey", "user_id", UserID, "error", keysErr)
 		return nil, keysErr
 	}
 
@@ -130,16 +141,19 @@ func (d *Database) UpdateUserAPIKey(UserID string, KeyID string, Active bool) ([
 }
 
 // DeleteUserAPIKey removes a users api key
-func (d *Database) DeleteUserAPIKey(UserID string, KeyID string) ([]*APIKey, error) {
-	if _, err := d.db.Exec(
+func (d *Database) DeleteUserAPIKey(ctx context.Context, UserID string, KeyID string) ([]*APIKey, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`DELETE FROM api_keys WHERE id = $1 AND user_id = $2;`, KeyID, UserID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteUserAPIKey", "user_id", UserID, "error", err)
 		return nil, err
 	}
 
-	keys, keysErr := d.GetUserAPIKeys(UserID)
+	keys, keysErr := d.GetUserAPIKeys(ctx, UserID)
 	if keysErr != nil {
-		log.Println(keysErr)
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteUserAPIKey", "user_id", UserID, "error", keysErr)
 		return nil, keysErr
 	}
 
@@ -147,19 +161,22 @@ func (d *Database) DeleteUserAPIKey(UserID string, KeyID string) ([]*APIKey, err
 }
 
 // ValidateAPIKey checks to see if the API key exists in the database and if so returns UserID
-func (d *Database) ValidateAPIKey(APK string) (UserID string, ValidatationErr error) {
+func (d *Database) ValidateAPIKey(ctx context.Context, APK string) (UserID string, ValidatationErr error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var warID string = ""
 
 	splitKey := strings.Split(APK, ".")
-	hashedKey := d.HashAPIKey(APK)
+	hashedKey := d.HashAPIKey(ctx, APK)
 	keyID := splitKey[0] + "." + hashedKey
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT user_id FROM api_keys WHERE id = $1 AND active = true`,
 		keyID,
 	).Scan(&warID)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "ValidateAPIKey", "error", e)
 		return "", errors.New("active API Key match not found")
 	}
 
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// the most open action items listed in a calendar feed, soonest due first
+const calendarActionLimit = 500
+
+// newCalendarToken generates the secret of a calendar feed url
+func newCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// calendarToken gets the calendar feed token of a user or team row, generating one the first time
+// or when Regenerate is set (invalidating the previous feed url)
+func (d *Database) calendarToken(ctx context.Context, Table string, ID string, Regenerate bool) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	NewToken, err := newCalendarToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `UPDATE ` + Table + ` SET calendar_token = COALESCE(calendar_token, $2) WHERE id = $1 RETURNING calendar_token;`
+	if Regenerate {
+		query = `UPDATE ` + Table + ` SET calendar_token = $2 WHERE id = $1 RETURNING calendar_token;`
+	}
+
+	var Token string
+	if err := d.db.QueryRowContext(ctx, query, ID, NewToken).Scan(&Token); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "calendarToken", "table", Table, "id", ID, "error", err)
+		return "", errors.New("Unable to get calendar token")
+	}
+
+	return Token, nil
+}
+
+// GetUserCalendarToken gets the secret token of the users calendar feed url
+func (d *Database) GetUserCalendarToken(ctx context.Context, UserID string) (string, error) {
+	return d.calendarToken(ctx, "users", UserID, false)
+}
+
+// RegenerateUserCalendarToken replaces the users calendar feed token, the previous feed url stops working
+func (d *Database) RegenerateUserCalendarToken(ctx context.Context, UserID string) (string, error) {
+	return d.calendarToken(ctx, "users", UserID, true)
+}
+
+// GetTeamCalendarToken gets the secret token of the teams calendar feed url
+func (d *Database) GetTeamCalendarToken(ctx context.Context, TeamID string) (string, error) {
+	return d.calendarToken(ctx, "team", TeamID, false)
+}
+
+// RegenerateTeamCalendarToken replaces the teams calendar feed token, the previous feed url stops working
+func (d *Database) RegenerateTeamCalendarToken(ctx context.Context, TeamID string) (string, error) {
+	return d.calendarToken(ctx, "team", TeamID, true)
+}
+
+// GetUserCalendar gets the calendar feed of the user with the token, the schedules of their teams and the open
+// action items with a due date assigned to them or from their teams retrospectives
+func (d *Database) GetUserCalendar(ctx context.Context, Token string) (*CalendarFeed, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var UserID string
+	var Feed = &CalendarFeed{}
+	if err := d.read.QueryRowContext(ctx,
+		`SELECT id, COALESCE(name, '') FROM users WHERE calendar_token = $1;`,
+		Token,
+	).Scan(&UserID, &Feed.Name); err != nil {
+		return nil, errors.New("calendar not found")
+	}
+
+	var err error
+	Feed.Schedules, err = d.calendarSchedules(ctx,
+		`trs.team_id IN (SELECT tu.team_id FROM team_user tu WHERE tu.user_id = $1)`, UserID)
+	if err != nil {
+		return nil, err
+	}
+	Feed.Actions, err = d.calendarActions(ctx,
+		`(ra.assignee_id = $1 OR ra.retrospective_id IN (
+			SELECT tr.retrospective_id FROM team_retrospective tr
+			JOIN team_user tu ON tu.team_id = tr.team_id
+			WHERE tu.user_id = $1
+		))`, UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return Feed, nil
+}
+
+// GetTeamCalendar gets the calendar feed of the team with the token, its schedules and
+// the open action items with a due date from its retrospectives
+func (d *Database) GetTeamCalendar(ctx context.Context, Token string) (*CalendarFeed, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var TeamID string
+	var Feed = &CalendarFeed{}
+	if err := d.read.QueryRowContext(ctx,
+		`SELECT id, COALESCE(name, '') FROM team WHERE calendar_token = $1;`,
+		Token,
+	).Scan(&TeamID, &Feed.Name); err != nil {
+		return nil, errors.New("calendar not found")
+	}
+
+	var err error
+	Feed.Schedules, err = d.calendarSchedules(ctx, `trs.team_id = $1`, TeamID)
+	if err != nil {
+		return nil, err
+	}
+	Feed.Actions, err = d.calendarActions(ctx,
+		`ra.retrospective_id IN (SELECT tr.retrospective_id FROM team_retrospective tr WHERE tr.team_id = $1)`, TeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return Feed, nil
+}
+
+// calendarSchedules gets the active schedules matching the Filter condition on trs (team_retrospective_schedule)
+func (d *Database) calendarSchedules(ctx context.Context, Filter string, ID string) ([]*CalendarSchedule, error) {
+	var schedules = make([]*CalendarSchedule, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT trs.id, trs.team_id, COALESCE(t.name, ''), trs.name, trs.interval_weeks, trs.next_run_date,
+			trs.created_date, trs.updated_date, trs.last_retrospective_id
+		FROM team_retrospective_schedule trs
+		JOIN team t ON t.id = trs.team_id
+		WHERE trs.active = true AND `+Filter+`
+		ORDER BY trs.next_run_date;`,
+		ID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "calendarSchedules", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cs CalendarSchedule
+		var LastRetrospectiveID sql.NullString
+		if err := rows.Scan(
+			&cs.ScheduleID,
+			&cs.TeamID,
+			&cs.TeamName,
+			&cs.Name,
+			&cs.IntervalWeeks,
+			&cs.NextRunDate,
+			&cs.CreatedDate,
+			&cs.UpdatedDate,
+			&LastRetrospectiveID,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "calendarSchedules", "error", err)
+			return nil, err
+		}
+		cs.LastRetrospectiveID = LastRetrospectiveID.String
+		schedules = append(schedules, &cs)
+	}
+
+	return schedules, rows.Err()
+}
+
+// calendarActions gets the open action items with a due date matching the Filter condition on ra (retrospective_action)
+func (d *Database) calendarActions(ctx context.Context, Filter string, ID string) ([]*CalendarAction, error) {
+	var actions = make([]*CalendarAction, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT ra.id, ra.retrospective_id, r.name, ra.content, COALESCE(u.name, ''), ra.due_date, ra.updated_date
+		FROM retrospective_action ra
+		JOIN retrospective r ON r.id = ra.retrospective_id
+		LEFT JOIN users u ON u.id = ra.assignee_id
+		WHERE ra.completed = false AND ra.due_date IS NOT NULL AND `+Filter+`
+		ORDER BY ra.due_date, ra.created_date
+		LIMIT $2;`,
+		ID,
+		calendarActionLimit,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "calendarActions", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ca CalendarAction
+		if err := rows.Scan(
+			&ca.ActionID,
+			&ca.RetrospectiveID,
+			&ca.RetrospectiveName,
+			&ca.Content,
+			&ca.AssigneeName,
+			&ca.DueDate,
+			&ca.UpdatedDate,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "calendarActions", "error", err)
+			return nil, err
+		}
+		actions = append(actions, &ca)
+	}
+
+	return actions, rows.Err()
+}
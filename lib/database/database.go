@@ -1,53 +1,85 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
-	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	_ "github.com/lib/pq" // necessary for postgres
 	"github.com/spf13/viper"
 )
 
+// bounds of the wait between startup connection attempts
+const (
+	connectBackoffMin = time.Second
+	connectBackoffMax = 30 * time.Second
+)
+
 // New runs db migrations, sets up a db connection pool
 // and sets previously active users to false during startup
-func New(AdminEmail string, schemaSQL string) *Database {
+// schemaSQL is applied to postgres and sqliteSchemaSQL to the sqlite db.driver
+func New(AdminEmail string, schemaSQL string, sqliteSchemaSQL string) *Database {
 	var d = &Database{
 		// read environment variables and sets up mailserver configuration values
 		config: &Config{
-			host:     viper.GetString("db.host"),
-			port:     viper.GetInt("db.port"),
-			user:     viper.GetString("db.user"),
-			password: viper.GetString("db.pass"),
-			dbname:   viper.GetString("db.name"),
-			sslmode:  viper.GetString("db.sslmode"),
+			driver:          viper.GetString("db.driver"),
+			url:             viper.GetString("db.url"),
+			replicaURL:      viper.GetString("db.replica_url"),
+			host:            viper.GetString("db.host"),
+			port:            viper.GetInt("db.port"),
+			user:            viper.GetString("db.user"),
+			password:        viper.GetString("db.pass"),
+			dbname:          viper.GetString("db.name"),
+			sslmode:         viper.GetString("db.sslmode"),
+			queryTimeout:    time.Duration(viper.GetInt("db.query_timeout")) * time.Second,
+			maxOpenConns:    viper.GetInt("db.max_open_conns"),
+			maxIdleConns:    viper.GetInt("db.max_idle_conns"),
+			connMaxLifetime: time.Duration(viper.GetInt("db.conn_max_lifetime")) * time.Second,
+			connectRetries:  viper.GetInt("db.connect_retries"),
 		},
 	}
 
-	psqlInfo := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		d.config.host,
-		d.config.port,
-		d.config.user,
-		d.config.password,
-		d.config.dbname,
-		d.config.sslmode,
-	)
+	driverName := "postgres"
+	if d.config.driver == "sqlite" {
+		if !sqliteEnabled {
+			logging.Fatal("the sqlite db.driver requires a build with cgo enabled")
+		}
+		driverName = sqliteDriverName
+		schemaSQL = sqliteSchemaSQL
+	} else if d.config.driver != "postgres" {
+		logging.Fatal("unsupported db.driver", "driver", d.config.driver)
+	}
 
-	pdb, err := sql.Open("postgres", psqlInfo)
+	pdb, err := d.connect(driverName, d.config.dsn())
 	if err != nil {
-		log.Fatal("error connecting to the database: ", err)
+		logging.Fatal("error connecting to the database", "error", err)
 	}
 	d.db = pdb
+	d.read = pdb
+
+	if d.config.replicaURL != "" && d.config.driver == "sqlite" {
+		logging.Warn("db.replica_url is not supported by the sqlite driver, reading from the primary")
+	} else if d.config.replicaURL != "" {
+		rdb, err := d.connect(driverName, d.config.replicaURL)
+		if err != nil {
+			logging.Error("error connecting to the read replica, reading from the primary", "error", err)
+		} else {
+			d.read = rdb
+		}
+	}
 
 	if _, err := d.db.Exec(schemaSQL); err != nil {
-		log.Fatal(err)
+		logging.Fatal("New failed", "error", err)
 	}
 
 	// on server start reset all users to active false for retrospectives
 	if _, err := d.db.Exec(
 		`call deactivate_all_users();`); err != nil {
-		log.Println(err)
+		logging.Error("database query failed", "method", "New", "error", err)
 	}
 
 	// on server start if admin email is specified set that user to ADMIN type
@@ -56,9 +88,100 @@ func New(AdminEmail string, schemaSQL string) *Database {
 			`call promote_user_by_email($1);`,
 			AdminEmail,
 		); err != nil {
-			log.Println(err)
+			logging.Error("database query failed", "method", "New", "error", err)
 		}
 	}
 
 	return d
 }
+
+// dsn returns the configured db.url, or builds a postgres url from the individual settings
+// so passwords containing spaces or quotes are escaped
+// for sqlite db.url is the database file, wakita.db in the working directory by default
+func (c *Config) dsn() string {
+	if c.driver == "sqlite" {
+		if c.url == "" {
+			return sqliteDSN("wakita.db")
+		}
+		return sqliteDSN(c.url)
+	}
+	if c.url != "" {
+		return c.url
+	}
+
+	u := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.user, c.password),
+		Host:     net.JoinHostPort(c.host, strconv.Itoa(c.port)),
+		Path:     "/" + c.dbname,
+		RawQuery: url.Values{"sslmode": []string{c.sslmode}}.Encode(),
+	}
+
+	return u.String()
+}
+
+// connect opens a connection pool with the configured limits and pings it,
+// retrying with exponential backoff while the database comes up
+func (d *Database) connect(driverName string, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(d.config.maxOpenConns)
+	db.SetMaxIdleConns(d.config.maxIdleConns)
+	db.SetConnMaxLifetime(d.config.connMaxLifetime)
+	if driverName == sqliteDriverName && sqliteInMemory(dsn) {
+		// each connection to an in memory database is a separate database that is gone once it closes
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+	}
+
+	backoff := connectBackoffMin
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := d.withTimeout(context.Background())
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= d.config.connectRetries {
+			db.Close()
+			return nil, err
+		}
+
+		logging.Warn("database not reachable, retrying", "attempt", attempt+1, "backoff", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > connectBackoffMax {
+			backoff = connectBackoffMax
+		}
+	}
+}
+
+// withTimeout bounds ctx by the configured query timeout
+func (d *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d.config.queryTimeout)
+}
+
+// withTx runs fn in a transaction, committing when fn succeeds and rolling back when it returns an error
+func (d *Database) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		logging.FromContext(ctx).Error("unable to begin transaction", "error", err)
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logging.FromContext(ctx).Error("unable to rollback transaction", "error", rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Error("unable to commit transaction", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// testDatabases runs a storage test against the sqlite driver,
+// and against postgres when WAKITA_TEST_DB_URL is set to the url of a database the test can write to
+func testDatabases(t *testing.T, test func(t *testing.T, d *Database)) {
+	t.Run("sqlite", func(t *testing.T) {
+		if !sqliteEnabled {
+			t.Skip("the sqlite driver requires a build with cgo enabled")
+		}
+		test(t, newTestDatabase(t, "sqlite", filepath.Join(t.TempDir(), "wakita.db"), "../../schema_sqlite.sql"))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("WAKITA_TEST_DB_URL")
+		if url == "" {
+			t.Skip("WAKITA_TEST_DB_URL is not set")
+		}
+		test(t, newTestDatabase(t, "postgres", url, "../../schema.sql"))
+	})
+}
+
+func newTestDatabase(t *testing.T, driver string, url string, schemaFile string) *Database {
+	schema, err := os.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set("db.driver", driver)
+	viper.Set("db.url", url)
+	viper.Set("db.query_timeout", 10)
+	viper.Set("db.max_open_conns", 5)
+	viper.Set("db.max_idle_conns", 5)
+	viper.Set("db.conn_max_lifetime", 300)
+
+	d := New("", string(schema), string(schema))
+	t.Cleanup(func() {
+		d.db.Close()
+	})
+
+	return d
+}
+
+// testEmail is unique per call so tests can share a postgres database between runs
+func testEmail(name string) string {
+	return fmt.Sprintf("%s+%d@wakita.test", name, time.Now().UnixNano())
+}
+
+func TestSchema(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		if err := d.CheckSchema(context.Background()); err != nil {
+			t.Errorf("CheckSchema() = %v", err)
+		}
+	})
+}
+
+func TestUserAccount(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+		email := testEmail("thor")
+
+		user, verifyID, err := d.CreateUserRegistered(ctx, "Thor", email, "mjolnir123", "")
+		if err != nil {
+			t.Fatalf("CreateUserRegistered() = %v", err)
+		}
+		if _, _, err := d.CreateUserRegistered(ctx, "Thor", email, "mjolnir123", ""); err == nil {
+			t.Errorf("CreateUserRegistered() with a registered email succeeded")
+		}
+
+		if _, err := d.AuthUser(ctx, email, "mjolnir123"); err != nil {
+			t.Errorf("AuthUser() = %v", err)
+		}
+		if _, err := d.AuthUser(ctx, email, "stormbreaker"); err == nil {
+			t.Errorf("AuthUser() with a wrong password succeeded")
+		}
+
+		if err := d.VerifyUserAccount(ctx, verifyID); err != nil {
+			t.Fatalf("VerifyUserAccount() = %v", err)
+		}
+		verified, err := d.GetUser(ctx, user.UserID)
+		if err != nil {
+			t.Fatalf("GetUser() = %v", err)
+		}
+		if !verified.Verified || verified.UserEmail != email {
+			t.Errorf("GetUser() = %+v, want a verified user with email %s", verified, email)
+		}
+
+		resetID, _, err := d.UserResetRequest(ctx, email)
+		if err != nil {
+			t.Fatalf("UserResetRequest() = %v", err)
+		}
+		if _, _, err := d.UserResetPassword(ctx, resetID, "stormbreaker"); err != nil {
+			t.Fatalf("UserResetPassword() = %v", err)
+		}
+		if _, err := d.AuthUser(ctx, email, "stormbreaker"); err != nil {
+			t.Errorf("AuthUser() with the reset password = %v", err)
+		}
+		if _, _, err := d.UserResetPassword(ctx, resetID, "mjolnir123"); err == nil {
+			t.Errorf("UserResetPassword() reusing a reset succeeded")
+		}
+	})
+}
+
+func TestRetrospectiveItems(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		owner, _, err := d.CreateUserRegistered(ctx, "Owner", testEmail("owner"), "password1", "")
+		if err != nil {
+			t.Fatalf("CreateUserRegistered() = %v", err)
+		}
+		guest, err := d.CreateUserGuest(ctx, "Guest")
+		if err != nil {
+			t.Fatalf("CreateUserGuest() = %v", err)
+		}
+
+		retro, err := d.CreateRetrospective(ctx, owner.UserID, "Sprint 1")
+		if err != nil {
+			t.Fatalf("CreateRetrospective() = %v", err)
+		}
+		for _, u := range []*User{owner, guest} {
+			if _, err := d.AddUserToRetrospective(ctx, retro.RetrospectiveID, u.UserID); err != nil {
+				t.Fatalf("AddUserToRetrospective() = %v", err)
+			}
+		}
+
+		items, err := d.CreateRetrospectiveItemWorked(ctx, retro.RetrospectiveID, guest.UserID, "Deploys were fast")
+		if err != nil || len(items) != 1 {
+			t.Fatalf("CreateRetrospectiveItemWorked() = %v, %v", items, err)
+		}
+		itemID := items[0].ID
+		items, _ = d.CreateRetrospectiveItemWorked(ctx, retro.RetrospectiveID, owner.UserID, "Pairing helped")
+		var childID string
+		for _, item := range items {
+			if item.ID != itemID {
+				childID = item.ID
+			}
+		}
+
+		worked, _, _, err := d.VoteRetrospectiveItem(ctx, retro.RetrospectiveID, owner.UserID, itemID)
+		if err != nil {
+			t.Fatalf("VoteRetrospectiveItem() = %v", err)
+		}
+		for _, item := range worked {
+			if item.ID == itemID && (len(item.Votes) != 1 || item.Votes[0] != owner.UserID) {
+				t.Errorf("VoteRetrospectiveItem() votes = %v, want [%s]", item.Votes, owner.UserID)
+			}
+		}
+
+		if _, _, err := d.UpdateRetrospectiveItem(ctx, retro.RetrospectiveID, guest.UserID, itemID, "Deploys were really fast"); err != nil {
+			t.Fatalf("UpdateRetrospectiveItem() = %v", err)
+		}
+		if _, _, err := d.UpdateRetrospectiveItem(ctx, retro.RetrospectiveID, guest.UserID, childID, "Not mine"); err == nil {
+			t.Errorf("UpdateRetrospectiveItem() of another users item succeeded")
+		}
+		history, err := d.GetRetrospectiveItemHistory(ctx, retro.RetrospectiveID, itemID)
+		if err != nil {
+			t.Fatalf("GetRetrospectiveItemHistory() = %v", err)
+		}
+		if len(history) != 1 || history[0].Content != "Deploys were fast" {
+			t.Errorf("GetRetrospectiveItemHistory() = %+v, want the previous content", history)
+		}
+
+		_, reacted, err := d.ToggleRetrospectiveItemReaction(ctx, retro.RetrospectiveID, guest.UserID, itemID, "🎉")
+		if err != nil {
+			t.Fatalf("ToggleRetrospectiveItemReaction() = %v", err)
+		}
+		for _, item := range reacted {
+			if item.ID == itemID && (len(item.Reactions) != 1 || item.Reactions[0].Count != 1) {
+				t.Errorf("ToggleRetrospectiveItemReaction() reactions = %+v, want one reaction", item.Reactions)
+			}
+		}
+
+		if _, _, _, err := d.NestRetrospectiveItem(ctx, retro.RetrospectiveID, owner.UserID, childID, itemID); err != nil {
+			t.Fatalf("NestRetrospectiveItem() = %v", err)
+		}
+		discussion, err := d.GetRetrospectiveDiscussion(ctx, retro.RetrospectiveID)
+		if err != nil {
+			t.Fatalf("GetRetrospectiveDiscussion() = %v", err)
+		}
+		if len(discussion.Queue) != 1 || discussion.Queue[0].ItemID != itemID || discussion.Queue[0].ChildCount != 1 {
+			t.Errorf("GetRetrospectiveDiscussion() queue = %+v, want the parent item with one child", discussion.Queue)
+		}
+
+		other, _ := d.CreateRetrospective(ctx, owner.UserID, "Sprint 2")
+		if _, _, _, err := d.UnNestRetrospectiveItem(ctx, other.RetrospectiveID, owner.UserID, childID); err == nil {
+			t.Errorf("UnNestRetrospectiveItem() of an item of another retrospective succeeded")
+		}
+		if _, _, _, err := d.UnNestRetrospectiveItem(ctx, retro.RetrospectiveID, owner.UserID, itemID); err == nil {
+			t.Errorf("UnNestRetrospectiveItem() of a top level item succeeded")
+		}
+		worked, _, _, err = d.UnNestRetrospectiveItem(ctx, retro.RetrospectiveID, owner.UserID, childID)
+		if err != nil {
+			t.Fatalf("UnNestRetrospectiveItem() = %v", err)
+		}
+		for _, item := range worked {
+			if item.ParentID != "" {
+				t.Errorf("UnNestRetrospectiveItem() left %s nested under %s", item.ID, item.ParentID)
+			}
+		}
+
+		if _, err := d.CreateRetrospectiveAction(ctx, retro.RetrospectiveID, owner.UserID, "Keep pairing"); err != nil {
+			t.Fatalf("CreateRetrospectiveAction() = %v", err)
+		}
+		got, err := d.GetRetrospective(ctx, retro.RetrospectiveID)
+		if err != nil {
+			t.Fatalf("GetRetrospective() = %v", err)
+		}
+		if len(got.WorkedItems) != 2 || len(got.ActionItems) != 1 || len(got.Users) != 2 {
+			t.Errorf("GetRetrospective() = %d items, %d actions, %d users, want 2, 1 and 2",
+				len(got.WorkedItems), len(got.ActionItems), len(got.Users))
+		}
+	})
+}
+
+func TestRetrospectiveUserRole(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		owner, _, _ := d.CreateUserRegistered(ctx, "Owner", testEmail("owner"), "password1", "")
+		member, _ := d.CreateUserGuest(ctx, "Member")
+		outsider, _ := d.CreateUserGuest(ctx, "Outsider")
+		retro, err := d.CreateRetrospective(ctx, owner.UserID, "Sprint 2")
+		if err != nil {
+			t.Fatalf("CreateRetrospective() = %v", err)
+		}
+		d.AddUserToRetrospective(ctx, retro.RetrospectiveID, member.UserID)
+
+		users, err := d.SetRetrospectiveUserRole(ctx, retro.RetrospectiveID, owner.UserID, member.UserID, "OBSERVER")
+		if err != nil {
+			t.Fatalf("SetRetrospectiveUserRole() = %v", err)
+		}
+		for _, u := range users {
+			if u.UserID == member.UserID && u.Role != "OBSERVER" {
+				t.Errorf("SetRetrospectiveUserRole() role = %s, want OBSERVER", u.Role)
+			}
+		}
+		if _, err := d.CreateRetrospectiveItemWorked(ctx, retro.RetrospectiveID, member.UserID, "Observing"); err == nil {
+			t.Errorf("CreateRetrospectiveItemWorked() by an observer succeeded")
+		}
+
+		if _, err := d.SetRetrospectiveUserRole(ctx, retro.RetrospectiveID, owner.UserID, outsider.UserID, "FACILITATOR"); err == nil {
+			t.Errorf("SetRetrospectiveUserRole() for a user not in the retrospective succeeded")
+		}
+		if _, err := d.SetRetrospectiveUserRole(ctx, retro.RetrospectiveID, member.UserID, member.UserID, "FACILITATOR"); err == nil {
+			t.Errorf("SetRetrospectiveUserRole() by a participant succeeded")
+		}
+	})
+}
+
+func TestTeamsAndOrganizations(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		admin, _, _ := d.CreateUserRegistered(ctx, "Admin", testEmail("admin"), "password1", "")
+		member, _, _ := d.CreateUserRegistered(ctx, "Member", testEmail("member"), "password1", "")
+
+		orgID, err := d.OrganizationCreate(ctx, admin.UserID, "Asgard")
+		if err != nil {
+			t.Fatalf("OrganizationCreate() = %v", err)
+		}
+		if role, err := d.OrganizationUserRole(ctx, admin.UserID, orgID); err != nil || role != "ADMIN" {
+			t.Errorf("OrganizationUserRole() = %q, %v, want ADMIN", role, err)
+		}
+
+		teamID, err := d.TeamCreate(ctx, admin.UserID, "Avengers")
+		if err != nil {
+			t.Fatalf("TeamCreate() = %v", err)
+		}
+		if _, err := d.TeamAddUser(ctx, teamID, member.UserID, "MEMBER"); err != nil {
+			t.Fatalf("TeamAddUser() = %v", err)
+		}
+		if role, err := d.TeamUserRole(ctx, member.UserID, teamID); err != nil || role != "MEMBER" {
+			t.Errorf("TeamUserRole() = %q, %v, want MEMBER", role, err)
+		}
+
+		retro, err := d.TeamCreateRetrospective(ctx, teamID, admin.UserID, "Team Sprint")
+		if err != nil {
+			t.Fatalf("TeamCreateRetrospective() = %v", err)
+		}
+		retros := d.TeamRetrospectiveList(ctx, teamID, 10, 0)
+		if len(retros) != 1 || retros[0].RetrospectiveID != retro.RetrospectiveID {
+			t.Errorf("TeamRetrospectiveList() = %+v, want the team retrospective", retros)
+		}
+		if err := d.ConfirmRetrospectiveUser(ctx, retro.RetrospectiveID, member.UserID); err != nil {
+			t.Errorf("ConfirmRetrospectiveUser() for a team member = %v", err)
+		}
+	})
+}
+
+func TestAdminRetrospectiveListLastActivity(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		owner, _, _ := d.CreateUserRegistered(ctx, "Owner", testEmail("owner"), "password1", "")
+		name := fmt.Sprintf("Activity %d", time.Now().UnixNano())
+		retro, err := d.CreateRetrospective(ctx, owner.UserID, name)
+		if err != nil {
+			t.Fatalf("CreateRetrospective() = %v", err)
+		}
+		d.CreateRetrospectiveItemWorked(ctx, retro.RetrospectiveID, owner.UserID, "Shipped")
+
+		retros := d.AdminRetrospectiveList(ctx, name, false, 10, 0)
+		if len(retros) != 1 {
+			t.Fatalf("AdminRetrospectiveList() = %d retrospectives, want 1", len(retros))
+		}
+		if retros[0].LastActivity.IsZero() || retros[0].LastActivity.Before(retros[0].CreatedDate) {
+			t.Errorf("AdminRetrospectiveList() lastActivity = %v, created %v", retros[0].LastActivity, retros[0].CreatedDate)
+		}
+	})
+}
@@ -1,16 +1,22 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"log"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
 // DepartmentUserRole gets a users role in department (and organization)
-func (d *Database) DepartmentUserRole(UserID string, OrgID string, DepartmentID string) (string, string, error) {
+func (d *Database) DepartmentUserRole(ctx context.Context, UserID string, OrgID string, DepartmentID string) (string, string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var orgRole string
 	var departmentRole string
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT orgRole, departmentRole FROM department_get_user_role($1, $2, $3)`,
 		UserID,
 		OrgID,
@@ -20,7 +26,7 @@ func (d *Database) DepartmentUserRole(UserID string, OrgID string, DepartmentID
 		&departmentRole,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentUserRole", "user_id", UserID, "organization_id", OrgID, "department_id", DepartmentID, "error", e)
 		return "", "", errors.New("error getting department users role")
 	}
 
@@ -28,7 +34,10 @@ func (d *Database) DepartmentUserRole(UserID string, OrgID string, DepartmentID
 }
 
 // DepartmentGet gets a department
-func (d *Database) DepartmentGet(DepartmentID string) (*Department, error) {
+func (d *Database) DepartmentGet(ctx context.Context, DepartmentID string) (*Department, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var org = &Department{
 		DepartmentID: "",
 		Name:         "",
@@ -36,7 +45,7 @@ func (d *Database) DepartmentGet(DepartmentID string) (*Department, error) {
 		UpdatedDate:  "",
 	}
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM department_get_by_id($1)`,
 		DepartmentID,
 	).Scan(
@@ -46,7 +55,7 @@ func (d *Database) DepartmentGet(DepartmentID string) (*Department, error) {
 		&org.UpdatedDate,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentGet", "department_id", DepartmentID, "error", e)
 		return nil, errors.New("department not found")
 	}
 
@@ -54,9 +63,12 @@ func (d *Database) DepartmentGet(DepartmentID string) (*Department, error) {
 }
 
 // OrganizationDepartmentList gets a list of organization departments
-func (d *Database) OrganizationDepartmentList(OrgID string, Limit int, Offset int) []*Department {
+func (d *Database) OrganizationDepartmentList(ctx context.Context, OrgID string, Limit int, Offset int) []*Department {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var departments = make([]*Department, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM department_list($1, $2, $3);`,
 		OrgID,
 		Limit,
@@ -74,29 +86,32 @@ func (d *Database) OrganizationDepartmentList(OrgID string, Limit int, Offset in
 				&department.CreatedDate,
 				&department.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "OrganizationDepartmentList", "organization_id", OrgID, "error", err)
 			} else {
 				departments = append(departments, &department)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationDepartmentList", "organization_id", OrgID, "error", err)
 	}
 
 	return departments
 }
 
 // DepartmentCreate creates an organization department
-func (d *Database) DepartmentCreate(OrgID string, OrgName string) (string, error) {
+func (d *Database) DepartmentCreate(ctx context.Context, OrgID string, OrgName string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var DepartmentID string
-	err := d.db.QueryRow(`
+	err := d.db.QueryRowContext(ctx, `
 		SELECT departmentId FROM department_create($1, $2);`,
 		OrgID,
 		OrgName,
 	).Scan(&DepartmentID)
 
 	if err != nil {
-		log.Println("Unable to create organization department: ", err)
+		logging.FromContext(ctx).Error("Unable to create organization department", "organization_id", OrgID, "error", err)
 		return "", err
 	}
 
@@ -104,9 +119,12 @@ func (d *Database) DepartmentCreate(OrgID string, OrgName string) (string, error
 }
 
 // DepartmentTeamList gets a list of department teams
-func (d *Database) DepartmentTeamList(DepartmentID string, Limit int, Offset int) []*Team {
+func (d *Database) DepartmentTeamList(ctx context.Context, DepartmentID string, Limit int, Offset int) []*Team {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var teams = make([]*Team, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM department_team_list($1, $2, $3);`,
 		DepartmentID,
 		Limit,
@@ -124,29 +142,32 @@ func (d *Database) DepartmentTeamList(DepartmentID string, Limit int, Offset int
 				&team.CreatedDate,
 				&team.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "DepartmentTeamList", "department_id", DepartmentID, "error", err)
 			} else {
 				teams = append(teams, &team)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentTeamList", "department_id", DepartmentID, "error", err)
 	}
 
 	return teams
 }
 
 // DepartmentTeamCreate creates a department team
-func (d *Database) DepartmentTeamCreate(DepartmentID string, TeamName string) (string, error) {
+func (d *Database) DepartmentTeamCreate(ctx context.Context, DepartmentID string, TeamName string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var TeamID string
-	err := d.db.QueryRow(`
+	err := d.db.QueryRowContext(ctx, `
 		SELECT teamId FROM department_team_create($1, $2);`,
 		DepartmentID,
 		TeamName,
 	).Scan(&TeamID)
 
 	if err != nil {
-		log.Println("Unable to create department team: ", err)
+		logging.FromContext(ctx).Error("Unable to create department team", "department_id", DepartmentID, "error", err)
 		return "", err
 	}
 
@@ -154,9 +175,12 @@ func (d *Database) DepartmentTeamCreate(DepartmentID string, TeamName string) (s
 }
 
 // DepartmentUserList gets a list of department users
-func (d *Database) DepartmentUserList(DepartmentID string, Limit int, Offset int) []*DepartmentUser {
+func (d *Database) DepartmentUserList(ctx context.Context, DepartmentID string, Limit int, Offset int) []*DepartmentUser {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var users = make([]*DepartmentUser, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, email, role FROM department_user_list($1, $2, $3);`,
 		DepartmentID,
 		Limit,
@@ -174,21 +198,24 @@ func (d *Database) DepartmentUserList(DepartmentID string, Limit int, Offset int
 				&usr.Email,
 				&usr.Role,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "DepartmentUserList", "department_id", DepartmentID, "error", err)
 			} else {
 				users = append(users, &usr)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentUserList", "department_id", DepartmentID, "error", err)
 	}
 
 	return users
 }
 
 // DepartmentAddUser adds a user to an organization department
-func (d *Database) DepartmentAddUser(DepartmentID string, UserID string, Role string) (string, error) {
-	_, err := d.db.Exec(
+func (d *Database) DepartmentAddUser(ctx context.Context, DepartmentID string, UserID string, Role string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`SELECT department_user_add($1, $2, $3);`,
 		DepartmentID,
 		UserID,
@@ -196,23 +223,38 @@ func (d *Database) DepartmentAddUser(DepartmentID string, UserID string, Role st
 	)
 
 	if err != nil {
-		log.Println("Unable to add user to department: ", err)
+		logging.FromContext(ctx).Error("Unable to add user to department", "department_id", DepartmentID, "user_id", UserID, "error", err)
 		return "", err
 	}
 
+	// let the user know in their next digest
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT INTO user_notification (user_id, type, title, link)
+		SELECT u.id, $3, od.name, 'organization/' || od.organization_id || '/department/' || od.id FROM users u, organization_department od
+		WHERE u.id = $2 AND od.id = $1 AND u.notify_invites = true;`,
+		DepartmentID,
+		UserID,
+		NotificationInvite,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentAddUser", "department_id", DepartmentID, "user_id", UserID, "error", err)
+	}
+
 	return DepartmentID, nil
 }
 
 // DepartmentRemoveUser removes a user from a department (and department teams)
-func (d *Database) DepartmentRemoveUser(DepartmentID string, UserID string) error {
-	_, err := d.db.Exec(
+func (d *Database) DepartmentRemoveUser(ctx context.Context, DepartmentID string, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`CALL department_user_remove($1, $2);`,
 		DepartmentID,
 		UserID,
 	)
 
 	if err != nil {
-		log.Println("Unable to remove user from department: ", err)
+		logging.FromContext(ctx).Error("Unable to remove user from department", "department_id", DepartmentID, "user_id", UserID, "error", err)
 		return err
 	}
 
@@ -220,12 +262,15 @@ func (d *Database) DepartmentRemoveUser(DepartmentID string, UserID string) erro
 }
 
 // DepartmentTeamUserRole gets a users role in organization department team
-func (d *Database) DepartmentTeamUserRole(UserID string, OrgID string, DepartmentID string, TeamID string) (string, string, string, error) {
+func (d *Database) DepartmentTeamUserRole(ctx context.Context, UserID string, OrgID string, DepartmentID string, TeamID string) (string, string, string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var orgRole string
 	var departmentRole string
 	var teamRole string
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT orgRole, departmentRole, teamRole FROM department_team_user_role($1, $2, $3, $4)`,
 		UserID,
 		OrgID,
@@ -237,9 +282,65 @@ func (d *Database) DepartmentTeamUserRole(UserID string, OrgID string, Departmen
 		&teamRole,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentTeamUserRole", "user_id", UserID, "organization_id", OrgID, "department_id", DepartmentID, "team_id", TeamID, "error", e)
 		return "", "", "", errors.New("error getting department team users role")
 	}
 
 	return orgRole, departmentRole, teamRole, nil
 }
+
+// DepartmentUpdate renames an organization department, names are unique within the organization
+func (d *Database) DepartmentUpdate(ctx context.Context, DepartmentID string, DepartmentName string) (*Department, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE organization_department SET name = $2, updated_date = NOW() WHERE id = $1;`,
+		DepartmentID,
+		DepartmentName,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentUpdate", "department_id", DepartmentID, "error", err)
+		return nil, errors.New("a department with that name already exists")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return nil, errors.New("department not found")
+	}
+
+	return d.DepartmentGet(ctx, DepartmentID)
+}
+
+// DepartmentDelete deletes an organization department along with its teams,
+// the teams retrospectives are kept by their owners
+func (d *Database) DepartmentDelete(ctx context.Context, DepartmentID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM team WHERE id IN (SELECT team_id FROM department_team WHERE department_id = $1);`,
+			DepartmentID,
+		); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM organization_department WHERE id = $1;`, DepartmentID)
+		if err != nil {
+			return err
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+	if err == sql.ErrNoRows {
+		return errors.New("department not found")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DepartmentDelete", "department_id", DepartmentID, "error", err)
+		return errors.New("error deleting department")
+	}
+
+	return nil
+}
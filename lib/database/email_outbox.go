@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
+)
+
+// EmailOutboxEnqueue queues an email for delivery by the outbox worker, Body is the html and TextBody the plain text alternative,
+// UnsubscribeURL is the one-click unsubscribe link of notification emails
+func (d *Database) EmailOutboxEnqueue(ctx context.Context, ToName string, ToEmail string, Subject string, Body string, TextBody string, UnsubscribeURL string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var MessageID string
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO email_outbox (to_name, to_email, subject, body, text_body, unsubscribe_url) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;`,
+		ToName,
+		ToEmail,
+		Subject,
+		Body,
+		TextBody,
+		UnsubscribeURL,
+	).Scan(&MessageID)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to queue email", "error", err)
+		return "", err
+	}
+
+	return MessageID, nil
+}
+
+// EmailOutboxClaim claims up to Limit pending emails that are due, counting the attempt and
+// leasing them for the Lease duration so other replicas skip them while they are being sent,
+// times are computed by the database so they compare with NOW() regardless of the servers clock and time zone
+func (d *Database) EmailOutboxClaim(ctx context.Context, Limit int, Lease time.Duration) ([]*EmailOutboxMessage, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	Messages := make([]*EmailOutboxMessage, 0)
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT id, COALESCE(to_name, ''), to_email, subject, body, COALESCE(text_body, ''), COALESCE(unsubscribe_url, ''), attempts
+			FROM email_outbox
+			WHERE status = 'PENDING' AND next_attempt_date <= NOW()
+			ORDER BY next_attempt_date
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED;`,
+			Limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		MessageIDs := make([]string, 0)
+		for rows.Next() {
+			var m EmailOutboxMessage
+			if err := rows.Scan(&m.MessageID, &m.ToName, &m.ToEmail, &m.Subject, &m.Body, &m.TextBody, &m.UnsubscribeURL, &m.Attempts); err != nil {
+				return err
+			}
+			m.Status = "PENDING"
+			m.Attempts = m.Attempts + 1
+			Messages = append(Messages, &m)
+			MessageIDs = append(MessageIDs, m.MessageID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		if len(MessageIDs) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE email_outbox SET attempts = attempts + 1, next_attempt_date = NOW() + $2 * interval '1 second', updated_date = NOW()
+			WHERE id = ANY($1);`,
+			pq.Array(MessageIDs),
+			int(Lease.Seconds()),
+		)
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to claim queued emails", "error", err)
+		return nil, err
+	}
+
+	return Messages, nil
+}
+
+// EmailOutboxMarkSent marks a queued email as delivered
+func (d *Database) EmailOutboxMarkSent(ctx context.Context, MessageID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE email_outbox SET status = 'SENT', last_error = NULL, sent_date = NOW(), updated_date = NOW() WHERE id = $1;`,
+		MessageID,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxMarkSent", "message_id", MessageID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// EmailOutboxRetryLater records a failed delivery attempt, the email is sent again once RetryAfter has passed
+func (d *Database) EmailOutboxRetryLater(ctx context.Context, MessageID string, SendError string, RetryAfter time.Duration) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE email_outbox SET last_error = $2, next_attempt_date = NOW() + $3 * interval '1 second', updated_date = NOW() WHERE id = $1;`,
+		MessageID,
+		SendError,
+		int(RetryAfter.Seconds()),
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxRetryLater", "message_id", MessageID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// EmailOutboxMarkFailed records the final failed delivery attempt, the email stays failed until an admin retries it
+func (d *Database) EmailOutboxMarkFailed(ctx context.Context, MessageID string, SendError string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE email_outbox SET status = 'FAILED', last_error = $2, updated_date = NOW() WHERE id = $1;`,
+		MessageID,
+		SendError,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxMarkFailed", "message_id", MessageID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// EmailOutboxList gets queued emails for admin listing, newest first, optionally filtered by Status (PENDING, SENT, FAILED)
+func (d *Database) EmailOutboxList(ctx context.Context, Status string, Limit int, Offset int) []*EmailOutboxMessage {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	Messages := make([]*EmailOutboxMessage, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, COALESCE(to_name, ''), to_email, subject, status, attempts, COALESCE(last_error, ''),
+			next_attempt_date, sent_date, created_date
+		FROM email_outbox
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_date DESC
+		LIMIT $2
+		OFFSET $3;`,
+		Status,
+		Limit,
+		Offset,
+	)
+
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var m EmailOutboxMessage
+			var SentDate sql.NullString
+
+			if err := rows.Scan(
+				&m.MessageID,
+				&m.ToName,
+				&m.ToEmail,
+				&m.Subject,
+				&m.Status,
+				&m.Attempts,
+				&m.LastError,
+				&m.NextAttemptDate,
+				&SentDate,
+				&m.CreatedDate,
+			); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxList", "error", err)
+			} else {
+				m.SentDate = SentDate.String
+				Messages = append(Messages, &m)
+			}
+		}
+	} else {
+		logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxList", "error", err)
+	}
+
+	return Messages
+}
+
+// EmailOutboxRetry queues a failed email to be sent again with a fresh set of attempts
+func (d *Database) EmailOutboxRetry(ctx context.Context, MessageID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE email_outbox
+		SET status = 'PENDING', attempts = 0, next_attempt_date = NOW(), updated_date = NOW()
+		WHERE id = $1 AND status = 'FAILED';`,
+		MessageID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxRetry", "message_id", MessageID, "error", err)
+		return err
+	}
+
+	if count, _ := res.RowsAffected(); count == 0 {
+		return errors.New("failed email not found")
+	}
+
+	return nil
+}
+
+// EmailOutboxRetryFailed queues all failed emails to be sent again, returning how many were queued
+func (d *Database) EmailOutboxRetryFailed(ctx context.Context) (int64, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE email_outbox
+		SET status = 'PENDING', attempts = 0, next_attempt_date = NOW(), updated_date = NOW()
+		WHERE status = 'FAILED';`,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "EmailOutboxRetryFailed", "error", err)
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
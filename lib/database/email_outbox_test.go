@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEmailOutboxLease(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		messageID, err := d.EmailOutboxEnqueue(ctx, "Thor", testEmail("thor"), "Subject", "<p>Body</p>", "Body", "")
+		if err != nil {
+			t.Fatalf("EmailOutboxEnqueue() = %v", err)
+		}
+
+		claimed := func() *EmailOutboxMessage {
+			messages, err := d.EmailOutboxClaim(ctx, 100, time.Hour)
+			if err != nil {
+				t.Fatalf("EmailOutboxClaim() = %v", err)
+			}
+			for _, m := range messages {
+				if m.MessageID == messageID {
+					return m
+				}
+			}
+			return nil
+		}
+
+		if m := claimed(); m == nil || m.Attempts != 1 {
+			t.Fatalf("EmailOutboxClaim() = %+v, want the queued email on its first attempt", m)
+		}
+		if m := claimed(); m != nil {
+			t.Errorf("EmailOutboxClaim() claimed a leased email")
+		}
+
+		if err := d.EmailOutboxRetryLater(ctx, messageID, "connection refused", time.Hour); err != nil {
+			t.Fatalf("EmailOutboxRetryLater() = %v", err)
+		}
+		if m := claimed(); m != nil {
+			t.Errorf("EmailOutboxClaim() claimed an email before its retry")
+		}
+
+		if err := d.EmailOutboxRetryLater(ctx, messageID, "connection refused", 0); err != nil {
+			t.Fatalf("EmailOutboxRetryLater() = %v", err)
+		}
+		if m := claimed(); m == nil || m.Attempts != 2 {
+			t.Errorf("EmailOutboxClaim() = %+v, want the due email on its second attempt", m)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// Ping checks a connection from the pool can reach the database, and the read replica when configured
+func (d *Database) Ping(ctx context.Context) error {
+	if err := d.db.PingContext(ctx); err != nil {
+		return err
+	}
+	if d.read != d.db {
+		return d.read.PingContext(ctx)
+	}
+
+	return nil
+}
+
+// schemaVersion is the schema version this build expects, schema.sql and schema_sqlite.sql record it
+// in schema_migration as their last statement, bump all three together when changing the schema
+const schemaVersion = "2026-10-19.2"
+
+// CheckSchema confirms the schema version this build expects has been applied to the database
+func (d *Database) CheckSchema(ctx context.Context) error {
+	var applied bool
+
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM schema_migration WHERE version = $1);`,
+		schemaVersion,
+	).Scan(&applied); err != nil {
+		return err
+	}
+	if !applied {
+		return errors.New("schema version " + schemaVersion + " not applied")
+	}
+
+	return nil
+}
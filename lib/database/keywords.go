@@ -0,0 +1,105 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords are common english words ignored when extracting keywords from item content
+var stopWords = map[string]bool{
+	"a": true, "about": true, "after": true, "again": true, "all": true, "also": true, "am": true, "an": true,
+	"and": true, "any": true, "are": true, "as": true, "at": true, "be": true, "been": true, "before": true,
+	"being": true, "but": true, "by": true, "can": true, "could": true, "did": true, "do": true, "does": true,
+	"doing": true, "dont": true, "for": true, "from": true, "get": true, "got": true, "had": true, "has": true,
+	"have": true, "how": true, "i": true, "if": true, "in": true, "into": true, "is": true, "it": true,
+	"its": true, "just": true, "like": true, "lot": true, "more": true, "most": true, "much": true, "my": true,
+	"need": true, "not": true, "of": true, "on": true, "or": true, "our": true, "out": true, "over": true,
+	"really": true, "should": true, "so": true, "some": true, "than": true, "that": true, "the": true,
+	"their": true, "them": true, "then": true, "there": true, "these": true, "they": true, "this": true,
+	"to": true, "too": true, "up": true, "us": true, "very": true, "was": true, "we": true, "were": true,
+	"what": true, "when": true, "which": true, "while": true, "who": true, "why": true, "will": true,
+	"with": true, "would": true, "you": true, "your": true,
+}
+
+// contentKeywords splits item content into lower cased words, dropping stop words and very short words
+func contentKeywords(Content string) []string {
+	var keywords = make([]string, 0)
+
+	words := strings.FieldsFunc(strings.ToLower(Content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if len(word) < 3 || stopWords[word] {
+			continue
+		}
+		keywords = append(keywords, word)
+	}
+
+	return keywords
+}
+
+// stemSuffixes are the suffixes stripped by stemKeyword, longest first
+var stemSuffixes = []string{
+	"ational", "ization", "fulness", "iveness", "ations", "ments", "ation", "ness", "ment", "ings",
+	"able", "ible", "ies", "ing", "ful", "ed", "ly", "es", "s",
+}
+
+// minStemLength is the shortest stem a suffix is stripped down to, shorter stems like "spe" (from "speed")
+// or "str" (from "string") merge unrelated words, plurals can be stripped down to minPluralStemLength
+const (
+	minStemLength       = 4
+	minPluralStemLength = 3
+)
+
+// stemKeyword reduces a keyword to a rough stem by stripping common english suffixes
+// so that for example "deploy", "deploys", "deployed" and "deployment" are treated as the same word
+func stemKeyword(Keyword string) string {
+	for _, suffix := range stemSuffixes {
+		minLength := minStemLength
+		if suffix == "s" || suffix == "es" || suffix == "ies" {
+			minLength = minPluralStemLength
+		}
+		if !strings.HasSuffix(Keyword, suffix) || len(Keyword)-len(suffix) < minLength {
+			continue
+		}
+
+		stem := strings.TrimSuffix(Keyword, suffix)
+		switch {
+		case suffix == "ies":
+			stem = stem + "y"
+		case suffix == "es" && !hasEsPluralSuffix(stem):
+			// words like "names" and "releases" only drop the "s"
+			continue
+		case suffix == "s" && strings.HasSuffix(stem, "s"):
+			// words like "process" and "class"
+			return Keyword
+		}
+		// collapse doubled consonants left behind, "planned" -> "plan"
+		if n := len(stem); (suffix == "ed" || suffix == "ing") && n > 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiouls", rune(stem[n-1])) {
+			stem = stem[:n-1]
+		}
+		return stem
+	}
+
+	return Keyword
+}
+
+// hasEsPluralSuffix checks whether the stem is pluralized with "es", like "fixes", "classes" and "pushes"
+func hasEsPluralSuffix(Stem string) bool {
+	for _, ending := range []string{"ss", "x", "z", "ch", "sh"} {
+		if strings.HasSuffix(Stem, ending) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentStems returns the stemmed keywords of item content
+func contentStems(Content string) []string {
+	keywords := contentKeywords(Content)
+	for i, keyword := range keywords {
+		keywords[i] = stemKeyword(keyword)
+	}
+
+	return keywords
+}
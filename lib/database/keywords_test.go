@@ -0,0 +1,91 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStemKeyword(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    string
+	}{
+		// related words share a stem
+		{"deploy", "deploy"},
+		{"deploys", "deploy"},
+		{"deployed", "deploy"},
+		{"deploying", "deploy"},
+		{"deployment", "deploy"},
+		{"deployments", "deploy"},
+		{"planned", "plan"},
+		{"planning", "plan"},
+		{"running", "run"},
+		{"tested", "test"},
+		{"testing", "test"},
+		{"tests", "test"},
+		{"stories", "story"},
+		{"bugs", "bug"},
+		{"fixes", "fix"},
+		{"classes", "class"},
+		{"pushes", "push"},
+		{"names", "name"},
+		{"uses", "use"},
+		{"releases", "release"},
+		{"meetings", "meet"},
+		{"helpful", "help"},
+		{"quickly", "quick"},
+		{"readable", "read"},
+		{"organization", "organ"},
+		// stems shorter than the minimum are left alone
+		{"speed", "speed"},
+		{"feed", "feed"},
+		{"bleed", "bleed"},
+		{"string", "string"},
+		{"thing", "thing"},
+		{"reply", "reply"},
+		{"early", "early"},
+		{"table", "table"},
+		// words ending in a double s aren't plurals
+		{"process", "process"},
+		{"class", "class"},
+	}
+
+	for _, tt := range tests {
+		if got := stemKeyword(tt.keyword); got != tt.want {
+			t.Errorf("stemKeyword(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestStemKeywordUnrelatedWords(t *testing.T) {
+	tests := [][2]string{
+		{"speed", "spend"},
+		{"feed", "feel"},
+		{"string", "strong"},
+		{"reply", "repo"},
+	}
+
+	for _, tt := range tests {
+		if stemKeyword(tt[0]) == stemKeyword(tt[1]) {
+			t.Errorf("stemKeyword(%q) and stemKeyword(%q) share the stem %q", tt[0], tt[1], stemKeyword(tt[0]))
+		}
+	}
+}
+
+func TestContentStems(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"", []string{}},
+		{"The deployments were slow!", []string{"deploy", "slow"}},
+		{"Speed up the CI builds", []string{"speed", "build"}},
+		{"We need more tests, and the tests are flaky", []string{"test", "test", "flaky"}},
+	}
+
+	for _, tt := range tests {
+		if got := contentStems(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("contentStems(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
+)
+
+// types of the notifications batched into the users digest
+const (
+	NotificationInvite         = "INVITE"
+	NotificationActionAssigned = "ACTION_ASSIGNED"
+	NotificationActionDue      = "ACTION_DUE"
+)
+
+// notificationColumns are the users columns of the notifications that can be unsubscribed from
+var notificationColumns = map[string]string{
+	"invites":        "notify_invites",
+	"retroSummary":   "notify_retro_summary",
+	"actionAssigned": "notify_action_assigned",
+	"actionDue":      "notify_action_due",
+	"teamDigest":     "notify_team_digest",
+}
+
+// GetUserNotificationPreferences gets the notification emails the user has opted in to
+func (d *Database) GetUserNotificationPreferences(ctx context.Context, UserID string) (*NotificationPreferences, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var np NotificationPreferences
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT notify_invites, notify_retro_summary, notify_action_assigned, notify_action_due, notify_team_digest, digest_frequency
+		FROM users WHERE id = $1;`,
+		UserID,
+	).Scan(
+		&np.Invites,
+		&np.RetroSummary,
+		&np.ActionAssigned,
+		&np.ActionDue,
+		&np.TeamDigest,
+		&np.DigestFrequency,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetUserNotificationPreferences", "user_id", UserID, "error", err)
+		return nil, errors.New("User Not found")
+	}
+
+	return &np, nil
+}
+
+// UpdateUserNotificationPreferences sets the notification emails the user has opted in to
+func (d *Database) UpdateUserNotificationPreferences(ctx context.Context, UserID string, Preferences *NotificationPreferences) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if Preferences.DigestFrequency != "DAILY" && Preferences.DigestFrequency != "WEEKLY" {
+		return errors.New("digest frequency must be DAILY or WEEKLY")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE users SET notify_invites = $2, notify_retro_summary = $3, notify_action_assigned = $4,
+			notify_action_due = $5, notify_team_digest = $6, digest_frequency = $7, updated_date = NOW()
+		WHERE id = $1;`,
+		UserID,
+		Preferences.Invites,
+		Preferences.RetroSummary,
+		Preferences.ActionAssigned,
+		Preferences.ActionDue,
+		Preferences.TeamDigest,
+		Preferences.DigestFrequency,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateUserNotificationPreferences", "user_id", UserID, "error", err)
+		return errors.New("Error attempting to update users notification preferences")
+	}
+
+	return nil
+}
+
+// UserUnsubscribe turns off the Notification (e.g. teamDigest) for the user the unsubscribe Token belongs to,
+// all notifications when Notification is empty
+func (d *Database) UserUnsubscribe(ctx context.Context, Token string, Notification string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var query string
+	if Notification == "" {
+		query = `UPDATE users SET notify_invites = false, notify_retro_summary = false, notify_action_assigned = false,
+			notify_action_due = false, notify_team_digest = false, updated_date = NOW()
+		WHERE unsubscribe_token = $1;`
+	} else if column, ok := notificationColumns[Notification]; ok {
+		query = `UPDATE users SET ` + column + ` = false, updated_date = NOW() WHERE unsubscribe_token = $1;`
+	} else {
+		return errors.New("unknown notification")
+	}
+
+	res, err := d.db.ExecContext(ctx, query, Token)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UserUnsubscribe", "error", err)
+		return err
+	}
+
+	if count, _ := res.RowsAffected(); count == 0 {
+		return errors.New("unsubscribe token not found")
+	}
+
+	return nil
+}
+
+// QueueActionDueReminders queues a reminder for the assignees of open actions due by DueBy (formatted 2006-01-02),
+// each action is only reminded once per due date and assignee
+func (d *Database) QueueActionDueReminders(ctx context.Context, DueBy string) (int, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	ActionIDs := make([]string, 0)
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`UPDATE retrospective_action SET due_reminder_date = NOW()
+			WHERE completed = false AND assignee_id IS NOT NULL AND due_date IS NOT NULL
+				AND due_date <= $1 AND due_reminder_date IS NULL
+			RETURNING id;`,
+			DueBy,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ActionID string
+			if err := rows.Scan(&ActionID); err != nil {
+				return err
+			}
+			ActionIDs = append(ActionIDs, ActionID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		if len(ActionIDs) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO user_notification (user_id, type, title, content, link)
+			SELECT u.id, $2, r.name, ra.content, 'retrospective/' || r.id
+			FROM retrospective_action ra
+			JOIN retrospective r ON r.id = ra.retrospective_id
+			JOIN users u ON u.id = ra.assignee_id
+			WHERE ra.id = ANY($1) AND u.notify_action_due = true;`,
+			pq.Array(ActionIDs),
+			NotificationActionDue,
+		)
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "QueueActionDueReminders", "error", err)
+		return 0, err
+	}
+
+	return len(ActionIDs), nil
+}
+
+// NotificationDigestClaimDue claims the next user whose daily or weekly digest of pending notifications is due,
+// returning the user and the notifications now marked sent, or a nil user when no digest is due
+func (d *Database) NotificationDigestClaimDue(ctx context.Context) (*User, []*UserNotification, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var Recipient *User
+	Notifications := make([]*UserNotification, 0)
+	now := time.Now()
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`UPDATE users SET digest_sent_date = NOW()
+			WHERE id = (
+				SELECT u.id FROM users u
+				WHERE u.email IS NOT NULL
+					AND ((u.digest_frequency = 'WEEKLY' AND u.digest_sent_date <= $2)
+						OR (u.digest_frequency <> 'WEEKLY' AND u.digest_sent_date <= $1))
+					AND EXISTS (SELECT 1 FROM user_notification un WHERE un.user_id = u.id AND un.sent_date IS NULL)
+				ORDER BY u.digest_sent_date
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, name, email, unsubscribe_token;`,
+			now.AddDate(0, 0, -1).UTC(),
+			now.AddDate(0, 0, -7).UTC(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			return rows.Err()
+		}
+		var u User
+		if err := rows.Scan(&u.UserID, &u.UserName, &u.UserEmail, &u.UnsubscribeToken); err != nil {
+			return err
+		}
+		rows.Close()
+		Recipient = &u
+
+		nRows, err := tx.QueryContext(ctx,
+			`SELECT id, type, title, COALESCE(content, ''), COALESCE(link, ''), created_date
+			FROM user_notification
+			WHERE user_id = $1 AND sent_date IS NULL
+			ORDER BY created_date;`,
+			u.UserID,
+		)
+		if err != nil {
+			return err
+		}
+		defer nRows.Close()
+
+		NotificationIDs := make([]string, 0)
+		for nRows.Next() {
+			var n UserNotification
+			if err := nRows.Scan(&n.NotificationID, &n.Type, &n.Title, &n.Content, &n.Link, &n.CreatedDate); err != nil {
+				return err
+			}
+			Notifications = append(Notifications, &n)
+			NotificationIDs = append(NotificationIDs, n.NotificationID)
+		}
+		if err := nRows.Err(); err != nil {
+			return err
+		}
+		nRows.Close()
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE user_notification SET sent_date = NOW() WHERE id = ANY($1);`,
+			pq.Array(NotificationIDs),
+		)
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to claim notification digest", "error", err)
+		return nil, nil, err
+	}
+
+	return Recipient, Notifications, nil
+}
+
+// TeamDigestClaimDue claims the next user opted in to the weekly team digest whose digest is due,
+// returning the user and the past weeks retrospectives and open action items of their teams,
+// or a nil user when no digest is due
+func (d *Database) TeamDigestClaimDue(ctx context.Context) (*User, []*TeamDigest, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	since := time.Now().AddDate(0, 0, -7).UTC()
+
+	var u User
+	err := d.db.QueryRowContext(ctx,
+		`UPDATE users SET team_digest_sent_date = NOW()
+		WHERE id = (
+			SELECT u.id FROM users u
+			WHERE u.email IS NOT NULL AND u.notify_team_digest = true AND u.team_digest_sent_date <= $1
+				AND EXISTS (SELECT 1 FROM team_user tu WHERE tu.user_id = u.id)
+			ORDER BY u.team_digest_sent_date
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, name, email, unsubscribe_token;`,
+		since,
+	).Scan(&u.UserID, &u.UserName, &u.UserEmail, &u.UnsubscribeToken)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to claim team digest", "error", err)
+		return nil, nil, err
+	}
+
+	Teams := make([]*TeamDigest, 0)
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT t.id, t.name FROM team t
+		JOIN team_user tu ON tu.team_id = t.id
+		WHERE tu.user_id = $1
+		ORDER BY t.name;`,
+		u.UserID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamDigestClaimDue", "user_id", u.UserID, "error", err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var td = &TeamDigest{
+			Retrospectives: make([]*Retrospective, 0),
+			OpenActions:    make([]*RetrospectiveAction, 0),
+		}
+		if err := rows.Scan(&td.TeamID, &td.TeamName); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "TeamDigestClaimDue", "user_id", u.UserID, "error", err)
+		} else {
+			Teams = append(Teams, td)
+		}
+	}
+	rows.Close()
+
+	for _, td := range Teams {
+		td.Retrospectives = d.teamDigestRetrospectives(ctx, td.TeamID, since)
+		td.OpenActions = d.teamDigestOpenActions(ctx, td.TeamID)
+	}
+
+	return &u, Teams, nil
+}
+
+// teamDigestRetrospectives gets the teams retrospectives created since Since
+func (d *Database) teamDigestRetrospectives(ctx context.Context, TeamID string, Since time.Time) []*Retrospective {
+	var retrospectives = make([]*Retrospective, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT r.id, r.name, r.phase FROM retrospective r
+		JOIN team_retrospective tr ON tr.retrospective_id = r.id
+		WHERE tr.team_id = $1 AND r.created_date >= $2
+		ORDER BY r.created_date;`,
+		TeamID,
+		Since,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "teamDigestRetrospectives", "team_id", TeamID, "error", err)
+		return retrospectives
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Retrospective
+		if err := rows.Scan(&r.RetrospectiveID, &r.RetrospectiveName, &r.Phase); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "teamDigestRetrospectives", "team_id", TeamID, "error", err)
+		} else {
+			retrospectives = append(retrospectives, &r)
+		}
+	}
+
+	return retrospectives
+}
+
+// teamDigestOpenActions gets the open action items of the teams retrospectives, soonest due first
+func (d *Database) teamDigestOpenActions(ctx context.Context, TeamID string) []*RetrospectiveAction {
+	var actions = make([]*RetrospectiveAction, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT ra.id, ra.retrospective_id, ra.content, ra.completed, ra.assignee_id, COALESCE(u.name, ''), ra.due_date,
+			ra.tracker_id, ra.external_key, ra.external_url
+		FROM retrospective_action ra
+		JOIN team_retrospective tr ON tr.retrospective_id = ra.retrospective_id
+		LEFT JOIN users u ON u.id = ra.assignee_id
+		WHERE tr.team_id = $1 AND ra.completed = false
+		ORDER BY ra.due_date IS NULL, ra.due_date, ra.created_date
+		LIMIT 50;`,
+		TeamID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "teamDigestOpenActions", "team_id", TeamID, "error", err)
+		return actions
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ra, err := scanRetrospectiveAction(rows)
+		if err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "teamDigestOpenActions", "team_id", TeamID, "error", err)
+		} else {
+			actions = append(actions, ra)
+		}
+	}
+
+	return actions
+}
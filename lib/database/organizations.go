@@ -1,12 +1,18 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"log"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
 // OrganizationGet gets an organization
-func (d *Database) OrganizationGet(OrgID string) (*Organization, error) {
+func (d *Database) OrganizationGet(ctx context.Context, OrgID string) (*Organization, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var org = &Organization{
 		OrganizationID: "",
 		Name:           "",
@@ -14,7 +20,7 @@ func (d *Database) OrganizationGet(OrgID string) (*Organization, error) {
 		UpdatedDate:    "",
 	}
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM organization_get_by_id($1)`,
 		OrgID,
 	).Scan(
@@ -24,7 +30,7 @@ func (d *Database) OrganizationGet(OrgID string) (*Organization, error) {
 		&org.UpdatedDate,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationGet", "organization_id", OrgID, "error", e)
 		return nil, errors.New("error getting organization")
 	}
 
@@ -32,10 +38,13 @@ func (d *Database) OrganizationGet(OrgID string) (*Organization, error) {
 }
 
 // OrganizationUserRole gets a users role in organization
-func (d *Database) OrganizationUserRole(UserID string, OrgID string) (string, error) {
+func (d *Database) OrganizationUserRole(ctx context.Context, UserID string, OrgID string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var role string
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT role FROM organization_get_user_role($1, $2)`,
 		UserID,
 		OrgID,
@@ -43,7 +52,7 @@ func (d *Database) OrganizationUserRole(UserID string, OrgID string) (string, er
 		&role,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationUserRole", "user_id", UserID, "organization_id", OrgID, "error", e)
 		return "", errors.New("error getting organization users role")
 	}
 
@@ -51,9 +60,12 @@ func (d *Database) OrganizationUserRole(UserID string, OrgID string) (string, er
 }
 
 // OrganizationList gets a list of organizations the user is apart of
-func (d *Database) OrganizationListByUser(UserID string, Limit int, Offset int) []*Organization {
+func (d *Database) OrganizationListByUser(ctx context.Context, UserID string, Limit int, Offset int) []*Organization {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var organizations = make([]*Organization, 0)
-	rows, err := d.db.Query(
+	rows, err := d.db.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM organization_list_by_user($1, $2, $3);`,
 		UserID,
 		Limit,
@@ -71,29 +83,32 @@ func (d *Database) OrganizationListByUser(UserID string, Limit int, Offset int)
 				&org.CreatedDate,
 				&org.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "OrganizationListByUser", "user_id", UserID, "error", err)
 			} else {
 				organizations = append(organizations, &org)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationListByUser", "user_id", UserID, "error", err)
 	}
 
 	return organizations
 }
 
 // OrganizationCreate creates an organization
-func (d *Database) OrganizationCreate(UserID string, OrgName string) (string, error) {
+func (d *Database) OrganizationCreate(ctx context.Context, UserID string, OrgName string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var OrgID string
-	err := d.db.QueryRow(`
+	err := d.db.QueryRowContext(ctx, `
 		SELECT organizationId FROM organization_create($1, $2);`,
 		UserID,
 		OrgName,
 	).Scan(&OrgID)
 
 	if err != nil {
-		log.Println("Unable to create organization: ", err)
+		logging.FromContext(ctx).Error("Unable to create organization", "user_id", UserID, "error", err)
 		return "", err
 	}
 
@@ -101,9 +116,12 @@ func (d *Database) OrganizationCreate(UserID string, OrgName string) (string, er
 }
 
 // OrganizationUserList gets a list of organization users
-func (d *Database) OrganizationUserList(OrgID string, Limit int, Offset int) []*OrganizationUser {
+func (d *Database) OrganizationUserList(ctx context.Context, OrgID string, Limit int, Offset int) []*OrganizationUser {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var users = make([]*OrganizationUser, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, email, role FROM organization_user_list($1, $2, $3);`,
 		OrgID,
 		Limit,
@@ -121,21 +139,24 @@ func (d *Database) OrganizationUserList(OrgID string, Limit int, Offset int) []*
 				&usr.Email,
 				&usr.Role,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "OrganizationUserList", "organization_id", OrgID, "error", err)
 			} else {
 				users = append(users, &usr)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationUserList", "organization_id", OrgID, "error", err)
 	}
 
 	return users
 }
 
 // OrganizationAddUser adds a user to an organization
-func (d *Database) OrganizationAddUser(OrgID string, UserID string, Role string) (string, error) {
-	_, err := d.db.Exec(
+func (d *Database) OrganizationAddUser(ctx context.Context, OrgID string, UserID string, Role string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`SELECT organization_user_add($1, $2, $3);`,
 		OrgID,
 		UserID,
@@ -143,23 +164,38 @@ func (d *Database) OrganizationAddUser(OrgID string, UserID string, Role string)
 	)
 
 	if err != nil {
-		log.Println("Unable to add user to organization: ", err)
+		logging.FromContext(ctx).Error("Unable to add user to organization", "organization_id", OrgID, "user_id", UserID, "error", err)
 		return "", err
 	}
 
+	// let the user know in their next digest
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT INTO user_notification (user_id, type, title, link)
+		SELECT u.id, $3, o.name, 'organization/' || o.id FROM users u, organization o
+		WHERE u.id = $2 AND o.id = $1 AND u.notify_invites = true;`,
+		OrgID,
+		UserID,
+		NotificationInvite,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationAddUser", "organization_id", OrgID, "user_id", UserID, "error", err)
+	}
+
 	return OrgID, nil
 }
 
 // OrganizationRemoveUser removes a user from a organization
-func (d *Database) OrganizationRemoveUser(OrganizationID string, UserID string) error {
-	_, err := d.db.Exec(
+func (d *Database) OrganizationRemoveUser(ctx context.Context, OrganizationID string, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`CALL organization_user_remove($1, $2);`,
 		OrganizationID,
 		UserID,
 	)
 
 	if err != nil {
-		log.Println("Unable to remove user from organization: ", err)
+		logging.FromContext(ctx).Error("Unable to remove user from organization", "organization_id", OrganizationID, "user_id", UserID, "error", err)
 		return err
 	}
 
@@ -167,9 +203,12 @@ func (d *Database) OrganizationRemoveUser(OrganizationID string, UserID string)
 }
 
 // OrganizationTeamList gets a list of organization teams
-func (d *Database) OrganizationTeamList(OrgID string, Limit int, Offset int) []*Team {
+func (d *Database) OrganizationTeamList(ctx context.Context, OrgID string, Limit int, Offset int) []*Team {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var teams = make([]*Team, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM organization_team_list($1, $2, $3);`,
 		OrgID,
 		Limit,
@@ -187,29 +226,32 @@ func (d *Database) OrganizationTeamList(OrgID string, Limit int, Offset int) []*
 				&team.CreatedDate,
 				&team.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "OrganizationTeamList", "organization_id", OrgID, "error", err)
 			} else {
 				teams = append(teams, &team)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationTeamList", "organization_id", OrgID, "error", err)
 	}
 
 	return teams
 }
 
 // OrganizationTeamCreate creates an organization team
-func (d *Database) OrganizationTeamCreate(OrgID string, TeamName string) (string, error) {
+func (d *Database) OrganizationTeamCreate(ctx context.Context, OrgID string, TeamName string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var TeamID string
-	err := d.db.QueryRow(`
+	err := d.db.QueryRowContext(ctx, `
 		SELECT teamId FROM organization_team_create($1, $2);`,
 		OrgID,
 		TeamName,
 	).Scan(&TeamID)
 
 	if err != nil {
-		log.Println("Unable to create organization team: ", err)
+		logging.FromContext(ctx).Error("Unable to create organization team", "organization_id", OrgID, "error", err)
 		return "", err
 	}
 
@@ -217,11 +259,14 @@ func (d *Database) OrganizationTeamCreate(OrgID string, TeamName string) (string
 }
 
 // OrganizationTeamUserRole gets a users role in organization team
-func (d *Database) OrganizationTeamUserRole(UserID string, OrgID string, TeamID string) (string, string, error) {
+func (d *Database) OrganizationTeamUserRole(ctx context.Context, UserID string, OrgID string, TeamID string) (string, string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var orgRole string
 	var teamRole string
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT orgRole, teamRole FROM organization_team_user_role($1, $2, $3)`,
 		UserID,
 		OrgID,
@@ -231,9 +276,71 @@ func (d *Database) OrganizationTeamUserRole(UserID string, OrgID string, TeamID
 		&teamRole,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationTeamUserRole", "user_id", UserID, "organization_id", OrgID, "team_id", TeamID, "error", e)
 		return "", "", errors.New("error getting organization team users role")
 	}
 
 	return orgRole, teamRole, nil
 }
+
+// OrganizationUpdate renames an organization
+func (d *Database) OrganizationUpdate(ctx context.Context, OrgID string, OrgName string) (*Organization, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE organization SET name = $2, updated_date = NOW() WHERE id = $1;`,
+		OrgID,
+		OrgName,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationUpdate", "organization_id", OrgID, "error", err)
+		return nil, errors.New("error updating organization")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return nil, errors.New("organization not found")
+	}
+
+	return d.OrganizationGet(ctx, OrgID)
+}
+
+// OrganizationDelete deletes an organization along with its departments and teams,
+// the teams retrospectives are kept by their owners
+func (d *Database) OrganizationDelete(ctx context.Context, OrgID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM team WHERE id IN (
+				SELECT ot.team_id FROM organization_team ot WHERE ot.organization_id = $1
+				UNION
+				SELECT dt.team_id FROM department_team dt
+				JOIN organization_department od ON od.id = dt.department_id
+				WHERE od.organization_id = $1
+			);`,
+			OrgID,
+		); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM organization WHERE id = $1;`, OrgID)
+		if err != nil {
+			return err
+		}
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+	if err == sql.ErrNoRows {
+		return errors.New("organization not found")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "OrganizationDelete", "organization_id", OrgID, "error", err)
+		return errors.New("error deleting organization")
+	}
+
+	return nil
+}
@@ -1,81 +1,225 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"log"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
+// actionDueDateFormat is the format of action due dates, a calendar date without a time
+const actionDueDateFormat = "2006-01-02"
+
 // CreateRetroAction adds a new action to the retrospective
-func (d *Database) CreateRetrospectiveAction(RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveAction, error) {
-	err := d.ConfirmOwner(RetrospectiveID, UserID)
+func (d *Database) CreateRetrospectiveAction(ctx context.Context, RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveAction, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, UserID)
 	if err != nil {
 		return nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`INSERT INTO retrospective_action (retrospective_id, content) VALUES ($1, $2);`, RetrospectiveID, Content,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospectiveAction", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	actions := d.GetRetrospectiveActions(RetrospectiveID)
+	actions := d.GetRetrospectiveActions(ctx, RetrospectiveID)
 
 	return actions, nil
 }
 
-// UpdatedRetrospectiveAction updates an actions status
-func (d *Database) UpdatedRetrospectiveAction(RetrospectiveID string, userID string, ActionID string, Completed bool) (Actions []*RetrospectiveAction, DeleteError error) {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+// ErrInvalidDueDate is returned for action due dates not formatted 2006-01-02
+var ErrInvalidDueDate = errors.New("Invalid due date")
+
+// ErrAssigneeNotUser is returned when assigning an action to someone who isn't a user of the retrospective
+var ErrAssigneeNotUser = errors.New("Assignee is not a user of the retrospective")
+
+// UpdateRetrospectiveAction updates an actions content, status, assignee and/or due date, all fields are validated
+// before any is changed and the changes are made together, previous content is kept in the actions edit history
+func (d *Database) UpdateRetrospectiveAction(ctx context.Context, RetrospectiveID string, userID string, ActionID string, Update *RetrospectiveActionUpdate) ([]*RetrospectiveAction, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
-		`UPDATE retrospective_action SET completed = $2, updated_date = NOW() WHERE id = $1;`, ActionID, Completed); err != nil {
-		log.Println(err)
+	// assignees are limited to the retrospectives users and, for team retrospectives, the team members
+	var Assignee sql.NullString
+	if Update.AssigneeID != nil && *Update.AssigneeID != "" {
+		var members int
+		if err := d.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM users u
+			WHERE u.id = $2 AND (
+				u.id IN (SELECT ru.user_id FROM retrospective_user ru WHERE ru.retrospective_id = $1)
+				OR u.id IN (SELECT tu.user_id FROM team_user tu JOIN team_retrospective tr ON tr.team_id = tu.team_id WHERE tr.retrospective_id = $1)
+			);`,
+			RetrospectiveID, *Update.AssigneeID,
+		).Scan(&members); err != nil || members == 0 {
+			return nil, ErrAssigneeNotUser
+		}
+		Assignee = sql.NullString{String: *Update.AssigneeID, Valid: true}
+	}
+
+	var Due sql.NullString
+	if Update.DueDate != nil && *Update.DueDate != "" {
+		if _, err := time.Parse(actionDueDateFormat, *Update.DueDate); err != nil {
+			return nil, ErrInvalidDueDate
+		}
+		Due = sql.NullString{String: *Update.DueDate, Valid: true}
+	}
+
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		if Update.Content != nil {
+			if _, err := tx.ExecContext(ctx,
+				`call retrospective_action_update($1, $2, $3, $4);`, RetrospectiveID, ActionID, userID, *Update.Content,
+			); err != nil {
+				return err
+			}
+		}
+
+		if Update.Completed != nil {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE retrospective_action SET completed = $3,
+					completed_date = CASE WHEN $3 THEN COALESCE(completed_date, NOW()) ELSE NULL END,
+					updated_date = NOW()
+				WHERE id = $1 AND retrospective_id = $2;`, ActionID, RetrospectiveID, *Update.Completed,
+			); err != nil {
+				return err
+			}
+		}
+
+		if Update.AssigneeID != nil {
+			res, err := tx.ExecContext(ctx,
+				`UPDATE retrospective_action SET assignee_id = $3, due_reminder_date = NULL, updated_date = NOW()
+				WHERE id = $1 AND retrospective_id = $2 AND assignee_id IS DISTINCT FROM $3;`,
+				ActionID, RetrospectiveID, Assignee)
+			if err != nil {
+				return err
+			}
+
+			// notify the new assignee in their next digest, unless they assigned it to themselves
+			if count, _ := res.RowsAffected(); count > 0 && Assignee.Valid && Assignee.String != userID {
+				if _, err := tx.ExecContext(ctx,
+					`INSERT INTO user_notification (user_id, type, title, content, link)
+					SELECT u.id, $4, r.name, ra.content, 'retrospective/' || r.id
+					FROM users u, retrospective_action ra
+					JOIN retrospective r ON r.id = ra.retrospective_id
+					WHERE u.id = $3 AND ra.id = $1 AND ra.retrospective_id = $2 AND u.notify_action_assigned = true;`,
+					ActionID, RetrospectiveID, Assignee.String, NotificationActionAssigned,
+				); err != nil {
+					return err
+				}
+			}
+		}
+
+		// a new due date gets a new reminder
+		if Update.DueDate != nil {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE retrospective_action SET due_date = $3, due_reminder_date = NULL, updated_date = NOW()
+				WHERE id = $1 AND retrospective_id = $2;`,
+				ActionID, RetrospectiveID, Due,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateRetrospectiveAction", "retrospective_id", RetrospectiveID, "user_id", userID, "action_id", ActionID, "error", err)
+		return nil, errors.New("Unable to update action")
 	}
 
-	actions := d.GetRetrospectiveActions(RetrospectiveID)
+	actions := d.GetRetrospectiveActions(ctx, RetrospectiveID)
 
 	return actions, nil
 }
 
+// GetRetrospectiveActionHistory retrieves the previous contents of a retrospective action, newest first
+func (d *Database) GetRetrospectiveActionHistory(ctx context.Context, RetrospectiveID string, ActionID string) ([]*RetrospectiveEdit, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var edits = make([]*RetrospectiveEdit, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT rah.id, rah.user_id, rah.content, rah.updated_date
+		FROM retrospective_action_history rah
+		JOIN retrospective_action ra ON ra.id = rah.action_id
+		WHERE rah.action_id = $1 AND ra.retrospective_id = $2
+		ORDER BY rah.updated_date DESC;`,
+		ActionID,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveActionHistory", "retrospective_id", RetrospectiveID, "action_id", ActionID, "error", err)
+		return nil, errors.New("Unable to get action history")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var re RetrospectiveEdit
+		var editUserID sql.NullString
+		if err := rows.Scan(&re.ID, &editUserID, &re.Content, &re.UpdatedDate); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveActionHistory", "retrospective_id", RetrospectiveID, "action_id", ActionID, "error", err)
+		} else {
+			re.UserID = editUserID.String
+			edits = append(edits, &re)
+		}
+	}
+
+	return edits, nil
+}
+
 // DeleteRetrospectiveAction removes a goal from the current board by ID
-func (d *Database) DeleteRetrospectiveAction(RetrospectiveID string, userID string, ActionID string) ([]*RetrospectiveAction, error) {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+func (d *Database) DeleteRetrospectiveAction(ctx context.Context, RetrospectiveID string, userID string, ActionID string) ([]*RetrospectiveAction, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
-		`DELETE FROM retrospective_action WHERE id = $1;`, ActionID); err != nil {
-		log.Println(err)
+	if _, err := d.db.ExecContext(ctx,
+		`DELETE FROM retrospective_action WHERE id = $1 AND retrospective_id = $2;`, ActionID, RetrospectiveID); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteRetrospectiveAction", "retrospective_id", RetrospectiveID, "user_id", userID, "action_id", ActionID, "error", err)
 	}
 
-	actions := d.GetRetrospectiveActions(RetrospectiveID)
+	actions := d.GetRetrospectiveActions(ctx, RetrospectiveID)
 
 	return actions, nil
 }
 
 // GetRetrospectiveActions retrieves retrospective actions from the DB
-func (d *Database) GetRetrospectiveActions(RetrospectiveID string) []*RetrospectiveAction {
+func (d *Database) GetRetrospectiveActions(ctx context.Context, RetrospectiveID string) []*RetrospectiveAction {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var actions = make([]*RetrospectiveAction, 0)
 
-	actionRows, actionsErr := d.db.Query(
-		`SELECT id, retrospective_id, content, completed FROM retrospective_action WHERE retrospective_id = $1 ORDER BY created_date ASC;`,
+	actionRows, actionsErr := d.db.QueryContext(ctx,
+		`SELECT ra.id, ra.retrospective_id, ra.content, ra.completed, ra.assignee_id, COALESCE(u.name, ''), ra.due_date,
+			ra.tracker_id, ra.external_key, ra.external_url
+		FROM retrospective_action ra
+		LEFT JOIN users u ON u.id = ra.assignee_id
+		WHERE ra.retrospective_id = $1
+		ORDER BY ra.created_date ASC;`,
 		RetrospectiveID,
 	)
 	if actionsErr == nil {
 		defer actionRows.Close()
 		for actionRows.Next() {
-			var ri = &RetrospectiveAction{
-				ID:              "",
-				RetrospectiveID: "",
-				Content:         "",
-				Completed:       false,
-			}
-			if err := actionRows.Scan(&ri.ID, &ri.RetrospectiveID, &ri.Content, &ri.Completed); err != nil {
-				log.Println(err)
+			ri, err := scanRetrospectiveAction(actionRows)
+			if err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveActions", "retrospective_id", RetrospectiveID, "error", err)
 			} else {
 				actions = append(actions, ri)
 			}
@@ -84,3 +228,35 @@ func (d *Database) GetRetrospectiveActions(RetrospectiveID string) []*Retrospect
 
 	return actions
 }
+
+// scanRetrospectiveAction scans an action selected as id, retrospective_id, content, completed, assignee_id, assignee name,
+// due_date, tracker_id, external_key and external_url
+func scanRetrospectiveAction(rows *sql.Rows) (*RetrospectiveAction, error) {
+	var ri = &RetrospectiveAction{
+		ID:              "",
+		RetrospectiveID: "",
+		Content:         "",
+		Completed:       false,
+	}
+	var AssigneeID sql.NullString
+	var DueDate sql.NullTime
+	var TrackerID sql.NullString
+	var ExternalKey sql.NullString
+	var ExternalURL sql.NullString
+
+	if err := rows.Scan(
+		&ri.ID, &ri.RetrospectiveID, &ri.Content, &ri.Completed, &AssigneeID, &ri.AssigneeName, &DueDate,
+		&TrackerID, &ExternalKey, &ExternalURL,
+	); err != nil {
+		return nil, err
+	}
+	ri.AssigneeID = AssigneeID.String
+	ri.TrackerID = TrackerID.String
+	ri.ExternalKey = ExternalKey.String
+	ri.ExternalURL = ExternalURL.String
+	if DueDate.Valid {
+		ri.DueDate = DueDate.Time.Format(actionDueDateFormat)
+	}
+
+	return ri, nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpdateRetrospectiveAction(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		owner, _, _ := d.CreateUserRegistered(ctx, "Owner", testEmail("owner"), "password1", "")
+		member, _, _ := d.CreateUserRegistered(ctx, "Member", testEmail("member"), "password1", "")
+		stranger, _, _ := d.CreateUserRegistered(ctx, "Stranger", testEmail("stranger"), "password1", "")
+		retro, err := d.CreateRetrospective(ctx, owner.UserID, "Sprint")
+		if err != nil {
+			t.Fatalf("CreateRetrospective() = %v", err)
+		}
+		d.AddUserToRetrospective(ctx, retro.RetrospectiveID, member.UserID)
+		actions, err := d.CreateRetrospectiveAction(ctx, retro.RetrospectiveID, owner.UserID, "Fix the build")
+		if err != nil || len(actions) != 1 {
+			t.Fatalf("CreateRetrospectiveAction() = %v, %v", actions, err)
+		}
+		actionID := actions[0].ID
+
+		content := "Fix the flaky build"
+		completed := true
+		invalidDue := "next friday"
+		if _, err := d.UpdateRetrospectiveAction(ctx, retro.RetrospectiveID, owner.UserID, actionID, &RetrospectiveActionUpdate{
+			Content: &content, Completed: &completed, DueDate: &invalidDue,
+		}); err != ErrInvalidDueDate {
+			t.Errorf("UpdateRetrospectiveAction() with an invalid due date = %v, want ErrInvalidDueDate", err)
+		}
+		if _, err := d.UpdateRetrospectiveAction(ctx, retro.RetrospectiveID, owner.UserID, actionID, &RetrospectiveActionUpdate{
+			Content: &content, AssigneeID: &stranger.UserID,
+		}); err != ErrAssigneeNotUser {
+			t.Errorf("UpdateRetrospectiveAction() with a stranger as assignee = %v, want ErrAssigneeNotUser", err)
+		}
+
+		// rejected updates change nothing, not even the fields that were valid
+		action := d.GetRetrospectiveActions(ctx, retro.RetrospectiveID)[0]
+		if action.Content != "Fix the build" || action.Completed {
+			t.Errorf("rejected UpdateRetrospectiveAction() changed the action to %+v", action)
+		}
+		if history, _ := d.GetRetrospectiveActionHistory(ctx, retro.RetrospectiveID, actionID); len(history) != 0 {
+			t.Errorf("rejected UpdateRetrospectiveAction() added %d edits to the history", len(history))
+		}
+
+		due := "2026-11-02"
+		actions, err = d.UpdateRetrospectiveAction(ctx, retro.RetrospectiveID, owner.UserID, actionID, &RetrospectiveActionUpdate{
+			Content: &content, Completed: &completed, AssigneeID: &member.UserID, DueDate: &due,
+		})
+		if err != nil || len(actions) != 1 {
+			t.Fatalf("UpdateRetrospectiveAction() = %v, %v", actions, err)
+		}
+		if got := actions[0]; got.Content != content || !got.Completed || got.AssigneeID != member.UserID || got.DueDate != due {
+			t.Errorf("UpdateRetrospectiveAction() action = %+v", got)
+		}
+		if history, _ := d.GetRetrospectiveActionHistory(ctx, retro.RetrospectiveID, actionID); len(history) != 1 || history[0].Content != "Fix the build" {
+			t.Errorf("UpdateRetrospectiveAction() history = %+v, want the previous content", history)
+		}
+
+		if _, err := d.UpdateRetrospectiveAction(ctx, retro.RetrospectiveID, member.UserID, actionID, &RetrospectiveActionUpdate{
+			Completed: &completed,
+		}); err == nil || err == ErrInvalidDueDate || err == ErrAssigneeNotUser {
+			t.Errorf("UpdateRetrospectiveAction() by a participant = %v, want a permission error", err)
+		}
+	})
+}
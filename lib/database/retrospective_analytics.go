@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// the maximum number of themes and top voted items included in an analytics report
+const analyticsListLimit = 10
+
+// retrospective id subqueries for each analytics scope, $1 is the team, department or organization id
+const (
+	teamAnalyticsScope       = `SELECT tr.retrospective_id FROM team_retrospective tr WHERE tr.team_id = $1`
+	departmentAnalyticsScope = `SELECT tr.retrospective_id FROM team_retrospective tr
+		JOIN department_team dt ON dt.team_id = tr.team_id
+		WHERE dt.department_id = $1`
+	organizationAnalyticsScope = `SELECT tr.retrospective_id FROM team_retrospective tr
+		WHERE tr.team_id IN (
+			SELECT ot.team_id FROM organization_team ot WHERE ot.organization_id = $1
+			UNION
+			SELECT dt.team_id FROM department_team dt
+			JOIN organization_department od ON od.id = dt.department_id
+			WHERE od.organization_id = $1
+		)`
+)
+
+// TeamAnalytics gets a trend report across the teams retrospectives
+func (d *Database) TeamAnalytics(ctx context.Context, TeamID string) (*RetrospectiveAnalytics, error) {
+	return d.getRetrospectiveAnalytics(ctx, teamAnalyticsScope, TeamID)
+}
+
+// DepartmentAnalytics gets a trend report across the retrospectives of all the departments teams
+func (d *Database) DepartmentAnalytics(ctx context.Context, DepartmentID string) (*RetrospectiveAnalytics, error) {
+	return d.getRetrospectiveAnalytics(ctx, departmentAnalyticsScope, DepartmentID)
+}
+
+// OrganizationAnalytics gets a trend report across the retrospectives of all the organizations teams
+// including those that belong to its departments
+func (d *Database) OrganizationAnalytics(ctx context.Context, OrganizationID string) (*RetrospectiveAnalytics, error) {
+	return d.getRetrospectiveAnalytics(ctx, organizationAnalyticsScope, OrganizationID)
+}
+
+// getRetrospectiveAnalytics builds the trend report for the retrospectives returned by the scope subquery
+func (d *Database) getRetrospectiveAnalytics(ctx context.Context, Scope string, ScopeID string) (*RetrospectiveAnalytics, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var analytics = &RetrospectiveAnalytics{
+		Retrospectives: make([]*RetrospectiveTrend, 0),
+		Themes:         make([]*RetrospectiveTheme, 0),
+		TopItems:       make([]*RetrospectiveAnalyticsItem, 0),
+	}
+
+	trendRows, err := d.read.QueryContext(ctx,
+		`SELECT r.id, r.name, r.created_date,
+			(SELECT COUNT(*) FROM retrospective_user ru WHERE ru.retrospective_id = r.id),
+			(SELECT COUNT(DISTINCT ri.user_id) FROM retrospective_item ri WHERE ri.retrospective_id = r.id),
+			(SELECT COUNT(*) FROM retrospective_item ri WHERE ri.retrospective_id = r.id AND ri.type = 'worked'),
+			(SELECT COUNT(*) FROM retrospective_item ri WHERE ri.retrospective_id = r.id AND ri.type = 'improve'),
+			(SELECT COUNT(*) FROM retrospective_item ri WHERE ri.retrospective_id = r.id AND ri.type = 'question'),
+			(SELECT COUNT(*) FROM retrospective_action ra WHERE ra.retrospective_id = r.id),
+			(SELECT COUNT(*) FROM retrospective_action ra WHERE ra.retrospective_id = r.id AND ra.completed = true)
+		FROM retrospective r
+		WHERE r.id IN (`+Scope+`)
+		ORDER BY r.created_date ASC;`,
+		ScopeID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveAnalytics", "error", err)
+		return nil, errors.New("unable to get retrospective analytics")
+	}
+	defer trendRows.Close()
+
+	for trendRows.Next() {
+		var rt RetrospectiveTrend
+		if err := trendRows.Scan(
+			&rt.RetrospectiveID,
+			&rt.Name,
+			&rt.CreatedDate,
+			&rt.ParticipantCount,
+			&rt.ContributorCount,
+			&rt.WorkedCount,
+			&rt.ImproveCount,
+			&rt.QuestionCount,
+			&rt.ActionCount,
+			&rt.ActionsCompleted,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveAnalytics", "error", err)
+			return nil, errors.New("unable to get retrospective analytics")
+		}
+		analytics.Retrospectives = append(analytics.Retrospectives, &rt)
+		analytics.ActionCount = analytics.ActionCount + rt.ActionCount
+		analytics.ActionsCompleted = analytics.ActionsCompleted + rt.ActionsCompleted
+	}
+	analytics.RetrospectiveCount = len(analytics.Retrospectives)
+	if analytics.ActionCount > 0 {
+		analytics.ActionCompletionRate = float64(analytics.ActionsCompleted) / float64(analytics.ActionCount)
+	}
+
+	var meanHoursToClose sql.NullFloat64
+	if err := d.read.QueryRowContext(ctx,
+		`SELECT AVG(EXTRACT(EPOCH FROM (ra.completed_date - ra.created_date)) / 3600)
+		FROM retrospective_action ra
+		WHERE ra.retrospective_id IN (`+Scope+`) AND ra.completed = true AND ra.completed_date IS NOT NULL;`,
+		ScopeID,
+	).Scan(&meanHoursToClose); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveAnalytics", "error", err)
+		return nil, errors.New("unable to get retrospective analytics")
+	}
+	analytics.MeanHoursToClose = meanHoursToClose.Float64
+
+	topRows, err := d.read.QueryContext(ctx,
+		`SELECT ri.id, ri.retrospective_id, r.name, ri.type, ri.content, COALESCE(array_length(ri.votes, 1), 0) AS vote_count
+		FROM retrospective_item ri
+		JOIN retrospective r ON r.id = ri.retrospective_id
+		WHERE ri.retrospective_id IN (`+Scope+`)
+		ORDER BY vote_count DESC, ri.created_date ASC
+		LIMIT $2;`,
+		ScopeID,
+		analyticsListLimit,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveAnalytics", "error", err)
+		return nil, errors.New("unable to get retrospective analytics")
+	}
+	defer topRows.Close()
+
+	for topRows.Next() {
+		var ai RetrospectiveAnalyticsItem
+		if err := topRows.Scan(
+			&ai.ItemID,
+			&ai.RetrospectiveID,
+			&ai.RetrospectiveName,
+			&ai.Type,
+			&ai.Content,
+			&ai.VoteCount,
+		); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveAnalytics", "error", err)
+			return nil, errors.New("unable to get retrospective analytics")
+		}
+		if ai.VoteCount > 0 {
+			analytics.TopItems = append(analytics.TopItems, &ai)
+		}
+	}
+
+	themes, err := d.getRetrospectiveThemes(ctx, Scope, ScopeID)
+	if err != nil {
+		return nil, err
+	}
+	analytics.Themes = themes
+
+	return analytics, nil
+}
+
+// getRetrospectiveThemes finds the keywords that occur in items of more than one retrospective,
+// ordered by the number of retrospectives they occur in then the number of items
+func (d *Database) getRetrospectiveThemes(ctx context.Context, Scope string, ScopeID string) ([]*RetrospectiveTheme, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var themes = make([]*RetrospectiveTheme, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT ri.retrospective_id, ri.content FROM retrospective_item ri WHERE ri.retrospective_id IN (`+Scope+`);`,
+		ScopeID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveThemes", "error", err)
+		return nil, errors.New("unable to get retrospective analytics")
+	}
+	defer rows.Close()
+
+	themesByKeyword := make(map[string]*RetrospectiveTheme)
+	keywordRetrospectives := make(map[string]map[string]bool)
+	for rows.Next() {
+		var RetrospectiveID string
+		var Content string
+		if err := rows.Scan(&RetrospectiveID, &Content); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveThemes", "error", err)
+			return nil, errors.New("unable to get retrospective analytics")
+		}
+
+		seen := make(map[string]bool)
+		for _, keyword := range contentKeywords(Content) {
+			if seen[keyword] {
+				continue
+			}
+			seen[keyword] = true
+
+			theme, ok := themesByKeyword[keyword]
+			if !ok {
+				theme = &RetrospectiveTheme{Keyword: keyword}
+				themesByKeyword[keyword] = theme
+				keywordRetrospectives[keyword] = make(map[string]bool)
+			}
+			theme.ItemCount = theme.ItemCount + 1
+			keywordRetrospectives[keyword][RetrospectiveID] = true
+		}
+	}
+
+	for keyword, theme := range themesByKeyword {
+		theme.RetrospectiveCount = len(keywordRetrospectives[keyword])
+		if theme.RetrospectiveCount > 1 {
+			themes = append(themes, theme)
+		}
+	}
+
+	sort.Slice(themes, func(i, j int) bool {
+		if themes[i].RetrospectiveCount != themes[j].RetrospectiveCount {
+			return themes[i].RetrospectiveCount > themes[j].RetrospectiveCount
+		}
+		if themes[i].ItemCount != themes[j].ItemCount {
+			return themes[i].ItemCount > themes[j].ItemCount
+		}
+		return themes[i].Keyword < themes[j].Keyword
+	})
+	if len(themes) > analyticsListLimit {
+		themes = themes[:analyticsListLimit]
+	}
+
+	return themes, nil
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
+)
+
+// buildRetrospectiveDiscussion computes the discussion queue from the retrospective items and groups, top level
+// items and titled groups are ordered by their total votes (most first) then by creation order.
+// Items are combined in two ways: nesting stacks an item under a top level item of its column (parent_id, the
+// boards drag and drop stacking used by clients) and groups collect top level items under a title (group_id).
+// A nested item always follows its top level item, so a stack whose top level item is grouped joins the group
+func buildRetrospectiveDiscussion(FocusedItemID string, Groups []*RetrospectiveGroup, ItemLists ...[]*RetrospectiveItem) *RetrospectiveDiscussion {
+	var discussion = &RetrospectiveDiscussion{
+		FocusedItemID: FocusedItemID,
+		Queue:         make([]*RetrospectiveDiscussionItem, 0),
+	}
+
+	itemsByID := make(map[string]*RetrospectiveItem)
+	for _, items := range ItemLists {
+		for _, ri := range items {
+			itemsByID[ri.ID] = ri
+		}
+	}
+
+	groupsByID := make(map[string]*RetrospectiveGroup)
+	for _, rg := range Groups {
+		if len(rg.ItemIDs) > 0 {
+			groupsByID[rg.GroupID] = rg
+		}
+	}
+
+	// find the top level item of a group, guarding against cycles
+	rootOf := func(ri *RetrospectiveItem) *RetrospectiveItem {
+		visited := make(map[string]bool)
+		for ri.ParentID != "" && !visited[ri.ID] {
+			visited[ri.ID] = true
+			parent, ok := itemsByID[ri.ParentID]
+			if !ok {
+				break
+			}
+			ri = parent
+		}
+		return ri
+	}
+
+	// queue entries by their top level items id, or by group id for grouped items
+	queueItems := make(map[string]*RetrospectiveDiscussionItem)
+	for _, items := range ItemLists {
+		for _, ri := range items {
+			root := rootOf(ri)
+			key := root.ID
+			// a root still having a parent is an item whose parent is missing or part of a cycle, it isn't grouped
+			rg, grouped := groupsByID[root.GroupID]
+			if grouped && root.ParentID == "" {
+				key = rg.GroupID
+			} else {
+				grouped = false
+			}
+
+			qi, ok := queueItems[key]
+			if !ok {
+				lead := root
+				if grouped {
+					lead = itemsByID[rg.ItemIDs[0]]
+				}
+				qi = &RetrospectiveDiscussionItem{
+					ItemID:    lead.ID,
+					Type:      lead.Type,
+					Content:   lead.Content,
+					Discussed: true,
+				}
+				if grouped {
+					qi.GroupID = rg.GroupID
+					qi.Title = rg.Title
+					qi.VoteCount = rg.VoteCount
+				}
+				queueItems[key] = qi
+				discussion.Queue = append(discussion.Queue, qi)
+			}
+			if !grouped {
+				qi.VoteCount = qi.VoteCount + len(ri.Votes)
+			}
+			if ri.ID != qi.ItemID {
+				qi.ChildCount = qi.ChildCount + 1
+			}
+			// a group is only discussed once all of its items have been
+			qi.Discussed = qi.Discussed && root.Discussed
+		}
+	}
+
+	sort.SliceStable(discussion.Queue, func(i, j int) bool {
+		return discussion.Queue[i].VoteCount > discussion.Queue[j].VoteCount
+	})
+
+	return discussion
+}
+
+// inQueue checks whether the item is one of the discussion queues top level items, nested items can't be focused
+func (rd *RetrospectiveDiscussion) inQueue(ItemID string) bool {
+	for _, qi := range rd.Queue {
+		if qi.ItemID == ItemID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRetrospectiveDiscussion gets the retrospectives discussion queue and focused item
+func (d *Database) GetRetrospectiveDiscussion(ctx context.Context, RetrospectiveID string) (*RetrospectiveDiscussion, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var focusedItemID sql.NullString
+
+	e := d.db.QueryRowContext(ctx,
+		`SELECT focused_item_id FROM retrospective WHERE id = $1;`,
+		RetrospectiveID,
+	).Scan(&focusedItemID)
+	if e != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveDiscussion", "retrospective_id", RetrospectiveID, "error", e)
+		return nil, errors.New("Retrospective Not found")
+	}
+
+	worked, improve, question := d.GetRetrospectiveItems(ctx, RetrospectiveID)
+	groups := d.getRetrospectiveGroups(ctx, RetrospectiveID, worked, improve, question)
+
+	return buildRetrospectiveDiscussion(focusedItemID.String, groups, worked, improve, question), nil
+}
+
+// SetRetrospectiveFocus sets the item currently being discussed, an empty ItemID clears the focus
+func (d *Database) SetRetrospectiveFocus(ctx context.Context, RetrospectiveID string, userID string, ItemID string) (*RetrospectiveDiscussion, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	var focusedItemID sql.NullString
+	if ItemID != "" {
+		discussion, err := d.GetRetrospectiveDiscussion(ctx, RetrospectiveID)
+		if err != nil {
+			return nil, err
+		}
+		if !discussion.inQueue(ItemID) {
+			return nil, errors.New("Item is not in the discussion queue")
+		}
+		focusedItemID = sql.NullString{String: ItemID, Valid: true}
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective SET focused_item_id = $2, updated_date = NOW() WHERE id = $1;`,
+		RetrospectiveID, focusedItemID); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SetRetrospectiveFocus", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", err)
+		return nil, errors.New("Unable to set focused item")
+	}
+
+	return d.GetRetrospectiveDiscussion(ctx, RetrospectiveID)
+}
+
+// SetRetrospectiveItemDiscussed marks an item as discussed (or not discussed), along with the rest of its group
+func (d *Database) SetRetrospectiveItemDiscussed(ctx context.Context, RetrospectiveID string, userID string, ItemID string, Discussed bool) (*RetrospectiveDiscussion, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective_item SET discussed = $3, updated_date = NOW()
+		WHERE retrospective_id = $2 AND (id = $1 OR group_id IN (SELECT group_id FROM retrospective_item WHERE id = $1 AND retrospective_id = $2));`,
+		ItemID, RetrospectiveID, Discussed); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SetRetrospectiveItemDiscussed", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", err)
+		return nil, errors.New("Unable to mark item discussed")
+	}
+
+	return d.GetRetrospectiveDiscussion(ctx, RetrospectiveID)
+}
+
+// lockRetrospectiveDiscussion locks the retrospective row for the rest of the transaction and computes its
+// discussion queue from the items and groups as seen by the transaction
+func lockRetrospectiveDiscussion(ctx context.Context, tx *sql.Tx, RetrospectiveID string) (*RetrospectiveDiscussion, error) {
+	var focusedItemID sql.NullString
+	if err := tx.QueryRowContext(ctx,
+		`SELECT focused_item_id FROM retrospective WHERE id = $1 FOR UPDATE;`,
+		RetrospectiveID,
+	).Scan(&focusedItemID); err != nil {
+		return nil, err
+	}
+
+	itemRows, err := tx.QueryContext(ctx,
+		`SELECT id, parent_id, group_id, content, votes, type, discussed FROM retrospective_item WHERE retrospective_id = $1 ORDER BY created_date ASC;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	var items = make([]*RetrospectiveItem, 0)
+	for itemRows.Next() {
+		var parentID sql.NullString
+		var groupID sql.NullString
+		var ri = &RetrospectiveItem{
+			RetrospectiveID: RetrospectiveID,
+			Votes:           make([]string, 0),
+		}
+		if err := itemRows.Scan(&ri.ID, &parentID, &groupID, &ri.Content, pq.Array(&ri.Votes), &ri.Type, &ri.Discussed); err != nil {
+			return nil, err
+		}
+		ri.ParentID = parentID.String
+		ri.GroupID = groupID.String
+		items = append(items, ri)
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, err
+	}
+
+	groupRows, err := tx.QueryContext(ctx,
+		`SELECT id, title FROM retrospective_group WHERE retrospective_id = $1 ORDER BY created_date ASC;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer groupRows.Close()
+
+	var groups = make([]*RetrospectiveGroup, 0)
+	for groupRows.Next() {
+		var rg = &RetrospectiveGroup{
+			ItemIDs: make([]string, 0),
+		}
+		if err := groupRows.Scan(&rg.GroupID, &rg.Title); err != nil {
+			return nil, err
+		}
+		groups = append(groups, rg)
+	}
+	if err := groupRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildRetrospectiveDiscussion(focusedItemID.String, buildRetrospectiveGroups(groups, items), items), nil
+}
+
+// AdvanceRetrospectiveFocus marks the focused item (and the rest of its group) as discussed and focuses
+// the next not yet discussed item in the queue (clearing the focus when none remain), the retrospective
+// is locked while advancing so concurrent advances by several facilitators each move the focus on by one item
+func (d *Database) AdvanceRetrospectiveFocus(ctx context.Context, RetrospectiveID string, userID string) (*RetrospectiveDiscussion, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		discussion, err := lockRetrospectiveDiscussion(ctx, tx, RetrospectiveID)
+		if err != nil {
+			return err
+		}
+
+		var nextItemID sql.NullString
+		for _, qi := range discussion.Queue {
+			if !qi.Discussed && qi.ItemID != discussion.FocusedItemID {
+				nextItemID = sql.NullString{String: qi.ItemID, Valid: true}
+				break
+			}
+		}
+
+		if discussion.FocusedItemID != "" {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE retrospective_item SET discussed = true, updated_date = NOW()
+				WHERE retrospective_id = $2 AND (id = $1 OR group_id IN (SELECT group_id FROM retrospective_item WHERE id = $1 AND retrospective_id = $2));`,
+				discussion.FocusedItemID, RetrospectiveID); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE retrospective SET focused_item_id = $2, updated_date = NOW() WHERE id = $1;`,
+			RetrospectiveID, nextItemID)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "AdvanceRetrospectiveFocus", "retrospective_id", RetrospectiveID, "user_id", userID, "error", err)
+		return nil, errors.New("Unable to advance focused item")
+	}
+
+	return d.GetRetrospectiveDiscussion(ctx, RetrospectiveID)
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestAdvanceRetrospectiveFocus(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		owner, _, _ := d.CreateUserRegistered(ctx, "Owner", testEmail("owner"), "password1", "")
+		retro, err := d.CreateRetrospective(ctx, owner.UserID, "Sprint")
+		if err != nil {
+			t.Fatalf("CreateRetrospective() = %v", err)
+		}
+		var itemIDs []string
+		for _, content := range []string{"Shipped", "Paired", "Demoed", "Celebrated"} {
+			items, err := d.CreateRetrospectiveItemWorked(ctx, retro.RetrospectiveID, owner.UserID, content)
+			if err != nil {
+				t.Fatalf("CreateRetrospectiveItemWorked() = %v", err)
+			}
+			itemIDs = append(itemIDs, items[len(items)-1].ID)
+		}
+
+		if _, err := d.SetRetrospectiveFocus(ctx, retro.RetrospectiveID, owner.UserID, itemIDs[0]); err != nil {
+			t.Fatalf("SetRetrospectiveFocus() = %v", err)
+		}
+
+		// facilitators advancing at the same time each move the focus on by one item
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := d.AdvanceRetrospectiveFocus(ctx, retro.RetrospectiveID, owner.UserID); err != nil {
+					t.Errorf("AdvanceRetrospectiveFocus() = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		discussion, err := d.GetRetrospectiveDiscussion(ctx, retro.RetrospectiveID)
+		if err != nil {
+			t.Fatalf("GetRetrospectiveDiscussion() = %v", err)
+		}
+		if discussion.FocusedItemID != itemIDs[2] {
+			t.Errorf("FocusedItemID after two advances = %q, want %q", discussion.FocusedItemID, itemIDs[2])
+		}
+		discussed := make(map[string]bool)
+		for _, qi := range discussion.Queue {
+			discussed[qi.ItemID] = qi.Discussed
+		}
+		for i, want := range []bool{true, true, false, false} {
+			if discussed[itemIDs[i]] != want {
+				t.Errorf("item %d discussed = %v, want %v", i, discussed[itemIDs[i]], want)
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := d.AdvanceRetrospectiveFocus(ctx, retro.RetrospectiveID, owner.UserID); err != nil {
+				t.Fatalf("AdvanceRetrospectiveFocus() = %v", err)
+			}
+		}
+		if discussion, _ := d.GetRetrospectiveDiscussion(ctx, retro.RetrospectiveID); discussion.FocusedItemID != "" {
+			t.Errorf("FocusedItemID after the last item = %q, want none", discussion.FocusedItemID)
+		}
+	})
+}
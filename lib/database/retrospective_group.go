@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
+)
+
+// buildRetrospectiveGroups attaches the grouped items to their groups and totals the groups votes,
+// votes on items nested under a grouped item count towards the group
+func buildRetrospectiveGroups(Groups []*RetrospectiveGroup, ItemLists ...[]*RetrospectiveItem) []*RetrospectiveGroup {
+	groupsByID := make(map[string]*RetrospectiveGroup)
+	for _, rg := range Groups {
+		groupsByID[rg.GroupID] = rg
+	}
+
+	itemGroups := make(map[string]*RetrospectiveGroup)
+	for _, items := range ItemLists {
+		for _, ri := range items {
+			if rg, ok := groupsByID[ri.GroupID]; ok && ri.ParentID == "" {
+				rg.ItemIDs = append(rg.ItemIDs, ri.ID)
+				itemGroups[ri.ID] = rg
+			}
+		}
+	}
+
+	for _, items := range ItemLists {
+		for _, ri := range items {
+			rg, ok := itemGroups[ri.ID]
+			if !ok {
+				rg, ok = itemGroups[ri.ParentID]
+			}
+			if ok {
+				rg.VoteCount = rg.VoteCount + len(ri.Votes)
+			}
+		}
+	}
+
+	return Groups
+}
+
+// getRetrospectiveGroups gets the retrospectives groups with their items and vote totals
+func (d *Database) getRetrospectiveGroups(ctx context.Context, RetrospectiveID string, ItemLists ...[]*RetrospectiveItem) []*RetrospectiveGroup {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var groups = make([]*RetrospectiveGroup, 0)
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, title FROM retrospective_group WHERE retrospective_id = $1 ORDER BY created_date ASC;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveGroups", "retrospective_id", RetrospectiveID, "error", err)
+		return groups
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rg = &RetrospectiveGroup{
+			ItemIDs: make([]string, 0),
+		}
+		if err := rows.Scan(&rg.GroupID, &rg.Title); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveGroups", "retrospective_id", RetrospectiveID, "error", err)
+		} else {
+			groups = append(groups, rg)
+		}
+	}
+
+	return buildRetrospectiveGroups(groups, ItemLists...)
+}
+
+// GetRetrospectiveBoard gets the retrospectives items and groups
+func (d *Database) GetRetrospectiveBoard(ctx context.Context, RetrospectiveID string) *RetrospectiveBoard {
+	worked, improve, question := d.GetRetrospectiveItems(ctx, RetrospectiveID)
+
+	return &RetrospectiveBoard{
+		WorkedItems:   worked,
+		ImproveItems:  improve,
+		QuestionItems: question,
+		Groups:        d.getRetrospectiveGroups(ctx, RetrospectiveID, worked, improve, question),
+	}
+}
+
+// confirmRetrospectiveItems confirms every item belongs to the retrospective
+func confirmRetrospectiveItems(ctx context.Context, tx *sql.Tx, RetrospectiveID string, ItemIDs []string) error {
+	uniqueIDs := make(map[string]bool)
+	for _, ItemID := range ItemIDs {
+		uniqueIDs[ItemID] = true
+	}
+
+	var itemCount int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM retrospective_item WHERE retrospective_id = $1 AND id = ANY($2);`,
+		RetrospectiveID, pq.Array(ItemIDs),
+	).Scan(&itemCount); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "confirmRetrospectiveItems", "retrospective_id", RetrospectiveID, "error", err)
+		return errors.New("Unable to find items")
+	}
+	if len(uniqueIDs) == 0 || itemCount != len(uniqueIDs) {
+		return errors.New("items not found in retrospective")
+	}
+
+	return nil
+}
+
+// confirmRetrospectiveGroups confirms every group belongs to the retrospective
+func confirmRetrospectiveGroups(ctx context.Context, tx *sql.Tx, RetrospectiveID string, GroupIDs []string) error {
+	uniqueIDs := make(map[string]bool)
+	for _, GroupID := range GroupIDs {
+		uniqueIDs[GroupID] = true
+	}
+
+	var groupCount int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM retrospective_group WHERE retrospective_id = $1 AND id = ANY($2);`,
+		RetrospectiveID, pq.Array(GroupIDs),
+	).Scan(&groupCount); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "confirmRetrospectiveGroups", "retrospective_id", RetrospectiveID, "error", err)
+		return errors.New("Unable to find groups")
+	}
+	if len(uniqueIDs) == 0 || groupCount != len(uniqueIDs) {
+		return errors.New("groups not found in retrospective")
+	}
+
+	return nil
+}
+
+// moveRetrospectiveItems moves the items into the group (or out of any group when GroupID is null),
+// nested items are unnested since only top level items belong to a group
+func moveRetrospectiveItems(ctx context.Context, tx *sql.Tx, RetrospectiveID string, GroupID sql.NullString, ItemIDs []string) error {
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE retrospective_item SET group_id = $2, parent_id = NULL, updated_date = NOW()
+		WHERE retrospective_id = $1 AND id = ANY($3);`,
+		RetrospectiveID, GroupID, pq.Array(ItemIDs)); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "moveRetrospectiveItems", "retrospective_id", RetrospectiveID, "error", err)
+		return errors.New("Unable to move items")
+	}
+
+	return nil
+}
+
+// CreateRetrospectiveGroup creates a titled group containing the items
+func (d *Database) CreateRetrospectiveGroup(ctx context.Context, RetrospectiveID string, userID string, Title string, ItemIDs []string) (*RetrospectiveBoard, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	if Title == "" {
+		return nil, errors.New("group title is required")
+	}
+
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := confirmRetrospectiveItems(ctx, tx, RetrospectiveID, ItemIDs); err != nil {
+			return err
+		}
+
+		var GroupID string
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO retrospective_group (retrospective_id, title) VALUES ($1, $2) RETURNING id;`,
+			RetrospectiveID, Title,
+		).Scan(&GroupID); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospectiveGroup", "retrospective_id", RetrospectiveID, "user_id", userID, "error", err)
+			return errors.New("Unable to create group")
+		}
+
+		if err := moveRetrospectiveItems(ctx, tx, RetrospectiveID, sql.NullString{String: GroupID, Valid: true}, ItemIDs); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetRetrospectiveBoard(ctx, RetrospectiveID), nil
+}
+
+// UpdateRetrospectiveGroupTitle renames a group
+func (d *Database) UpdateRetrospectiveGroupTitle(ctx context.Context, RetrospectiveID string, userID string, GroupID string, Title string) (*RetrospectiveBoard, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	if Title == "" {
+		return nil, errors.New("group title is required")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective_group SET title = $3, updated_date = NOW() WHERE id = $2 AND retrospective_id = $1;`,
+		RetrospectiveID, GroupID, Title); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateRetrospectiveGroupTitle", "retrospective_id", RetrospectiveID, "user_id", userID, "group_id", GroupID, "error", err)
+		return nil, errors.New("Unable to update group")
+	}
+
+	return d.GetRetrospectiveBoard(ctx, RetrospectiveID), nil
+}
+
+// MoveRetrospectiveItems moves the items into a group in a single transaction,
+// an empty GroupID removes the items from their groups
+func (d *Database) MoveRetrospectiveItems(ctx context.Context, RetrospectiveID string, userID string, GroupID string, ItemIDs []string) (*RetrospectiveBoard, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := confirmRetrospectiveItems(ctx, tx, RetrospectiveID, ItemIDs); err != nil {
+			return err
+		}
+
+		var groupID sql.NullString
+		if GroupID != "" {
+			if err := confirmRetrospectiveGroups(ctx, tx, RetrospectiveID, []string{GroupID}); err != nil {
+				return err
+			}
+			groupID = sql.NullString{String: GroupID, Valid: true}
+		}
+
+		if err := moveRetrospectiveItems(ctx, tx, RetrospectiveID, groupID, ItemIDs); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetRetrospectiveBoard(ctx, RetrospectiveID), nil
+}
+
+// MergeRetrospectiveGroups moves the items of the source groups into the target group
+// and deletes the source groups in a single transaction
+func (d *Database) MergeRetrospectiveGroups(ctx context.Context, RetrospectiveID string, userID string, GroupID string, SourceGroupIDs []string) (*RetrospectiveBoard, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	sourceGroupIDs := make([]string, 0, len(SourceGroupIDs))
+	for _, SourceGroupID := range SourceGroupIDs {
+		if SourceGroupID != GroupID {
+			sourceGroupIDs = append(sourceGroupIDs, SourceGroupID)
+		}
+	}
+
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		if err := confirmRetrospectiveGroups(ctx, tx, RetrospectiveID, append([]string{GroupID}, sourceGroupIDs...)); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE retrospective_item SET group_id = $2, updated_date = NOW()
+			WHERE retrospective_id = $1 AND group_id = ANY($3);`,
+			RetrospectiveID, GroupID, pq.Array(sourceGroupIDs)); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "MergeRetrospectiveGroups", "retrospective_id", RetrospectiveID, "user_id", userID, "group_id", GroupID, "error", err)
+			return errors.New("Unable to merge groups")
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM retrospective_group WHERE retrospective_id = $1 AND id = ANY($2);`,
+			RetrospectiveID, pq.Array(sourceGroupIDs)); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "MergeRetrospectiveGroups", "retrospective_id", RetrospectiveID, "user_id", userID, "group_id", GroupID, "error", err)
+			return errors.New("Unable to merge groups")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetRetrospectiveBoard(ctx, RetrospectiveID), nil
+}
+
+// DeleteRetrospectiveGroup deletes a group, its items are kept but no longer grouped
+func (d *Database) DeleteRetrospectiveGroup(ctx context.Context, RetrospectiveID string, userID string, GroupID string) (*RetrospectiveBoard, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`DELETE FROM retrospective_group WHERE id = $2 AND retrospective_id = $1;`,
+		RetrospectiveID, GroupID); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteRetrospectiveGroup", "retrospective_id", RetrospectiveID, "user_id", userID, "group_id", GroupID, "error", err)
+		return nil, errors.New("Unable to delete group")
+	}
+
+	return d.GetRetrospectiveBoard(ctx, RetrospectiveID), nil
+}
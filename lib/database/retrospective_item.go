@@ -1,15 +1,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"log"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/lib/pq"
 )
 
 // FilterItemsByUser filters the list of items by userId
-func (d *Database) FilterItemsByUser(UserID string, Items []*RetrospectiveItem) []*RetrospectiveItem {
+func (d *Database) FilterItemsByUser(ctx context.Context, UserID string, Items []*RetrospectiveItem) []*RetrospectiveItem {
 	filteredItems := make([]*RetrospectiveItem, 0)
 
 	for _, item := range Items {
@@ -22,128 +23,337 @@ func (d *Database) FilterItemsByUser(UserID string, Items []*RetrospectiveItem)
 }
 
 // CreateRetrospectiveItemWorked adds a worked item to the retrospective
-func (d *Database) CreateRetrospectiveItemWorked(RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveItem, error) {
+func (d *Database) CreateRetrospectiveItemWorked(ctx context.Context, RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveItem, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmContributor(ctx, RetrospectiveID, UserID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
 	var Type string = "worked"
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`INSERT INTO retrospective_item
 		(retrospective_id, type, content, user_id)
 		VALUES ($1,$2, $3, $4);`,
 		RetrospectiveID, Type, Content, UserID,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospectiveItemWorked", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	items, _, _ := d.GetRetrospectiveItems(RetrospectiveID)
+	items, _, _ := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return items, nil
 }
 
 // CreateRetrospectiveItemImprove adds a improve item to the retrospective
-func (d *Database) CreateRetrospectiveItemImprove(RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveItem, error) {
+func (d *Database) CreateRetrospectiveItemImprove(ctx context.Context, RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveItem, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmContributor(ctx, RetrospectiveID, UserID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
 	var Type string = "improve"
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`INSERT INTO retrospective_item
 		(retrospective_id, type, content, user_id)
 		VALUES ($1,$2, $3, $4);`,
 		RetrospectiveID, Type, Content, UserID,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospectiveItemImprove", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	_, items, _ := d.GetRetrospectiveItems(RetrospectiveID)
+	_, items, _ := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return items, nil
 }
 
 // CreateRetrospectiveItemQuestion adds a question item to the retrospective
-func (d *Database) CreateRetrospectiveItemQuestion(RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveItem, error) {
+func (d *Database) CreateRetrospectiveItemQuestion(ctx context.Context, RetrospectiveID string, UserID string, Content string) ([]*RetrospectiveItem, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmContributor(ctx, RetrospectiveID, UserID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
 	var Type string = "question"
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`INSERT INTO retrospective_item
 		(retrospective_id, type, content, user_id)
 		VALUES ($1,$2, $3, $4);`,
 		RetrospectiveID, Type, Content, UserID,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospectiveItemQuestion", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	_, _, items := d.GetRetrospectiveItems(RetrospectiveID)
+	_, _, items := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return items, nil
 }
 
-// NestRetrospectiveItem nests a item under another
-func (d *Database) NestRetrospectiveItem(RetrospectiveID string, userID string, ItemID string, ParentID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+// NestRetrospectiveItem nests a item under another, the parent must be a top level item in the same retrospective
+// and column, any items already nested under the item are moved under the new parent to keep groups one level deep
+func (d *Database) NestRetrospectiveItem(ctx context.Context, RetrospectiveID string, userID string, ItemID string, ParentID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return nil, nil, nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
-		`UPDATE retrospective_item SET parent_id = $2, updated_date = NOW() WHERE id = $1;`, ItemID, ParentID); err != nil {
-		log.Println(err)
+	if ItemID == ParentID {
+		return nil, nil, nil, errors.New("item cannot be nested under itself")
+	}
+
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		var itemType string
+		var parentType string
+		var parentParentID sql.NullString
+		if err := tx.QueryRowContext(ctx,
+			`SELECT i.type, p.type, p.parent_id
+			FROM retrospective_item i
+			JOIN retrospective_item p ON p.id = $3 AND p.retrospective_id = i.retrospective_id
+			WHERE i.id = $2 AND i.retrospective_id = $1
+			FOR UPDATE;`,
+			RetrospectiveID, ItemID, ParentID,
+		).Scan(&itemType, &parentType, &parentParentID); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "NestRetrospectiveItem", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "parent_id", ParentID, "error", err)
+			return errors.New("items not found in retrospective")
+		}
+		if itemType != parentType {
+			return errors.New("items must be in the same column to be nested")
+		}
+		if parentParentID.Valid {
+			return errors.New("cannot nest under an item that is itself nested")
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE retrospective_item SET parent_id = $3, group_id = NULL, updated_date = NOW()
+			WHERE retrospective_id = $1 AND (id = $2 OR parent_id = $2);`,
+			RetrospectiveID, ItemID, ParentID); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "NestRetrospectiveItem", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "parent_id", ParentID, "error", err)
+			return errors.New("Unable to nest item")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(RetrospectiveID)
+	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return workedItems, improveItems, questionItems, nil
 }
 
-// NestRetrospectiveItem unnests a item from under another
-func (d *Database) UnNestRetrospectiveItem(RetrospectiveID string, userID string, ItemID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+// UnNestRetrospectiveItem unnests a item from under another, the item must be a nested item of the retrospective
+func (d *Database) UnNestRetrospectiveItem(ctx context.Context, RetrospectiveID string, userID string, ItemID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return nil, nil, nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
-		`UPDATE retrospective_item SET parent_id = null, updated_date = NOW() WHERE id = $1;`, ItemID); err != nil {
-		log.Println(err)
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective_item SET parent_id = null, updated_date = NOW()
+		WHERE id = $1 AND retrospective_id = $2 AND parent_id IS NOT NULL;`, ItemID, RetrospectiveID)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UnNestRetrospectiveItem", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", err)
+		return nil, nil, nil, errors.New("Unable to unnest item")
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return nil, nil, nil, errors.New("nested item not found in retrospective")
 	}
 
-	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(RetrospectiveID)
+	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return workedItems, improveItems, questionItems, nil
 }
 
 // VoteRetrospectiveItem votes for a retrospective item
-func (d *Database) VoteRetrospectiveItem(RetrospectiveID string, userID string, ItemID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
-	if _, err := d.db.Exec(
+func (d *Database) VoteRetrospectiveItem(ctx context.Context, RetrospectiveID string, userID string, ItemID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmContributor(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, nil, nil, errors.New("Incorrect permissions")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
 		`call vote_retrospective_item($1, $2);`, ItemID, userID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "VoteRetrospectiveItem", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", err)
 	}
 
-	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(RetrospectiveID)
+	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return workedItems, improveItems, questionItems, nil
 }
 
+// getRetrospectiveItemType gets the type of an item, confirming it belongs to the retrospective
+func (d *Database) getRetrospectiveItemType(ctx context.Context, RetrospectiveID string, ItemID string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var itemType string
+
+	e := d.db.QueryRowContext(ctx,
+		`SELECT type FROM retrospective_item WHERE id = $1 AND retrospective_id = $2;`,
+		ItemID,
+		RetrospectiveID,
+	).Scan(&itemType)
+	if e != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveItemType", "retrospective_id", RetrospectiveID, "item_id", ItemID, "error", e)
+		return "", errors.New("Item Not found")
+	}
+
+	return itemType, nil
+}
+
+// getRetrospectiveItemsByType retrieves the retrospective items of the given type
+func (d *Database) getRetrospectiveItemsByType(ctx context.Context, RetrospectiveID string, ItemType string) []*RetrospectiveItem {
+	worked, improve, question := d.GetRetrospectiveItems(ctx, RetrospectiveID)
+
+	switch ItemType {
+	case "improve":
+		return improve
+	case "question":
+		return question
+	default:
+		return worked
+	}
+}
+
+// confirmItemAuthorOrFacilitator confirms the item belongs to the retrospective and that the user
+// is either the items author or a facilitator of the retrospective, returning the items type
+func (d *Database) confirmItemAuthorOrFacilitator(ctx context.Context, RetrospectiveID string, userID string, ItemID string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var authorID sql.NullString
+	var itemType string
+
+	e := d.db.QueryRowContext(ctx,
+		`SELECT user_id, type FROM retrospective_item WHERE id = $1 AND retrospective_id = $2;`,
+		ItemID,
+		RetrospectiveID,
+	).Scan(&authorID, &itemType)
+	if e != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "confirmItemAuthorOrFacilitator", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", e)
+		return "", errors.New("Item Not found")
+	}
+
+	if authorID.String != userID {
+		if err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID); err != nil {
+			return "", errors.New("Incorrect permissions")
+		}
+	}
+
+	return itemType, nil
+}
+
+// UpdateRetrospectiveItem updates an items content keeping the previous content in its edit history,
+// returning the items type along with the updated items of that type
+func (d *Database) UpdateRetrospectiveItem(ctx context.Context, RetrospectiveID string, userID string, ItemID string, Content string) (ItemType string, Items []*RetrospectiveItem, UpdateError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	itemType, err := d.confirmItemAuthorOrFacilitator(ctx, RetrospectiveID, userID, ItemID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`call retrospective_item_update($1, $2, $3, $4);`, RetrospectiveID, ItemID, userID, Content); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateRetrospectiveItem", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", err)
+		return "", nil, errors.New("Unable to update item")
+	}
+
+	return itemType, d.getRetrospectiveItemsByType(ctx, RetrospectiveID, itemType), nil
+}
+
+// GetRetrospectiveItemHistory retrieves the previous contents of a retrospective item, newest first
+func (d *Database) GetRetrospectiveItemHistory(ctx context.Context, RetrospectiveID string, ItemID string) ([]*RetrospectiveEdit, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var edits = make([]*RetrospectiveEdit, 0)
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT rih.id, rih.user_id, rih.content, rih.updated_date
+		FROM retrospective_item_history rih
+		JOIN retrospective_item ri ON ri.id = rih.item_id
+		WHERE rih.item_id = $1 AND ri.retrospective_id = $2
+		ORDER BY rih.updated_date DESC;`,
+		ItemID,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveItemHistory", "retrospective_id", RetrospectiveID, "item_id", ItemID, "error", err)
+		return nil, errors.New("Unable to get item history")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var re RetrospectiveEdit
+		var editUserID sql.NullString
+		if err := rows.Scan(&re.ID, &editUserID, &re.Content, &re.UpdatedDate); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveItemHistory", "retrospective_id", RetrospectiveID, "item_id", ItemID, "error", err)
+		} else {
+			re.UserID = editUserID.String
+			edits = append(edits, &re)
+		}
+	}
+
+	return edits, nil
+}
+
 // DeleteRetrospectiveItem removes a item from the current board by ID
-func (d *Database) DeleteRetrospectiveItem(RetrospectiveID string, userID string, ItemID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
-	if _, err := d.db.Exec(
-		`DELETE FROM retrospective_item WHERE id = $1;`, ItemID); err != nil {
-		log.Println(err)
+func (d *Database) DeleteRetrospectiveItem(ctx context.Context, RetrospectiveID string, userID string, ItemID string) (WorkedItems []*RetrospectiveItem, ImproveItems []*RetrospectiveItem, QuestionItems []*RetrospectiveItem, DeleteError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.confirmItemAuthorOrFacilitator(ctx, RetrospectiveID, userID, ItemID); err != nil {
+		return nil, nil, nil, err
 	}
 
-	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(RetrospectiveID)
+	if _, err := d.db.ExecContext(ctx,
+		`DELETE FROM retrospective_item WHERE id = $1 AND retrospective_id = $2;`, ItemID, RetrospectiveID); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteRetrospectiveItem", "retrospective_id", RetrospectiveID, "user_id", userID, "item_id", ItemID, "error", err)
+	}
+
+	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(ctx, RetrospectiveID)
 
 	return workedItems, improveItems, questionItems, nil
 }
 
 // GetRetrospectiveItems retrieves retrospective items from the DB
-func (d *Database) GetRetrospectiveItems(RetrospectiveID string) (Worked []*RetrospectiveItem, Improve []*RetrospectiveItem, Question []*RetrospectiveItem) {
+func (d *Database) GetRetrospectiveItems(ctx context.Context, RetrospectiveID string) (Worked []*RetrospectiveItem, Improve []*RetrospectiveItem, Question []*RetrospectiveItem) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var itemsWorked = make([]*RetrospectiveItem, 0)
 	var itemsImprove = make([]*RetrospectiveItem, 0)
 	var itemsQuestion = make([]*RetrospectiveItem, 0)
 
-	itemRows, itemsErr := d.db.Query(
-		`SELECT id, retrospective_id, user_id, parent_id, content, votes, type FROM retrospective_item WHERE retrospective_id = $1 ORDER BY created_date ASC;`,
+	itemRows, itemsErr := d.db.QueryContext(ctx,
+		`SELECT id, retrospective_id, user_id, parent_id, group_id, content, votes, type, discussed FROM retrospective_item WHERE retrospective_id = $1 ORDER BY created_date ASC;`,
 		RetrospectiveID,
 	)
 	if itemsErr == nil {
 		defer itemRows.Close()
 		for itemRows.Next() {
 			var parentId sql.NullString
+			var groupId sql.NullString
 			var ri = &RetrospectiveItem{
 				ID:              "",
 				RetrospectiveID: "",
@@ -152,11 +362,14 @@ func (d *Database) GetRetrospectiveItems(RetrospectiveID string) (Worked []*Retr
 				Content:         "",
 				Type:            "",
 				Votes:           make([]string, 0),
+				Comments:        make([]*RetrospectiveItemComment, 0),
+				Reactions:       make([]*RetrospectiveItemReaction, 0),
 			}
-			if err := itemRows.Scan(&ri.ID, &ri.RetrospectiveID, &ri.UserID, &parentId, &ri.Content, pq.Array(&ri.Votes), &ri.Type); err != nil {
-				log.Println(err)
+			if err := itemRows.Scan(&ri.ID, &ri.RetrospectiveID, &ri.UserID, &parentId, &groupId, &ri.Content, pq.Array(&ri.Votes), &ri.Type, &ri.Discussed); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveItems", "retrospective_id", RetrospectiveID, "error", err)
 			} else {
 				ri.ParentID = parentId.String
+				ri.GroupID = groupId.String
 				if ri.Type == "worked" {
 					itemsWorked = append(itemsWorked, ri)
 				}
@@ -169,7 +382,20 @@ func (d *Database) GetRetrospectiveItems(RetrospectiveID string) (Worked []*Retr
 			}
 		}
 	} else {
-		log.Println(itemsErr)
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveItems", "retrospective_id", RetrospectiveID, "error", itemsErr)
+	}
+
+	comments := d.getRetrospectiveItemComments(ctx, RetrospectiveID)
+	reactions := d.getRetrospectiveItemReactions(ctx, RetrospectiveID)
+	for _, items := range [][]*RetrospectiveItem{itemsWorked, itemsImprove, itemsQuestion} {
+		for _, ri := range items {
+			if c, ok := comments[ri.ID]; ok {
+				ri.Comments = c
+			}
+			if r, ok := reactions[ri.ID]; ok {
+				ri.Reactions = r
+			}
+		}
 	}
 
 	return itemsWorked, itemsImprove, itemsQuestion
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+// the minimum cosine similarity for two items to be suggested in the same group
+const itemClusterThreshold = 0.3
+
+// the number of shared keywords reported for a suggested group
+const itemClusterKeywordLimit = 3
+
+// itemVector is an items TF-IDF weighted stem vector
+type itemVector struct {
+	item    *RetrospectiveItem
+	weights map[string]float64
+	norm    float64
+}
+
+// buildItemVectors weights each items stems by term frequency and inverse document frequency
+// (documents being the items themselves) so words common to every item carry little weight
+func buildItemVectors(Items []*RetrospectiveItem) []*itemVector {
+	var vectors = make([]*itemVector, 0, len(Items))
+	documentFrequency := make(map[string]int)
+	termFrequencies := make([]map[string]int, 0, len(Items))
+
+	for _, ri := range Items {
+		tf := make(map[string]int)
+		for _, stem := range contentStems(ri.Content) {
+			tf[stem] = tf[stem] + 1
+		}
+		for stem := range tf {
+			documentFrequency[stem] = documentFrequency[stem] + 1
+		}
+		termFrequencies = append(termFrequencies, tf)
+	}
+
+	documentCount := float64(len(Items))
+	for i, ri := range Items {
+		v := &itemVector{item: ri, weights: make(map[string]float64)}
+		for stem, count := range termFrequencies[i] {
+			// smoothed idf so stems shared by every item still count for something
+			idf := math.Log((1+documentCount)/(1+float64(documentFrequency[stem]))) + 1
+			weight := float64(count) * idf
+			v.weights[stem] = weight
+			v.norm = v.norm + weight*weight
+		}
+		v.norm = math.Sqrt(v.norm)
+		vectors = append(vectors, v)
+	}
+
+	return vectors
+}
+
+// cosineSimilarity of two item vectors, 0 when either item has no keywords
+func cosineSimilarity(a *itemVector, b *itemVector) float64 {
+	if a.norm == 0 || b.norm == 0 {
+		return 0
+	}
+
+	var dot float64
+	for stem, weight := range a.weights {
+		dot = dot + weight*b.weights[stem]
+	}
+
+	return dot / (a.norm * b.norm)
+}
+
+// clusterRetrospectiveItems proposes groups of similar ungrouped top level items within and across columns,
+// pairs are linked most similar first and each groups items are listed most voted first
+func clusterRetrospectiveItems(Items []*RetrospectiveItem) []*RetrospectiveItemCluster {
+	var clusters = make([]*RetrospectiveItemCluster, 0)
+
+	topLevel := make([]*RetrospectiveItem, 0)
+	for _, ri := range Items {
+		if ri.ParentID == "" && ri.GroupID == "" {
+			topLevel = append(topLevel, ri)
+		}
+	}
+	vectors := buildItemVectors(topLevel)
+
+	type itemPair struct {
+		a, b       int
+		similarity float64
+	}
+	pairs := make([]itemPair, 0)
+	for i := 0; i < len(vectors); i++ {
+		for j := i + 1; j < len(vectors); j++ {
+			if similarity := cosineSimilarity(vectors[i], vectors[j]); similarity >= itemClusterThreshold {
+				pairs = append(pairs, itemPair{i, j, similarity})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].similarity > pairs[j].similarity
+	})
+
+	// union find over the item indexes
+	groupOf := make([]int, len(vectors))
+	for i := range groupOf {
+		groupOf[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if groupOf[i] != i {
+			groupOf[i] = find(groupOf[i])
+		}
+		return groupOf[i]
+	}
+	minSimilarity := make(map[int]float64)
+	for _, p := range pairs {
+		ga, gb := find(p.a), find(p.b)
+		if ga == gb {
+			continue
+		}
+		groupOf[gb] = ga
+		similarity := p.similarity
+		for _, g := range []int{ga, gb} {
+			if s, ok := minSimilarity[g]; ok && s < similarity {
+				similarity = s
+			}
+		}
+		delete(minSimilarity, gb)
+		minSimilarity[ga] = similarity
+	}
+
+	members := make(map[int][]int)
+	roots := make([]int, 0)
+	for i := range vectors {
+		g := find(i)
+		if _, ok := members[g]; !ok {
+			roots = append(roots, g)
+		}
+		members[g] = append(members[g], i)
+	}
+
+	for _, g := range roots {
+		if len(members[g]) < 2 {
+			continue
+		}
+
+		parent := members[g][0]
+		stemWeights := make(map[string]float64)
+		stemItems := make(map[string]int)
+		for _, i := range members[g] {
+			if len(vectors[i].item.Votes) > len(vectors[parent].item.Votes) {
+				parent = i
+			}
+			for stem, weight := range vectors[i].weights {
+				stemWeights[stem] = stemWeights[stem] + weight
+				stemItems[stem] = stemItems[stem] + 1
+			}
+		}
+
+		cluster := &RetrospectiveItemCluster{
+			ItemIDs:    []string{vectors[parent].item.ID},
+			Keywords:   make([]string, 0),
+			Similarity: minSimilarity[g],
+		}
+		for _, i := range members[g] {
+			if i != parent {
+				cluster.ItemIDs = append(cluster.ItemIDs, vectors[i].item.ID)
+			}
+		}
+
+		shared := make([]string, 0)
+		for stem, count := range stemItems {
+			if count > 1 {
+				shared = append(shared, stem)
+			}
+		}
+		sort.Slice(shared, func(i, j int) bool {
+			if stemWeights[shared[i]] != stemWeights[shared[j]] {
+				return stemWeights[shared[i]] > stemWeights[shared[j]]
+			}
+			return shared[i] < shared[j]
+		})
+		if len(shared) > itemClusterKeywordLimit {
+			shared = shared[:itemClusterKeywordLimit]
+		}
+		cluster.Keywords = append(cluster.Keywords, shared...)
+		cluster.Title = strings.Join(cluster.Keywords, " / ")
+
+		clusters = append(clusters, cluster)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Similarity > clusters[j].Similarity
+	})
+
+	return clusters
+}
+
+// GetRetrospectiveItemClusters suggests groups of similar items for the facilitator to accept with CreateRetrospectiveGroup
+func (d *Database) GetRetrospectiveItemClusters(ctx context.Context, RetrospectiveID string, userID string) ([]*RetrospectiveItemCluster, error) {
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	workedItems, improveItems, questionItems := d.GetRetrospectiveItems(ctx, RetrospectiveID)
+	items := append(append(append(make([]*RetrospectiveItem, 0), workedItems...), improveItems...), questionItems...)
+
+	return clusterRetrospectiveItems(items), nil
+}
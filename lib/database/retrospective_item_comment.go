@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// CreateRetrospectiveItemComment adds a comment (or a reply to a comment) to a retrospective item
+func (d *Database) CreateRetrospectiveItemComment(ctx context.Context, RetrospectiveID string, UserID string, ItemID string, ParentID string, Content string) (ItemType string, Items []*RetrospectiveItem, CommentError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmContributor(ctx, RetrospectiveID, UserID)
+	if err != nil {
+		return "", nil, errors.New("Incorrect permissions")
+	}
+
+	itemType, err := d.getRetrospectiveItemType(ctx, RetrospectiveID, ItemID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var parentID sql.NullString
+	if ParentID != "" {
+		// replies must be to a comment on the same item
+		var parentItemID string
+		e := d.db.QueryRowContext(ctx,
+			`SELECT item_id FROM retrospective_item_comment WHERE id = $1;`,
+			ParentID,
+		).Scan(&parentItemID)
+		if e != nil || parentItemID != ItemID {
+			return "", nil, errors.New("Parent comment Not found")
+		}
+		parentID = sql.NullString{String: ParentID, Valid: true}
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT INTO retrospective_item_comment (item_id, user_id, parent_id, content) VALUES ($1, $2, $3, $4);`,
+		ItemID, UserID, parentID, Content,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospectiveItemComment", "retrospective_id", RetrospectiveID, "user_id", UserID, "item_id", ItemID, "parent_id", ParentID, "error", err)
+		return "", nil, errors.New("Unable to add comment")
+	}
+
+	return itemType, d.getRetrospectiveItemsByType(ctx, RetrospectiveID, itemType), nil
+}
+
+// DeleteRetrospectiveItemComment removes a comment (and its replies) from a retrospective item,
+// only the comments author or a facilitator can delete it
+func (d *Database) DeleteRetrospectiveItemComment(ctx context.Context, RetrospectiveID string, userID string, CommentID string) (ItemType string, Items []*RetrospectiveItem, CommentError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var authorID sql.NullString
+	var itemType string
+
+	e := d.db.QueryRowContext(ctx,
+		`SELECT ric.user_id, ri.type
+		FROM retrospective_item_comment ric
+		JOIN retrospective_item ri ON ri.id = ric.item_id
+		WHERE ric.id = $1 AND ri.retrospective_id = $2;`,
+		CommentID,
+		RetrospectiveID,
+	).Scan(&authorID, &itemType)
+	if e != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteRetrospectiveItemComment", "retrospective_id", RetrospectiveID, "user_id", userID, "comment_id", CommentID, "error", e)
+		return "", nil, errors.New("Comment Not found")
+	}
+
+	if authorID.String != userID {
+		if err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID); err != nil {
+			return "", nil, errors.New("Incorrect permissions")
+		}
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`DELETE FROM retrospective_item_comment WHERE id = $1;`, CommentID); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteRetrospectiveItemComment", "retrospective_id", RetrospectiveID, "user_id", userID, "comment_id", CommentID, "error", err)
+		return "", nil, errors.New("Unable to delete comment")
+	}
+
+	return itemType, d.getRetrospectiveItemsByType(ctx, RetrospectiveID, itemType), nil
+}
+
+// getRetrospectiveItemComments retrieves all item comments for the retrospective keyed by item ID
+func (d *Database) getRetrospectiveItemComments(ctx context.Context, RetrospectiveID string) map[string][]*RetrospectiveItemComment {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var comments = make(map[string][]*RetrospectiveItemComment)
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT ric.id, ric.item_id, ric.user_id, COALESCE(u.name, ''), ric.parent_id, ric.content, ric.created_date, r.anonymous
+		FROM retrospective_item_comment ric
+		JOIN retrospective_item ri ON ri.id = ric.item_id
+		JOIN retrospective r ON r.id = ri.retrospective_id
+		LEFT JOIN users u ON u.id = ric.user_id
+		WHERE ri.retrospective_id = $1
+		ORDER BY ric.created_date ASC;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveItemComments", "retrospective_id", RetrospectiveID, "error", err)
+		return comments
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var c RetrospectiveItemComment
+		var userID sql.NullString
+		var parentID sql.NullString
+		var anonymous bool
+
+		if err := rows.Scan(&c.ID, &c.ItemID, &userID, &c.UserName, &parentID, &c.Content, &c.CreatedDate, &anonymous); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveItemComments", "retrospective_id", RetrospectiveID, "error", err)
+		} else {
+			c.UserID = userID.String
+			c.ParentID = parentID.String
+			if anonymous {
+				c.UserID = ""
+				c.UserName = ""
+			}
+			comments[c.ItemID] = append(comments[c.ItemID], &c)
+		}
+	}
+
+	return comments
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/lib/pq"
+)
+
+// ToggleRetrospectiveItemReaction adds the users emoji reaction to an item, or removes it if already reacted
+func (d *Database) ToggleRetrospectiveItemReaction(ctx context.Context, RetrospectiveID string, UserID string, ItemID string, Emoji string) (ItemType string, Items []*RetrospectiveItem, ReactionError error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if Emoji == "" || len(Emoji) > 32 || !utf8.ValidString(Emoji) {
+		return "", nil, errors.New("Invalid emoji")
+	}
+
+	err := d.ConfirmContributor(ctx, RetrospectiveID, UserID)
+	if err != nil {
+		return "", nil, errors.New("Incorrect permissions")
+	}
+
+	itemType, err := d.getRetrospectiveItemType(ctx, RetrospectiveID, ItemID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`call retrospective_item_reaction_toggle($1, $2, $3);`, ItemID, UserID, Emoji); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ToggleRetrospectiveItemReaction", "retrospective_id", RetrospectiveID, "user_id", UserID, "item_id", ItemID, "error", err)
+		return "", nil, errors.New("Unable to react to item")
+	}
+
+	return itemType, d.getRetrospectiveItemsByType(ctx, RetrospectiveID, itemType), nil
+}
+
+// getRetrospectiveItemReactions retrieves all item reactions for the retrospective keyed by item ID
+func (d *Database) getRetrospectiveItemReactions(ctx context.Context, RetrospectiveID string) map[string][]*RetrospectiveItemReaction {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var reactions = make(map[string][]*RetrospectiveItemReaction)
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT rir.item_id, rir.emoji, array_agg(rir.user_id ORDER BY rir.created_date), r.anonymous
+		FROM retrospective_item_reaction rir
+		JOIN retrospective_item ri ON ri.id = rir.item_id
+		JOIN retrospective r ON r.id = ri.retrospective_id
+		WHERE ri.retrospective_id = $1
+		GROUP BY rir.item_id, rir.emoji, r.anonymous
+		ORDER BY MIN(rir.created_date) ASC;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveItemReactions", "retrospective_id", RetrospectiveID, "error", err)
+		return reactions
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var itemID string
+		var anonymous bool
+		var rr = &RetrospectiveItemReaction{
+			Users: make([]string, 0),
+		}
+
+		if err := rows.Scan(&itemID, &rr.Emoji, pq.Array(&rr.Users), &anonymous); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "getRetrospectiveItemReactions", "retrospective_id", RetrospectiveID, "error", err)
+		} else {
+			rr.Count = len(rr.Users)
+			if anonymous {
+				rr.Users = make([]string, 0)
+			}
+			reactions[itemID] = append(reactions[itemID], rr)
+		}
+	}
+
+	return reactions
+}
@@ -1,13 +1,16 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"log"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
-//CreateRetrospective adds a new retrospective to the db
-func (d *Database) CreateRetrospective(OwnerID string, RetrospectiveName string) (*Retrospective, error) {
-	var b = &Retrospective{
+// newRetrospective makes a new phase 1 retrospective with no users, items or actions
+func newRetrospective(OwnerID string, RetrospectiveName string) *Retrospective {
+	return &Retrospective{
 		RetrospectiveID:   "",
 		OwnerID:           OwnerID,
 		RetrospectiveName: RetrospectiveName,
@@ -17,15 +20,24 @@ func (d *Database) CreateRetrospective(OwnerID string, RetrospectiveName string)
 		ImproveItems:      make([]*RetrospectiveItem, 0),
 		QuestionItems:     make([]*RetrospectiveItem, 0),
 		ActionItems:       make([]*RetrospectiveAction, 0),
+		Groups:            make([]*RetrospectiveGroup, 0),
 	}
+}
+
+// CreateRetrospective adds a new retrospective to the db
+func (d *Database) CreateRetrospective(ctx context.Context, OwnerID string, RetrospectiveName string) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-	e := d.db.QueryRow(
+	var b = newRetrospective(OwnerID, RetrospectiveName)
+
+	e := d.db.QueryRowContext(ctx,
 		`SELECT * FROM create_retrospective($1, $2);`,
 		OwnerID,
 		RetrospectiveName,
 	).Scan(&b.RetrospectiveID)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateRetrospective", "error", e)
 		return nil, errors.New("Error Creating Retrospective")
 	}
 
@@ -33,7 +45,10 @@ func (d *Database) CreateRetrospective(OwnerID string, RetrospectiveName string)
 }
 
 // GetRetrospective gets a retrospective by ID
-func (d *Database) GetRetrospective(RetrospectiveID string) (*Retrospective, error) {
+func (d *Database) GetRetrospective(ctx context.Context, RetrospectiveID string) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var b = &Retrospective{
 		RetrospectiveID:   RetrospectiveID,
 		OwnerID:           "",
@@ -44,12 +59,15 @@ func (d *Database) GetRetrospective(RetrospectiveID string) (*Retrospective, err
 		ImproveItems:      make([]*RetrospectiveItem, 0),
 		QuestionItems:     make([]*RetrospectiveItem, 0),
 		ActionItems:       make([]*RetrospectiveAction, 0),
+		Groups:            make([]*RetrospectiveGroup, 0),
 	}
 
+	var focusedItemID sql.NullString
+
 	// get retrospective
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT
-			id, name, owner_id, phase
+			id, name, owner_id, phase, anonymous, focused_item_id
 		FROM retrospective WHERE id = $1`,
 		RetrospectiveID,
 	).Scan(
@@ -57,26 +75,33 @@ func (d *Database) GetRetrospective(RetrospectiveID string) (*Retrospective, err
 		&b.RetrospectiveName,
 		&b.OwnerID,
 		&b.Phase,
+		&b.Anonymous,
+		&focusedItemID,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospective", "retrospective_id", RetrospectiveID, "error", e)
 		return nil, errors.New("Not found")
 	}
 
-	worked, improve, question := d.GetRetrospectiveItems(RetrospectiveID)
-	b.Users = d.GetRetrospectiveUsers(RetrospectiveID)
+	worked, improve, question := d.GetRetrospectiveItems(ctx, RetrospectiveID)
+	b.Users = d.GetRetrospectiveUsers(ctx, RetrospectiveID)
 	b.WorkedItems = worked
 	b.ImproveItems = improve
 	b.QuestionItems = question
-	b.ActionItems = d.GetRetrospectiveActions(RetrospectiveID)
+	b.Groups = d.getRetrospectiveGroups(ctx, RetrospectiveID, worked, improve, question)
+	b.ActionItems = d.GetRetrospectiveActions(ctx, RetrospectiveID)
+	b.Discussion = buildRetrospectiveDiscussion(focusedItemID.String, b.Groups, worked, improve, question)
 
 	return b, nil
 }
 
 // GetRetrospectivesByUser gets a list of retrospectives by UserID
-func (d *Database) GetRetrospectivesByUser(UserID string) ([]*Retrospective, error) {
+func (d *Database) GetRetrospectivesByUser(ctx context.Context, UserID string) ([]*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var retrospectives = make([]*Retrospective, 0)
-	retrospectiveRows, retrospectivesErr := d.db.Query(`
+	retrospectiveRows, retrospectivesErr := d.read.QueryContext(ctx, `
 		SELECT * FROM get_retrospectives_by_user($1);
 	`, UserID)
 	if retrospectivesErr != nil {
@@ -98,7 +123,7 @@ func (d *Database) GetRetrospectivesByUser(UserID string) ([]*Retrospective, err
 			&b.OwnerID,
 			&b.Phase,
 		); err != nil {
-			log.Println(err)
+			logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectivesByUser", "user_id", UserID, "error", err)
 		} else {
 			retrospectives = append(retrospectives, b)
 		}
@@ -108,11 +133,14 @@ func (d *Database) GetRetrospectivesByUser(UserID string) ([]*Retrospective, err
 }
 
 // ConfirmOwner confirms the user is infact owner of the retrospective
-func (d *Database) ConfirmOwner(RetrospectiveID string, userID string) error {
+func (d *Database) ConfirmOwner(ctx context.Context, RetrospectiveID string, userID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var ownerID string
-	e := d.db.QueryRow("SELECT owner_id FROM retrospective WHERE id = $1", RetrospectiveID).Scan(&ownerID)
+	e := d.db.QueryRowContext(ctx, "SELECT owner_id FROM retrospective WHERE id = $1", RetrospectiveID).Scan(&ownerID)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "ConfirmOwner", "retrospective_id", RetrospectiveID, "user_id", userID, "error", e)
 		return errors.New("Retrospective Not found")
 	}
 
@@ -123,12 +151,90 @@ func (d *Database) ConfirmOwner(RetrospectiveID string, userID string) error {
 	return nil
 }
 
+// RetrospectiveUserRole gets the users role in the retrospective (FACILITATOR, PARTICIPANT, OBSERVER)
+func (d *Database) RetrospectiveUserRole(ctx context.Context, RetrospectiveID string, UserID string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var role string
+	e := d.db.QueryRowContext(ctx,
+		`SELECT role FROM retrospective_get_user_role($1, $2);`,
+		RetrospectiveID,
+		UserID,
+	).Scan(&role)
+	if e != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveUserRole", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", e)
+		return "", errors.New("error getting retrospective users role")
+	}
+
+	return role, nil
+}
+
+// ConfirmFacilitator confirms the user is a facilitator of the retrospective
+// (owner, assigned facilitator, or team/department/organization admin of a team retrospective)
+func (d *Database) ConfirmFacilitator(ctx context.Context, RetrospectiveID string, userID string) error {
+	role, err := d.RetrospectiveUserRole(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return err
+	}
+
+	if role != "FACILITATOR" {
+		return errors.New("Not Facilitator")
+	}
+
+	return nil
+}
+
+// ConfirmContributor confirms the user is allowed to contribute to the retrospective (not an OBSERVER)
+func (d *Database) ConfirmContributor(ctx context.Context, RetrospectiveID string, userID string) error {
+	role, err := d.RetrospectiveUserRole(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return err
+	}
+
+	if role == "OBSERVER" {
+		return errors.New("Observers are read only")
+	}
+
+	return nil
+}
+
+// ConfirmRetrospectiveUser confirms the user is a member of the retrospective, having joined it or
+// being a member of its team, or is one of its facilitators
+func (d *Database) ConfirmRetrospectiveUser(ctx context.Context, RetrospectiveID string, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var Member bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM retrospective_user WHERE retrospective_id = $1 AND user_id = $2)
+			OR EXISTS (SELECT 1 FROM team_retrospective tr JOIN team_user tu ON tu.team_id = tr.team_id
+				WHERE tr.retrospective_id = $1 AND tu.user_id = $2);`,
+		RetrospectiveID,
+		UserID,
+	).Scan(&Member); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "ConfirmRetrospectiveUser", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
+		return errors.New("Retrospective Not found")
+	}
+
+	if !Member {
+		if err := d.ConfirmFacilitator(ctx, RetrospectiveID, UserID); err != nil {
+			return errors.New("Not a retrospective user")
+		}
+	}
+
+	return nil
+}
+
 // GetRetrospectiveUser gets a user from db by ID and checks retrospective active status
-func (d *Database) GetRetrospectiveUser(RetrospectiveID string, UserID string) (*RetrospectiveUser, error) {
+func (d *Database) GetRetrospectiveUser(ctx context.Context, RetrospectiveID string, UserID string) (*RetrospectiveUser, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var active bool
 	var w RetrospectiveUser
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT * FROM get_retrospective_user($1, $2);`,
 		RetrospectiveID,
 		UserID,
@@ -138,7 +244,7 @@ func (d *Database) GetRetrospectiveUser(RetrospectiveID string, UserID string) (
 		&active,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveUser", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", e)
 		return nil, errors.New("User Not found")
 	}
 
@@ -150,9 +256,12 @@ func (d *Database) GetRetrospectiveUser(RetrospectiveID string, UserID string) (
 }
 
 // GetRetrospectiveUsers retrieves the users for a given retrospective from db
-func (d *Database) GetRetrospectiveUsers(RetrospectiveID string) []*RetrospectiveUser {
+func (d *Database) GetRetrospectiveUsers(ctx context.Context, RetrospectiveID string) []*RetrospectiveUser {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var users = make([]*RetrospectiveUser, 0)
-	rows, err := d.db.Query(
+	rows, err := d.db.QueryContext(ctx,
 		`SELECT * FROM get_retrospective_users($1);`,
 		RetrospectiveID,
 	)
@@ -160,8 +269,8 @@ func (d *Database) GetRetrospectiveUsers(RetrospectiveID string) []*Retrospectiv
 		defer rows.Close()
 		for rows.Next() {
 			var w RetrospectiveUser
-			if err := rows.Scan(&w.UserID, &w.UserName, &w.Active); err != nil {
-				log.Println(err)
+			if err := rows.Scan(&w.UserID, &w.UserName, &w.Active, &w.Role); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveUsers", "retrospective_id", RetrospectiveID, "error", err)
 			} else {
 				users = append(users, &w)
 			}
@@ -172,71 +281,83 @@ func (d *Database) GetRetrospectiveUsers(RetrospectiveID string) []*Retrospectiv
 }
 
 // AddUserToRetrospective adds a user by ID to the retrospective by ID
-func (d *Database) AddUserToRetrospective(RetrospectiveID string, UserID string) ([]*RetrospectiveUser, error) {
-	if _, err := d.db.Exec(
+func (d *Database) AddUserToRetrospective(ctx context.Context, RetrospectiveID string, UserID string) ([]*RetrospectiveUser, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`INSERT INTO retrospective_user (retrospective_id, user_id, active)
 		VALUES ($1, $2, true)
 		ON CONFLICT (retrospective_id, user_id) DO UPDATE SET active = true, abandoned = false`,
 		RetrospectiveID,
 		UserID,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "AddUserToRetrospective", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	users := d.GetRetrospectiveUsers(RetrospectiveID)
+	users := d.GetRetrospectiveUsers(ctx, RetrospectiveID)
 
 	return users, nil
 }
 
 // RetreatUser removes a user from the current retrospective by ID
-func (d *Database) RetreatUser(RetrospectiveID string, UserID string) []*RetrospectiveUser {
-	if _, err := d.db.Exec(
+func (d *Database) RetreatUser(ctx context.Context, RetrospectiveID string, UserID string) []*RetrospectiveUser {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`UPDATE retrospective_user SET active = false WHERE retrospective_id = $1 AND user_id = $2`, RetrospectiveID, UserID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "RetreatUser", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`UPDATE users SET last_active = NOW() WHERE id = $1`, UserID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "RetreatUser", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 	}
 
-	users := d.GetRetrospectiveUsers(RetrospectiveID)
+	users := d.GetRetrospectiveUsers(ctx, RetrospectiveID)
 
 	return users
 }
 
 // AbandonRetrospective removes a user from the current retrospective by ID and sets abandoned true
-func (d *Database) AbandonRetrospective(RetrospectiveID string, UserID string) ([]*RetrospectiveUser, error) {
-	if _, err := d.db.Exec(
+func (d *Database) AbandonRetrospective(ctx context.Context, RetrospectiveID string, UserID string) ([]*RetrospectiveUser, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`UPDATE retrospective_user SET active = false, abandoned = true WHERE retrospective_id = $1 AND user_id = $2`, RetrospectiveID, UserID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "AbandonRetrospective", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 		return nil, err
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`UPDATE users SET last_active = NOW() WHERE id = $1`, UserID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "AbandonRetrospective", "retrospective_id", RetrospectiveID, "user_id", UserID, "error", err)
 		return nil, err
 	}
 
-	users := d.GetRetrospectiveUsers(RetrospectiveID)
+	users := d.GetRetrospectiveUsers(ctx, RetrospectiveID)
 
 	return users, nil
 }
 
 // SetRetrospectiveOwner sets the ownerId for the retrospective
-func (d *Database) SetRetrospectiveOwner(RetrospectiveID string, userID string, OwnerID string) (*Retrospective, error) {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+func (d *Database) SetRetrospectiveOwner(ctx context.Context, RetrospectiveID string, userID string, OwnerID string) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmOwner(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`call set_retrospective_owner($1, $2);`, RetrospectiveID, OwnerID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "SetRetrospectiveOwner", "retrospective_id", RetrospectiveID, "user_id", userID, "error", err)
 	}
 
-	retrospective, err := d.GetRetrospective(RetrospectiveID)
+	retrospective, err := d.GetRetrospective(ctx, RetrospectiveID)
 	if err != nil {
 		return nil, errors.New("Unable to promote owner")
 	}
@@ -244,34 +365,153 @@ func (d *Database) SetRetrospectiveOwner(RetrospectiveID string, userID string,
 	return retrospective, nil
 }
 
+// SetRetrospectiveUserRole sets a users role (FACILITATOR, PARTICIPANT, OBSERVER) in the retrospective
+func (d *Database) SetRetrospectiveUserRole(ctx context.Context, RetrospectiveID string, userID string, RoleUserID string, Role string) ([]*RetrospectiveUser, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	if Role != "FACILITATOR" && Role != "PARTICIPANT" && Role != "OBSERVER" {
+		return nil, errors.New("Invalid role")
+	}
+
+	// the owner is always a facilitator, ownership is changed via SetRetrospectiveOwner
+	if err := d.ConfirmOwner(ctx, RetrospectiveID, RoleUserID); err == nil {
+		return nil, errors.New("Unable to change owners role")
+	}
+
+	var UserInRetrospective bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM retrospective_user WHERE retrospective_id = $1 AND user_id = $2);`,
+		RetrospectiveID,
+		RoleUserID,
+	).Scan(&UserInRetrospective); err != nil || !UserInRetrospective {
+		return nil, errors.New("User Not found")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`call set_retrospective_user_role($1, $2, $3);`, RetrospectiveID, RoleUserID, Role); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SetRetrospectiveUserRole", "retrospective_id", RetrospectiveID, "user_id", userID, "role_user_id", RoleUserID, "error", err)
+		return nil, errors.New("Unable to set user role")
+	}
+
+	users := d.GetRetrospectiveUsers(ctx, RetrospectiveID)
+
+	return users, nil
+}
+
 // RetrospectiveAdvancePhase sets the phase for the retrospective
-func (d *Database) RetrospectiveAdvancePhase(RetrospectiveID string, userID string, Phase int) (*Retrospective, error) {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+func (d *Database) RetrospectiveAdvancePhase(ctx context.Context, RetrospectiveID string, userID string, Phase int) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return nil, errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`call set_retrospective_phase($1, $2);`, RetrospectiveID, Phase); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveAdvancePhase", "retrospective_id", RetrospectiveID, "user_id", userID, "error", err)
 		return nil, errors.New("Unable to advance phase")
 	}
 
-	retrospective, err := d.GetRetrospective(RetrospectiveID)
+	retrospective, err := d.GetRetrospective(ctx, RetrospectiveID)
+	if err != nil {
+		return nil, err
+	}
 
 	return retrospective, nil
 }
 
+// RetrospectiveClaimSummary claims sending the retrospectives summary email, returning false when
+// it was already sent so advancing to the last phase again (or on another replica) doesn't resend it
+func (d *Database) RetrospectiveClaimSummary(ctx context.Context, RetrospectiveID string) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective SET summary_sent_date = NOW() WHERE id = $1 AND summary_sent_date IS NULL;`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveClaimSummary", "retrospective_id", RetrospectiveID, "error", err)
+		return false, err
+	}
+
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+// GetRetrospectiveSummaryRecipients gets the registered users of the retrospective and, for team retrospectives,
+// the team members who opted in to retrospective summary emails
+func (d *Database) GetRetrospectiveSummaryRecipients(ctx context.Context, RetrospectiveID string) []*User {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var users = make([]*User, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT u.id, u.name, u.email, u.unsubscribe_token FROM users u
+		WHERE u.email IS NOT NULL AND u.notify_retro_summary = true AND (
+			u.id IN (SELECT ru.user_id FROM retrospective_user ru WHERE ru.retrospective_id = $1)
+			OR u.id IN (SELECT tu.user_id FROM team_user tu JOIN team_retrospective tr ON tr.team_id = tu.team_id WHERE tr.retrospective_id = $1)
+		);`,
+		RetrospectiveID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveSummaryRecipients", "retrospective_id", RetrospectiveID, "error", err)
+		return users
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.UserID, &u.UserName, &u.UserEmail, &u.UnsubscribeToken); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveSummaryRecipients", "retrospective_id", RetrospectiveID, "error", err)
+		} else {
+			users = append(users, &u)
+		}
+	}
+
+	return users
+}
+
+// SetRetrospectiveAnonymous sets whether comment and reaction authors are hidden in the retrospective
+func (d *Database) SetRetrospectiveAnonymous(ctx context.Context, RetrospectiveID string, userID string, Anonymous bool) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return nil, errors.New("Incorrect permissions")
+	}
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective SET anonymous = $2, updated_date = NOW() WHERE id = $1;`, RetrospectiveID, Anonymous); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SetRetrospectiveAnonymous", "retrospective_id", RetrospectiveID, "user_id", userID, "error", err)
+		return nil, errors.New("Unable to update retrospective anonymity")
+	}
+
+	return d.GetRetrospective(ctx, RetrospectiveID)
+}
+
 // DeleteRetrospective removes all retrospective associations and the retrospective itself from DB by RetrospectiveID
-func (d *Database) DeleteRetrospective(RetrospectiveID string, userID string) error {
-	err := d.ConfirmOwner(RetrospectiveID, userID)
+func (d *Database) DeleteRetrospective(ctx context.Context, RetrospectiveID string, userID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
 	if err != nil {
 		return errors.New("Incorrect permissions")
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`call delete_retrospective($1);`, RetrospectiveID); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteRetrospective", "retrospective_id", RetrospectiveID, "user_id", userID, "error", err)
 		return err
 	}
 
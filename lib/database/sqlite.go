@@ -0,0 +1,84 @@
+package database
+
+import (
+	"strings"
+)
+
+// sqliteDriverName is the database/sql driver used for the sqlite db.driver, it wraps go-sqlite3
+// to translate the postgres dialect used by the Database methods and to run the Go versions
+// of the schema.sql stored procedures and functions (see sqlite_routines.go)
+const sqliteDriverName = "wakita_sqlite3"
+
+// sqliteTimeFormat matches CURRENT_TIMESTAMP so timestamps compare correctly as text
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// sqliteEnabled is set when the driver is registered, go-sqlite3 is only built with cgo
+var sqliteEnabled bool
+
+// sqliteDSN adds the connection settings the backend relies on to the sqlite database file
+// foreign keys for the ON DELETE rules, WAL with a busy timeout so readers don't block the writer,
+// and immediate transactions so concurrent writers wait for the lock instead of failing
+func sqliteDSN(path string) string {
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return path + sep + "_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+}
+
+// sqliteInMemory reports whether the path is an in memory database, which only exists for a single connection
+func sqliteInMemory(path string) bool {
+	return strings.Contains(path, ":memory:") || strings.Contains(path, "mode=memory")
+}
+
+// parsePostgresArray parses a one dimensional postgres array literal such as {a,"b c"}
+func parsePostgresArray(s string) []string {
+	values := make([]string, 0)
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return values
+	}
+	s = s[1 : len(s)-1]
+
+	var b strings.Builder
+	var quoted, escaped, started bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case r == ',' && !quoted:
+			values = append(values, b.String())
+			b.Reset()
+			started = false
+		default:
+			b.WriteRune(r)
+			started = true
+		}
+	}
+	if started || b.Len() > 0 {
+		values = append(values, b.String())
+	}
+
+	return values
+}
+
+// formatPostgresArray formats values as a postgres array literal, the format lib/pq scans into a slice
+func formatPostgresArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		v = strings.ReplaceAll(v, `\`, `\\`)
+		quoted[i] = `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+	}
+
+	return "{" + strings.Join(quoted, ",") + "}"
+}
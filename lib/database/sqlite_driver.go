@@ -0,0 +1,365 @@
+//go:build cgo
+// +build cgo
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sqliteEnabled = true
+	sql.Register(sqliteDriverName, &sqliteDriver{
+		base: &sqlite3.SQLiteDriver{ConnectHook: sqliteConnectHook},
+	})
+}
+
+// sqliteConnectHook registers the postgres array functions used by the Database methods
+func sqliteConnectHook(c *sqlite3.SQLiteConn) error {
+	if err := c.RegisterFunc("array_length", sqliteArrayLength, true); err != nil {
+		return err
+	}
+
+	return c.RegisterAggregator("array_agg", newSQLiteArrayAgg, true)
+}
+
+type sqliteDriver struct {
+	base *sqlite3.SQLiteDriver
+}
+
+// Open opens a go-sqlite3 connection wrapped with the postgres dialect translation
+func (d *sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.base.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqliteConn{c.(*sqlite3.SQLiteConn)}, nil
+}
+
+// sqliteConn translates each statement before handing it to go-sqlite3,
+// statements calling a stored procedure or function run its Go version on the same connection
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if call, ok := parseSQLiteRoutineCall(query); ok {
+		rc, err := c.runRoutine(ctx, call, args)
+		if err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(rc.rowsAffected), nil
+	}
+
+	t := translateSQLite(query)
+	if t.noop {
+		return driver.RowsAffected(0), nil
+	}
+	targs, err := t.args(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SQLiteConn.ExecContext(ctx, t.query, targs)
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if call, ok := parseSQLiteRoutineCall(query); ok {
+		rc, err := c.runRoutine(ctx, call, args)
+		if err != nil {
+			return nil, err
+		}
+		return newSQLiteRows(c.SQLiteConn.QueryContext(ctx, call.selectFrom(rc), namedValues(rc.resultArgs)))
+	}
+
+	t := translateSQLite(query)
+	targs, err := t.args(args)
+	if err != nil {
+		return nil, err
+	}
+	if t.noop {
+		return c.SQLiteConn.QueryContext(ctx, `SELECT NULL WHERE 0;`, nil)
+	}
+
+	return newSQLiteRows(c.SQLiteConn.QueryContext(ctx, t.query, targs))
+}
+
+// sqliteRows returns timestamps computed by expressions such as MAX(updated_date) as times like postgres does,
+// sqlite has no column type for an expression so they would otherwise be CURRENT_TIMESTAMP formatted text
+type sqliteRows struct {
+	*sqlite3.SQLiteRows
+}
+
+func newSQLiteRows(rows driver.Rows, err error) (driver.Rows, error) {
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := rows.(*sqlite3.SQLiteRows); ok {
+		return &sqliteRows{r}, nil
+	}
+
+	return rows, nil
+}
+
+// Next implements driver.Rows, converting text in the timestamp format from columns without a declared type
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.SQLiteRows.Next(dest); err != nil {
+		return err
+	}
+
+	declTypes := r.DeclTypes()
+	for i, v := range dest {
+		text, ok := v.(string)
+		if !ok || declTypes[i] != "" || len(text) != len(sqliteTimeFormat) {
+			continue
+		}
+		if t, err := time.ParseInLocation(sqliteTimeFormat, text, time.UTC); err == nil {
+			dest[i] = t
+		}
+	}
+
+	return nil
+}
+
+// PrepareContext implements driver.ConnPrepareContext, stored procedure calls can only be run directly
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if _, ok := parseSQLiteRoutineCall(query); ok {
+		return nil, errors.New("sqlite: stored procedure calls cannot be prepared")
+	}
+
+	return c.SQLiteConn.PrepareContext(ctx, translateSQLite(query).query)
+}
+
+// Prepare implements driver.Conn
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// runRoutine runs the Go version of a stored procedure or function inside a savepoint,
+// so it is atomic on its own and part of the callers transaction when there is one
+func (c *sqliteConn) runRoutine(ctx context.Context, call *sqliteRoutineCall, args []driver.NamedValue) (*sqliteRoutineContext, error) {
+	routine, ok := sqliteRoutines[call.name]
+	if !ok {
+		return nil, errors.New("sqlite: unknown routine " + call.name)
+	}
+
+	rc := &sqliteRoutineContext{ctx: ctx, conn: c.SQLiteConn}
+	for _, n := range call.params {
+		if n < 1 || n > len(args) {
+			return nil, errors.New("sqlite: missing argument $" + strconv.Itoa(n) + " for " + call.name)
+		}
+		rc.args = append(rc.args, sqliteValue(args[n-1].Value))
+	}
+
+	if _, err := c.SQLiteConn.ExecContext(ctx, `SAVEPOINT routine;`, nil); err != nil {
+		return nil, err
+	}
+	if err := routine(rc); err != nil {
+		if _, rbErr := c.SQLiteConn.ExecContext(ctx, `ROLLBACK TO routine; RELEASE routine;`, nil); rbErr != nil {
+			return nil, rbErr
+		}
+		return nil, err
+	}
+	if _, err := c.SQLiteConn.ExecContext(ctx, `RELEASE routine;`, nil); err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+// sqliteRoutineCall is a statement that only calls a stored procedure or function,
+// e.g. `call promote_user($1)`, `SELECT team_user_add($1, $2, $3)` or `SELECT id, name FROM team_list($1, $2)`
+type sqliteRoutineCall struct {
+	name string
+	// the statement argument numbers passed to the routine, in order
+	params []int
+	// columns selected from a table function, empty for calls and scalar selects
+	columns string
+	// called as a table function in the FROM clause
+	table bool
+}
+
+var sqliteRoutineCallPattern = regexp.MustCompile(
+	`(?is)^\s*(?:(call)\s+(\w+)|select\s+(\w+)|select\s+([\w\s,*]+?)\s+from\s+(\w+))\s*\(\s*((?:\$\d+\s*,\s*)*\$\d+)?\s*\)\s*;?\s*$`,
+)
+
+// parseSQLiteRoutineCall matches statements calling a routine implemented in sqliteRoutines
+func parseSQLiteRoutineCall(query string) (*sqliteRoutineCall, bool) {
+	m := sqliteRoutineCallPattern.FindStringSubmatch(query)
+	if m == nil {
+		return nil, false
+	}
+
+	call := &sqliteRoutineCall{}
+	switch {
+	case m[1] != "":
+		call.name = strings.ToLower(m[2])
+	case m[3] != "":
+		call.name = strings.ToLower(m[3])
+	default:
+		call.name = strings.ToLower(m[5])
+		call.columns = m[4]
+		call.table = true
+	}
+	if _, ok := sqliteRoutines[call.name]; !ok {
+		return nil, false
+	}
+
+	if m[6] != "" {
+		for _, p := range strings.Split(m[6], ",") {
+			n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(p), "$"))
+			if err != nil {
+				return nil, false
+			}
+			call.params = append(call.params, n)
+		}
+	}
+
+	return call, true
+}
+
+// selectFrom builds the statement returning the routine result to the caller
+func (call *sqliteRoutineCall) selectFrom(rc *sqliteRoutineContext) string {
+	if rc.result == "" {
+		return `SELECT NULL AS ` + call.name + `;`
+	}
+	if !call.table {
+		return rc.result
+	}
+
+	return `SELECT ` + call.columns + ` FROM (` + rc.result + `) AS ` + call.name + `;`
+}
+
+// sqliteTranslation is a postgres statement rewritten for sqlite
+type sqliteTranslation struct {
+	query string
+	// statements with no sqlite equivalent that are safe to skip, e.g. refreshing a materialized view
+	noop bool
+	// argument numbers bound to ANY(), sent as json arrays instead of postgres array literals
+	arrayParams map[int]bool
+}
+
+var (
+	sqliteTranslations sync.Map
+
+	pgAnyPattern        = regexp.MustCompile(`(?i)=\s*ANY\(\s*\$(\d+)\s*\)`)
+	pgParamPattern      = regexp.MustCompile(`\$(\d+)`)
+	pgNowPattern        = regexp.MustCompile(`(?i)\bNOW\(\)`)
+	pgNowSecondsPattern = regexp.MustCompile(`(?i)\bNOW\(\)\s*([+-])\s*\$(\d+)\s*\*\s*interval\s+'1 second'`)
+	pgForUpdatePattern  = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE(\s+SKIP\s+LOCKED)?`)
+	pgArrayAggPattern   = regexp.MustCompile(`(?i)array_agg\(([^()]+?)\s+ORDER\s+BY\s+[^()]+\)`)
+	pgEpochDiffPattern  = regexp.MustCompile(`(?i)EXTRACT\(\s*EPOCH\s+FROM\s+\(\s*([\w.]+)\s*-\s*([\w.]+)\s*\)\s*\)`)
+	pgRefreshMatPattern = regexp.MustCompile(`(?is)^\s*REFRESH\s+MATERIALIZED\s+VIEW\s+\w+\s*;?\s*$`)
+)
+
+// translateSQLite rewrites the postgres specific syntax used by the Database methods, caching the result per query
+func translateSQLite(query string) *sqliteTranslation {
+	if t, ok := sqliteTranslations.Load(query); ok {
+		return t.(*sqliteTranslation)
+	}
+
+	t := &sqliteTranslation{query: query, arrayParams: make(map[int]bool)}
+	if pgRefreshMatPattern.MatchString(query) {
+		// active_countries is a plain view in sqlite
+		t.noop = true
+	} else {
+		q := pgAnyPattern.ReplaceAllStringFunc(query, func(s string) string {
+			n := pgAnyPattern.FindStringSubmatch(s)[1]
+			i, _ := strconv.Atoi(n)
+			t.arrayParams[i] = true
+			return `IN (SELECT value FROM json_each($` + n + `))`
+		})
+		q = pgNowSecondsPattern.ReplaceAllStringFunc(q, func(s string) string {
+			m := pgNowSecondsPattern.FindStringSubmatch(s)
+			if m[1] == "-" {
+				return `datetime(NOW(), '-' || $` + m[2] + ` || ' seconds')`
+			}
+			return `datetime(NOW(), $` + m[2] + ` || ' seconds')`
+		})
+		q = pgParamPattern.ReplaceAllString(q, `?$1`)
+		q = pgNowPattern.ReplaceAllString(q, `CURRENT_TIMESTAMP`)
+		q = pgForUpdatePattern.ReplaceAllString(q, ``)
+		q = pgArrayAggPattern.ReplaceAllString(q, `array_agg($1)`)
+		q = pgEpochDiffPattern.ReplaceAllString(q, `((julianday($1) - julianday($2)) * 86400)`)
+		t.query = q
+	}
+
+	sqliteTranslations.Store(query, t)
+	return t
+}
+
+// args converts the statement arguments to their sqlite representation
+func (t *sqliteTranslation) args(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	out := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		a.Value = sqliteValue(a.Value)
+		if t.arrayParams[a.Ordinal] {
+			s, _ := a.Value.(string)
+			j, err := json.Marshal(parsePostgresArray(s))
+			if err != nil {
+				return nil, err
+			}
+			a.Value = string(j)
+		}
+		out[i] = a
+	}
+
+	return out, nil
+}
+
+// sqliteValue stores times in UTC using the CURRENT_TIMESTAMP format
+func sqliteValue(v driver.Value) driver.Value {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(sqliteTimeFormat)
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+
+	return v
+}
+
+func namedValues(values []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: sqliteValue(v)}
+	}
+
+	return named
+}
+
+// sqliteArrayLength is array_length for postgres array literals
+func sqliteArrayLength(s string, dimension int) int {
+	return len(parsePostgresArray(s))
+}
+
+// sqliteArrayAgg is array_agg, aggregating into a postgres array literal
+type sqliteArrayAgg struct {
+	values []string
+}
+
+func newSQLiteArrayAgg() *sqliteArrayAgg {
+	return &sqliteArrayAgg{values: make([]string, 0)}
+}
+
+func (a *sqliteArrayAgg) Step(v string) {
+	a.values = append(a.values, v)
+}
+
+func (a *sqliteArrayAgg) Done() string {
+	return formatPostgresArray(a.values)
+}
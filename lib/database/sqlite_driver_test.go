@@ -0,0 +1,135 @@
+//go:build cgo
+// +build cgo
+
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateSQLite(t *testing.T) {
+	tests := []struct {
+		query       string
+		want        string
+		arrayParams map[int]bool
+	}{
+		{
+			query:       `SELECT id FROM users WHERE id = $1 AND name = $2;`,
+			want:        `SELECT id FROM users WHERE id = ?1 AND name = ?2;`,
+			arrayParams: map[int]bool{},
+		},
+		{
+			query:       `UPDATE users SET last_active = NOW() WHERE id = $1;`,
+			want:        `UPDATE users SET last_active = CURRENT_TIMESTAMP WHERE id = ?1;`,
+			arrayParams: map[int]bool{},
+		},
+		{
+			query:       `UPDATE email_outbox SET next_attempt_date = NOW() + $2 * interval '1 second' WHERE id = $1;`,
+			want:        `UPDATE email_outbox SET next_attempt_date = datetime(CURRENT_TIMESTAMP, ?2 || ' seconds') WHERE id = ?1;`,
+			arrayParams: map[int]bool{},
+		},
+		{
+			query:       `SELECT id FROM retrospective_action WHERE ticket_claimed_date < NOW() - $1 * interval '1 second';`,
+			want:        `SELECT id FROM retrospective_action WHERE ticket_claimed_date < datetime(CURRENT_TIMESTAMP, '-' || ?1 || ' seconds');`,
+			arrayParams: map[int]bool{},
+		},
+		{
+			query:       `SELECT id FROM retrospective_item WHERE id = ANY($1) AND retrospective_id = $2;`,
+			want:        `SELECT id FROM retrospective_item WHERE id IN (SELECT value FROM json_each(?1)) AND retrospective_id = ?2;`,
+			arrayParams: map[int]bool{1: true},
+		},
+		{
+			query:       `SELECT id FROM email_outbox WHERE sent_date IS NULL FOR UPDATE SKIP LOCKED;`,
+			want:        `SELECT id FROM email_outbox WHERE sent_date IS NULL;`,
+			arrayParams: map[int]bool{},
+		},
+		{
+			query:       `SELECT array_agg(id ORDER BY created_date) FROM retrospective_item;`,
+			want:        `SELECT array_agg(id) FROM retrospective_item;`,
+			arrayParams: map[int]bool{},
+		},
+		{
+			query:       `SELECT EXTRACT(EPOCH FROM (ra.completed_date - ra.created_date)) FROM retrospective_action ra;`,
+			want:        `SELECT ((julianday(ra.completed_date) - julianday(ra.created_date)) * 86400) FROM retrospective_action ra;`,
+			arrayParams: map[int]bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := translateSQLite(tt.query)
+		if got.noop {
+			t.Errorf("translateSQLite(%q) is a noop", tt.query)
+		}
+		if got.query != tt.want {
+			t.Errorf("translateSQLite(%q) = %q, want %q", tt.query, got.query, tt.want)
+		}
+		if !reflect.DeepEqual(got.arrayParams, tt.arrayParams) {
+			t.Errorf("translateSQLite(%q) arrayParams = %v, want %v", tt.query, got.arrayParams, tt.arrayParams)
+		}
+	}
+}
+
+func TestTranslateSQLiteRefreshMaterializedView(t *testing.T) {
+	if got := translateSQLite(`REFRESH MATERIALIZED VIEW active_countries;`); !got.noop {
+		t.Errorf("translateSQLite(REFRESH MATERIALIZED VIEW) is not a noop")
+	}
+}
+
+func TestParseSQLiteRoutineCall(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *sqliteRoutineCall
+	}{
+		{
+			query: `call promote_user($1);`,
+			want:  &sqliteRoutineCall{name: "promote_user", params: []int{1}},
+		},
+		{
+			query: `CALL deactivate_all_users();`,
+			want:  &sqliteRoutineCall{name: "deactivate_all_users"},
+		},
+		{
+			query: `SELECT organization_create($1, $2);`,
+			want:  &sqliteRoutineCall{name: "organization_create", params: []int{1, 2}},
+		},
+		{
+			query: `SELECT userId, verifyId FROM register_user($1, $2, $3, $4);`,
+			want: &sqliteRoutineCall{
+				name: "register_user", params: []int{1, 2, 3, 4}, columns: "userId, verifyId", table: true,
+			},
+		},
+		{
+			query: `SELECT * FROM get_user($1)`,
+			want:  &sqliteRoutineCall{name: "get_user", params: []int{1}, columns: "*", table: true},
+		},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseSQLiteRoutineCall(tt.query)
+		if !ok {
+			t.Errorf("parseSQLiteRoutineCall(%q) did not match", tt.query)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSQLiteRoutineCall(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseSQLiteRoutineCallOtherStatements(t *testing.T) {
+	queries := []string{
+		// not a routine of schema.sql
+		`SELECT now();`,
+		`call unknown_procedure($1);`,
+		// arguments other than statement parameters are left to sqlite
+		`SELECT * FROM get_user('id');`,
+		`SELECT id, name FROM users WHERE id = $1;`,
+	}
+
+	for _, query := range queries {
+		if call, ok := parseSQLiteRoutineCall(query); ok {
+			t.Errorf("parseSQLiteRoutineCall(%q) = %+v, want no match", query, call)
+		}
+	}
+}
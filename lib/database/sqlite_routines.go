@@ -0,0 +1,907 @@
+//go:build cgo
+// +build cgo
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteRoutineContext is the connection and arguments a routine runs with,
+// table functions set the result query the calling statement selects from
+type sqliteRoutineContext struct {
+	ctx  context.Context
+	conn *sqlite3.SQLiteConn
+	args []driver.Value
+
+	rowsAffected int64
+	result       string
+	resultArgs   []driver.Value
+}
+
+// sqliteRoutine is the Go version of a schema.sql stored procedure or function
+type sqliteRoutine func(rc *sqliteRoutineContext) error
+
+// exec runs a statement, adding to the rows affected by the routine
+func (rc *sqliteRoutineContext) exec(query string, args ...driver.Value) (int64, error) {
+	res, err := rc.conn.ExecContext(rc.ctx, query, namedValues(args))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	rc.rowsAffected = rc.rowsAffected + n
+
+	return n, nil
+}
+
+// queryRow returns the first row of the query, or nil when there are no rows
+func (rc *sqliteRoutineContext) queryRow(query string, args ...driver.Value) ([]driver.Value, error) {
+	rows, err := rc.conn.QueryContext(rc.ctx, query, namedValues(args))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	row := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(row); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return row, nil
+}
+
+// returns sets the result of a table function
+func (rc *sqliteRoutineContext) returns(query string, args ...driver.Value) error {
+	rc.result = query
+	rc.resultArgs = args
+
+	return nil
+}
+
+// returnsQuery sets the result of a table function to a query over the routine arguments, bound as ?1, ?2...
+func (rc *sqliteRoutineContext) returnsQuery(query string) error {
+	return rc.returns(query, rc.args...)
+}
+
+// sqliteRetrospectiveRole is retrospective_get_user_role as an expression, owners and team, department
+// or organization admins of a team retrospective are implicitly facilitators
+func sqliteRetrospectiveRole(retrospectiveID string, userID string) string {
+	return `CASE
+		WHEN EXISTS (SELECT 1 FROM retrospective r WHERE r.id = ` + retrospectiveID + ` AND r.owner_id = ` + userID + `) THEN 'FACILITATOR'
+		WHEN EXISTS (
+			SELECT 1
+			FROM team_retrospective tr
+			LEFT JOIN team_user tu ON tu.team_id = tr.team_id AND tu.user_id = ` + userID + ` AND tu.role = 'ADMIN'
+			LEFT JOIN department_team dt ON dt.team_id = tr.team_id
+			LEFT JOIN department_user du ON du.department_id = dt.department_id AND du.user_id = ` + userID + ` AND du.role = 'ADMIN'
+			LEFT JOIN organization_department od ON od.id = dt.department_id
+			LEFT JOIN organization_team ot ON ot.team_id = tr.team_id
+			LEFT JOIN organization_user ou ON ou.organization_id = COALESCE(ot.organization_id, od.organization_id)
+				AND ou.user_id = ` + userID + ` AND ou.role = 'ADMIN'
+			WHERE tr.retrospective_id = ` + retrospectiveID + `
+				AND (tu.user_id IS NOT NULL OR du.user_id IS NOT NULL OR ou.user_id IS NOT NULL)
+		) THEN 'FACILITATOR'
+		ELSE COALESCE(
+			(SELECT ru.role FROM retrospective_user ru WHERE ru.retrospective_id = ` + retrospectiveID + ` AND ru.user_id = ` + userID + `),
+			'PARTICIPANT'
+		)
+	END`
+}
+
+// sqliteRoutines are the stored procedures and functions of schema.sql, keyed by name
+var sqliteRoutines map[string]sqliteRoutine
+
+func init() {
+	sqliteRoutines = map[string]sqliteRoutine{
+		// Reset All Users to Inactive, used by server restart
+		"deactivate_all_users": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`UPDATE retrospective_user SET active = false WHERE active = true;`)
+			return err
+		},
+
+		// Set Retrospective Owner, previous owner stays on as a facilitator
+		"set_retrospective_owner": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(
+				`INSERT INTO retrospective_user (retrospective_id, user_id, role)
+				SELECT r.id, r.owner_id, 'FACILITATOR' FROM retrospective r WHERE r.id = ?1 AND r.owner_id IS NOT NULL
+				ON CONFLICT (retrospective_id, user_id) DO UPDATE SET role = 'FACILITATOR';`,
+				rc.args[0],
+			); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE retrospective SET updated_date = CURRENT_TIMESTAMP, owner_id = ?2 WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Set Retrospective User Role (FACILITATOR, PARTICIPANT, OBSERVER)
+		"set_retrospective_user_role": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(
+				`UPDATE retrospective_user SET role = ?3 WHERE retrospective_id = ?1 AND user_id = ?2;`,
+				rc.args...,
+			); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE retrospective SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Set Retrospective Phase
+		"set_retrospective_phase": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`UPDATE retrospective SET updated_date = CURRENT_TIMESTAMP, phase = ?2 WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Delete Retrospective
+		"delete_retrospective": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`DELETE FROM retrospective WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Reset User Password
+		"reset_user_password": func(rc *sqliteRoutineContext) error {
+			row, err := rc.queryRow(
+				`SELECT u.id FROM user_reset ur
+				JOIN users u ON u.id = ur.user_id
+				WHERE ur.reset_id = ?1 AND CURRENT_TIMESTAMP < ur.expire_date;`,
+				rc.args[0],
+			)
+			if err != nil {
+				return err
+			}
+			if row == nil {
+				return errors.New("Valid Reset ID not found")
+			}
+
+			if _, err := rc.exec(
+				`UPDATE users SET password = ?2, last_active = CURRENT_TIMESTAMP, updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`,
+				row[0], rc.args[1],
+			); err != nil {
+				return err
+			}
+			_, err = rc.exec(`DELETE FROM user_reset WHERE reset_id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Update User Password
+		"update_user_password": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(
+				`UPDATE users SET password = ?2, last_active = CURRENT_TIMESTAMP, updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`,
+				rc.args...,
+			)
+			return err
+		},
+
+		// Verify a user account email
+		"verify_user_account": func(rc *sqliteRoutineContext) error {
+			row, err := rc.queryRow(
+				`SELECT u.id FROM user_verify uv
+				JOIN users u ON u.id = uv.user_id
+				WHERE uv.verify_id = ?1 AND CURRENT_TIMESTAMP < uv.expire_date;`,
+				rc.args[0],
+			)
+			if err != nil {
+				return err
+			}
+			if row == nil {
+				return errors.New("Valid Verify ID not found")
+			}
+
+			if _, err := rc.exec(
+				`UPDATE users SET verified = true, last_active = CURRENT_TIMESTAMP, updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`,
+				row[0],
+			); err != nil {
+				return err
+			}
+			_, err = rc.exec(`DELETE FROM user_verify WHERE verify_id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Promote User to ADMIN by ID
+		"promote_user": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`UPDATE users SET type = 'ADMIN', updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Promote User to ADMIN by Email
+		"promote_user_by_email": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`UPDATE users SET type = 'ADMIN', updated_date = CURRENT_TIMESTAMP WHERE email = ?1;`, rc.args...)
+			return err
+		},
+
+		// Demote User to Registered by ID
+		"demote_user": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`UPDATE users SET type = 'REGISTERED', updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Clean up Retrospectives older than X Days
+		"clean_retrospectives": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`DELETE FROM retrospective WHERE updated_date < datetime('now', '-' || ?1 || ' days');`, rc.args...)
+			return err
+		},
+
+		// Clean up Guest Users (and their created retrospectives) older than X Days
+		"clean_guest_users": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(
+				`DELETE FROM users WHERE last_active < datetime('now', '-' || ?1 || ' days') AND type = 'GUEST';`,
+				rc.args...,
+			)
+			return err
+		},
+
+		// Deletes a User and all his retrospective(s), api keys
+		"delete_user": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`DELETE FROM users WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Updates a users profile
+		"user_profile_update": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(
+				`UPDATE users
+				SET
+					name = ?2,
+					avatar = ?3,
+					country = ?4,
+					locale = ?5,
+					company = ?6,
+					job_title = ?7,
+					last_active = CURRENT_TIMESTAMP,
+					updated_date = CURRENT_TIMESTAMP
+				WHERE id = ?1;`,
+				rc.args...,
+			)
+			return err
+		},
+
+		// Adds a vote to retrospective item
+		"vote_retrospective_item": func(rc *sqliteRoutineContext) error {
+			row, err := rc.queryRow(`SELECT votes FROM retrospective_item WHERE id = ?1;`, rc.args[0])
+			if err != nil || row == nil {
+				return err
+			}
+
+			votes := parsePostgresArray(fmt.Sprint(row[0]))
+			userID := fmt.Sprint(rc.args[1])
+			for _, v := range votes {
+				if v == userID {
+					return nil
+				}
+			}
+			votes = append(votes, userID)
+
+			_, err = rc.exec(
+				`UPDATE retrospective_item SET votes = ?2, updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`,
+				rc.args[0], formatPostgresArray(votes),
+			)
+			return err
+		},
+
+		// Updates a retrospective items content, keeping the previous content in history
+		"retrospective_item_update": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(
+				`INSERT INTO retrospective_item_history (item_id, user_id, content)
+				SELECT ri.id, ?3, ri.content FROM retrospective_item ri WHERE ri.id = ?2 AND ri.retrospective_id = ?1;`,
+				rc.args[0], rc.args[1], rc.args[2],
+			); err != nil {
+				return err
+			}
+			_, err := rc.exec(
+				`UPDATE retrospective_item SET content = ?3, updated_date = CURRENT_TIMESTAMP WHERE id = ?2 AND retrospective_id = ?1;`,
+				rc.args[0], rc.args[1], rc.args[3],
+			)
+			return err
+		},
+
+		// Updates a retrospective actions content, keeping the previous content in history
+		"retrospective_action_update": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(
+				`INSERT INTO retrospective_action_history (action_id, user_id, content)
+				SELECT ra.id, ?3, ra.content FROM retrospective_action ra WHERE ra.id = ?2 AND ra.retrospective_id = ?1;`,
+				rc.args[0], rc.args[1], rc.args[2],
+			); err != nil {
+				return err
+			}
+			_, err := rc.exec(
+				`UPDATE retrospective_action SET content = ?3, updated_date = CURRENT_TIMESTAMP WHERE id = ?2 AND retrospective_id = ?1;`,
+				rc.args[0], rc.args[1], rc.args[3],
+			)
+			return err
+		},
+
+		// Toggles a users emoji reaction on a retrospective item
+		"retrospective_item_reaction_toggle": func(rc *sqliteRoutineContext) error {
+			deleted, err := rc.exec(
+				`DELETE FROM retrospective_item_reaction WHERE item_id = ?1 AND user_id = ?2 AND emoji = ?3;`,
+				rc.args...,
+			)
+			if err != nil || deleted > 0 {
+				return err
+			}
+			_, err = rc.exec(`INSERT INTO retrospective_item_reaction (item_id, user_id, emoji) VALUES (?1, ?2, ?3);`, rc.args...)
+			return err
+		},
+
+		// Create a Retrospective
+		"create_retrospective": func(rc *sqliteRoutineContext) error {
+			row, err := rc.queryRow(`INSERT INTO retrospective (owner_id, name) VALUES (?1, ?2) RETURNING id;`, rc.args...)
+			if err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS create_retrospective`, row[0])
+		},
+
+		// Get Retrospectives by User ID
+		"get_retrospectives_by_user": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT b.id, b.name, b.owner_id, b.phase
+				FROM retrospective b
+				LEFT JOIN retrospective_user su ON b.id = su.retrospective_id WHERE su.user_id = ?1 AND su.abandoned = false
+				GROUP BY b.id ORDER BY b.created_date DESC`,
+			)
+		},
+
+		// Get a User by ID
+		"get_user": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT u.id, u.name, coalesce(u.email, '') AS email, u.type, u.verified, u.avatar, u.country, u.locale, u.company, u.job_title AS jobTitle
+				FROM users u WHERE u.id = ?1`,
+			)
+		},
+
+		// Get Retrospective User Role
+		"retrospective_get_user_role": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(`SELECT ` + sqliteRetrospectiveRole("?1", "?2") + ` AS role`)
+		},
+
+		// Get Retrospective Users
+		"get_retrospective_users": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT w.id, w.name, su.active, ` + sqliteRetrospectiveRole("?1", "w.id") + ` AS role
+				FROM retrospective_user su
+				LEFT JOIN users w ON su.user_id = w.id
+				WHERE su.retrospective_id = ?1
+				ORDER BY w.name`,
+			)
+		},
+
+		// Get Retrospective User by id
+		"get_retrospective_user": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT w.id, w.name, coalesce(su.active, false) AS active
+				FROM users w
+				LEFT JOIN retrospective_user su ON su.user_id = w.id AND su.retrospective_id = ?1
+				WHERE w.id = ?2`,
+			)
+		},
+
+		// Get User Auth by Email
+		"get_user_auth_by_email": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT u.id, u.name, coalesce(u.email, '') AS email, u.type, u.password, u.locale FROM users u WHERE u.email = ?1`,
+			)
+		},
+
+		// Get Application Stats e.g. total user and retrospective counts
+		"get_app_stats": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT
+					(SELECT COUNT(*) FROM users WHERE email IS NULL) AS unregistered_user_count,
+					(SELECT COUNT(*) FROM users WHERE email IS NOT NULL) AS registered_user_count,
+					(SELECT COUNT(*) FROM retrospective) AS retrospective_count,
+					(SELECT COUNT(*) FROM organization) AS organization_count,
+					(SELECT COUNT(*) FROM organization_department) AS department_count,
+					(SELECT COUNT(*) FROM team) AS team_count,
+					(SELECT COUNT(*) FROM api_keys) AS apikey_count`,
+			)
+		},
+
+		// Insert a new user password reset
+		"insert_user_reset": func(rc *sqliteRoutineContext) error {
+			user, err := rc.queryRow(`SELECT id, name FROM users WHERE email = ?1;`, rc.args[0])
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				return fmt.Errorf("Nonexistent User --> %v", rc.args[0])
+			}
+
+			reset, err := rc.queryRow(`INSERT INTO user_reset (user_id) VALUES (?1) RETURNING reset_id;`, user[0])
+			if err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS resetId, ?2 AS userId, ?3 AS userName`, reset[0], user[0], user[1])
+		},
+
+		// Register a new user, or a new user from an existing GUEST when called with the guests id
+		"register_user": func(rc *sqliteRoutineContext) error {
+			if len(rc.args) == 5 {
+				return sqliteRegisterExistingUser(rc)
+			}
+
+			user, err := rc.queryRow(
+				`INSERT INTO users (name, email, password, type) VALUES (?1, ?2, ?3, ?4) RETURNING id;`,
+				rc.args...,
+			)
+			if err != nil {
+				return err
+			}
+			return sqliteUserVerify(rc, user[0])
+		},
+
+		// Register a new user from existing GUEST
+		"register_existing_user": sqliteRegisterExistingUser,
+
+		// Get a list of countries
+		"countries_active": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(`SELECT ac.country FROM active_countries ac`)
+		},
+
+		// Get Organization
+		"organization_get_by_id": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT o.id, o.name, o.created_date, o.updated_date FROM organization o WHERE o.id = ?1`,
+			)
+		},
+
+		// Get Organization User Role
+		"organization_get_user_role": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT (SELECT ou.role FROM organization_user ou WHERE ou.organization_id = ?2 AND ou.user_id = ?1) AS role`,
+			)
+		},
+
+		// Get Organizations
+		"organization_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT o.id, o.name, o.created_date, o.updated_date
+				FROM organization o
+				ORDER BY o.created_date
+				LIMIT ?1 OFFSET ?2`,
+			)
+		},
+
+		// Get Organizations by User
+		"organization_list_by_user": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT o.id, o.name, o.created_date, o.updated_date, ou.role
+				FROM organization_user ou
+				LEFT JOIN organization o ON ou.organization_id = o.id
+				WHERE ou.user_id = ?1
+				ORDER BY o.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Create Organization
+		"organization_create": func(rc *sqliteRoutineContext) error {
+			org, err := rc.queryRow(`INSERT INTO organization (name) VALUES (?1) RETURNING id;`, rc.args[1])
+			if err != nil {
+				return err
+			}
+			if _, err := rc.exec(
+				`INSERT INTO organization_user (organization_id, user_id, role) VALUES (?1, ?2, 'ADMIN');`,
+				org[0], rc.args[0],
+			); err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS organizationId`, org[0])
+		},
+
+		// Add User to Organization
+		"organization_user_add": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(
+				`INSERT INTO organization_user (organization_id, user_id, role) VALUES (?1, ?2, ?3);`,
+				rc.args...,
+			); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE organization SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Remove User from Organization
+		"organization_user_remove": func(rc *sqliteRoutineContext) error {
+			rows, err := rc.conn.QueryContext(rc.ctx,
+				`SELECT id FROM organization_department WHERE organization_id = ?1;`,
+				namedValues(rc.args[:1]),
+			)
+			if err != nil {
+				return err
+			}
+			var departmentIDs []driver.Value
+			row := make([]driver.Value, 1)
+			for rows.Next(row) == nil {
+				departmentIDs = append(departmentIDs, row[0])
+			}
+			rows.Close()
+
+			for _, departmentID := range departmentIDs {
+				if err := sqliteDepartmentUserRemove(rc, departmentID, rc.args[1]); err != nil {
+					return err
+				}
+			}
+
+			if _, err := rc.exec(
+				`DELETE FROM team_user WHERE team_id IN (
+					SELECT ot.team_id FROM organization_team ot WHERE ot.organization_id = ?1
+				) AND user_id = ?2;`,
+				rc.args...,
+			); err != nil {
+				return err
+			}
+			if _, err := rc.exec(`DELETE FROM organization_user WHERE organization_id = ?1 AND user_id = ?2;`, rc.args...); err != nil {
+				return err
+			}
+			_, err = rc.exec(`UPDATE organization SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Get Organization Users
+		"organization_user_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT u.id, u.name, u.email, ou.role
+				FROM organization_user ou
+				LEFT JOIN users u ON ou.user_id = u.id
+				WHERE ou.organization_id = ?1
+				ORDER BY ou.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Get Organization Teams
+		"organization_team_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT t.id, t.name, t.created_date, t.updated_date
+				FROM organization_team ot
+				LEFT JOIN team t ON ot.team_id = t.id
+				WHERE ot.organization_id = ?1
+				ORDER BY t.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Create Organization Team
+		"organization_team_create": func(rc *sqliteRoutineContext) error {
+			team, err := rc.queryRow(`INSERT INTO team (name) VALUES (?1) RETURNING id;`, rc.args[1])
+			if err != nil {
+				return err
+			}
+			if _, err := rc.exec(`INSERT INTO organization_team (organization_id, team_id) VALUES (?1, ?2);`, rc.args[0], team[0]); err != nil {
+				return err
+			}
+			if _, err := rc.exec(`UPDATE organization SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0]); err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS teamId`, team[0])
+		},
+
+		// Get Organization Team User Role
+		"organization_team_user_role": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT ou.role AS orgRole, COALESCE(tu.role, '') AS teamRole
+				FROM organization_user ou
+				LEFT JOIN team_user tu ON tu.user_id = ?1 AND tu.team_id = ?3
+				WHERE ou.organization_id = ?2 AND ou.user_id = ?1`,
+			)
+		},
+
+		// Get Department
+		"department_get_by_id": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT od.id, od.name, od.created_date, od.updated_date FROM organization_department od WHERE od.id = ?1`,
+			)
+		},
+
+		// Get Department User Role
+		"department_get_user_role": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT ou.role AS orgRole, COALESCE(du.role, '') AS departmentRole
+				FROM organization_user ou
+				LEFT JOIN department_user du ON du.user_id = ?1 AND du.department_id = ?3
+				WHERE ou.organization_id = ?2 AND ou.user_id = ?1`,
+			)
+		},
+
+		// Get Organization Departments
+		"department_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT d.id, d.name, d.created_date, d.updated_date
+				FROM organization_department d
+				WHERE d.organization_id = ?1
+				ORDER BY d.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Create Organization Department
+		"department_create": func(rc *sqliteRoutineContext) error {
+			department, err := rc.queryRow(
+				`INSERT INTO organization_department (name, organization_id) VALUES (?1, ?2) RETURNING id;`,
+				rc.args[1], rc.args[0],
+			)
+			if err != nil {
+				return err
+			}
+			if _, err := rc.exec(`UPDATE organization SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0]); err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS departmentId`, department[0])
+		},
+
+		// Get Department Teams
+		"department_team_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT t.id, t.name, t.created_date, t.updated_date
+				FROM department_team dt
+				LEFT JOIN team t ON dt.team_id = t.id
+				WHERE dt.department_id = ?1
+				ORDER BY t.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Create Department Team
+		"department_team_create": func(rc *sqliteRoutineContext) error {
+			team, err := rc.queryRow(`INSERT INTO team (name) VALUES (?1) RETURNING id;`, rc.args[1])
+			if err != nil {
+				return err
+			}
+			if _, err := rc.exec(`INSERT INTO department_team (department_id, team_id) VALUES (?1, ?2);`, rc.args[0], team[0]); err != nil {
+				return err
+			}
+			if _, err := rc.exec(`UPDATE organization_department SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0]); err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS teamId`, team[0])
+		},
+
+		// Get Department Team User Role
+		"department_team_user_role": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT ou.role AS orgRole, COALESCE(du.role, '') AS departmentRole, COALESCE(tu.role, '') AS teamRole
+				FROM organization_user ou
+				LEFT JOIN department_user du ON du.user_id = ?1 AND du.department_id = ?3
+				LEFT JOIN team_user tu ON tu.user_id = ?1 AND tu.team_id = ?4
+				WHERE ou.organization_id = ?2 AND ou.user_id = ?1`,
+			)
+		},
+
+		// Get Department Users
+		"department_user_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT u.id, u.name, u.email, du.role
+				FROM department_user du
+				LEFT JOIN users u ON du.user_id = u.id
+				WHERE du.department_id = ?1
+				ORDER BY du.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Add User to Department
+		"department_user_add": func(rc *sqliteRoutineContext) error {
+			org, err := rc.queryRow(`SELECT organization_id FROM organization_user WHERE user_id = ?1;`, rc.args[1])
+			if err != nil {
+				return err
+			}
+			if org == nil {
+				return fmt.Errorf("User not in Organization -> %v", rc.args[1])
+			}
+
+			if _, err := rc.exec(`INSERT INTO department_user (department_id, user_id, role) VALUES (?1, ?2, ?3);`, rc.args...); err != nil {
+				return err
+			}
+			_, err = rc.exec(`UPDATE organization_department SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Remove User from Department
+		"department_user_remove": func(rc *sqliteRoutineContext) error {
+			return sqliteDepartmentUserRemove(rc, rc.args[0], rc.args[1])
+		},
+
+		// Get Team
+		"team_get_by_id": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(`SELECT o.id, o.name, o.created_date, o.updated_date FROM team o WHERE o.id = ?1`)
+		},
+
+		// Get Team User Role
+		"team_get_user_role": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(`SELECT tu.role FROM team_user tu WHERE tu.team_id = ?2 AND tu.user_id = ?1`)
+		},
+
+		// Get Teams
+		"team_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT t.id, t.name, t.created_date, t.updated_date
+				FROM team t
+				ORDER BY t.created_date
+				LIMIT ?1 OFFSET ?2`,
+			)
+		},
+
+		// Get Teams by User
+		"team_list_by_user": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT t.id, t.name, t.created_date, t.updated_date
+				FROM team_user tu
+				LEFT JOIN team t ON tu.team_id = t.id
+				WHERE tu.user_id = ?1
+				ORDER BY t.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Create Team
+		"team_create": func(rc *sqliteRoutineContext) error {
+			team, err := rc.queryRow(`INSERT INTO team (name) VALUES (?1) RETURNING id;`, rc.args[1])
+			if err != nil {
+				return err
+			}
+			if _, err := rc.exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?1, ?2, 'ADMIN');`, team[0], rc.args[0]); err != nil {
+				return err
+			}
+			return rc.returns(`SELECT ?1 AS teamId`, team[0])
+		},
+
+		// Get Team Users
+		"team_user_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT u.id, u.name, u.email, tu.role
+				FROM team_user tu
+				LEFT JOIN users u ON tu.user_id = u.id
+				WHERE tu.team_id = ?1
+				ORDER BY tu.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Add User to Team
+		"team_user_add": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(`INSERT INTO team_user (team_id, user_id, role) VALUES (?1, ?2, ?3);`, rc.args...); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE team SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Remove User from Team
+		"team_user_remove": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(`DELETE FROM team_user WHERE team_id = ?1 AND user_id = ?2;`, rc.args...); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE team SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Get Team Retrospectives
+		"team_retrospective_list": func(rc *sqliteRoutineContext) error {
+			return rc.returnsQuery(
+				`SELECT b.id, b.name
+				FROM team_retrospective tb
+				LEFT JOIN retrospective b ON tb.retrospective_id = b.id
+				WHERE tb.team_id = ?1
+				ORDER BY tb.created_date
+				LIMIT ?2 OFFSET ?3`,
+			)
+		},
+
+		// Add Retrospective to Team
+		"team_retrospective_add": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(`INSERT INTO team_retrospective (team_id, retrospective_id) VALUES (?1, ?2);`, rc.args...); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE team SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Remove Retrospective from Team
+		"team_retrospective_remove": func(rc *sqliteRoutineContext) error {
+			if _, err := rc.exec(`DELETE FROM team_retrospective WHERE retrospective_id = ?2 AND team_id = ?1;`, rc.args...); err != nil {
+				return err
+			}
+			_, err := rc.exec(`UPDATE team SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, rc.args[0])
+			return err
+		},
+
+		// Delete Team
+		"team_delete": func(rc *sqliteRoutineContext) error {
+			_, err := rc.exec(`DELETE FROM team WHERE id = ?1;`, rc.args...)
+			return err
+		},
+
+		// Claim a due Team Retrospective Schedule, advancing it to its next future run
+		// sqlite has a single writer so the claim can't race another replica
+		"team_retrospective_schedule_claim": func(rc *sqliteRoutineContext) error {
+			due, err := rc.queryRow(
+				`SELECT id, next_run_date, interval_weeks FROM team_retrospective_schedule
+				WHERE active = true AND next_run_date <= CURRENT_TIMESTAMP
+				ORDER BY next_run_date
+				LIMIT 1;`,
+			)
+			if err != nil {
+				return err
+			}
+			if due == nil {
+				return rc.returns(`SELECT NULL AS id, NULL AS team_id, NULL AS owner_id, NULL AS name WHERE 0`)
+			}
+
+			nextRun, _ := due[1].(time.Time)
+			interval := time.Duration(due[2].(int64)) * 7 * 24 * time.Hour
+			periods := math.Floor(float64(time.Since(nextRun)) / float64(interval))
+			nextRun = nextRun.Add(interval * time.Duration(periods+1))
+
+			if _, err := rc.exec(
+				`UPDATE team_retrospective_schedule SET next_run_date = ?2, updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`,
+				due[0], nextRun,
+			); err != nil {
+				return err
+			}
+			return rc.returns(`SELECT id, team_id, owner_id, name FROM team_retrospective_schedule WHERE id = ?1`, due[0])
+		},
+	}
+}
+
+// sqliteRegisterExistingUser registers an existing GUEST user
+func sqliteRegisterExistingUser(rc *sqliteRoutineContext) error {
+	user, err := rc.queryRow(
+		`UPDATE users
+		SET
+			name = ?2,
+			email = ?3,
+			password = ?4,
+			type = ?5,
+			last_active = CURRENT_TIMESTAMP,
+			updated_date = CURRENT_TIMESTAMP
+		WHERE id = ?1
+		RETURNING id;`,
+		rc.args...,
+	)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	return sqliteUserVerify(rc, user[0])
+}
+
+// sqliteUserVerify adds an email verification for the newly registered user
+func sqliteUserVerify(rc *sqliteRoutineContext, userID driver.Value) error {
+	verify, err := rc.queryRow(`INSERT INTO user_verify (user_id) VALUES (?1) RETURNING verify_id;`, userID)
+	if err != nil {
+		return err
+	}
+
+	return rc.returns(`SELECT ?1 AS userId, ?2 AS verifyId`, userID, verify[0])
+}
+
+// sqliteDepartmentUserRemove removes the user from the department and its teams
+func sqliteDepartmentUserRemove(rc *sqliteRoutineContext, departmentID driver.Value, userID driver.Value) error {
+	if _, err := rc.exec(
+		`DELETE FROM team_user WHERE team_id IN (
+			SELECT dt.team_id FROM department_team dt WHERE dt.department_id = ?1
+		) AND user_id = ?2;`,
+		departmentID, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := rc.exec(`DELETE FROM department_user WHERE department_id = ?1 AND user_id = ?2;`, departmentID, userID); err != nil {
+		return err
+	}
+	_, err := rc.exec(`UPDATE organization_department SET updated_date = CURRENT_TIMESTAMP WHERE id = ?1;`, departmentID)
+	return err
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePostgresArray(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    []string
+	}{
+		{`{}`, []string{}},
+		{`{a,b}`, []string{"a", "b"}},
+		{`{"a b","c,d"}`, []string{"a b", "c,d"}},
+		{`{"say \"hi\"","back\\slash"}`, []string{`say "hi"`, `back\slash`}},
+		{`{""}`, []string{""}},
+		{`not an array`, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := parsePostgresArray(tt.literal); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePostgresArray(%q) = %q, want %q", tt.literal, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPostgresArray(t *testing.T) {
+	values := []string{"a", "b c", `say "hi"`, `back\slash`, ""}
+
+	literal := formatPostgresArray(values)
+	if want := `{"a","b c","say \"hi\"","back\\slash",""}`; literal != want {
+		t.Errorf("formatPostgresArray(%q) = %q, want %q", values, literal, want)
+	}
+	if got := parsePostgresArray(literal); !reflect.DeepEqual(got, values) {
+		t.Errorf("parsePostgresArray(formatPostgresArray(%q)) = %q", values, got)
+	}
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/outbound"
+)
+
+// Team chat integration webhook payload formats
+const (
+	IntegrationFormatSlack      = "SLACK"
+	IntegrationFormatTeams      = "TEAMS"
+	IntegrationFormatMattermost = "MATTERMOST"
+)
+
+// validateIntegration checks the webhook url is an https url outside of the servers network and the format is supported
+func validateIntegration(WebhookURL string, Format string) error {
+	switch Format {
+	case IntegrationFormatSlack, IntegrationFormatTeams, IntegrationFormatMattermost:
+	default:
+		return errors.New("format must be one of SLACK, TEAMS or MATTERMOST")
+	}
+
+	if err := outbound.ValidateURL(WebhookURL); err != nil {
+		return errors.New("webhook url must be an https url of a public address")
+	}
+
+	return nil
+}
+
+// TeamIntegrationList gets a list of the teams chat integrations
+func (d *Database) TeamIntegrationList(ctx context.Context, TeamID string) []*TeamIntegration {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var integrations = make([]*TeamIntegration, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, team_id, webhook_url, format, active, created_date, updated_date
+		FROM team_integration
+		WHERE team_id = $1
+		ORDER BY created_date;`,
+		TeamID,
+	)
+
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var ti TeamIntegration
+
+			if err := rows.Scan(
+				&ti.IntegrationID,
+				&ti.TeamID,
+				&ti.WebhookURL,
+				&ti.Format,
+				&ti.Active,
+				&ti.CreatedDate,
+				&ti.UpdatedDate,
+			); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamIntegrationList", "team_id", TeamID, "error", err)
+			} else {
+				integrations = append(integrations, &ti)
+			}
+		}
+	} else {
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamIntegrationList", "team_id", TeamID, "error", err)
+	}
+
+	return integrations
+}
+
+// TeamIntegrationCreate adds a chat incoming webhook to the team
+func (d *Database) TeamIntegrationCreate(ctx context.Context, TeamID string, WebhookURL string, Format string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := validateIntegration(WebhookURL, Format); err != nil {
+		return "", err
+	}
+
+	var IntegrationID string
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO team_integration (team_id, webhook_url, format)
+		VALUES ($1, $2, $3)
+		RETURNING id;`,
+		TeamID,
+		WebhookURL,
+		Format,
+	).Scan(&IntegrationID)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to create team integration", "team_id", TeamID, "error", err)
+		return "", err
+	}
+
+	return IntegrationID, nil
+}
+
+// TeamIntegrationUpdate updates a teams chat integration webhook url, format and whether it is active
+func (d *Database) TeamIntegrationUpdate(ctx context.Context, TeamID string, IntegrationID string, WebhookURL string, Format string, Active bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := validateIntegration(WebhookURL, Format); err != nil {
+		return err
+	}
+
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE team_integration SET webhook_url = $3, format = $4, active = $5, updated_date = NOW()
+		WHERE id = $2 AND team_id = $1;`,
+		TeamID,
+		IntegrationID,
+		WebhookURL,
+		Format,
+		Active,
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to update team integration", "team_id", TeamID, "integration_id", IntegrationID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TeamIntegrationDelete deletes a teams chat integration
+func (d *Database) TeamIntegrationDelete(ctx context.Context, TeamID string, IntegrationID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
+		`DELETE FROM team_integration WHERE id = $2 AND team_id = $1;`,
+		TeamID,
+		IntegrationID,
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to delete team integration", "team_id", TeamID, "integration_id", IntegrationID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRetrospectiveIntegrations gets the active chat integrations of the teams the retrospective belongs to
+func (d *Database) GetRetrospectiveIntegrations(ctx context.Context, RetrospectiveID string) []*TeamIntegration {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var integrations = make([]*TeamIntegration, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT ti.id, ti.team_id, COALESCE(t.name, ''), ti.webhook_url, ti.format
+		FROM team_retrospective tr
+		JOIN team t ON t.id = tr.team_id
+		JOIN team_integration ti ON ti.team_id = tr.team_id
+		WHERE tr.retrospective_id = $1 AND ti.active = true;`,
+		RetrospectiveID,
+	)
+
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var ti = TeamIntegration{Active: true}
+
+			if err := rows.Scan(
+				&ti.IntegrationID,
+				&ti.TeamID,
+				&ti.TeamName,
+				&ti.WebhookURL,
+				&ti.Format,
+			); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveIntegrations", "retrospective_id", RetrospectiveID, "error", err)
+			} else {
+				integrations = append(integrations, &ti)
+			}
+		}
+	} else {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveIntegrations", "retrospective_id", RetrospectiveID, "error", err)
+	}
+
+	return integrations
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// TeamScheduleList gets a list of the teams recurring retrospective schedules
+func (d *Database) TeamScheduleList(ctx context.Context, TeamID string) []*TeamRetrospectiveSchedule {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var schedules = make([]*TeamRetrospectiveSchedule, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, team_id, owner_id, name, interval_weeks, next_run_date, active, created_date, updated_date
+		FROM team_retrospective_schedule
+		WHERE team_id = $1
+		ORDER BY next_run_date;`,
+		TeamID,
+	)
+
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var trs TeamRetrospectiveSchedule
+
+			if err := rows.Scan(
+				&trs.ScheduleID,
+				&trs.TeamID,
+				&trs.OwnerID,
+				&trs.Name,
+				&trs.IntervalWeeks,
+				&trs.NextRunDate,
+				&trs.Active,
+				&trs.CreatedDate,
+				&trs.UpdatedDate,
+			); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamScheduleList", "team_id", TeamID, "error", err)
+			} else {
+				schedules = append(schedules, &trs)
+			}
+		}
+	} else {
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamScheduleList", "team_id", TeamID, "error", err)
+	}
+
+	return schedules
+}
+
+// TeamScheduleCreate creates a recurring retrospective schedule for a team, the first retrospective
+// is created at StartDate and then every IntervalWeeks weeks after
+func (d *Database) TeamScheduleCreate(ctx context.Context, TeamID string, OwnerID string, Name string, IntervalWeeks int, StartDate time.Time) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if IntervalWeeks < 1 || IntervalWeeks > 52 {
+		return "", errors.New("interval weeks must be between 1 and 52")
+	}
+	if StartDate.IsZero() {
+		StartDate = time.Now()
+	}
+
+	var ScheduleID string
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO team_retrospective_schedule (team_id, owner_id, name, interval_weeks, next_run_date)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id;`,
+		TeamID,
+		OwnerID,
+		Name,
+		IntervalWeeks,
+		StartDate.UTC(),
+	).Scan(&ScheduleID)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to create team schedule", "team_id", TeamID, "error", err)
+		return "", err
+	}
+
+	return ScheduleID, nil
+}
+
+// TeamScheduleUpdateActive pauses or resumes a teams recurring retrospective schedule
+func (d *Database) TeamScheduleUpdateActive(ctx context.Context, TeamID string, ScheduleID string, Active bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE team_retrospective_schedule SET active = $3, updated_date = NOW() WHERE id = $2 AND team_id = $1;`,
+		TeamID,
+		ScheduleID,
+		Active,
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to update team schedule", "team_id", TeamID, "schedule_id", ScheduleID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TeamScheduleDelete deletes a teams recurring retrospective schedule
+func (d *Database) TeamScheduleDelete(ctx context.Context, TeamID string, ScheduleID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
+		`DELETE FROM team_retrospective_schedule WHERE id = $2 AND team_id = $1;`,
+		TeamID,
+		ScheduleID,
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to delete team schedule", "team_id", TeamID, "schedule_id", ScheduleID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TeamScheduleRunDue claims the next due schedule (advancing it to its next run) and creates its team
+// retrospective, named after the schedule and RunDate, in a single transaction so a run that fails is
+// retried instead of lost, returning nil when no schedules are due
+func (d *Database) TeamScheduleRunDue(ctx context.Context, RunDate time.Time) (*TeamRetrospectiveSchedule, *Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var trs *TeamRetrospectiveSchedule
+	var b *Retrospective
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		var schedule TeamRetrospectiveSchedule
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, team_id, owner_id, name FROM team_retrospective_schedule_claim();`,
+		).Scan(
+			&schedule.ScheduleID,
+			&schedule.TeamID,
+			&schedule.OwnerID,
+			&schedule.Name,
+		)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("Unable to claim team schedule", "error", err)
+			return err
+		}
+
+		retrospective := newRetrospective(schedule.OwnerID, schedule.Name+" "+RunDate.UTC().Format("2006-01-02"))
+		if err := teamCreateRetrospective(ctx, tx, schedule.TeamID, retrospective); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE team_retrospective_schedule SET last_retrospective_id = $2 WHERE id = $1;`,
+			schedule.ScheduleID,
+			retrospective.RetrospectiveID,
+		); err != nil {
+			logging.FromContext(ctx).Error("Unable to update team schedule", "schedule_id", schedule.ScheduleID, "error", err)
+			return err
+		}
+
+		trs, b = &schedule, retrospective
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return trs, b, nil
+}
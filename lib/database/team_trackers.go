@@ -0,0 +1,408 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/outbound"
+)
+
+// Team issue tracker providers
+const (
+	TrackerProviderJira   = "JIRA"
+	TrackerProviderGitHub = "GITHUB"
+	TrackerProviderGitLab = "GITLAB"
+)
+
+// validateTracker checks the provider is supported and has the settings it needs, the base url is only
+// required for Jira, GitHub and GitLab default to their hosted api, and must be an https url outside of the servers network
+func validateTracker(Provider string, BaseURL string, Project string, Username string) error {
+	switch Provider {
+	case TrackerProviderJira:
+		if BaseURL == "" || Username == "" {
+			return errors.New("jira trackers require a base url and username")
+		}
+	case TrackerProviderGitHub, TrackerProviderGitLab:
+	default:
+		return errors.New("provider must be one of JIRA, GITHUB or GITLAB")
+	}
+
+	if BaseURL != "" {
+		if err := outbound.ValidateURL(BaseURL); err != nil {
+			return errors.New("base url must be an https url of a public address")
+		}
+	}
+
+	if Project == "" {
+		return errors.New("project is required")
+	}
+
+	return nil
+}
+
+// TeamTrackerList gets a list of the teams issue trackers
+func (d *Database) TeamTrackerList(ctx context.Context, TeamID string) []*TeamTracker {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var trackers = make([]*TeamTracker, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, team_id, provider, base_url, project, username, webhook_secret, active, created_date, updated_date
+		FROM team_tracker
+		WHERE team_id = $1
+		ORDER BY created_date;`,
+		TeamID,
+	)
+
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var tt TeamTracker
+
+			if err := rows.Scan(
+				&tt.TrackerID,
+				&tt.TeamID,
+				&tt.Provider,
+				&tt.BaseURL,
+				&tt.Project,
+				&tt.Username,
+				&tt.WebhookSecret,
+				&tt.Active,
+				&tt.CreatedDate,
+				&tt.UpdatedDate,
+			); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamTrackerList", "team_id", TeamID, "error", err)
+			} else {
+				trackers = append(trackers, &tt)
+			}
+		}
+	} else {
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamTrackerList", "team_id", TeamID, "error", err)
+	}
+
+	return trackers
+}
+
+// TeamTrackerCreate adds an issue tracker project to the team
+func (d *Database) TeamTrackerCreate(ctx context.Context, TeamID string, Provider string, BaseURL string, Project string, Username string, Token string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := validateTracker(Provider, BaseURL, Project, Username); err != nil {
+		return "", err
+	}
+	if Token == "" {
+		return "", errors.New("token is required")
+	}
+
+	var TrackerID string
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO team_tracker (team_id, provider, base_url, project, username, token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id;`,
+		TeamID,
+		Provider,
+		BaseURL,
+		Project,
+		Username,
+		Token,
+	).Scan(&TrackerID)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to create team tracker", "team_id", TeamID, "error", err)
+		return "", err
+	}
+
+	return TrackerID, nil
+}
+
+// TeamTrackerUpdate updates a teams issue tracker, an empty Token keeps the current token unless the provider
+// or base url changes, the token is never sent to another tracker than the one it was given for
+func (d *Database) TeamTrackerUpdate(ctx context.Context, TeamID string, TrackerID string, Provider string, BaseURL string, Project string, Username string, Token string, Active bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := validateTracker(Provider, BaseURL, Project, Username); err != nil {
+		return err
+	}
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		var CurrentProvider, CurrentBaseURL string
+		if err := tx.QueryRowContext(ctx,
+			`SELECT provider, base_url FROM team_tracker WHERE id = $2 AND team_id = $1 FOR UPDATE;`,
+			TeamID,
+			TrackerID,
+		).Scan(&CurrentProvider, &CurrentBaseURL); err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("tracker not found")
+			}
+			return err
+		}
+		if Token == "" && (Provider != CurrentProvider || BaseURL != CurrentBaseURL) {
+			return errors.New("a new token is required when the provider or base url changes")
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`UPDATE team_tracker SET provider = $3, base_url = $4, project = $5, username = $6,
+				token = COALESCE(NULLIF($7, ''), token), active = $8, updated_date = NOW()
+			WHERE id = $2 AND team_id = $1;`,
+			TeamID,
+			TrackerID,
+			Provider,
+			BaseURL,
+			Project,
+			Username,
+			Token,
+			Active,
+		)
+		return err
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to update team tracker", "team_id", TeamID, "tracker_id", TrackerID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TeamTrackerDelete deletes a teams issue tracker, its tickets stay linked to their actions but are no longer synced
+func (d *Database) TeamTrackerDelete(ctx context.Context, TeamID string, TrackerID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
+		`DELETE FROM team_tracker WHERE id = $2 AND team_id = $1;`,
+		TeamID,
+		TrackerID,
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Unable to delete team tracker", "team_id", TeamID, "tracker_id", TrackerID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TeamTrackerGet gets an issue tracker including its token
+func (d *Database) TeamTrackerGet(ctx context.Context, TrackerID string) (*TeamTracker, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var tt TeamTracker
+	err := d.db.QueryRowContext(ctx,
+		`SELECT id, team_id, provider, base_url, project, username, token, webhook_secret, active, created_date, updated_date
+		FROM team_tracker
+		WHERE id = $1;`,
+		TrackerID,
+	).Scan(
+		&tt.TrackerID,
+		&tt.TeamID,
+		&tt.Provider,
+		&tt.BaseURL,
+		&tt.Project,
+		&tt.Username,
+		&tt.Token,
+		&tt.WebhookSecret,
+		&tt.Active,
+		&tt.CreatedDate,
+		&tt.UpdatedDate,
+	)
+	if err != nil {
+		return nil, errors.New("tracker not found")
+	}
+
+	return &tt, nil
+}
+
+// GetRetrospectiveTrackers gets the active issue trackers of the teams the retrospective belongs to,
+// without their secrets
+func (d *Database) GetRetrospectiveTrackers(ctx context.Context, RetrospectiveID string) []*TeamTracker {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var trackers = make([]*TeamTracker, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT tt.id, tt.team_id, tt.provider, tt.base_url, tt.project, tt.active, tt.created_date, tt.updated_date
+		FROM team_retrospective tr
+		JOIN team_tracker tt ON tt.team_id = tr.team_id
+		WHERE tr.retrospective_id = $1 AND tt.active = true
+		ORDER BY tt.created_date;`,
+		RetrospectiveID,
+	)
+
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var tt TeamTracker
+
+			if err := rows.Scan(
+				&tt.TrackerID,
+				&tt.TeamID,
+				&tt.Provider,
+				&tt.BaseURL,
+				&tt.Project,
+				&tt.Active,
+				&tt.CreatedDate,
+				&tt.UpdatedDate,
+			); err != nil {
+				logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveTrackers", "retrospective_id", RetrospectiveID, "error", err)
+			} else {
+				trackers = append(trackers, &tt)
+			}
+		}
+	} else {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetRetrospectiveTrackers", "retrospective_id", RetrospectiveID, "error", err)
+	}
+
+	return trackers
+}
+
+// ticketClaimTimeout is how long an actions ticket reservation lasts, reservations left behind
+// by a replica that stopped while creating the ticket can be claimed again once it has passed
+const ticketClaimTimeout = 5 * time.Minute
+
+// RetrospectiveActionClaimTicket reserves an action for a ticket in one of the retrospective teams active trackers,
+// returning false when the action already has (or is getting) a ticket
+func (d *Database) RetrospectiveActionClaimTicket(ctx context.Context, RetrospectiveID string, userID string, ActionID string, TrackerID string) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.ConfirmFacilitator(ctx, RetrospectiveID, userID)
+	if err != nil {
+		return false, errors.New("Incorrect permissions")
+	}
+
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective_action SET tracker_id = $3, ticket_claimed_date = NOW(), updated_date = NOW()
+		WHERE id = $1 AND retrospective_id = $2 AND external_key IS NULL
+			AND (tracker_id IS NULL OR ticket_claimed_date IS NULL OR ticket_claimed_date < NOW() - $4 * interval '1 second')
+			AND $3 IN (
+				SELECT tt.id FROM team_tracker tt
+				JOIN team_retrospective tr ON tr.team_id = tt.team_id
+				WHERE tr.retrospective_id = $2 AND tt.active = true
+			);`,
+		ActionID, RetrospectiveID, TrackerID, int(ticketClaimTimeout.Seconds()),
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveActionClaimTicket", "retrospective_id", RetrospectiveID, "action_id", ActionID, "error", err)
+		return false, err
+	}
+
+	count, _ := res.RowsAffected()
+
+	return count == 1, nil
+}
+
+// RetrospectiveActionReleaseTicket releases an actions ticket reservation when creating or linking the ticket failed
+func (d *Database) RetrospectiveActionReleaseTicket(ctx context.Context, RetrospectiveID string, ActionID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective_action SET tracker_id = NULL, ticket_claimed_date = NULL
+		WHERE id = $1 AND retrospective_id = $2 AND external_key IS NULL;`,
+		ActionID, RetrospectiveID,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "RetrospectiveActionReleaseTicket", "retrospective_id", RetrospectiveID, "action_id", ActionID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetRetrospectiveActionTicket stores the key and url of the ticket created for a reserved action
+func (d *Database) SetRetrospectiveActionTicket(ctx context.Context, RetrospectiveID string, ActionID string, ExternalKey string, ExternalURL string) ([]*RetrospectiveAction, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE retrospective_action SET external_key = $3, external_url = $4, external_synced_date = NOW(),
+			ticket_claimed_date = NULL, updated_date = NOW()
+		WHERE id = $1 AND retrospective_id = $2;`,
+		ActionID, RetrospectiveID, ExternalKey, ExternalURL,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "SetRetrospectiveActionTicket", "retrospective_id", RetrospectiveID, "action_id", ActionID, "error", err)
+		return nil, errors.New("Unable to set action ticket")
+	}
+
+	actions := d.GetRetrospectiveActions(ctx, RetrospectiveID)
+
+	return actions, nil
+}
+
+// TrackerSyncClaimDue claims up to Limit open actions with tickets in active trackers that were last synced
+// before SyncedBefore, SKIP LOCKED keeps multiple replicas from syncing the same actions
+func (d *Database) TrackerSyncClaimDue(ctx context.Context, SyncedBefore time.Time, Limit int) ([]*RetrospectiveAction, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var actions = make([]*RetrospectiveAction, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`UPDATE retrospective_action SET external_synced_date = NOW()
+		WHERE id IN (
+			SELECT ra.id FROM retrospective_action ra
+			WHERE ra.completed = false AND ra.external_key IS NOT NULL
+				AND (ra.external_synced_date IS NULL OR ra.external_synced_date < $1)
+				AND ra.tracker_id IN (SELECT tt.id FROM team_tracker tt WHERE tt.active = true)
+			ORDER BY ra.external_synced_date
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, retrospective_id, tracker_id, external_key;`,
+		SyncedBefore.UTC(),
+		Limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "TrackerSyncClaimDue", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ra RetrospectiveAction
+		if err := rows.Scan(&ra.ID, &ra.RetrospectiveID, &ra.TrackerID, &ra.ExternalKey); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "TrackerSyncClaimDue", "error", err)
+			return nil, err
+		}
+		actions = append(actions, &ra)
+	}
+
+	return actions, rows.Err()
+}
+
+// TrackerCompleteAction marks the open actions linked to a closed ticket completed,
+// returning the retrospectives of the completed actions
+func (d *Database) TrackerCompleteAction(ctx context.Context, TrackerID string, ExternalKey string) ([]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var RetrospectiveIDs = make([]string, 0)
+	rows, err := d.db.QueryContext(ctx,
+		`UPDATE retrospective_action SET completed = true, completed_date = COALESCE(completed_date, NOW()), updated_date = NOW()
+		WHERE tracker_id = $1 AND external_key = $2 AND completed = false
+		RETURNING retrospective_id;`,
+		TrackerID,
+		ExternalKey,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "TrackerCompleteAction", "tracker_id", TrackerID, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var RetrospectiveID string
+		if err := rows.Scan(&RetrospectiveID); err != nil {
+			logging.FromContext(ctx).Error("database query failed", "method", "TrackerCompleteAction", "tracker_id", TrackerID, "error", err)
+			return nil, err
+		}
+		RetrospectiveIDs = append(RetrospectiveIDs, RetrospectiveID)
+	}
+
+	return RetrospectiveIDs, rows.Err()
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTeamTrackerUpdateToken(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		admin, _, _ := d.CreateUserRegistered(ctx, "Admin", testEmail("admin"), "password1", "")
+		teamID, err := d.TeamCreate(ctx, admin.UserID, "Avengers")
+		if err != nil {
+			t.Fatalf("TeamCreate() = %v", err)
+		}
+		trackerID, err := d.TeamTrackerCreate(ctx, teamID, TrackerProviderGitHub, "", "asgard/bifrost", "", "first-token")
+		if err != nil {
+			t.Fatalf("TeamTrackerCreate() = %v", err)
+		}
+
+		token := func() string {
+			tracker, err := d.TeamTrackerGet(ctx, trackerID)
+			if err != nil {
+				t.Fatalf("TeamTrackerGet() = %v", err)
+			}
+			return tracker.Token
+		}
+
+		if err := d.TeamTrackerUpdate(ctx, teamID, trackerID, TrackerProviderGitHub, "", "asgard/rainbow", "", "", true); err != nil {
+			t.Fatalf("TeamTrackerUpdate() of the project = %v", err)
+		}
+		if got := token(); got != "first-token" {
+			t.Errorf("TeamTrackerUpdate() without a token changed it to %q", got)
+		}
+
+		if err := d.TeamTrackerUpdate(ctx, teamID, trackerID, TrackerProviderGitHub, "https://github.example.com/api/v3", "asgard/rainbow", "", "", true); err == nil {
+			t.Errorf("TeamTrackerUpdate() of the base url without a token succeeded")
+		}
+		if err := d.TeamTrackerUpdate(ctx, teamID, trackerID, TrackerProviderGitLab, "", "asgard/rainbow", "", "", true); err == nil {
+			t.Errorf("TeamTrackerUpdate() of the provider without a token succeeded")
+		}
+
+		if err := d.TeamTrackerUpdate(ctx, teamID, trackerID, TrackerProviderGitLab, "", "asgard/rainbow", "", "second-token", true); err != nil {
+			t.Fatalf("TeamTrackerUpdate() of the provider with a token = %v", err)
+		}
+		if got := token(); got != "second-token" {
+			t.Errorf("TeamTrackerUpdate() token = %q, want second-token", got)
+		}
+	})
+}
+
+func TestRetrospectiveActionClaimTicket(t *testing.T) {
+	testDatabases(t, func(t *testing.T, d *Database) {
+		ctx := context.Background()
+
+		admin, _, _ := d.CreateUserRegistered(ctx, "Admin", testEmail("admin"), "password1", "")
+		teamID, _ := d.TeamCreate(ctx, admin.UserID, "Avengers")
+		trackerID, err := d.TeamTrackerCreate(ctx, teamID, TrackerProviderGitHub, "", "asgard/bifrost", "", "token")
+		if err != nil {
+			t.Fatalf("TeamTrackerCreate() = %v", err)
+		}
+		retro, err := d.TeamCreateRetrospective(ctx, teamID, admin.UserID, "Sprint")
+		if err != nil {
+			t.Fatalf("TeamCreateRetrospective() = %v", err)
+		}
+		actions, err := d.CreateRetrospectiveAction(ctx, retro.RetrospectiveID, admin.UserID, "Fix the bifrost")
+		if err != nil || len(actions) != 1 {
+			t.Fatalf("CreateRetrospectiveAction() = %v, %v", actions, err)
+		}
+		actionID := actions[0].ID
+
+		claim := func() bool {
+			claimed, err := d.RetrospectiveActionClaimTicket(ctx, retro.RetrospectiveID, admin.UserID, actionID, trackerID)
+			if err != nil {
+				t.Fatalf("RetrospectiveActionClaimTicket() = %v", err)
+			}
+			return claimed
+		}
+
+		if !claim() {
+			t.Fatalf("RetrospectiveActionClaimTicket() of an action without a ticket = false")
+		}
+		if claim() {
+			t.Errorf("RetrospectiveActionClaimTicket() of a reserved action = true")
+		}
+
+		if err := d.RetrospectiveActionReleaseTicket(ctx, retro.RetrospectiveID, actionID); err != nil {
+			t.Fatalf("RetrospectiveActionReleaseTicket() = %v", err)
+		}
+		if !claim() {
+			t.Fatalf("RetrospectiveActionClaimTicket() of a released action = false")
+		}
+
+		// a reservation left behind by a replica that stopped while creating the ticket
+		if _, err := d.db.ExecContext(ctx,
+			`UPDATE retrospective_action SET ticket_claimed_date = NOW() - $2 * interval '1 second' WHERE id = $1;`,
+			actionID, int(ticketClaimTimeout.Seconds())+60,
+		); err != nil {
+			t.Fatal(err)
+		}
+		if !claim() {
+			t.Fatalf("RetrospectiveActionClaimTicket() of an expired reservation = false")
+		}
+
+		if _, err := d.SetRetrospectiveActionTicket(ctx, retro.RetrospectiveID, actionID, "1", "https://github.com/asgard/bifrost/issues/1"); err != nil {
+			t.Fatalf("SetRetrospectiveActionTicket() = %v", err)
+		}
+		if claim() {
+			t.Errorf("RetrospectiveActionClaimTicket() of an action with a ticket = true")
+		}
+	})
+}
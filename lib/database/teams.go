@@ -1,15 +1,21 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"log"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 )
 
 // TeamUserRole gets a users role in team
-func (d *Database) TeamUserRole(UserID string, TeamID string) (string, error) {
+func (d *Database) TeamUserRole(ctx context.Context, UserID string, TeamID string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var teamRole string
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT role FROM team_get_user_role($1, $2)`,
 		UserID,
 		TeamID,
@@ -17,7 +23,7 @@ func (d *Database) TeamUserRole(UserID string, TeamID string) (string, error) {
 		&teamRole,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamUserRole", "user_id", UserID, "team_id", TeamID, "error", e)
 		return "", errors.New("error getting team users role")
 	}
 
@@ -25,7 +31,10 @@ func (d *Database) TeamUserRole(UserID string, TeamID string) (string, error) {
 }
 
 // TeamGet gets an team
-func (d *Database) TeamGet(TeamID string) (*Team, error) {
+func (d *Database) TeamGet(ctx context.Context, TeamID string) (*Team, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var team = &Team{
 		TeamID:      "",
 		Name:        "",
@@ -33,7 +42,7 @@ func (d *Database) TeamGet(TeamID string) (*Team, error) {
 		UpdatedDate: "",
 	}
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM team_get_by_id($1)`,
 		TeamID,
 	).Scan(
@@ -43,7 +52,7 @@ func (d *Database) TeamGet(TeamID string) (*Team, error) {
 		&team.UpdatedDate,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamGet", "team_id", TeamID, "error", e)
 		return nil, errors.New("team not found")
 	}
 
@@ -51,9 +60,12 @@ func (d *Database) TeamGet(TeamID string) (*Team, error) {
 }
 
 // TeamListByUser gets a list of teams the user is on
-func (d *Database) TeamListByUser(UserID string, Limit int, Offset int) []*Team {
+func (d *Database) TeamListByUser(ctx context.Context, UserID string, Limit int, Offset int) []*Team {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var teams = make([]*Team, 0)
-	rows, err := d.db.Query(
+	rows, err := d.db.QueryContext(ctx,
 		`SELECT id, name, created_date, updated_date FROM team_list_by_user($1, $2, $3);`,
 		UserID,
 		Limit,
@@ -71,29 +83,32 @@ func (d *Database) TeamListByUser(UserID string, Limit int, Offset int) []*Team
 				&team.CreatedDate,
 				&team.UpdatedDate,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamListByUser", "user_id", UserID, "error", err)
 			} else {
 				teams = append(teams, &team)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamListByUser", "user_id", UserID, "error", err)
 	}
 
 	return teams
 }
 
 // TTeamCreate creates a team with current user as an ADMIN
-func (d *Database) TeamCreate(UserID string, TeamName string) (string, error) {
+func (d *Database) TeamCreate(ctx context.Context, UserID string, TeamName string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var TeamID string
-	err := d.db.QueryRow(`
+	err := d.db.QueryRowContext(ctx, `
 		SELECT teamId FROM team_create($1, $2);`,
 		UserID,
 		TeamName,
 	).Scan(&TeamID)
 
 	if err != nil {
-		log.Println("Unable to create team: ", err)
+		logging.FromContext(ctx).Error("Unable to create team", "user_id", UserID, "error", err)
 		return "", err
 	}
 
@@ -101,8 +116,11 @@ func (d *Database) TeamCreate(UserID string, TeamName string) (string, error) {
 }
 
 // TeamAddUser adds a user to a team
-func (d *Database) TeamAddUser(TeamID string, UserID string, Role string) (string, error) {
-	_, err := d.db.Exec(
+func (d *Database) TeamAddUser(ctx context.Context, TeamID string, UserID string, Role string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`SELECT team_user_add($1, $2, $3);`,
 		TeamID,
 		UserID,
@@ -110,17 +128,32 @@ func (d *Database) TeamAddUser(TeamID string, UserID string, Role string) (strin
 	)
 
 	if err != nil {
-		log.Println("Unable to add user to team: ", err)
+		logging.FromContext(ctx).Error("Unable to add user to team", "team_id", TeamID, "user_id", UserID, "error", err)
 		return "", err
 	}
 
+	// let the user know in their next digest
+	if _, err := d.db.ExecContext(ctx,
+		`INSERT INTO user_notification (user_id, type, title, link)
+		SELECT u.id, $3, t.name, 'team/' || t.id FROM users u, team t
+		WHERE u.id = $2 AND t.id = $1 AND u.notify_invites = true;`,
+		TeamID,
+		UserID,
+		NotificationInvite,
+	); err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamAddUser", "team_id", TeamID, "user_id", UserID, "error", err)
+	}
+
 	return TeamID, nil
 }
 
 // TeamUserList gets a list of team users
-func (d *Database) TeamUserList(TeamID string, Limit int, Offset int) []*OrganizationUser {
+func (d *Database) TeamUserList(ctx context.Context, TeamID string, Limit int, Offset int) []*OrganizationUser {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var users = make([]*OrganizationUser, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name, email, role FROM team_user_list($1, $2, $3);`,
 		TeamID,
 		Limit,
@@ -138,28 +171,31 @@ func (d *Database) TeamUserList(TeamID string, Limit int, Offset int) []*Organiz
 				&usr.Email,
 				&usr.Role,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamUserList", "team_id", TeamID, "error", err)
 			} else {
 				users = append(users, &usr)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamUserList", "team_id", TeamID, "error", err)
 	}
 
 	return users
 }
 
 // TeamRemoveUser removes a user from a team
-func (d *Database) TeamRemoveUser(TeamID string, UserID string) error {
-	_, err := d.db.Exec(
+func (d *Database) TeamRemoveUser(ctx context.Context, TeamID string, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`CALL team_user_remove($1, $2);`,
 		TeamID,
 		UserID,
 	)
 
 	if err != nil {
-		log.Println("Unable to remove user from team: ", err)
+		logging.FromContext(ctx).Error("Unable to remove user from team", "team_id", TeamID, "user_id", UserID, "error", err)
 		return err
 	}
 
@@ -167,9 +203,12 @@ func (d *Database) TeamRemoveUser(TeamID string, UserID string) error {
 }
 
 // TeamRetrospectiveList gets a list of team retrospectives
-func (d *Database) TeamRetrospectiveList(TeamID string, Limit int, Offset int) []*Retrospective {
+func (d *Database) TeamRetrospectiveList(ctx context.Context, TeamID string, Limit int, Offset int) []*Retrospective {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var retrospectives = make([]*Retrospective, 0)
-	rows, err := d.db.Query(
+	rows, err := d.read.QueryContext(ctx,
 		`SELECT id, name FROM team_retrospective_list($1, $2, $3);`,
 		TeamID,
 		Limit,
@@ -185,28 +224,71 @@ func (d *Database) TeamRetrospectiveList(TeamID string, Limit int, Offset int) [
 				&tb.RetrospectiveID,
 				&tb.RetrospectiveName,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "TeamRetrospectiveList", "team_id", TeamID, "error", err)
 			} else {
 				retrospectives = append(retrospectives, &tb)
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamRetrospectiveList", "team_id", TeamID, "error", err)
 	}
 
 	return retrospectives
 }
 
 // TeamAddRetrospective adds a retrospective to a team
-func (d *Database) TeamAddRetrospective(TeamID string, RetrospectiveID string) error {
-	_, err := d.db.Exec(
+func (d *Database) TeamAddRetrospective(ctx context.Context, TeamID string, RetrospectiveID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`SELECT team_retrospective_add($1, $2);`,
 		TeamID,
 		RetrospectiveID,
 	)
 
 	if err != nil {
-		log.Println("Unable to add retrospective to team: ", err)
+		logging.FromContext(ctx).Error("Unable to add retrospective to team", "team_id", TeamID, "retrospective_id", RetrospectiveID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TeamCreateRetrospective creates a retrospective and adds it to the team in a single transaction
+func (d *Database) TeamCreateRetrospective(ctx context.Context, TeamID string, OwnerID string, RetrospectiveName string) (*Retrospective, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var b = newRetrospective(OwnerID, RetrospectiveName)
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		return teamCreateRetrospective(ctx, tx, TeamID, b)
+	})
+	if err != nil {
+		return nil, errors.New("Error Creating Retrospective")
+	}
+
+	return b, nil
+}
+
+// teamCreateRetrospective creates the new retrospective b and adds it to the team within the transaction
+func teamCreateRetrospective(ctx context.Context, tx *sql.Tx, TeamID string, b *Retrospective) error {
+	if err := tx.QueryRowContext(ctx,
+		`SELECT * FROM create_retrospective($1, $2);`,
+		b.OwnerID,
+		b.RetrospectiveName,
+	).Scan(&b.RetrospectiveID); err != nil {
+		logging.FromContext(ctx).Error("Unable to create team retrospective", "team_id", TeamID, "error", err)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`SELECT team_retrospective_add($1, $2);`,
+		TeamID,
+		b.RetrospectiveID,
+	); err != nil {
+		logging.FromContext(ctx).Error("Unable to add retrospective to team", "team_id", TeamID, "retrospective_id", b.RetrospectiveID, "error", err)
 		return err
 	}
 
@@ -214,15 +296,18 @@ func (d *Database) TeamAddRetrospective(TeamID string, RetrospectiveID string) e
 }
 
 // TeamRemoveRetrospective removes a retrospective from a team
-func (d *Database) TeamRemoveRetrospective(TeamID string, RetrospectiveID string) error {
-	_, err := d.db.Exec(
+func (d *Database) TeamRemoveRetrospective(ctx context.Context, TeamID string, RetrospectiveID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`SELECT team_retrospective_remove($1, $2);`,
 		TeamID,
 		RetrospectiveID,
 	)
 
 	if err != nil {
-		log.Println("Unable to remove retrospective from team: ", err)
+		logging.FromContext(ctx).Error("Unable to remove retrospective from team", "team_id", TeamID, "retrospective_id", RetrospectiveID, "error", err)
 		return err
 	}
 
@@ -230,16 +315,40 @@ func (d *Database) TeamRemoveRetrospective(TeamID string, RetrospectiveID string
 }
 
 // TeamDelete deletes a team
-func (d *Database) TeamDelete(TeamID string) error {
-	_, err := d.db.Exec(
+func (d *Database) TeamDelete(ctx context.Context, TeamID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
 		`CALL team_delete($1);`,
 		TeamID,
 	)
 
 	if err != nil {
-		log.Println("Unable to delete team: ", err)
+		logging.FromContext(ctx).Error("Unable to delete team", "team_id", TeamID, "error", err)
 		return err
 	}
 
 	return nil
 }
+
+// TeamUpdate renames a team
+func (d *Database) TeamUpdate(ctx context.Context, TeamID string, TeamName string) (*Team, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE team SET name = $2, updated_date = NOW() WHERE id = $1;`,
+		TeamID,
+		TeamName,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "TeamUpdate", "team_id", TeamID, "error", err)
+		return nil, errors.New("error updating team")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return nil, errors.New("team not found")
+	}
+
+	return d.TeamGet(ctx, TeamID)
+}
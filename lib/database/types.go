@@ -7,18 +7,34 @@ import (
 
 // Config holds all the configuration for the db
 type Config struct {
-	host     string
-	port     int
-	user     string
-	password string
-	dbname   string
-	sslmode  string
+	// database/sql driver, postgres or sqlite
+	driver string
+	// full connection string, used instead of the individual settings when set
+	url string
+	// optional connection string of a read replica for list, stats and analytics queries
+	replicaURL string
+	host       string
+	port       int
+	user       string
+	password   string
+	dbname     string
+	sslmode    string
+	// the longest a database method may take before its queries are canceled
+	queryTimeout time.Duration
+	// connection pool limits
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	// how many times the startup ping is retried before giving up
+	connectRetries int
 }
 
 // Database contains all the methods to interact with DB
 type Database struct {
 	config *Config
 	db     *sql.DB
+	// read serves read only queries that tolerate replication lag, the primary when no replica is configured
+	read *sql.DB
 }
 
 // Color is a color legend
@@ -32,30 +48,94 @@ type RetrospectiveUser struct {
 	UserID   string `json:"id"`
 	UserName string `json:"name"`
 	Active   bool   `json:"active"`
+	Role     string `json:"role"`
 }
 
 // Retrospective A story mapping board
 type Retrospective struct {
-	RetrospectiveID   string                 `json:"id" db:"id"`
-	OwnerID           string                 `json:"ownerId" db:"ownder_id"`
-	RetrospectiveName string                 `json:"name" db:"name"`
-	Users             []*RetrospectiveUser   `json:"users"`
-	WorkedItems       []*RetrospectiveItem   `json:"workedItems"`
-	ImproveItems      []*RetrospectiveItem   `json:"improveItems"`
-	QuestionItems     []*RetrospectiveItem   `json:"questionItems"`
-	ActionItems       []*RetrospectiveAction `json:"actionItems"`
-	Phase             int                    `json:"phase" db:"phase"`
+	RetrospectiveID   string                   `json:"id" db:"id"`
+	OwnerID           string                   `json:"ownerId" db:"ownder_id"`
+	RetrospectiveName string                   `json:"name" db:"name"`
+	Users             []*RetrospectiveUser     `json:"users"`
+	WorkedItems       []*RetrospectiveItem     `json:"workedItems"`
+	ImproveItems      []*RetrospectiveItem     `json:"improveItems"`
+	QuestionItems     []*RetrospectiveItem     `json:"questionItems"`
+	ActionItems       []*RetrospectiveAction   `json:"actionItems"`
+	Phase             int                      `json:"phase" db:"phase"`
+	Anonymous         bool                     `json:"anonymous" db:"anonymous"`
+	Groups            []*RetrospectiveGroup    `json:"groups"`
+	Discussion        *RetrospectiveDiscussion `json:"discussion"`
 }
 
 // RetrospectiveItem can be a pro (went well/worked), con (needs improvement), or a question
 type RetrospectiveItem struct {
-	ID              string   `json:"id" db:"id"`
-	RetrospectiveID string   `json:"retrospectiveId" db:"retrospective_id"`
-	UserID          string   `json:"userId" db:"user_id"`
-	ParentID        string   `json:"parentId" db:"parent_id"`
-	Content         string   `json:"content" db:"content"`
-	Type            string   `json:"type" db:"type"`
-	Votes           []string `json:"votes" db:"votes"`
+	ID              string                       `json:"id" db:"id"`
+	RetrospectiveID string                       `json:"retrospectiveId" db:"retrospective_id"`
+	UserID          string                       `json:"userId" db:"user_id"`
+	ParentID        string                       `json:"parentId" db:"parent_id"`
+	GroupID         string                       `json:"groupId" db:"group_id"`
+	Content         string                       `json:"content" db:"content"`
+	Type            string                       `json:"type" db:"type"`
+	Votes           []string                     `json:"votes" db:"votes"`
+	Discussed       bool                         `json:"discussed" db:"discussed"`
+	Comments        []*RetrospectiveItemComment  `json:"comments"`
+	Reactions       []*RetrospectiveItemReaction `json:"reactions"`
+}
+
+// RetrospectiveGroup is a titled group of top level retrospective items (from any column),
+// VoteCount totals the votes of the grouped items and the items nested under them
+type RetrospectiveGroup struct {
+	GroupID   string   `json:"id" db:"id"`
+	Title     string   `json:"title" db:"title"`
+	ItemIDs   []string `json:"itemIds"`
+	VoteCount int      `json:"voteCount"`
+}
+
+// RetrospectiveBoard is the retrospectives items and groups, broadcast after bulk grouping changes
+type RetrospectiveBoard struct {
+	WorkedItems   []*RetrospectiveItem  `json:"workedItems"`
+	ImproveItems  []*RetrospectiveItem  `json:"improveItems"`
+	QuestionItems []*RetrospectiveItem  `json:"questionItems"`
+	Groups        []*RetrospectiveGroup `json:"groups"`
+}
+
+// RetrospectiveDiscussion is the phase 3 discussion queue and currently focused item
+type RetrospectiveDiscussion struct {
+	FocusedItemID string                         `json:"focusedItemId"`
+	Queue         []*RetrospectiveDiscussionItem `json:"queue"`
+}
+
+// RetrospectiveDiscussionItem is a top level item (and its nested items) in the discussion queue,
+// a titled group is a single entry for its first item with the groups vote total
+type RetrospectiveDiscussionItem struct {
+	ItemID     string `json:"id"`
+	Type       string `json:"type"`
+	Content    string `json:"content"`
+	GroupID    string `json:"groupId"`
+	Title      string `json:"title"`
+	VoteCount  int    `json:"voteCount"`
+	ChildCount int    `json:"childCount"`
+	Discussed  bool   `json:"discussed"`
+}
+
+// RetrospectiveItemComment is a (threaded) comment on a retrospective item,
+// author is omitted when the retrospective is anonymous
+type RetrospectiveItemComment struct {
+	ID          string `json:"id" db:"id"`
+	ItemID      string `json:"itemId" db:"item_id"`
+	UserID      string `json:"userId" db:"user_id"`
+	UserName    string `json:"userName"`
+	ParentID    string `json:"parentId" db:"parent_id"`
+	Content     string `json:"content" db:"content"`
+	CreatedDate string `json:"createdDate" db:"created_date"`
+}
+
+// RetrospectiveItemReaction is an emoji reaction on a retrospective item,
+// users are omitted when the retrospective is anonymous
+type RetrospectiveItemReaction struct {
+	Emoji string   `json:"emoji" db:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
 }
 
 // RetrospectiveAction is an action the team can take based on retro feedback
@@ -64,6 +144,29 @@ type RetrospectiveAction struct {
 	RetrospectiveID string `json:"retrospectiveId" db:"retrospective_id"`
 	Content         string `json:"content" db:"content"`
 	Completed       bool   `json:"completed" db:"completed"`
+	AssigneeID      string `json:"assigneeId" db:"assignee_id"`
+	AssigneeName    string `json:"assigneeName"`
+	DueDate         string `json:"dueDate" db:"due_date"`
+	TrackerID       string `json:"trackerId" db:"tracker_id"`
+	ExternalKey     string `json:"externalKey" db:"external_key"`
+	ExternalURL     string `json:"externalUrl" db:"external_url"`
+}
+
+// RetrospectiveActionUpdate is a change to an action, fields left nil are unchanged,
+// an empty AssigneeID unassigns the action and an empty DueDate (formatted 2006-01-02) clears it
+type RetrospectiveActionUpdate struct {
+	Content    *string `json:"content"`
+	Completed  *bool   `json:"completed"`
+	AssigneeID *string `json:"assigneeId"`
+	DueDate    *string `json:"dueDate"`
+}
+
+// RetrospectiveEdit is a previous version of a retrospective item or actions content
+type RetrospectiveEdit struct {
+	ID          string `json:"id" db:"id"`
+	UserID      string `json:"userId" db:"user_id"`
+	Content     string `json:"content" db:"content"`
+	UpdatedDate string `json:"updatedDate" db:"updated_date"`
 }
 
 // User aka user
@@ -78,6 +181,41 @@ type User struct {
 	Locale     string `json:"locale"`
 	Company    string `json:"company"`
 	JobTitle   string `json:"jobTitle"`
+	// only included in the admin user listing, suspended users can't log in or use their sessions
+	Suspended bool `json:"suspended"`
+	// only included in the users own profile
+	Notifications *NotificationPreferences `json:"notifications,omitempty"`
+	// secret of the one-click unsubscribe links in notification emails
+	UnsubscribeToken string `json:"-"`
+}
+
+// NotificationPreferences are the notification emails a user has opted in to, invites and action item
+// notifications are batched into a DAILY or WEEKLY digest, the team digest is always weekly
+type NotificationPreferences struct {
+	Invites         bool   `json:"invites"`
+	RetroSummary    bool   `json:"retroSummary"`
+	ActionAssigned  bool   `json:"actionAssigned"`
+	ActionDue       bool   `json:"actionDue"`
+	TeamDigest      bool   `json:"teamDigest"`
+	DigestFrequency string `json:"digestFrequency"`
+}
+
+// UserNotification is a notification waiting to be sent in the users next digest
+type UserNotification struct {
+	NotificationID string `json:"id"`
+	Type           string `json:"type"`
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Link           string `json:"link"`
+	CreatedDate    string `json:"createdDate"`
+}
+
+// TeamDigest is a teams activity for the weekly team digest
+type TeamDigest struct {
+	TeamID         string                 `json:"id"`
+	TeamName       string                 `json:"name"`
+	Retrospectives []*Retrospective       `json:"retrospectives"`
+	OpenActions    []*RetrospectiveAction `json:"openActions"`
 }
 
 // APIKey structure
@@ -158,4 +296,186 @@ type Alert struct {
 	RegisteredOnly bool   `json:"registeredOnly" db:"registered_only"`
 	CreatedDate    string `json:"createdDate" db:"created_date"`
 	UpdatedDate    string `json:"updatedDate" db:"updated_date"`
+	// the alert is only shown from StartDate until EndDate when set
+	StartDate *time.Time `json:"startDate" db:"start_date"`
+	EndDate   *time.Time `json:"endDate" db:"end_date"`
+	// the alert is only shown to members of OrganizationID, users with Locale and users of UserType when set
+	OrganizationID string `json:"organizationId" db:"organization_id"`
+	Locale         string `json:"locale" db:"locale"`
+	UserType       string `json:"userType" db:"user_type"`
+}
+
+// AlertAudience is who an alert could be shown to, the user type, locale and organizations of a user
+type AlertAudience struct {
+	UserType        string
+	Locale          string
+	OrganizationIDs []string
+}
+
+// TeamRetrospectiveSchedule is a recurring (every N weeks) team retrospective
+type TeamRetrospectiveSchedule struct {
+	ScheduleID    string `json:"id"`
+	TeamID        string `json:"teamId"`
+	OwnerID       string `json:"ownerId"`
+	Name          string `json:"name"`
+	IntervalWeeks int    `json:"intervalWeeks"`
+	NextRunDate   string `json:"nextRunDate"`
+	Active        bool   `json:"active"`
+	CreatedDate   string `json:"createdDate"`
+	UpdatedDate   string `json:"updatedDate"`
+}
+
+// TeamIntegration is a teams chat incoming webhook retrospective events are posted to
+type TeamIntegration struct {
+	IntegrationID string `json:"id"`
+	TeamID        string `json:"teamId"`
+	TeamName      string `json:"-"`
+	WebhookURL    string `json:"webhookUrl"`
+	Format        string `json:"format"`
+	Active        bool   `json:"active"`
+	CreatedDate   string `json:"createdDate"`
+	UpdatedDate   string `json:"updatedDate"`
+}
+
+// TeamTracker is a teams issue tracker project action items can be turned into tickets in
+type TeamTracker struct {
+	TrackerID     string `json:"id"`
+	TeamID        string `json:"teamId"`
+	Provider      string `json:"provider"`
+	BaseURL       string `json:"baseUrl"`
+	Project       string `json:"project"`
+	Username      string `json:"username"`
+	Token         string `json:"-"`
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+	Active        bool   `json:"active"`
+	CreatedDate   string `json:"createdDate"`
+	UpdatedDate   string `json:"updatedDate"`
+}
+
+// UserImpersonation is an admins time limited, read only "view as user" session, kept as an audit log
+type UserImpersonation struct {
+	ImpersonationID string     `json:"id"`
+	AdminID         string     `json:"adminId"`
+	AdminName       string     `json:"adminName"`
+	UserID          string     `json:"userId"`
+	UserName        string     `json:"userName"`
+	Reason          string     `json:"reason"`
+	CreatedDate     time.Time  `json:"createdDate"`
+	ExpireDate      time.Time  `json:"expireDate"`
+	EndedDate       *time.Time `json:"endedDate"`
+}
+
+// AdminRetrospective is a retrospective in the admin listing, with its participant counts and last activity
+type AdminRetrospective struct {
+	RetrospectiveID   string     `json:"id"`
+	RetrospectiveName string     `json:"name"`
+	OwnerID           string     `json:"ownerId"`
+	OwnerName         string     `json:"ownerName"`
+	Phase             int        `json:"phase"`
+	ParticipantCount  int        `json:"participantCount"`
+	ActiveCount       int        `json:"activeCount"`
+	CreatedDate       time.Time  `json:"createdDate"`
+	LastActivity      time.Time  `json:"lastActivity"`
+	ClosedDate        *time.Time `json:"closedDate"`
+}
+
+// CalendarFeed is the upcoming scheduled retrospectives and open action item due dates of a users or teams calendar feed
+type CalendarFeed struct {
+	Name      string
+	Schedules []*CalendarSchedule
+	Actions   []*CalendarAction
+}
+
+// CalendarSchedule is a teams recurring retrospective schedule in a calendar feed, LastRetrospectiveID is the
+// retrospective created by its previous run when it still exists
+type CalendarSchedule struct {
+	ScheduleID          string
+	TeamID              string
+	TeamName            string
+	Name                string
+	IntervalWeeks       int
+	NextRunDate         time.Time
+	CreatedDate         time.Time
+	UpdatedDate         time.Time
+	LastRetrospectiveID string
+}
+
+// CalendarAction is an open action item with a due date in a calendar feed
+type CalendarAction struct {
+	ActionID          string
+	RetrospectiveID   string
+	RetrospectiveName string
+	Content           string
+	AssigneeName      string
+	DueDate           time.Time
+	UpdatedDate       time.Time
+}
+
+// EmailOutboxMessage is an email queued for delivery by the outbox worker
+type EmailOutboxMessage struct {
+	MessageID       string `json:"id"`
+	ToName          string `json:"toName"`
+	ToEmail         string `json:"toEmail"`
+	Subject         string `json:"subject"`
+	Body            string `json:"-"`
+	TextBody        string `json:"-"`
+	UnsubscribeURL  string `json:"-"`
+	Status          string `json:"status"`
+	Attempts        int    `json:"attempts"`
+	LastError       string `json:"lastError"`
+	NextAttemptDate string `json:"nextAttemptDate"`
+	SentDate        string `json:"sentDate"`
+	CreatedDate     string `json:"createdDate"`
+}
+
+// RetrospectiveAnalytics is a trend report aggregated across a set of retrospectives
+type RetrospectiveAnalytics struct {
+	RetrospectiveCount   int                           `json:"retrospectiveCount"`
+	Retrospectives       []*RetrospectiveTrend         `json:"retrospectives"`
+	ActionCount          int                           `json:"actionCount"`
+	ActionsCompleted     int                           `json:"actionsCompleted"`
+	ActionCompletionRate float64                       `json:"actionCompletionRate"`
+	MeanHoursToClose     float64                       `json:"meanHoursToClose"`
+	Themes               []*RetrospectiveTheme         `json:"themes"`
+	TopItems             []*RetrospectiveAnalyticsItem `json:"topItems"`
+}
+
+// RetrospectiveTrend is a single retrospectives data point in an analytics report
+type RetrospectiveTrend struct {
+	RetrospectiveID  string `json:"id"`
+	Name             string `json:"name"`
+	CreatedDate      string `json:"createdDate"`
+	ParticipantCount int    `json:"participantCount"`
+	ContributorCount int    `json:"contributorCount"`
+	WorkedCount      int    `json:"workedCount"`
+	ImproveCount     int    `json:"improveCount"`
+	QuestionCount    int    `json:"questionCount"`
+	ActionCount      int    `json:"actionCount"`
+	ActionsCompleted int    `json:"actionsCompleted"`
+}
+
+// RetrospectiveTheme is a keyword that recurs across multiple retrospectives
+type RetrospectiveTheme struct {
+	Keyword            string `json:"keyword"`
+	RetrospectiveCount int    `json:"retrospectiveCount"`
+	ItemCount          int    `json:"itemCount"`
+}
+
+// RetrospectiveAnalyticsItem is a top voted item in an analytics report
+type RetrospectiveAnalyticsItem struct {
+	ItemID            string `json:"id"`
+	RetrospectiveID   string `json:"retrospectiveId"`
+	RetrospectiveName string `json:"retrospectiveName"`
+	Type              string `json:"type"`
+	Content           string `json:"content"`
+	VoteCount         int    `json:"voteCount"`
+}
+
+// RetrospectiveItemCluster is a suggested group of similar retrospective items,
+// ItemIDs are ordered most voted first and Title is a suggested group title
+type RetrospectiveItemCluster struct {
+	Title      string   `json:"title"`
+	ItemIDs    []string `json:"itemIds"`
+	Keywords   []string `json:"keywords"`
+	Similarity float64  `json:"similarity"`
 }
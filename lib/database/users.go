@@ -1,10 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"log"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,7 +19,7 @@ func HashAndSalt(pwd []byte) (string, error) {
 	// than the MinCost (4)
 	hash, err := bcrypt.GenerateFromPassword(pwd, bcrypt.MinCost)
 	if err != nil {
-		log.Println(err)
+		logging.Error("database query failed", "method", "HashAndSalt", "error", err)
 		return "", err
 	}
 	// GenerateFromPassword returns a byte slice so we need to
@@ -34,7 +35,7 @@ func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
 	byteHash := []byte(hashedPwd)
 	err := bcrypt.CompareHashAndPassword(byteHash, plainPwd)
 	if err != nil {
-		log.Println(err)
+		logging.Error("database query failed", "method", "ComparePasswords", "error", err)
 		return false
 	}
 
@@ -42,57 +43,15 @@ func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
 }
 
 // GetRegisteredUsers retrieves the registered users from db
-func (d *Database) GetRegisteredUsers(Limit int, Offset int) []*User {
-	var users = make([]*User, 0)
-	rows, err := d.db.Query(
-		`SELECT id, name, email, type, avatar, verified, country, locale, company, job_title
-		FROM users
-		WHERE email IS NOT NULL
-		ORDER BY created_date
-		LIMIT $1
-		OFFSET $2
-		`,
-		Limit,
-		Offset,
-	)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var w User
-			var userEmail sql.NullString
-			var UserCountry sql.NullString
-			var UserLocale sql.NullString
-			var UserCompany sql.NullString
-			var UserJobTitle sql.NullString
-
-			if err := rows.Scan(&w.UserID,
-				&w.UserName,
-				&userEmail,
-				&w.UserType,
-				&w.UserAvatar,
-				&w.Verified,
-				&UserCountry,
-				&UserLocale,
-				&UserCompany,
-				&UserJobTitle,
-			); err != nil {
-				log.Println(err)
-			} else {
-				w.UserEmail = userEmail.String
-				w.Country = UserCountry.String
-				w.Locale = UserLocale.String
-				w.Company = UserCompany.String
-				w.JobTitle = UserJobTitle.String
-				users = append(users, &w)
-			}
-		}
-	}
-
-	return users
+func (d *Database) GetRegisteredUsers(ctx context.Context, Limit int, Offset int) []*User {
+	return d.SearchUsers(ctx, "", "", Limit, Offset)
 }
 
 // GetUser gets a user from db by ID
-func (d *Database) GetUser(UserID string) (*User, error) {
+func (d *Database) GetUser(ctx context.Context, UserID string) (*User, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var w User
 	var UserEmail sql.NullString
 	var UserCountry sql.NullString
@@ -100,7 +59,7 @@ func (d *Database) GetUser(UserID string) (*User, error) {
 	var UserCompany sql.NullString
 	var UserJobTitle sql.NullString
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT * FROM get_user($1);`,
 		UserID,
 	).Scan(
@@ -116,7 +75,7 @@ func (d *Database) GetUser(UserID string) (*User, error) {
 		&UserJobTitle,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "GetUser", "user_id", UserID, "error", e)
 		return nil, errors.New("User Not found")
 	}
 
@@ -130,9 +89,12 @@ func (d *Database) GetUser(UserID string) (*User, error) {
 }
 
 // GetUserByEmail gets a user by email
-func (d *Database) GetUserByEmail(UserEmail string) (*User, error) {
+func (d *Database) GetUserByEmail(ctx context.Context, UserEmail string) (*User, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var u User
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		"SELECT id, name, email, type, verified FROM users WHERE email = $1",
 		UserEmail,
 	).Scan(
@@ -143,20 +105,41 @@ func (d *Database) GetUserByEmail(UserEmail string) (*User, error) {
 		&u.Verified,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "GetUserByEmail", "error", e)
 		return nil, errors.New("user email not found")
 	}
 
 	return &u, nil
 }
 
+// GetUserLocaleByEmail gets the locale of the user with the email, empty when the user hasn't chosen one
+func (d *Database) GetUserLocaleByEmail(ctx context.Context, UserEmail string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var UserLocale sql.NullString
+	e := d.db.QueryRowContext(ctx,
+		"SELECT locale FROM users WHERE email = $1",
+		UserEmail,
+	).Scan(&UserLocale)
+	if e != nil && e != sql.ErrNoRows {
+		logging.FromContext(ctx).Error("database query failed", "method", "GetUserLocaleByEmail", "error", e)
+		return "", e
+	}
+
+	return UserLocale.String, nil
+}
+
 // AuthUser attempts to authenticate the user
-func (d *Database) AuthUser(UserEmail string, UserPassword string) (*User, error) {
+func (d *Database) AuthUser(ctx context.Context, UserEmail string, UserPassword string) (*User, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var w User
 	var passHash string
 	var UserLocale sql.NullString
 
-	e := d.db.QueryRow(
+	e := d.db.QueryRowContext(ctx,
 		`SELECT * FROM get_user_auth_by_email($1)`,
 		UserEmail,
 	).Scan(
@@ -168,7 +151,7 @@ func (d *Database) AuthUser(UserEmail string, UserPassword string) (*User, error
 		&UserLocale,
 	)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "AuthUser", "error", e)
 		return nil, errors.New("User Not found")
 	}
 
@@ -182,11 +165,14 @@ func (d *Database) AuthUser(UserEmail string, UserPassword string) (*User, error
 }
 
 // CreateUserGuest adds a new user guest to the db
-func (d *Database) CreateUserGuest(UserName string) (*User, error) {
+func (d *Database) CreateUserGuest(ctx context.Context, UserName string) (*User, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var UserID string
-	e := d.db.QueryRow(`INSERT INTO users (name) VALUES ($1) RETURNING id`, UserName).Scan(&UserID)
+	e := d.db.QueryRowContext(ctx, `INSERT INTO users (name) VALUES ($1) RETURNING id`, UserName).Scan(&UserID)
 	if e != nil {
-		log.Println(e)
+		logging.FromContext(ctx).Error("database query failed", "method", "CreateUserGuest", "error", e)
 		return nil, errors.New("Unable to create new user")
 	}
 
@@ -194,7 +180,10 @@ func (d *Database) CreateUserGuest(UserName string) (*User, error) {
 }
 
 // CreateUserRegistered adds a new user registered to the db
-func (d *Database) CreateUserRegistered(UserName string, UserEmail string, UserPassword string, ActiveUserID string) (NewUser *User, VerifyID string, RegisterErr error) {
+func (d *Database) CreateUserRegistered(ctx context.Context, UserName string, UserEmail string, UserPassword string, ActiveUserID string) (NewUser *User, VerifyID string, RegisterErr error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	hashedPassword, hashErr := HashAndSalt([]byte(UserPassword))
 	if hashErr != nil {
 		return nil, "", hashErr
@@ -205,7 +194,7 @@ func (d *Database) CreateUserRegistered(UserName string, UserEmail string, UserP
 	UserType := "REGISTERED"
 
 	if ActiveUserID != "" {
-		e := d.db.QueryRow(
+		e := d.db.QueryRowContext(ctx,
 			`SELECT userId, verifyId FROM register_user($1, $2, $3, $4, $5);`,
 			ActiveUserID,
 			UserName,
@@ -214,11 +203,11 @@ func (d *Database) CreateUserRegistered(UserName string, UserEmail string, UserP
 			UserType,
 		).Scan(&UserID, &verifyID)
 		if e != nil {
-			log.Println(e)
+			logging.FromContext(ctx).Error("database query failed", "method", "CreateUserRegistered", "error", e)
 			return nil, "", errors.New("a user with that email already exists")
 		}
 	} else {
-		e := d.db.QueryRow(
+		e := d.db.QueryRowContext(ctx,
 			`SELECT userId, verifyId FROM register_user($1, $2, $3, $4);`,
 			UserName,
 			UserEmail,
@@ -226,7 +215,7 @@ func (d *Database) CreateUserRegistered(UserName string, UserEmail string, UserP
 			UserType,
 		).Scan(&UserID, &verifyID)
 		if e != nil {
-			log.Println(e)
+			logging.FromContext(ctx).Error("database query failed", "method", "CreateUserRegistered", "error", e)
 			return nil, "", errors.New("a user with that email already exists")
 		}
 	}
@@ -235,8 +224,11 @@ func (d *Database) CreateUserRegistered(UserName string, UserEmail string, UserP
 }
 
 // UpdateUserProfile attempts to update the users profile
-func (d *Database) UpdateUserProfile(UserID string, UserName string, UserAvatar string, Country string, Locale string, Company string, JobTitle string) error {
-	if _, err := d.db.Exec(
+func (d *Database) UpdateUserProfile(ctx context.Context, UserID string, UserName string, UserAvatar string, Country string, Locale string, Company string, JobTitle string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`call user_profile_update($1, $2, $3, $4, $5, $6, $7);`,
 		UserID,
 		UserName,
@@ -246,7 +238,7 @@ func (d *Database) UpdateUserProfile(UserID string, UserName string, UserAvatar
 		Company,
 		JobTitle,
 	); err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "UpdateUserProfile", "user_id", UserID, "error", err)
 		return errors.New("Error attempting to update users profile")
 	}
 
@@ -254,18 +246,21 @@ func (d *Database) UpdateUserProfile(UserID string, UserName string, UserAvatar
 }
 
 // UserResetRequest inserts a new user reset request
-func (d *Database) UserResetRequest(UserEmail string) (resetID string, userName string, resetErr error) {
+func (d *Database) UserResetRequest(ctx context.Context, UserEmail string) (resetID string, userName string, resetErr error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var ResetID sql.NullString
 	var UserID sql.NullString
 	var UserName sql.NullString
 
-	e := d.db.QueryRow(`
+	e := d.db.QueryRowContext(ctx, `
 		SELECT resetId, userId, userName FROM insert_user_reset($1);
 		`,
 		UserEmail,
 	).Scan(&ResetID, &UserID, &UserName)
 	if e != nil {
-		log.Println("Unable to reset user: ", e)
+		logging.FromContext(ctx).Error("Unable to reset user", "error", e)
 		return "", "", e
 	}
 
@@ -273,7 +268,10 @@ func (d *Database) UserResetRequest(UserEmail string) (resetID string, userName
 }
 
 // UserResetPassword attempts to reset a users password
-func (d *Database) UserResetPassword(ResetID string, UserPassword string) (userName string, userEmail string, resetErr error) {
+func (d *Database) UserResetPassword(ctx context.Context, ResetID string, UserPassword string) (userName string, userEmail string, resetErr error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var UserName sql.NullString
 	var UserEmail sql.NullString
 
@@ -282,21 +280,21 @@ func (d *Database) UserResetPassword(ResetID string, UserPassword string) (userN
 		return "", "", hashErr
 	}
 
-	userErr := d.db.QueryRow(`
+	userErr := d.db.QueryRowContext(ctx, `
 		SELECT
 			w.name, w.email
 		FROM user_reset wr
-		LEFT JOIN usersw ON w.id = wr.user_id
+		LEFT JOIN users w ON w.id = wr.user_id
 		WHERE wr.reset_id = $1;
 		`,
 		ResetID,
 	).Scan(&UserName, &UserEmail)
 	if userErr != nil {
-		log.Println("Unable to get user for password reset confirmation email: ", userErr)
+		logging.FromContext(ctx).Error("Unable to get user for password reset confirmation email", "error", userErr)
 		return "", "", userErr
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`call reset_user_password($1, $2)`, ResetID, hashedPassword); err != nil {
 		return "", "", err
 	}
@@ -305,11 +303,14 @@ func (d *Database) UserResetPassword(ResetID string, UserPassword string) (userN
 }
 
 // UserUpdatePassword attempts to update a users password
-func (d *Database) UserUpdatePassword(UserID string, UserPassword string) (userName string, userEmail string, resetErr error) {
+func (d *Database) UserUpdatePassword(ctx context.Context, UserID string, UserPassword string) (userName string, userEmail string, resetErr error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var UserName sql.NullString
 	var UserEmail sql.NullString
 
-	userErr := d.db.QueryRow(`
+	userErr := d.db.QueryRowContext(ctx, `
 		SELECT
 			w.name, w.email
 		FROM users w
@@ -318,7 +319,7 @@ func (d *Database) UserUpdatePassword(UserID string, UserPassword string) (userN
 		UserID,
 	).Scan(&UserName, &UserEmail)
 	if userErr != nil {
-		log.Println("Unable to get user for password update: ", userErr)
+		logging.FromContext(ctx).Error("Unable to get user for password update", "user_id", UserID, "error", userErr)
 		return "", "", userErr
 	}
 
@@ -327,7 +328,7 @@ func (d *Database) UserUpdatePassword(UserID string, UserPassword string) (userN
 		return "", "", hashErr
 	}
 
-	if _, err := d.db.Exec(
+	if _, err := d.db.ExecContext(ctx,
 		`call update_user_password($1, $2)`, UserID, hashedPassword); err != nil {
 		return "", "", err
 	}
@@ -336,8 +337,11 @@ func (d *Database) UserUpdatePassword(UserID string, UserPassword string) (userN
 }
 
 // VerifyUserAccount attempts to verify a users account email
-func (d *Database) VerifyUserAccount(VerifyID string) error {
-	if _, err := d.db.Exec(
+func (d *Database) VerifyUserAccount(ctx context.Context, VerifyID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx,
 		`call verify_user_account($1)`, VerifyID); err != nil {
 		return err
 	}
@@ -345,13 +349,23 @@ func (d *Database) VerifyUserAccount(VerifyID string) error {
 	return nil
 }
 
-// DeleteUser attempts to delete a user
-func (d *Database) DeleteUser(UserID string) error {
-	if _, err := d.db.Exec(
-		`call delete_user($1);`,
-		UserID,
-	); err != nil {
-		log.Println(err)
+// DeleteUser attempts to delete a user, refreshing the active countries in the same transaction
+func (d *Database) DeleteUser(ctx context.Context, UserID string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1;`, UserID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `REFRESH MATERIALIZED VIEW active_countries;`); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("database query failed", "method", "DeleteUser", "user_id", UserID, "error", err)
 		return errors.New("error attempting to delete user")
 	}
 
@@ -359,10 +373,13 @@ func (d *Database) DeleteUser(UserID string) error {
 }
 
 // GetActiveCountries gets a list of user countries
-func (d *Database) GetActiveCountries() ([]string, error) {
+func (d *Database) GetActiveCountries(ctx context.Context) ([]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var countries = make([]string, 0)
 
-	rows, err := d.db.Query(`SELECT * FROM countries_active();`)
+	rows, err := d.read.QueryContext(ctx, `SELECT * FROM countries_active();`)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -370,7 +387,7 @@ func (d *Database) GetActiveCountries() ([]string, error) {
 			if err := rows.Scan(
 				&country,
 			); err != nil {
-				log.Println(err)
+				logging.FromContext(ctx).Error("database query failed", "method", "GetActiveCountries", "error", err)
 			} else {
 				if country.String != "" {
 					countries = append(countries, country.String)
@@ -378,7 +395,7 @@ func (d *Database) GetActiveCountries() ([]string, error) {
 			}
 		}
 	} else {
-		log.Println(err)
+		logging.FromContext(ctx).Error("database query failed", "method", "GetActiveCountries", "error", err)
 		return nil, errors.New("error attempting to get active countries")
 	}
 
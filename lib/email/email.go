@@ -1,34 +1,16 @@
 package email
 
 import (
-	"crypto/tls"
-	"fmt"
-	"log"
+	"context"
 	"net/mail"
-	"net/smtp"
 	"strconv"
 	"time"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/matcornic/hermes/v2"
 	"github.com/spf13/viper"
 )
 
-// smtpServer data to smtp server
-type smtpServer struct {
-	host string
-	port string
-}
-
-// Address URI to smtp server
-func (s *smtpServer) Address() string {
-	return s.host + ":" + s.port
-}
-
-var smtpServerConfig = smtpServer{}
-var tlsConfig = &tls.Config{}
-var smtpFrom = mail.Address{}
-var smtpAuth smtp.Auth
-
 // Config contains all the mailserver values
 type Config struct {
 	AppURL       string
@@ -40,146 +22,159 @@ type Config struct {
 	smtpUser     string
 	smtpPass     string
 	smtpSender   string
+	// email.transport, smtp, file or log
+	transport string
+	// directory of the file transport maildir
+	fileDir string
+	// delivery attempts before a queued email is marked failed
+	maxAttempts int
+	// how often the outbox worker checks for due emails
+	outboxInterval time.Duration
+	// config.default_locale, for recipients without a locale
+	defaultLocale string
 }
 
 // Email contains all the methods to send application emails
 type Email struct {
-	config *Config
+	config    *Config
+	transport Transport
+	store     Store
+	// wakes the outbox worker when an email is queued
+	wake chan struct{}
 }
 
-// New creates a new instance of Email
-func New(AppDomain string, PathPrefix string) *Email {
+// Store is the database emails are queued in and recipients looked up from, implemented by database.Database
+type Store interface {
+	Outbox
+	GetUserLocaleByEmail(ctx context.Context, UserEmail string) (string, error)
+}
+
+// New creates a new instance of Email, emails are queued in the store's outbox
+// and delivered by RunOutbox through the configured transport
+func New(AppDomain string, PathPrefix string, store Store) *Email {
 	var AppURL string = "https://" + AppDomain + PathPrefix + "/"
 	var m = &Email{
 		// read environment variables and sets up mailserver configuration values
 		config: &Config{
-			AppURL:       AppURL,
-			SenderName:   "Wakita",
-			smtpHost:     viper.GetString("smtp.host"),
-			smtpPort:     viper.GetString("smtp.port"),
-			smtpSecure:   viper.GetBool("smtp.secure"),
-			smtpIdentity: viper.GetString("smtp.identity"),
-			smtpUser:     viper.GetString("smtp.user"),
-			smtpPass:     viper.GetString("smtp.pass"),
-			smtpSender:   viper.GetString("smtp.sender"),
+			AppURL:         AppURL,
+			SenderName:     "Wakita",
+			smtpHost:       viper.GetString("smtp.host"),
+			smtpPort:       viper.GetString("smtp.port"),
+			smtpSecure:     viper.GetBool("smtp.secure"),
+			smtpIdentity:   viper.GetString("smtp.identity"),
+			smtpUser:       viper.GetString("smtp.user"),
+			smtpPass:       viper.GetString("smtp.pass"),
+			smtpSender:     viper.GetString("smtp.sender"),
+			transport:      viper.GetString("email.transport"),
+			fileDir:        viper.GetString("email.file_dir"),
+			maxAttempts:    viper.GetInt("email.max_attempts"),
+			outboxInterval: time.Duration(viper.GetInt("email.outbox_interval")) * time.Second,
+			defaultLocale:  viper.GetString("config.default_locale"),
 		},
+		store: store,
+		wake:  make(chan struct{}, 1),
 	}
 
-	// smtp server configuration.
-	smtpServerConfig = smtpServer{host: m.config.smtpHost, port: m.config.smtpPort}
-
-	// smtp sender info
-	smtpFrom = mail.Address{
-		Name:    m.config.SenderName,
-		Address: m.config.smtpSender,
-	}
-
-	// TLS config
-	tlsConfig = &tls.Config{
-		InsecureSkipVerify: !m.config.smtpSecure,
-		ServerName:         m.config.smtpHost,
+	transport, err := newTransport(m.config)
+	if err != nil {
+		logging.Fatal("error configuring email transport", "error", err)
 	}
-
-	smtpAuth = smtp.PlainAuth(m.config.smtpIdentity, m.config.smtpUser, m.config.smtpPass, m.config.smtpHost)
+	m.transport = transport
 
 	return m
 }
 
-// Generates an Email Body with hermes
-func (m *Email) generateBody(Body hermes.Body) (emailBody string, generateErr error) {
+// Generates an Email Body with hermes in the locale, as html and the plain text alternative
+func (m *Email) generateBody(Locale string, Body hermes.Body) (htmlBody string, textBody string, generateErr error) {
 	currentTime := time.Now()
 	year := strconv.Itoa(currentTime.Year())
 	hms := hermes.Hermes{
 		Product: hermes.Product{
-			Name:      "Wakita",
-			Link:      m.config.AppURL,
-			Logo:      m.config.AppURL + "img/wakita-logo.png",
-			Copyright: "Copyright © " + year + " Wakita. All rights reserved.",
+			Name:        "Wakita",
+			Link:        m.config.AppURL,
+			Logo:        m.config.AppURL + "img/wakita-logo.png",
+			Copyright:   translate(Locale, "copyright", year),
+			TroubleText: translate(Locale, "trouble"),
 		},
 	}
 
+	if Body.Greeting == "" {
+		Body.Greeting = translate(Locale, "greeting")
+	}
+	if Body.Signature == "" {
+		Body.Signature = translate(Locale, "signature")
+	}
+
 	email := hermes.Email{
 		Body: Body,
 	}
 
 	// Generate an HTML email with the provided contents (for modern clients)
-	emailBody, err := hms.GenerateHTML(email)
+	htmlBody, err := hms.GenerateHTML(email)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return emailBody, nil
-}
-
-// Send - utility function to send emails
-func (m *Email) Send(UserName string, UserEmail string, Subject string, Body string) error {
-	to := mail.Address{
-		Name:    UserName,
-		Address: UserEmail,
+	// and the plain text version for clients that don't render html
+	textBody, err = hms.GeneratePlainText(email)
+	if err != nil {
+		return "", "", err
 	}
 
-	// Setup headers
-	headers := make(map[string]string)
-	headers["From"] = smtpFrom.String()
-	headers["To"] = to.String()
-	headers["Subject"] = Subject
-	headers["MIME-version"] = "1.0"
-	headers["Content-Type"] = "text/html"
-
-	// Setup message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	message += "\r\n" + Body
+	return htmlBody, textBody, nil
+}
 
-	c, err := smtp.Dial(smtpServerConfig.Address())
-	if err != nil {
-		log.Println("Error dialing SMTP: ", err)
-		return err
-	}
+// Send - utility function to queue emails in the outbox, without a store the email is delivered immediately
+func (m *Email) Send(UserName string, UserEmail string, Subject string, HTMLBody string, TextBody string) error {
+	return m.send(&Message{
+		To:      mail.Address{Name: UserName, Address: UserEmail},
+		Subject: Subject,
+		Body:    HTMLBody,
+		Text:    TextBody,
+	})
+}
 
-	c.StartTLS(tlsConfig)
+// send queues the message in the outbox, or delivers it immediately without a store
+func (m *Email) send(msg *Message) error {
+	ctx := context.Background()
 
-	// Auth
-	if m.config.smtpSecure == true {
-		if err = c.Auth(smtpAuth); err != nil {
-			log.Println("Error authenticating SMTP: ", err)
-			return err
-		}
+	if m.store == nil {
+		msg.From = m.from()
+		return m.transport.Send(ctx, msg)
 	}
 
-	// To && From
-	if err = c.Mail(smtpFrom.Address); err != nil {
-		log.Println("Error setting SMTP from: ", err)
+	if _, err := m.store.EmailOutboxEnqueue(ctx, msg.To.Name, msg.To.Address, msg.Subject, msg.Body, msg.Text, msg.ListUnsubscribe); err != nil {
 		return err
 	}
 
-	if err = c.Rcpt(to.Address); err != nil {
-		log.Println("Error setting SMTP to: ", err)
-		return err
+	select {
+	case m.wake <- struct{}{}:
+	default:
 	}
 
-	// Data
-	w, err := c.Data()
-	if err != nil {
-		log.Println("Error setting SMTP data: ", err)
-		return err
-	}
+	return nil
+}
 
-	_, err = w.Write([]byte(message))
-	if err != nil {
-		log.Println("Error sending email: ", err)
-		return err
+// unsubscribeURL is the one-click link turning off the Notification (e.g. teamDigest) for the owner of the Token,
+// or all their notifications without a Notification
+func (m *Email) unsubscribeURL(Token string, Notification string) string {
+	URL := m.config.AppURL + "api/unsubscribe/" + Token
+	if Notification != "" {
+		URL = URL + "?notification=" + Notification
 	}
 
-	err = w.Close()
-	if err != nil {
-		log.Println("Error closing SMTP: ", err)
-		return err
-	}
+	return URL
+}
 
-	c.Quit()
+// from is the configured sender address
+func (m *Email) from() mail.Address {
+	return mail.Address{
+		Name:    m.config.SenderName,
+		Address: m.config.smtpSender,
+	}
+}
 
-	return nil
+// Ping checks the email transport is accepting connections
+func (m *Email) Ping(ctx context.Context) error {
+	return m.transport.Ping(ctx)
 }
@@ -0,0 +1,256 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// fallbackLocale is used when neither the recipient nor config.default_locale have a translation
+const fallbackLocale = "en"
+
+// translations of the email templates, keyed by locale then message, the locales match the web app
+var translations = map[string]map[string]string{
+	"en": {
+		"greeting":  "Hi",
+		"signature": "Yours truly",
+		"copyright": "Copyright © %s Wakita. All rights reserved.",
+		"trouble":   "If you’re having trouble with the button '{ACTION}', copy and paste the URL below into your web browser.",
+
+		"helpInstructions": "Need help, or have questions? Visit our Github page",
+		"helpButton":       "Github Repo",
+
+		"welcomeSubject":      "Welcome to Wakita!",
+		"welcomeIntro":        "Welcome to Wakita.",
+		"welcomeInstructions": "Please validate your email, the following link will expire in 24 hours.",
+		"welcomeButton":       "Verify Account",
+
+		"forgotPasswordSubject":      "Forgot your Wakita password?",
+		"forgotPasswordIntro":        "It seems you've forgot your Wakita password.",
+		"forgotPasswordInstructions": "Reset your password now, the following link will expire within an hour of the original request.",
+		"forgotPasswordButton":       "Reset Password",
+
+		"passwordResetSubject":  "Your Wakita password was successfully reset.",
+		"passwordResetIntro":    "Your Wakita password was successfully reset.",
+		"passwordUpdateSubject": "Your Wakita password was successfully updated.",
+		"passwordUpdateIntro":   "Your Wakita password was successfully updated.",
+
+		"retrospectiveScheduledSubject":      "Retrospective %[1]s is ready",
+		"retrospectiveScheduledIntro":        "A new retrospective %[1]s has been scheduled for your team %[2]s.",
+		"retrospectiveScheduledInstructions": "Join the retrospective to start adding your feedback.",
+		"retrospectiveScheduledButton":       "Join Retrospective",
+
+		"retrospectiveSummarySubject":      "Summary of retrospective %[1]s",
+		"retrospectiveSummaryIntro":        "The retrospective %[1]s has finished, here are the top voted items and the agreed action items.",
+		"retrospectiveSummaryColumn":       "Column",
+		"retrospectiveSummaryItem":         "Item",
+		"retrospectiveSummaryVotes":        "Votes",
+		"retrospectiveSummaryWorked":       "Worked well",
+		"retrospectiveSummaryImprove":      "Needs improvement",
+		"retrospectiveSummaryQuestion":     "Question",
+		"retrospectiveSummaryGroup":        "Group",
+		"retrospectiveSummaryNoItems":      "No items were added.",
+		"retrospectiveSummaryActions":      "Action items:",
+		"retrospectiveSummaryNoActions":    "No action items were agreed.",
+		"retrospectiveSummaryUnassigned":   "Unassigned",
+		"retrospectiveSummaryCompleted":    "%[1]s (completed)",
+		"retrospectiveSummaryInstructions": "View the full retrospective.",
+		"retrospectiveSummaryButton":       "View Retrospective",
+		"retrospectiveSummaryOutro":        "You receive this email because you opted in to retrospective summaries in your profile.",
+
+		"unsubscribeInstructions": "Don't want these emails anymore? Unsubscribe with one click, or change your notification preferences in your profile.",
+		"unsubscribeButton":       "Unsubscribe",
+
+		"notificationDigestSubject":  "Your Wakita notifications",
+		"notificationDigestIntro":    "Here's what happened since your last digest.",
+		"notificationInvite":         "You were added to %[1]s",
+		"notificationActionAssigned": "You were assigned the action item \"%[2]s\" in retrospective %[1]s",
+		"notificationActionDue":      "Your action item \"%[2]s\" in retrospective %[1]s is due soon",
+
+		"teamDigestSubject":       "Your weekly team digest",
+		"teamDigestIntro":         "Here's what your teams have been up to this week.",
+		"teamDigestNoActivity":    "Your teams had no retrospectives or open action items this week.",
+		"teamDigestTeam":          "Team",
+		"teamDigestItem":          "Item",
+		"teamDigestAssignee":      "Assignee",
+		"teamDigestDue":           "Due",
+		"teamDigestRetrospective": "Retrospective %[1]s",
+		"teamDigestButton":        "Open Wakita",
+	},
+	"de": {
+		"greeting":  "Hallo",
+		"signature": "Viele Grüße",
+		"copyright": "Copyright © %s Wakita. Alle Rechte vorbehalten.",
+		"trouble":   "Falls der Button '{ACTION}' nicht funktioniert, kopiere die folgende URL in deinen Browser.",
+
+		"helpInstructions": "Brauchst du Hilfe oder hast du Fragen? Besuche unsere Github-Seite",
+		"helpButton":       "Github-Repository",
+
+		"welcomeSubject":      "Willkommen bei Wakita!",
+		"welcomeIntro":        "Willkommen bei Wakita.",
+		"welcomeInstructions": "Bitte bestätige deine E-Mail-Adresse, der folgende Link ist 24 Stunden gültig.",
+		"welcomeButton":       "Konto bestätigen",
+
+		"forgotPasswordSubject":      "Wakita-Passwort vergessen?",
+		"forgotPasswordIntro":        "Anscheinend hast du dein Wakita-Passwort vergessen.",
+		"forgotPasswordInstructions": "Setze dein Passwort jetzt zurück, der folgende Link ist bis eine Stunde nach der Anfrage gültig.",
+		"forgotPasswordButton":       "Passwort zurücksetzen",
+
+		"passwordResetSubject":  "Dein Wakita-Passwort wurde erfolgreich zurückgesetzt.",
+		"passwordResetIntro":    "Dein Wakita-Passwort wurde erfolgreich zurückgesetzt.",
+		"passwordUpdateSubject": "Dein Wakita-Passwort wurde erfolgreich geändert.",
+		"passwordUpdateIntro":   "Dein Wakita-Passwort wurde erfolgreich geändert.",
+
+		"retrospectiveScheduledSubject":      "Retrospektive %[1]s ist bereit",
+		"retrospectiveScheduledIntro":        "Für dein Team %[2]s wurde die neue Retrospektive %[1]s geplant.",
+		"retrospectiveScheduledInstructions": "Nimm an der Retrospektive teil, um dein Feedback hinzuzufügen.",
+		"retrospectiveScheduledButton":       "Zur Retrospektive",
+
+		"retrospectiveSummarySubject":      "Zusammenfassung der Retrospektive %[1]s",
+		"retrospectiveSummaryIntro":        "Die Retrospektive %[1]s ist beendet, hier sind die meistgewählten Einträge und die vereinbarten Maßnahmen.",
+		"retrospectiveSummaryColumn":       "Spalte",
+		"retrospectiveSummaryItem":         "Eintrag",
+		"retrospectiveSummaryVotes":        "Stimmen",
+		"retrospectiveSummaryWorked":       "Lief gut",
+		"retrospectiveSummaryImprove":      "Verbesserungswürdig",
+		"retrospectiveSummaryQuestion":     "Frage",
+		"retrospectiveSummaryGroup":        "Gruppe",
+		"retrospectiveSummaryNoItems":      "Es wurden keine Einträge hinzugefügt.",
+		"retrospectiveSummaryActions":      "Maßnahmen:",
+		"retrospectiveSummaryNoActions":    "Es wurden keine Maßnahmen vereinbart.",
+		"retrospectiveSummaryUnassigned":   "Nicht zugewiesen",
+		"retrospectiveSummaryCompleted":    "%[1]s (erledigt)",
+		"retrospectiveSummaryInstructions": "Sieh dir die vollständige Retrospektive an.",
+		"retrospectiveSummaryButton":       "Zur Retrospektive",
+		"retrospectiveSummaryOutro":        "Du erhältst diese E-Mail, weil du Zusammenfassungen von Retrospektiven in deinem Profil aktiviert hast.",
+
+		"unsubscribeInstructions": "Du möchtest diese E-Mails nicht mehr erhalten? Melde dich mit einem Klick ab oder ändere deine Benachrichtigungseinstellungen im Profil.",
+		"unsubscribeButton":       "Abmelden",
+
+		"notificationDigestSubject":  "Deine Wakita-Benachrichtigungen",
+		"notificationDigestIntro":    "Das ist seit deiner letzten Zusammenfassung passiert.",
+		"notificationInvite":         "Du wurdest zu %[1]s hinzugefügt",
+		"notificationActionAssigned": "Dir wurde die Maßnahme \"%[2]s\" in der Retrospektive %[1]s zugewiesen",
+		"notificationActionDue":      "Deine Maßnahme \"%[2]s\" in der Retrospektive %[1]s ist bald fällig",
+
+		"teamDigestSubject":       "Deine wöchentliche Team-Zusammenfassung",
+		"teamDigestIntro":         "Das haben deine Teams diese Woche gemacht.",
+		"teamDigestNoActivity":    "Deine Teams hatten diese Woche keine Retrospektiven oder offenen Maßnahmen.",
+		"teamDigestTeam":          "Team",
+		"teamDigestItem":          "Eintrag",
+		"teamDigestAssignee":      "Zuständig",
+		"teamDigestDue":           "Fällig",
+		"teamDigestRetrospective": "Retrospektive %[1]s",
+		"teamDigestButton":        "Wakita öffnen",
+	},
+	"ru": {
+		"greeting":  "Здравствуйте",
+		"signature": "С уважением",
+		"copyright": "Copyright © %s Wakita. Все права защищены.",
+		"trouble":   "Если кнопка '{ACTION}' не работает, скопируйте ссылку ниже и вставьте её в адресную строку браузера.",
+
+		"helpInstructions": "Нужна помощь или есть вопросы? Посетите нашу страницу на Github",
+		"helpButton":       "Репозиторий на Github",
+
+		"welcomeSubject":      "Добро пожаловать в Wakita!",
+		"welcomeIntro":        "Добро пожаловать в Wakita.",
+		"welcomeInstructions": "Пожалуйста, подтвердите свой адрес электронной почты, ссылка действительна 24 часа.",
+		"welcomeButton":       "Подтвердить аккаунт",
+
+		"forgotPasswordSubject":      "Забыли пароль от Wakita?",
+		"forgotPasswordIntro":        "Похоже, вы забыли свой пароль от Wakita.",
+		"forgotPasswordInstructions": "Сбросьте пароль сейчас, ссылка действительна в течение часа после запроса.",
+		"forgotPasswordButton":       "Сбросить пароль",
+
+		"passwordResetSubject":  "Ваш пароль от Wakita успешно сброшен.",
+		"passwordResetIntro":    "Ваш пароль от Wakita успешно сброшен.",
+		"passwordUpdateSubject": "Ваш пароль от Wakita успешно изменён.",
+		"passwordUpdateIntro":   "Ваш пароль от Wakita успешно изменён.",
+
+		"retrospectiveScheduledSubject":      "Ретроспектива %[1]s готова",
+		"retrospectiveScheduledIntro":        "Для вашей команды %[2]s запланирована новая ретроспектива %[1]s.",
+		"retrospectiveScheduledInstructions": "Присоединяйтесь к ретроспективе, чтобы оставить свой отзыв.",
+		"retrospectiveScheduledButton":       "Открыть ретроспективу",
+
+		"retrospectiveSummarySubject":      "Итоги ретроспективы %[1]s",
+		"retrospectiveSummaryIntro":        "Ретроспектива %[1]s завершена, вот пункты с наибольшим числом голосов и согласованные действия.",
+		"retrospectiveSummaryColumn":       "Колонка",
+		"retrospectiveSummaryItem":         "Пункт",
+		"retrospectiveSummaryVotes":        "Голоса",
+		"retrospectiveSummaryWorked":       "Что прошло хорошо",
+		"retrospectiveSummaryImprove":      "Что улучшить",
+		"retrospectiveSummaryQuestion":     "Вопрос",
+		"retrospectiveSummaryGroup":        "Группа",
+		"retrospectiveSummaryNoItems":      "Пункты не были добавлены.",
+		"retrospectiveSummaryActions":      "Действия:",
+		"retrospectiveSummaryNoActions":    "Действия не были согласованы.",
+		"retrospectiveSummaryUnassigned":   "Не назначено",
+		"retrospectiveSummaryCompleted":    "%[1]s (выполнено)",
+		"retrospectiveSummaryInstructions": "Откройте ретроспективу целиком.",
+		"retrospectiveSummaryButton":       "Открыть ретроспективу",
+		"retrospectiveSummaryOutro":        "Вы получили это письмо, потому что включили итоги ретроспектив в своём профиле.",
+
+		"unsubscribeInstructions": "Не хотите получать эти письма? Отпишитесь одним нажатием или измените настройки уведомлений в профиле.",
+		"unsubscribeButton":       "Отписаться",
+
+		"notificationDigestSubject":  "Ваши уведомления Wakita",
+		"notificationDigestIntro":    "Вот что произошло с момента последней сводки.",
+		"notificationInvite":         "Вас добавили в %[1]s",
+		"notificationActionAssigned": "Вам назначено действие \"%[2]s\" в ретроспективе %[1]s",
+		"notificationActionDue":      "Срок вашего действия \"%[2]s\" в ретроспективе %[1]s скоро истекает",
+
+		"teamDigestSubject":       "Еженедельная сводка по командам",
+		"teamDigestIntro":         "Вот чем занимались ваши команды на этой неделе.",
+		"teamDigestNoActivity":    "На этой неделе у ваших команд не было ретроспектив или открытых действий.",
+		"teamDigestTeam":          "Команда",
+		"teamDigestItem":          "Пункт",
+		"teamDigestAssignee":      "Исполнитель",
+		"teamDigestDue":           "Срок",
+		"teamDigestRetrospective": "Ретроспектива %[1]s",
+		"teamDigestButton":        "Открыть Wakita",
+	},
+}
+
+// translate formats the message in the locale, falling back to english for messages missing a translation
+func translate(locale string, key string, args ...interface{}) string {
+	message, ok := translations[locale][key]
+	if !ok {
+		message = translations[fallbackLocale][key]
+	}
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
+
+// supportedLocale returns the translated locale matching locale, e.g. de for de-AT, or empty when there is none
+func supportedLocale(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+	if _, ok := translations[locale]; ok {
+		return locale
+	}
+
+	return ""
+}
+
+// recipientLocale is the locale emails to the recipient are written in, their users.locale
+// falling back to config.default_locale
+func (m *Email) recipientLocale(ctx context.Context, UserEmail string) string {
+	if m.store != nil {
+		if UserLocale, err := m.store.GetUserLocaleByEmail(ctx, UserEmail); err == nil {
+			if locale := supportedLocale(UserLocale); locale != "" {
+				return locale
+			}
+		}
+	}
+
+	if locale := supportedLocale(m.config.defaultLocale); locale != "" {
+		return locale
+	}
+
+	return fallbackLocale
+}
@@ -0,0 +1,174 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/matcornic/hermes/v2"
+)
+
+// notificationMessages are the translation keys of the digest notification types
+var notificationMessages = map[string]string{
+	database.NotificationInvite:         "notificationInvite",
+	database.NotificationActionAssigned: "notificationActionAssigned",
+	database.NotificationActionDue:      "notificationActionDue",
+}
+
+// notificationPreferences are the unsubscribe notification names of the digest notification types
+var notificationPreferences = map[string]string{
+	database.NotificationInvite:         "invites",
+	database.NotificationActionAssigned: "actionAssigned",
+	database.NotificationActionDue:      "actionDue",
+}
+
+// SendNotificationDigest sends the users pending invites and action item notifications in one email
+func (m *Email) SendNotificationDigest(UserName string, UserEmail string, UnsubscribeToken string, Notifications []*database.UserNotification) error {
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	Entries := make([]hermes.Entry, 0, len(Notifications))
+	Types := make(map[string]bool)
+	for _, n := range Notifications {
+		Entries = append(Entries, hermes.Entry{
+			Key:   translate(locale, notificationMessages[n.Type], n.Title, n.Content),
+			Value: m.config.AppURL + n.Link,
+		})
+		Types[notificationPreferences[n.Type]] = true
+	}
+
+	// the one-click unsubscribe turns off the digests notification type, or all notifications for mixed digests
+	Unsubscribe := ""
+	if len(Types) == 1 {
+		for Notification := range Types {
+			Unsubscribe = Notification
+		}
+	}
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
+		hermes.Body{
+			Name: UserName,
+			Intros: []string{
+				translate(locale, "notificationDigestIntro"),
+			},
+			Dictionary: Entries,
+			Actions: []hermes.Action{
+				m.unsubscribeAction(locale, UnsubscribeToken, Unsubscribe),
+			},
+		},
+	)
+	if err != nil {
+		logging.Error("Error Generating Notification Digest Email HTML", "error", err)
+		return err
+	}
+
+	sendErr := m.send(&Message{
+		To:              mail.Address{Name: UserName, Address: UserEmail},
+		Subject:         translate(locale, "notificationDigestSubject"),
+		Body:            htmlBody,
+		Text:            textBody,
+		ListUnsubscribe: m.unsubscribeURL(UnsubscribeToken, Unsubscribe),
+	})
+	if sendErr != nil {
+		logging.Error("Error sending Notification Digest Email", "error", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// SendTeamDigest sends the weekly digest of the users teams retrospectives and open action items
+func (m *Email) SendTeamDigest(UserName string, UserEmail string, UnsubscribeToken string, Teams []*database.TeamDigest) error {
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	teamKey := translate(locale, "teamDigestTeam")
+	itemKey := translate(locale, "teamDigestItem")
+	assigneeKey := translate(locale, "teamDigestAssignee")
+	dueKey := translate(locale, "teamDigestDue")
+
+	var Rows [][]hermes.Entry
+	for _, Team := range Teams {
+		for _, Retrospective := range Team.Retrospectives {
+			Rows = append(Rows, []hermes.Entry{
+				{Key: teamKey, Value: Team.TeamName},
+				{Key: itemKey, Value: translate(locale, "teamDigestRetrospective", Retrospective.RetrospectiveName)},
+				{Key: assigneeKey, Value: ""},
+				{Key: dueKey, Value: ""},
+			})
+		}
+		for _, Action := range Team.OpenActions {
+			Rows = append(Rows, []hermes.Entry{
+				{Key: teamKey, Value: Team.TeamName},
+				{Key: itemKey, Value: Action.Content},
+				{Key: assigneeKey, Value: Action.AssigneeName},
+				{Key: dueKey, Value: Action.DueDate},
+			})
+		}
+	}
+
+	Intros := []string{
+		translate(locale, "teamDigestIntro"),
+	}
+	if len(Rows) == 0 {
+		Intros = []string{
+			translate(locale, "teamDigestNoActivity"),
+		}
+	}
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
+		hermes.Body{
+			Name:   UserName,
+			Intros: Intros,
+			Table: hermes.Table{
+				Data: Rows,
+				Columns: hermes.Columns{
+					CustomWidth: map[string]string{
+						teamKey: "20%",
+						dueKey:  "15%",
+					},
+				},
+			},
+			Actions: []hermes.Action{
+				{
+					Button: hermes.Button{
+						Text: translate(locale, "teamDigestButton"),
+						Link: m.config.AppURL,
+					},
+				},
+				m.unsubscribeAction(locale, UnsubscribeToken, "teamDigest"),
+			},
+		},
+	)
+	if err != nil {
+		logging.Error("Error Generating Team Digest Email HTML", "error", err)
+		return err
+	}
+
+	sendErr := m.send(&Message{
+		To:              mail.Address{Name: UserName, Address: UserEmail},
+		Subject:         translate(locale, "teamDigestSubject"),
+		Body:            htmlBody,
+		Text:            textBody,
+		ListUnsubscribe: m.unsubscribeURL(UnsubscribeToken, "teamDigest"),
+	})
+	if sendErr != nil {
+		logging.Error("Error sending Team Digest Email", "error", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// unsubscribeAction is the one-click unsubscribe link closing notification emails
+func (m *Email) unsubscribeAction(locale string, Token string, Notification string) hermes.Action {
+	return hermes.Action{
+		Instructions: translate(locale, "unsubscribeInstructions"),
+		Button: hermes.Button{
+			Color: "#74787E",
+			Text:  translate(locale, "unsubscribeButton"),
+			Link:  m.unsubscribeURL(Token, Notification),
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+const (
+	// emails claimed per outbox query
+	outboxBatchSize = 10
+	// how long a claimed email is hidden from other replicas while it is being sent
+	outboxLease = 5 * time.Minute
+	// the longest a single delivery attempt may take
+	outboxSendTimeout = 30 * time.Second
+	// bounds of the wait between delivery attempts of a failing email
+	outboxBackoffMin = 30 * time.Second
+	outboxBackoffMax = time.Hour
+)
+
+// Outbox persists queued emails until they are delivered, implemented by database.Database
+type Outbox interface {
+	EmailOutboxEnqueue(ctx context.Context, ToName string, ToEmail string, Subject string, Body string, TextBody string, UnsubscribeURL string) (string, error)
+	EmailOutboxClaim(ctx context.Context, Limit int, Lease time.Duration) ([]*database.EmailOutboxMessage, error)
+	EmailOutboxMarkSent(ctx context.Context, MessageID string) error
+	EmailOutboxRetryLater(ctx context.Context, MessageID string, SendError string, RetryAfter time.Duration) error
+	EmailOutboxMarkFailed(ctx context.Context, MessageID string, SendError string) error
+}
+
+// RunOutbox delivers queued emails until ctx is done, failed deliveries are retried with exponential backoff
+// up to email.max_attempts, emails are claimed in the database so multiple replicas can run the worker safely
+func (m *Email) RunOutbox(ctx context.Context) {
+	if m.store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(m.config.outboxInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+
+		m.deliverDue(ctx)
+	}
+}
+
+// deliverDue claims and delivers the emails that are due, batch by batch until none are left
+func (m *Email) deliverDue(ctx context.Context) {
+	for {
+		Messages, err := m.store.EmailOutboxClaim(ctx, outboxBatchSize, outboxLease)
+		if err != nil || len(Messages) == 0 {
+			return
+		}
+
+		for _, Message := range Messages {
+			m.deliver(ctx, Message)
+		}
+	}
+}
+
+// deliver sends a claimed email, recording the outcome in the outbox
+func (m *Email) deliver(ctx context.Context, queued *database.EmailOutboxMessage) {
+	sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+	err := m.transport.Send(sendCtx, &Message{
+		ID:      queued.MessageID,
+		From:    m.from(),
+		To:      mail.Address{Name: queued.ToName, Address: queued.ToEmail},
+		Subject: queued.Subject,
+		Body:    queued.Body,
+		Text:    queued.TextBody,
+		// notification emails can be unsubscribed from with one click
+		ListUnsubscribe: queued.UnsubscribeURL,
+	})
+	cancel()
+
+	if err == nil {
+		m.store.EmailOutboxMarkSent(ctx, queued.MessageID)
+		return
+	}
+
+	if queued.Attempts >= m.config.maxAttempts {
+		logging.Error("Error sending email, giving up", "message_id", queued.MessageID, "attempts", queued.Attempts, "error", err)
+		m.store.EmailOutboxMarkFailed(ctx, queued.MessageID, err.Error())
+		return
+	}
+
+	backoff := outboxBackoff(queued.Attempts)
+	logging.Warn("Error sending email, retrying", "message_id", queued.MessageID, "attempts", queued.Attempts, "backoff", backoff.String(), "error", err)
+	m.store.EmailOutboxRetryLater(ctx, queued.MessageID, err.Error(), backoff)
+}
+
+// outboxBackoff is the wait before the next delivery attempt, doubling with each failed attempt
+func outboxBackoff(Attempts int) time.Duration {
+	backoff := outboxBackoffMin
+	for i := 1; i < Attempts && backoff < outboxBackoffMax; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > outboxBackoffMax {
+		backoff = outboxBackoffMax
+	}
+
+	return backoff
+}
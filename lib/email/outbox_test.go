@@ -0,0 +1,170 @@
+//go:build cgo
+// +build cgo
+
+package email
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/spf13/viper"
+)
+
+// newTestStore creates an sqlite database in a temporary directory for the outbox to queue emails in
+func newTestStore(t *testing.T) *database.Database {
+	schema, err := os.ReadFile("../../schema_sqlite.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set("db.driver", "sqlite")
+	viper.Set("db.url", filepath.Join(t.TempDir(), "wakita.db"))
+	viper.Set("db.query_timeout", 10)
+	viper.Set("db.max_open_conns", 5)
+
+	return database.New("", string(schema), string(schema))
+}
+
+// leaseRecorder records the outbox row of the email being sent before handing it to the transport
+type leaseRecorder struct {
+	Transport
+	store  *database.Database
+	leased *database.EmailOutboxMessage
+}
+
+func (r *leaseRecorder) Send(ctx context.Context, msg *Message) error {
+	r.leased = outboxRow(ctx, r.store)
+	return r.Transport.Send(ctx, msg)
+}
+
+// outboxRow gets the only email of the outbox
+func outboxRow(ctx context.Context, store *database.Database) *database.EmailOutboxMessage {
+	Messages := store.EmailOutboxList(ctx, "", 10, 0)
+	if len(Messages) != 1 {
+		return nil
+	}
+	return Messages[0]
+}
+
+// within checks the outbox date is d from now, give or take the second precision of sqlite timestamps
+func within(t *testing.T, name string, date string, d time.Duration) {
+	t.Helper()
+	got, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		t.Fatalf("%s %q is not a time: %v", name, date, err)
+	}
+	if want := time.Now().Add(d); got.Before(want.Add(-5*time.Second)) || got.After(want.Add(5*time.Second)) {
+		t.Errorf("%s = %s, want about %s", name, got, want)
+	}
+}
+
+func TestOutboxDeliverDue(t *testing.T) {
+	tests := []struct {
+		name        string
+		broken      bool
+		maxAttempts int
+		status      string
+		// wait before the next attempt of a pending email
+		retryAfter time.Duration
+	}{
+		{name: "delivered", maxAttempts: 5, status: "SENT"},
+		{name: "retried with backoff", broken: true, maxAttempts: 5, status: "PENDING", retryAfter: outboxBackoffMin},
+		{name: "failed on the last attempt", broken: true, maxAttempts: 1, status: "FAILED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newTestStore(t)
+
+			// a maildir under a regular file can't be created, so the file transport fails to send
+			dir := t.TempDir()
+			transportDir := dir
+			if tt.broken {
+				file := filepath.Join(dir, "file")
+				if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				transportDir = filepath.Join(file, "mail")
+			}
+
+			transport := &leaseRecorder{Transport: &fileTransport{dir: transportDir}, store: store}
+			m := &Email{
+				config:    &Config{SenderName: "Wakita", smtpSender: "wakita@wakita.test", maxAttempts: tt.maxAttempts},
+				transport: transport,
+				store:     store,
+				wake:      make(chan struct{}, 1),
+			}
+
+			if err := m.Send("Thor", "thor@wakita.test", "Retro summary", "<p>Deploys were fast</p>", "Deploys were fast"); err != nil {
+				t.Fatalf("Send() = %v", err)
+			}
+			if row := outboxRow(ctx, store); row == nil || row.Status != "PENDING" || row.Attempts != 0 {
+				t.Fatalf("queued email = %+v, want a pending email without attempts", row)
+			}
+
+			m.deliverDue(ctx)
+
+			if transport.leased == nil {
+				t.Fatalf("deliverDue() did not send the queued email")
+			}
+			if transport.leased.Attempts != 1 {
+				t.Errorf("attempts while sending = %d, want 1", transport.leased.Attempts)
+			}
+			within(t, "lease while sending", transport.leased.NextAttemptDate, outboxLease)
+
+			row := outboxRow(ctx, store)
+			if row.Status != tt.status || row.Attempts != 1 {
+				t.Errorf("email after deliverDue() = %s on attempt %d, want %s on attempt 1", row.Status, row.Attempts, tt.status)
+			}
+			if tt.broken && row.LastError == "" {
+				t.Errorf("email after a failed delivery has no last error")
+			}
+			if tt.retryAfter > 0 {
+				within(t, "next attempt", row.NextAttemptDate, tt.retryAfter)
+			}
+
+			// the email is not claimed again before its next attempt is due
+			transport.leased = nil
+			m.deliverDue(ctx)
+			if transport.leased != nil {
+				t.Errorf("deliverDue() sent the email again")
+			}
+
+			files, _ := ioutil.ReadDir(filepath.Join(dir, "new"))
+			if tt.broken {
+				if len(files) != 0 {
+					t.Errorf("maildir has %d emails, want none", len(files))
+				}
+				return
+			}
+			if len(files) != 1 {
+				t.Fatalf("maildir has %d emails, want 1", len(files))
+			}
+			written, err := ioutil.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{
+				`From: "Wakita" <wakita@wakita.test>`,
+				`To: "Thor" <thor@wakita.test>`,
+				"Subject: Retro summary",
+				"Content-Type: multipart/alternative",
+				"<p>Deploys were fast</p>",
+			} {
+				if !strings.Contains(string(written), want) {
+					t.Errorf("written email does not contain %q:\n%s", want, written)
+				}
+			}
+			if !strings.Contains(files[0].Name(), row.MessageID) {
+				t.Errorf("maildir file %s is not named after the outbox id %s", files[0].Name(), row.MessageID)
+			}
+		})
+	}
+}
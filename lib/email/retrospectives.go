@@ -0,0 +1,204 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+	"sort"
+	"strconv"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/matcornic/hermes/v2"
+)
+
+// SendRetrospectiveScheduled sends a link to a team retrospective created by the teams schedule
+func (m *Email) SendRetrospectiveScheduled(UserName string, UserEmail string, TeamName string, RetrospectiveName string, RetrospectiveID string) error {
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
+		hermes.Body{
+			Name: UserName,
+			Intros: []string{
+				translate(locale, "retrospectiveScheduledIntro", RetrospectiveName, TeamName),
+			},
+			Actions: []hermes.Action{
+				{
+					Instructions: translate(locale, "retrospectiveScheduledInstructions"),
+					Button: hermes.Button{
+						Color: "#22BC66",
+						Text:  translate(locale, "retrospectiveScheduledButton"),
+						Link:  m.config.AppURL + "retrospective/" + RetrospectiveID,
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		logging.Error("Error Generating Retrospective Scheduled Email HTML", "error", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		UserName,
+		UserEmail,
+		translate(locale, "retrospectiveScheduledSubject", RetrospectiveName),
+		htmlBody,
+		textBody,
+	)
+	if sendErr != nil {
+		logging.Error("Error sending Retrospective Scheduled Email", "error", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// retrospectiveSummaryTopItems is how many of the top voted items of each column are in the summary
+const retrospectiveSummaryTopItems = 3
+
+// SendRetrospectiveSummary sends the action items, top voted items of each column and groups of a finished retrospective
+func (m *Email) SendRetrospectiveSummary(UserName string, UserEmail string, UnsubscribeToken string, Retrospective *database.Retrospective) error {
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	Intros := []string{
+		translate(locale, "retrospectiveSummaryIntro", Retrospective.RetrospectiveName),
+	}
+
+	var Actions []hermes.Entry
+	for _, Action := range Retrospective.ActionItems {
+		Content := Action.Content
+		if Action.Completed {
+			Content = translate(locale, "retrospectiveSummaryCompleted", Content)
+		}
+		Assignee := Action.AssigneeName
+		if Assignee == "" {
+			Assignee = translate(locale, "retrospectiveSummaryUnassigned")
+		}
+		Actions = append(Actions, hermes.Entry{Key: Content, Value: Assignee})
+	}
+	if len(Actions) == 0 {
+		Intros = append(Intros, translate(locale, "retrospectiveSummaryNoActions"))
+	} else {
+		Intros = append(Intros, translate(locale, "retrospectiveSummaryActions"))
+	}
+
+	columnKey := translate(locale, "retrospectiveSummaryColumn")
+	itemKey := translate(locale, "retrospectiveSummaryItem")
+	votesKey := translate(locale, "retrospectiveSummaryVotes")
+
+	var Rows [][]hermes.Entry
+	for _, column := range []struct {
+		name  string
+		items []*database.RetrospectiveItem
+	}{
+		{"retrospectiveSummaryWorked", Retrospective.WorkedItems},
+		{"retrospectiveSummaryImprove", Retrospective.ImproveItems},
+		{"retrospectiveSummaryQuestion", Retrospective.QuestionItems},
+	} {
+		for _, item := range topVotedItems(column.items, retrospectiveSummaryTopItems) {
+			Rows = append(Rows, []hermes.Entry{
+				{Key: columnKey, Value: translate(locale, column.name)},
+				{Key: itemKey, Value: item.Content},
+				{Key: votesKey, Value: strconv.Itoa(item.VoteCount)},
+			})
+		}
+	}
+	for _, Group := range Retrospective.Groups {
+		Rows = append(Rows, []hermes.Entry{
+			{Key: columnKey, Value: translate(locale, "retrospectiveSummaryGroup")},
+			{Key: itemKey, Value: Group.Title},
+			{Key: votesKey, Value: strconv.Itoa(Group.VoteCount)},
+		})
+	}
+	if len(Rows) == 0 {
+		Intros = append(Intros, translate(locale, "retrospectiveSummaryNoItems"))
+	}
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
+		hermes.Body{
+			Name:       UserName,
+			Intros:     Intros,
+			Dictionary: Actions,
+			Table: hermes.Table{
+				Data: Rows,
+				Columns: hermes.Columns{
+					CustomWidth: map[string]string{
+						columnKey: "25%",
+						votesKey:  "15%",
+					},
+					CustomAlignment: map[string]string{
+						votesKey: "right",
+					},
+				},
+			},
+			Actions: []hermes.Action{
+				{
+					Instructions: translate(locale, "retrospectiveSummaryInstructions"),
+					Button: hermes.Button{
+						Text: translate(locale, "retrospectiveSummaryButton"),
+						Link: m.config.AppURL + "retrospective/" + Retrospective.RetrospectiveID,
+					},
+				},
+				m.unsubscribeAction(locale, UnsubscribeToken, "retroSummary"),
+			},
+			Outros: []string{
+				translate(locale, "retrospectiveSummaryOutro"),
+			},
+		},
+	)
+	if err != nil {
+		logging.Error("Error Generating Retrospective Summary Email HTML", "error", err)
+		return err
+	}
+
+	sendErr := m.send(&Message{
+		To:              mail.Address{Name: UserName, Address: UserEmail},
+		Subject:         translate(locale, "retrospectiveSummarySubject", Retrospective.RetrospectiveName),
+		Body:            htmlBody,
+		Text:            textBody,
+		ListUnsubscribe: m.unsubscribeURL(UnsubscribeToken, "retroSummary"),
+	})
+	if sendErr != nil {
+		logging.Error("Error sending Retrospective Summary Email", "error", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// summaryItem is a top level retrospective item with the votes of the items nested under it
+type summaryItem struct {
+	Content   string
+	VoteCount int
+}
+
+// topVotedItems returns up to limit top level items with the most votes, ties keep the board order
+func topVotedItems(Items []*database.RetrospectiveItem, limit int) []*summaryItem {
+	nestedVotes := make(map[string]int)
+	for _, item := range Items {
+		if item.ParentID != "" {
+			nestedVotes[item.ParentID] = nestedVotes[item.ParentID] + len(item.Votes)
+		}
+	}
+
+	top := make([]*summaryItem, 0)
+	for _, item := range Items {
+		if item.ParentID == "" {
+			top = append(top, &summaryItem{
+				Content:   item.Content,
+				VoteCount: len(item.Votes) + nestedVotes[item.ID],
+			})
+		}
+	}
+
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].VoteCount > top[j].VoteCount
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top
+}
@@ -0,0 +1,96 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+)
+
+// smtpTransport delivers emails through the configured smtp server
+type smtpTransport struct {
+	address string
+	host    string
+	secure  bool
+	tls     *tls.Config
+	auth    smtp.Auth
+}
+
+func newSMTPTransport(c *Config) *smtpTransport {
+	return &smtpTransport{
+		address: net.JoinHostPort(c.smtpHost, c.smtpPort),
+		host:    c.smtpHost,
+		secure:  c.smtpSecure,
+		tls: &tls.Config{
+			InsecureSkipVerify: !c.smtpSecure,
+			ServerName:         c.smtpHost,
+		},
+		auth: smtp.PlainAuth(c.smtpIdentity, c.smtpUser, c.smtpPass, c.smtpHost),
+	}
+}
+
+// Send dials the smtp server and delivers the email, giving up when ctx is done
+func (t *smtpTransport) Send(ctx context.Context, msg *Message) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	c.StartTLS(t.tls)
+
+	// Auth
+	if t.secure {
+		if err = c.Auth(t.auth); err != nil {
+			return err
+		}
+	}
+
+	// To && From
+	if err = c.Mail(msg.From.Address); err != nil {
+		return err
+	}
+
+	if err = c.Rcpt(msg.To.Address); err != nil {
+		return err
+	}
+
+	// Data
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Ping checks the smtp server is accepting connections
+func (t *smtpTransport) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,161 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// Message is an email ready to be delivered by a Transport
+type Message struct {
+	// outbox id, empty when the email was not queued
+	ID      string
+	From    mail.Address
+	To      mail.Address
+	Subject string
+	// html body
+	Body string
+	// plain text alternative of the body, the email is html only when empty
+	Text string
+	// one-click unsubscribe url (RFC 8058) of notification emails
+	ListUnsubscribe string
+}
+
+// Bytes formats the message as it is sent over the wire, a multipart/alternative
+// of the plain text and html bodies so clients pick the richest one they can display
+func (msg *Message) Bytes() []byte {
+	var b bytes.Buffer
+
+	headers := [][2]string{
+		{"From", msg.From.String()},
+		{"To", msg.To.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+	}
+	if msg.ListUnsubscribe != "" {
+		headers = append(headers,
+			[2]string{"List-Unsubscribe", "<" + msg.ListUnsubscribe + ">"},
+			[2]string{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+		)
+	}
+	for _, h := range headers {
+		b.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+
+	if msg.Text == "" {
+		b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(&b, msg.Body)
+		return b.Bytes()
+	}
+
+	mw := multipart.NewWriter(&b)
+	b.WriteString("Content-Type: multipart/alternative; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	// parts are ordered least to most preferred
+	for _, part := range [][2]string{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.Body},
+	} {
+		w, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part[0]},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(w, part[1])
+	}
+	mw.Close()
+
+	return b.Bytes()
+}
+
+// writeQuotedPrintable writes the body quoted-printable encoded, keeping lines within the smtp limits
+func writeQuotedPrintable(w io.Writer, body string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+// Transport delivers emails, selected with email.transport
+type Transport interface {
+	Send(ctx context.Context, msg *Message) error
+	// Ping checks the transport is able to deliver
+	Ping(ctx context.Context) error
+}
+
+// newTransport creates the configured email transport
+func newTransport(c *Config) (Transport, error) {
+	switch c.transport {
+	case "smtp", "":
+		return newSMTPTransport(c), nil
+	case "file":
+		return &fileTransport{dir: c.fileDir}, nil
+	case "log":
+		return &logTransport{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported email.transport %q", c.transport)
+}
+
+// fileTransport delivers emails to a maildir for development, each email is a file in dir/new
+type fileTransport struct {
+	dir string
+}
+
+// Send writes the email to the maildir tmp directory, then moves it into new so readers never see partial emails
+func (t *fileTransport) Send(ctx context.Context, msg *Message) error {
+	if err := t.Ping(ctx); err != nil {
+		return err
+	}
+
+	id := msg.ID
+	if id == "" {
+		id = "direct"
+	}
+	name := fmt.Sprintf("%d.%s.wakita", time.Now().UnixNano(), id)
+
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := ioutil.WriteFile(tmp, msg.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// Ping creates the maildir directories
+func (t *fileTransport) Ping(ctx context.Context) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logTransport only logs emails, nothing is delivered
+type logTransport struct{}
+
+// Send logs the email recipient and subject
+func (t *logTransport) Send(ctx context.Context, msg *Message) error {
+	logging.Info("email", "id", msg.ID, "to", msg.To.Address, "subject", msg.Subject)
+
+	return nil
+}
+
+// Ping always succeeds
+func (t *logTransport) Ping(ctx context.Context) error {
+	return nil
+}
@@ -1,51 +1,50 @@
 package email
 
 import (
-	"log"
+	"context"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/matcornic/hermes/v2"
 )
 
 // SendWelcome sends the welcome email to new registered user
 func (m *Email) SendWelcome(UserName string, UserEmail string, VerifyID string) error {
-	emailBody, err := m.generateBody(
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
 		hermes.Body{
 			Name: UserName,
 			Intros: []string{
-				"Welcome to Wakita.",
+				translate(locale, "welcomeIntro"),
 			},
 			Actions: []hermes.Action{
 				{
-					Instructions: "Please validate your email, the following link will expire in 24 hours.",
+					Instructions: translate(locale, "welcomeInstructions"),
 					Button: hermes.Button{
 						Color: "#22BC66",
-						Text:  "Verify Account",
+						Text:  translate(locale, "welcomeButton"),
 						Link:  m.config.AppURL + "verify-account/" + VerifyID,
 					},
 				},
-				{
-					Instructions: "Need help, or have questions? Visit our Github page",
-					Button: hermes.Button{
-						Text: "Github Repo",
-						Link: "https://github.com/StevenWeathers/wakita-retro-tool/",
-					},
-				},
+				m.helpAction(locale),
 			},
 		},
 	)
 	if err != nil {
-		log.Println("Error Generating Welcome Email HTML: ", err)
+		logging.Error("Error Generating Welcome Email HTML", "error", err)
 		return err
 	}
 
 	sendErr := m.Send(
 		UserName,
 		UserEmail,
-		"Welcome to Wakita!",
-		emailBody,
+		translate(locale, "welcomeSubject"),
+		htmlBody,
+		textBody,
 	)
 	if sendErr != nil {
-		log.Println("Error sending Welcome Email: ", sendErr)
+		logging.Error("Error sending Welcome Email", "error", sendErr)
 		return sendErr
 	}
 
@@ -54,43 +53,41 @@ func (m *Email) SendWelcome(UserName string, UserEmail string, VerifyID string)
 
 // SendForgotPassword Sends a Forgot Password reset email to user
 func (m *Email) SendForgotPassword(UserName string, UserEmail string, ResetID string) error {
-	emailBody, err := m.generateBody(
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
 		hermes.Body{
 			Name: UserName,
 			Intros: []string{
-				"It seems you've forgot your Wakita password.",
+				translate(locale, "forgotPasswordIntro"),
 			},
 			Actions: []hermes.Action{
 				{
-					Instructions: "Reset your password now, the following link will expire within an hour of the original request.",
+					Instructions: translate(locale, "forgotPasswordInstructions"),
 					Button: hermes.Button{
-						Text: "Reset Password",
+						Text: translate(locale, "forgotPasswordButton"),
 						Link: m.config.AppURL + "reset-password/" + ResetID,
 					},
 				},
-				{
-					Instructions: "Need help, or have questions? Visit our Github page",
-					Button: hermes.Button{
-						Text: "Github Repo",
-						Link: "https://github.com/StevenWeathers/wakita-retro-tool/",
-					},
-				},
+				m.helpAction(locale),
 			},
 		},
 	)
 	if err != nil {
-		log.Println("Error Generating Forgot Password Email HTML: ", err)
+		logging.Error("Error Generating Forgot Password Email HTML", "error", err)
 		return err
 	}
 
 	sendErr := m.Send(
 		UserName,
 		UserEmail,
-		"Forgot your Wakita password?",
-		emailBody,
+		translate(locale, "forgotPasswordSubject"),
+		htmlBody,
+		textBody,
 	)
 	if sendErr != nil {
-		log.Println("Error sending Forgot Password Email: ", sendErr)
+		logging.Error("Error sending Forgot Password Email", "error", sendErr)
 		return sendErr
 	}
 
@@ -99,36 +96,34 @@ func (m *Email) SendForgotPassword(UserName string, UserEmail string, ResetID st
 
 // SendPasswordReset Sends a Reset Password confirmation email to user
 func (m *Email) SendPasswordReset(UserName string, UserEmail string) error {
-	emailBody, err := m.generateBody(
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
 		hermes.Body{
 			Name: UserName,
 			Intros: []string{
-				"Your Wakita password was successfully reset.",
+				translate(locale, "passwordResetIntro"),
 			},
 			Actions: []hermes.Action{
-				{
-					Instructions: "Need help, or have questions? Visit our Github page",
-					Button: hermes.Button{
-						Text: "Github Repo",
-						Link: "https://github.com/StevenWeathers/wakita-retro-tool/",
-					},
-				},
+				m.helpAction(locale),
 			},
 		},
 	)
 	if err != nil {
-		log.Println("Error Generating Reset Password Email HTML: ", err)
+		logging.Error("Error Generating Reset Password Email HTML", "error", err)
 		return err
 	}
 
 	sendErr := m.Send(
 		UserName,
 		UserEmail,
-		"Your Wakita password was successfully reset.",
-		emailBody,
+		translate(locale, "passwordResetSubject"),
+		htmlBody,
+		textBody,
 	)
 	if sendErr != nil {
-		log.Println("Error sending Reset Password Email: ", sendErr)
+		logging.Error("Error sending Reset Password Email", "error", sendErr)
 		return sendErr
 	}
 
@@ -137,38 +132,47 @@ func (m *Email) SendPasswordReset(UserName string, UserEmail string) error {
 
 // SendPasswordUpdate Sends an Update Password confirmation email to user
 func (m *Email) SendPasswordUpdate(UserName string, UserEmail string) error {
-	emailBody, err := m.generateBody(
+	locale := m.recipientLocale(context.Background(), UserEmail)
+
+	htmlBody, textBody, err := m.generateBody(
+		locale,
 		hermes.Body{
 			Name: UserName,
 			Intros: []string{
-				"Your Wakita password was successfully updated.",
+				translate(locale, "passwordUpdateIntro"),
 			},
 			Actions: []hermes.Action{
-				{
-					Instructions: "Need help, or have questions? Visit our Github page",
-					Button: hermes.Button{
-						Text: "Github Repo",
-						Link: "https://github.com/StevenWeathers/wakita-retro-tool/",
-					},
-				},
+				m.helpAction(locale),
 			},
 		},
 	)
 	if err != nil {
-		log.Println("Error Generating Update Password Email HTML: ", err)
+		logging.Error("Error Generating Update Password Email HTML", "error", err)
 		return err
 	}
 
 	sendErr := m.Send(
 		UserName,
 		UserEmail,
-		"Your Wakita password was successfully updated.",
-		emailBody,
+		translate(locale, "passwordUpdateSubject"),
+		htmlBody,
+		textBody,
 	)
 	if sendErr != nil {
-		log.Println("Error sending Update Password Email: ", sendErr)
+		logging.Error("Error sending Update Password Email", "error", sendErr)
 		return sendErr
 	}
 
 	return nil
 }
+
+// helpAction is the link to the Github repo closing the account emails
+func (m *Email) helpAction(locale string) hermes.Action {
+	return hermes.Action{
+		Instructions: translate(locale, "helpInstructions"),
+		Button: hermes.Button{
+			Text: translate(locale, "helpButton"),
+			Link: "https://github.com/StevenWeathers/wakita-retro-tool/",
+		},
+	}
+}
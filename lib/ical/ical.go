@@ -0,0 +1,231 @@
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateFormat      = "20060102"
+	localTimeFormat = "20060102T150405"
+	utcTimeFormat   = "20060102T150405Z"
+	// content lines longer than this many octets are folded
+	maxLineLength = 75
+)
+
+// Calendar is an iCalendar (RFC 5545) feed of events
+type Calendar struct {
+	Name string
+	// Location timed events are written in along with its VTIMEZONE, UTC when nil
+	Location *time.Location
+	Events   []*Event
+}
+
+// Event is a calendar event, AllDay events only use the dates of Start and End (exclusive)
+type Event struct {
+	// UID must stay the same across feed refreshes so calendar clients update the event instead of duplicating it
+	UID          string
+	Summary      string
+	Description  string
+	URL          string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	LastModified time.Time
+}
+
+// Bytes renders the calendar, Now is the DTSTAMP of its events
+func (c *Calendar) Bytes(Now time.Time) []byte {
+	w := &writer{}
+
+	tz := c.Location
+	if tz == time.UTC {
+		tz = nil
+	}
+
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//Wakita//Retrospectives//EN")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.line("X-WR-CALNAME:" + escapeText(c.Name))
+	w.line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	w.line("X-PUBLISHED-TTL:PT1H")
+	if tz != nil {
+		w.line("X-WR-TIMEZONE:" + tz.String())
+		c.writeTimezone(w, tz)
+	}
+
+	for _, e := range c.Events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + escapeText(e.UID))
+		w.line("DTSTAMP:" + Now.UTC().Format(utcTimeFormat))
+		if e.AllDay {
+			w.line("DTSTART;VALUE=DATE:" + e.Start.Format(dateFormat))
+			w.line("DTEND;VALUE=DATE:" + e.End.Format(dateFormat))
+		} else {
+			w.line("DTSTART" + formatTime(e.Start, tz))
+			w.line("DTEND" + formatTime(e.End, tz))
+		}
+		w.line("SUMMARY:" + escapeText(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escapeText(e.Description))
+		}
+		if e.URL != "" {
+			w.line("URL:" + e.URL)
+		}
+		if !e.LastModified.IsZero() {
+			w.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(utcTimeFormat))
+		}
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+
+	return w.buf.Bytes()
+}
+
+// formatTime formats a DTSTART or DTEND value (including the ':') as local time in tz, or UTC when tz is nil
+func formatTime(t time.Time, tz *time.Location) string {
+	if tz == nil {
+		return ":" + t.UTC().Format(utcTimeFormat)
+	}
+
+	return ";TZID=" + tz.String() + ":" + t.In(tz).Format(localTimeFormat)
+}
+
+// writeTimezone writes the VTIMEZONE of tz, with an observance for each of its offset changes
+// from a year before the earliest timed event to a year after the latest
+func (c *Calendar) writeTimezone(w *writer, tz *time.Location) {
+	var from, to time.Time
+	for _, e := range c.Events {
+		if e.AllDay {
+			continue
+		}
+		if from.IsZero() || e.Start.Before(from) {
+			from = e.Start
+		}
+		if to.IsZero() || e.End.After(to) {
+			to = e.End
+		}
+	}
+	if from.IsZero() {
+		from = time.Now()
+		to = from
+	}
+
+	start := time.Date(from.Year()-1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year()+2, time.January, 1, 0, 0, 0, 0, time.UTC)
+	observances := transitions(tz, start, end)
+
+	// the standard offset is the smallest in the window, larger offsets are daylight saving time
+	standard := observances[0].offsetTo
+	for _, o := range observances {
+		if o.offsetTo < standard {
+			standard = o.offsetTo
+		}
+	}
+
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + tz.String())
+	for _, o := range observances {
+		kind := "STANDARD"
+		if o.offsetTo > standard {
+			kind = "DAYLIGHT"
+		}
+
+		w.line("BEGIN:" + kind)
+		// observance onsets are in the local time before the change
+		w.line("DTSTART:" + o.at.Add(time.Duration(o.offsetFrom)*time.Second).UTC().Format(localTimeFormat))
+		w.line("TZOFFSETFROM:" + formatOffset(o.offsetFrom))
+		w.line("TZOFFSETTO:" + formatOffset(o.offsetTo))
+		if o.name != "" {
+			w.line("TZNAME:" + escapeText(o.name))
+		}
+		w.line("END:" + kind)
+	}
+	w.line("END:VTIMEZONE")
+}
+
+// observance is a change of a time zones utc offset
+type observance struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+	name       string
+}
+
+// transitions finds the offset changes of tz between start and end, the first observance is the offset at start
+func transitions(tz *time.Location, start time.Time, end time.Time) []observance {
+	name, offset := start.In(tz).Zone()
+	observances := []observance{{at: start, offsetFrom: offset, offsetTo: offset, name: name}}
+
+	for t := start; t.Before(end); {
+		next := t.Add(24 * time.Hour)
+		if n, o := next.In(tz).Zone(); o == offset && n == name {
+			t = next
+			continue
+		}
+
+		// narrow the change down to the second
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if n, o := mid.In(tz).Zone(); o == offset && n == name {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		n, o := hi.In(tz).Zone()
+		observances = append(observances, observance{at: hi, offsetFrom: offset, offsetTo: o, name: n})
+		name, offset = n, o
+		t = hi
+	}
+
+	return observances
+}
+
+// formatOffset formats a utc offset in seconds as +HHMM
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeText escapes a TEXT property value
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// writer writes CRLF terminated content lines, folding long lines without splitting utf-8 characters
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) line(s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// continuation lines start with a space which counts towards their length
+		limit = maxLineLength - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
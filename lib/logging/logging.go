@@ -0,0 +1,259 @@
+// Package logging provides structured leveled logging in text or JSON format,
+// with loggers carrying request scoped fields (such as the request id) through context.Context
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// log levels, entries below the loggers level are discarded
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// ParseLevel converts a level name to a Level, defaulting to info
+func ParseLevel(name string) Level {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level
+		}
+	}
+
+	return LevelInfo
+}
+
+// redacted replaces the value of any field whose key looks like it holds a secret
+const redacted = "[REDACTED]"
+
+// secretKeys are the key fragments of fields that are never logged
+var secretKeys = []string{"pass", "secret", "token", "apikey", "api_key", "hashkey", "cookie", "authorization"}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Logger writes leveled log entries with a set of key value fields
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	json   bool
+	fields []interface{}
+}
+
+// New creates a Logger writing entries at or above level in the format ("json" or "text")
+func New(out io.Writer, level string, format string) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  ParseLevel(level),
+		json:   strings.EqualFold(format, "json"),
+		fields: make([]interface{}, 0),
+	}
+}
+
+// With returns a Logger that adds the key value pairs to every entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+
+	return &Logger{
+		mu:     l.mu,
+		out:    l.out,
+		level:  l.level,
+		json:   l.json,
+		fields: fields,
+	}
+}
+
+// Debug logs a debug entry
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs an info entry
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn logs a warning entry
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error logs an error entry
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// Fatal logs an error entry then exits
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	keys := []string{"time", "level", "msg"}
+	values := []interface{}{time.Now().UTC().Format(time.RFC3339Nano), levelNames[level], msg}
+
+	fields := append(append(make([]interface{}, 0, len(l.fields)+len(keyvals)), l.fields...), keyvals...)
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if isSecretKey(key) {
+			value = redacted
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	var b strings.Builder
+	if l.json {
+		b.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			encodedKey, _ := json.Marshal(key)
+			encodedValue, err := json.Marshal(values[i])
+			if err != nil {
+				encodedValue, _ = json.Marshal(fmt.Sprint(values[i]))
+			}
+			b.Write(encodedKey)
+			b.WriteString(":")
+			b.Write(encodedValue)
+		}
+		b.WriteString("}\n")
+	} else {
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			value := fmt.Sprint(values[i])
+			if strings.ContainsAny(value, " \"=\t\n") || value == "" {
+				value = fmt.Sprintf("%q", value)
+			}
+			b.WriteString(key + "=" + value)
+		}
+		b.WriteString("\n")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, b.String())
+}
+
+var defaultLogger = New(os.Stderr, "info", "text")
+
+// SetDefault replaces the default Logger used by the package level functions
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// Default gets the default Logger
+func Default() *Logger {
+	return defaultLogger
+}
+
+// Debug logs a debug entry with the default Logger
+func Debug(msg string, keyvals ...interface{}) {
+	defaultLogger.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs an info entry with the default Logger
+func Info(msg string, keyvals ...interface{}) {
+	defaultLogger.log(LevelInfo, msg, keyvals)
+}
+
+// Warn logs a warning entry with the default Logger
+func Warn(msg string, keyvals ...interface{}) {
+	defaultLogger.log(LevelWarn, msg, keyvals)
+}
+
+// Error logs an error entry with the default Logger
+func Error(msg string, keyvals ...interface{}) {
+	defaultLogger.log(LevelError, msg, keyvals)
+}
+
+// Fatal logs an error entry with the default Logger then exits
+func Fatal(msg string, keyvals ...interface{}) {
+	defaultLogger.Fatal(msg, keyvals...)
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "requestId"
+
+// NewRequestID generates a random request id
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, RequestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, RequestID)
+}
+
+// RequestID gets the request id carried by ctx, if any
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	RequestID, _ := ctx.Value(requestIDKey).(string)
+
+	return RequestID
+}
+
+// FromContext gets the default Logger with the request id carried by ctx
+func FromContext(ctx context.Context) *Logger {
+	if RequestID := RequestID(ctx); RequestID != "" {
+		return defaultLogger.With("request_id", RequestID)
+	}
+
+	return defaultLogger
+}
@@ -0,0 +1,111 @@
+// Package outbound makes requests to user configured urls, such as team chat webhooks and issue tracker apis,
+// without letting them reach the servers own network
+package outbound
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned for urls and connections to loopback, private, link-local and other non public addresses
+var ErrBlockedAddress = errors.New("address is not a public address")
+
+// blockedNetworks are the non public ranges not covered by the net.IP checks in Blocked
+var blockedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // this network
+		"10.0.0.0/8",    // private
+		"100.64.0.0/10", // carrier grade nat
+		"172.16.0.0/12", // private
+		"192.168.0.0/16",
+		"198.18.0.0/15", // benchmarking
+		"fc00::/7",      // unique local
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// Blocked checks whether ip is an address outbound requests must not connect to
+func Blocked(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateURL checks a user configured url is an https url, with a host that isn't a blocked address,
+// host names are checked again by the Client on every connection since they can resolve to other addresses later
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return errors.New("url must be an https url")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrBlockedAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && Blocked(ip) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// NewClient creates an http client for user configured urls that gives up on requests not answered within timeout,
+// connections (including those of redirects) to blocked addresses fail with ErrBlockedAddress,
+// proxies from the environment aren't used since the proxy would make the connection instead
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   controlDial,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return errors.New("redirected to a url that isn't https")
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// controlDial rejects connections to blocked addresses once the host name is resolved, right before connecting
+func controlDial(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || Blocked(ip) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlocked(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"0.0.0.0", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"100.64.0.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"224.0.0.1", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, tt := range tests {
+		if got := Blocked(net.ParseIP(tt.ip)); got != tt.blocked {
+			t.Errorf("Blocked(%s) = %v, want %v", tt.ip, got, tt.blocked)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.slack.com/services/T000/B000/XXXX", true},
+		{"https://example.com:8443/webhook", true},
+		{"http://hooks.slack.com/services/T000/B000/XXXX", false},
+		{"ftp://example.com", false},
+		{"https://", false},
+		{"not a url", false},
+		{"https://localhost/hook", false},
+		{"https://api.localhost/hook", false},
+		{"https://127.0.0.1/hook", false},
+		{"https://[::1]/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://192.168.0.10/hook", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("ValidateURL(%q) = %v, want valid %v", tt.url, err, tt.valid)
+		}
+	}
+}
+
+func TestClientBlocksLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	_, err := NewClient(time.Second).Do(req)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("NewClient().Do(%s) = %v, want ErrBlockedAddress", srv.URL, err)
+	}
+}
@@ -0,0 +1,210 @@
+package tracker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// jira creates issues with the Jira REST api v2, webhooks are authenticated by a secret query parameter
+type jira struct {
+	api     *apiClient
+	project string
+	secret  string
+}
+
+func (j *jira) CreateTicket(ctx context.Context, Title string, Description string) (*Ticket, error) {
+	var body = map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": j.project},
+			"summary":     Title,
+			"description": Description,
+			"issuetype":   map[string]string{"name": "Task"},
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := j.api.do(ctx, http.MethodPost, "/rest/api/2/issue", body, &created); err != nil {
+		return nil, err
+	}
+
+	return &Ticket{Key: created.Key, URL: j.api.baseURL + "/browse/" + created.Key}, nil
+}
+
+// jiraIssue is the part of a Jira issue needed to tell whether it is done and which project it belongs to
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+		Status struct {
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+	} `json:"fields"`
+}
+
+func (i *jiraIssue) done() bool {
+	return i.Fields.Status.StatusCategory.Key == "done"
+}
+
+func (j *jira) TicketClosed(ctx context.Context, Key string) (bool, error) {
+	var issue jiraIssue
+	if err := j.api.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(Key)+"?fields=status", nil, &issue); err != nil {
+		return false, err
+	}
+
+	return issue.done(), nil
+}
+
+func (j *jira) ParseWebhook(r *http.Request, Body []byte) (string, bool, error) {
+	if !secretEqual(r.URL.Query().Get("secret"), j.secret) {
+		return "", false, ErrUnauthorized
+	}
+
+	var event struct {
+		Issue jiraIssue `json:"issue"`
+	}
+	if err := json.Unmarshal(Body, &event); err != nil {
+		return "", false, err
+	}
+	if !strings.EqualFold(event.Issue.Fields.Project.Key, j.project) {
+		return "", false, ErrOtherProject
+	}
+
+	return event.Issue.Key, event.Issue.done(), nil
+}
+
+// github creates issues with the GitHub REST api, webhooks are authenticated by their sha256 hmac signature
+type github struct {
+	api *apiClient
+	// owner/repository
+	project string
+	secret  string
+}
+
+// githubIssue is the part of a GitHub issue needed to link and sync it
+type githubIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+}
+
+func (g *github) CreateTicket(ctx context.Context, Title string, Description string) (*Ticket, error) {
+	var created githubIssue
+	if err := g.api.do(ctx, http.MethodPost, "/repos/"+g.project+"/issues", map[string]string{
+		"title": Title,
+		"body":  Description,
+	}, &created); err != nil {
+		return nil, err
+	}
+
+	return &Ticket{Key: strconv.Itoa(created.Number), URL: created.HTMLURL}, nil
+}
+
+func (g *github) TicketClosed(ctx context.Context, Key string) (bool, error) {
+	var issue githubIssue
+	if err := g.api.do(ctx, http.MethodGet, "/repos/"+g.project+"/issues/"+url.PathEscape(Key), nil, &issue); err != nil {
+		return false, err
+	}
+
+	return issue.State == "closed", nil
+}
+
+func (g *github) ParseWebhook(r *http.Request, Body []byte) (string, bool, error) {
+	mac := hmac.New(sha256.New, []byte(g.secret))
+	mac.Write(Body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if g.secret == "" || !hmac.Equal([]byte(r.Header.Get("X-Hub-Signature-256")), []byte(signature)) {
+		return "", false, ErrUnauthorized
+	}
+
+	var event struct {
+		Issue      githubIssue `json:"issue"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(Body, &event); err != nil {
+		return "", false, err
+	}
+	// the webhook secret can be shared by the hooks of several repositories
+	if !strings.EqualFold(event.Repository.FullName, strings.Trim(g.project, "/")) {
+		return "", false, ErrOtherProject
+	}
+
+	return strconv.Itoa(event.Issue.Number), event.Issue.State == "closed", nil
+}
+
+// gitlab creates issues with the GitLab REST api v4, webhooks are authenticated by their secret token header
+type gitlab struct {
+	api *apiClient
+	// project id or namespace/project path
+	project string
+	secret  string
+}
+
+// gitlabIssue is the part of a GitLab issue needed to link and sync it
+type gitlabIssue struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+	State  string `json:"state"`
+}
+
+func (g *gitlab) projectPath() string {
+	return "/api/v4/projects/" + url.PathEscape(strings.Trim(g.project, "/"))
+}
+
+func (g *gitlab) CreateTicket(ctx context.Context, Title string, Description string) (*Ticket, error) {
+	var created gitlabIssue
+	if err := g.api.do(ctx, http.MethodPost, g.projectPath()+"/issues", map[string]string{
+		"title":       Title,
+		"description": Description,
+	}, &created); err != nil {
+		return nil, err
+	}
+
+	return &Ticket{Key: strconv.Itoa(created.IID), URL: created.WebURL}, nil
+}
+
+func (g *gitlab) TicketClosed(ctx context.Context, Key string) (bool, error) {
+	var issue gitlabIssue
+	if err := g.api.do(ctx, http.MethodGet, g.projectPath()+"/issues/"+url.PathEscape(Key), nil, &issue); err != nil {
+		return false, err
+	}
+
+	return issue.State == "closed", nil
+}
+
+func (g *gitlab) ParseWebhook(r *http.Request, Body []byte) (string, bool, error) {
+	if !secretEqual(r.Header.Get("X-Gitlab-Token"), g.secret) {
+		return "", false, ErrUnauthorized
+	}
+
+	var event struct {
+		ObjectAttributes gitlabIssue `json:"object_attributes"`
+		Project          struct {
+			ID                int    `json:"id"`
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(Body, &event); err != nil {
+		return "", false, err
+	}
+	// the tracker project is either the project id or its path, group hooks send the events of every project in the group
+	project := strings.Trim(g.project, "/")
+	if project != strconv.Itoa(event.Project.ID) && !strings.EqualFold(project, event.Project.PathWithNamespace) {
+		return "", false, ErrOtherProject
+	}
+
+	return strconv.Itoa(event.ObjectAttributes.IID), event.ObjectAttributes.State == "closed", nil
+}
@@ -0,0 +1,88 @@
+package tracker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHubParseWebhookProject(t *testing.T) {
+	g := &github{project: "asgard/bifrost", secret: "secret"}
+	tests := []struct {
+		body    string
+		wantErr error
+	}{
+		{`{"issue":{"number":7,"state":"closed"},"repository":{"full_name":"asgard/bifrost"}}`, nil},
+		{`{"issue":{"number":7,"state":"closed"},"repository":{"full_name":"Asgard/Bifrost"}}`, nil},
+		{`{"issue":{"number":7,"state":"closed"},"repository":{"full_name":"asgard/other"}}`, ErrOtherProject},
+		{`{"issue":{"number":7,"state":"closed"}}`, ErrOtherProject},
+	}
+
+	for _, tt := range tests {
+		mac := hmac.New(sha256.New, []byte(g.secret))
+		mac.Write([]byte(tt.body))
+		r := httptest.NewRequest("POST", "/api/tracker/id/webhook", nil)
+		r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+		Key, Closed, err := g.ParseWebhook(r, []byte(tt.body))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseWebhook(%s) error = %v, want %v", tt.body, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (Key != "7" || !Closed) {
+			t.Errorf("ParseWebhook(%s) = %q, %v, want 7 closed", tt.body, Key, Closed)
+		}
+	}
+}
+
+func TestGitLabParseWebhookProject(t *testing.T) {
+	body := `{"object_attributes":{"iid":3,"state":"closed"},"project":{"id":42,"path_with_namespace":"asgard/bifrost"}}`
+	tests := []struct {
+		project string
+		wantErr error
+	}{
+		{"asgard/bifrost", nil},
+		{"42", nil},
+		{"asgard/other", ErrOtherProject},
+		{"43", ErrOtherProject},
+	}
+
+	for _, tt := range tests {
+		g := &gitlab{project: tt.project, secret: "secret"}
+		r := httptest.NewRequest("POST", "/api/tracker/id/webhook", nil)
+		r.Header.Set("X-Gitlab-Token", "secret")
+
+		Key, Closed, err := g.ParseWebhook(r, []byte(body))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseWebhook() for project %s error = %v, want %v", tt.project, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (Key != "3" || !Closed) {
+			t.Errorf("ParseWebhook() for project %s = %q, %v, want 3 closed", tt.project, Key, Closed)
+		}
+	}
+}
+
+func TestJiraParseWebhookProject(t *testing.T) {
+	j := &jira{project: "ASG", secret: "secret"}
+	tests := []struct {
+		body    string
+		wantErr error
+	}{
+		{`{"issue":{"key":"ASG-1","fields":{"project":{"key":"ASG"},"status":{"statusCategory":{"key":"done"}}}}}`, nil},
+		{`{"issue":{"key":"MID-1","fields":{"project":{"key":"MID"},"status":{"statusCategory":{"key":"done"}}}}}`, ErrOtherProject},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/tracker/id/webhook?secret=secret", nil)
+
+		Key, Closed, err := j.ParseWebhook(r, []byte(tt.body))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseWebhook(%s) error = %v, want %v", tt.body, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (Key != "ASG-1" || !Closed) {
+			t.Errorf("ParseWebhook(%s) = %q, %v, want ASG-1 closed", tt.body, Key, Closed)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/outbound"
+)
+
+// ErrUnauthorized is returned for inbound webhooks that don't carry the trackers webhook secret
+var ErrUnauthorized = errors.New("webhook secret does not match")
+
+// ErrOtherProject is returned for inbound webhook events about an issue of another project than the trackers
+var ErrOtherProject = errors.New("webhook event is for another project")
+
+// Ticket is an issue created in a tracker
+type Ticket struct {
+	Key string
+	URL string
+}
+
+// Provider creates tickets in an issue tracker and reports when they are closed
+type Provider interface {
+	// CreateTicket creates a ticket in the trackers project
+	CreateTicket(ctx context.Context, Title string, Description string) (*Ticket, error)
+	// TicketClosed checks whether the ticket has been closed (or resolved)
+	TicketClosed(ctx context.Context, Key string) (bool, error)
+	// ParseWebhook authenticates an inbound webhook event with the trackers webhook secret,
+	// returning the ticket it is about and whether the ticket is now closed, or ErrOtherProject
+	// when the event is about an issue of another project
+	ParseWebhook(r *http.Request, Body []byte) (Key string, Closed bool, err error)
+}
+
+// Tracker creates the Provider of a team tracker
+type Tracker struct {
+	client *http.Client
+}
+
+// New creates a new instance of Tracker, tracker api requests not answered within timeout fail
+// and trackers can't reach private or loopback addresses
+func New(timeout time.Duration) *Tracker {
+	return &Tracker{
+		client: outbound.NewClient(timeout),
+	}
+}
+
+// Provider gets the Provider of the team tracker
+func (t *Tracker) Provider(Tracker *database.TeamTracker) (Provider, error) {
+	api := &apiClient{
+		client:  t.client,
+		baseURL: strings.TrimRight(Tracker.BaseURL, "/"),
+	}
+
+	switch Tracker.Provider {
+	case database.TrackerProviderJira:
+		api.auth = func(req *http.Request) {
+			req.SetBasicAuth(Tracker.Username, Tracker.Token)
+		}
+		return &jira{api: api, project: Tracker.Project, secret: Tracker.WebhookSecret}, nil
+	case database.TrackerProviderGitHub:
+		if api.baseURL == "" {
+			api.baseURL = "https://api.github.com"
+		}
+		api.auth = func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+Tracker.Token)
+			req.Header.Set("Accept", "application/vnd.github+json")
+		}
+		return &github{api: api, project: Tracker.Project, secret: Tracker.WebhookSecret}, nil
+	case database.TrackerProviderGitLab:
+		if api.baseURL == "" {
+			api.baseURL = "https://gitlab.com"
+		}
+		api.auth = func(req *http.Request) {
+			req.Header.Set("PRIVATE-TOKEN", Tracker.Token)
+		}
+		return &gitlab{api: api, project: Tracker.Project, secret: Tracker.WebhookSecret}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported tracker provider %q", Tracker.Provider)
+}
+
+// apiClient makes authenticated json requests to a trackers api
+type apiClient struct {
+	client  *http.Client
+	baseURL string
+	auth    func(req *http.Request)
+}
+
+// do sends the request with body encoded as json (when not nil) and decodes the json response into result
+func (a *apiClient) do(ctx context.Context, Method string, Path string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, Method, a.baseURL+Path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	a.auth(req)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("tracker responded to %s %s with status %d", Method, Path, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// secretEqual compares webhook secrets in constant time
+func secretEqual(a string, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
+	// the scratch docker image has no zoneinfo, calendar feeds need it for their ?tz= time zone
+	_ "time/tzdata"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/chat"
 	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
 	"github.com/StevenWeathers/wakita-retro-tool/lib/email"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/tracker"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
 	"github.com/spf13/viper"
@@ -17,6 +25,9 @@ import (
 
 //go:embed schema.sql
 var schemaSQL string
+
+//go:embed schema_sqlite.sql
+var sqliteSchemaSQL string
 var embedUseOS bool
 var (
 	version = "dev"
@@ -47,22 +58,39 @@ type ServerConfig struct {
 	AvatarService string
 	// PathPrefix allows the application to be run on a shared domain
 	PathPrefix string
+	// how long to wait for in flight requests to finish when shutting down
+	ShutdownTimeout time.Duration
+	// how often open action items with tickets are checked for closed tickets, 0 disables the sync
+	TrackerSyncInterval time.Duration
+	// how often the active alerts are reloaded to pick up other replicas edits and start and end times, 0 disables it
+	AlertRefreshInterval time.Duration
+	// how long an admins read only "view as user" session lasts
+	ImpersonationTimeout time.Duration
+	// how often the open retrospective connections are checked for retrospectives force closed on other replicas, 0 disables it
+	ClosedArenaCheckInterval time.Duration
 }
 
 type server struct {
 	config   *ServerConfig
 	router   *mux.Router
 	email    *email.Email
+	chat     *chat.Chat
+	tracker  *tracker.Tracker
 	cookie   *securecookie.SecureCookie
 	database *database.Database
+	alerts   *alertCache
+	// set to 1 once shutdown has started, new websocket connections are turned away
+	shuttingDown int32
 }
 
 func main() {
 	embedUseOS = len(os.Args) > 1 && os.Args[1] == "live"
-	log.Println("Wakita version " + version)
 
 	InitConfig()
 
+	logging.SetDefault(logging.New(os.Stderr, viper.GetString("log.level"), viper.GetString("log.format")))
+	logging.Info("Wakita starting", "version", version)
+
 	cookieHashkey := viper.GetString("http.cookie_hashkey")
 	pathPrefix := viper.GetString("http.path_prefix")
 	router := mux.NewRouter()
@@ -73,26 +101,42 @@ func main() {
 
 	s := &server{
 		config: &ServerConfig{
-			ListenPort:         viper.GetString("http.port"),
-			AppDomain:          viper.GetString("http.domain"),
-			AdminEmail:         viper.GetString("admin.email"),
-			FrontendCookieName: viper.GetString("http.frontend_cookie_name"),
-			SecureCookieName:   viper.GetString("http.backend_cookie_name"),
-			SecureCookieFlag:   viper.GetBool("http.secure_cookie"),
-			AnalyticsEnabled:   viper.GetBool("analytics.enabled"),
-			AnalyticsID:        viper.GetString("analytics.id"),
-			Version:            version,
-			AvatarService:      viper.GetString(("config.avatar_service")),
-			PathPrefix:         pathPrefix,
+			ListenPort:               viper.GetString("http.port"),
+			AppDomain:                viper.GetString("http.domain"),
+			AdminEmail:               viper.GetString("admin.email"),
+			FrontendCookieName:       viper.GetString("http.frontend_cookie_name"),
+			SecureCookieName:         viper.GetString("http.backend_cookie_name"),
+			SecureCookieFlag:         viper.GetBool("http.secure_cookie"),
+			AnalyticsEnabled:         viper.GetBool("analytics.enabled"),
+			AnalyticsID:              viper.GetString("analytics.id"),
+			Version:                  version,
+			AvatarService:            viper.GetString(("config.avatar_service")),
+			PathPrefix:               pathPrefix,
+			ShutdownTimeout:          time.Duration(viper.GetInt("http.shutdown_timeout")) * time.Second,
+			TrackerSyncInterval:      time.Duration(viper.GetInt("tracker.sync_interval")) * time.Second,
+			AlertRefreshInterval:     time.Duration(viper.GetInt("alert.refresh_interval")) * time.Second,
+			ImpersonationTimeout:     time.Duration(viper.GetInt("admin.impersonation_timeout")) * time.Minute,
+			ClosedArenaCheckInterval: time.Duration(viper.GetInt("admin.close_check_interval")) * time.Second,
 		},
 		router: router,
 		cookie: securecookie.New([]byte(cookieHashkey), nil),
+		alerts: &alertCache{},
 	}
-	s.email = email.New(s.config.AppDomain, s.config.PathPrefix)
-	s.database = database.New(s.config.AdminEmail, schemaSQL)
+	s.database = database.New(s.config.AdminEmail, schemaSQL, sqliteSchemaSQL)
+	s.email = email.New(s.config.AppDomain, s.config.PathPrefix, s.database)
+	s.chat = chat.New(s.config.AppDomain, s.config.PathPrefix, s.database)
+	s.tracker = tracker.New(time.Duration(viper.GetInt("tracker.timeout")) * time.Second)
+	s.refreshAlerts(context.Background())
 
 	go h.run()
+	go s.runRetrospectiveScheduler()
+	go s.runNotificationScheduler()
+	go s.runTrackerSync()
+	go s.runAlertRefresh()
+	go s.runClosedArenaCheck()
+	go s.email.RunOutbox(context.Background())
 
+	s.router.Use(s.requestLogger)
 	s.routes()
 
 	srv := &http.Server{
@@ -103,7 +147,51 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 	}
 
-	log.Println("Access the WebUI via 127.0.0.1:" + s.config.ListenPort)
+	logging.Info("Access the WebUI via 127.0.0.1:" + s.config.ListenPort)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("http server failed", "error", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	s.shutdown(srv)
+}
+
+// shutdown turns away new websocket connections, closes the open ones (marking their users inactive)
+// so clients reconnect with backoff, then waits for the close frames to be written and in flight http requests,
+// together up to the shutdown timeout
+func (s *server) shutdown(srv *http.Server) {
+	logging.Info("Shutting down, draining connections")
+	atomic.StoreInt32(&s.shuttingDown, 1)
 
-	log.Fatal(srv.ListenAndServe())
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	drained := make(chan []subscription)
+	h.drain <- drained
+	subscriptions := <-drained
+	for _, ss := range subscriptions {
+		// an admin viewing as the user never joined them to the retrospective
+		if ss.readOnly {
+			continue
+		}
+		s.database.RetreatUser(context.Background(), ss.arena, ss.userID)
+	}
+
+	// srv.Shutdown doesn't track hijacked websocket connections, so wait for their close frames to be written
+	for _, ss := range subscriptions {
+		if !ss.conn.waitClosed(ctx) {
+			logging.Warn("shutdown timeout reached before every websocket connection was closed")
+			break
+		}
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logging.Error("error shutting down http server", "error", err)
+	}
 }
@@ -1,14 +1,90 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"log"
+	"errors"
+	"net"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/gorilla/mux"
 )
 
+// requestIDHeaderName is the header a request id is read from and returned in
+const requestIDHeaderName = "X-Request-ID"
+
+// validRequestID limits which incoming request ids are trusted, others are replaced
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// statusRecorder captures the response status code for request logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack allows websocket upgrades through the recorder
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	sr.status = http.StatusSwitchingProtocols
+
+	return hijacker.Hijack()
+}
+
+// secretRouteVars are route variables granting access on their own, such as the calendar feed and unsubscribe tokens,
+// they are masked in the logged request path
+var secretRouteVars = []string{"token"}
+
+// loggedPath is the request path with the values of secret route variables replaced by the variable name
+func loggedPath(r *http.Request) string {
+	path := r.URL.Path
+	vars := mux.Vars(r)
+	for _, name := range secretRouteVars {
+		if value := vars[name]; value != "" {
+			path = strings.Replace(path, value, "{"+name+"}", -1)
+		}
+	}
+
+	return path
+}
+
+// requestLogger middleware assigns the request an id carried in its context (and websocket session)
+// then logs the completed request
+func (s *server) requestLogger(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RequestID := r.Header.Get(requestIDHeaderName)
+		if !validRequestID.MatchString(RequestID) {
+			RequestID = logging.NewRequestID()
+		}
+		w.Header().Set(requestIDHeaderName, RequestID)
+
+		ctx := logging.WithRequestID(r.Context(), RequestID)
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		h.ServeHTTP(sr, r.WithContext(ctx))
+
+		logging.FromContext(ctx).Info("request",
+			"method", r.Method,
+			"path", loggedPath(r),
+			"status", sr.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
+
 // adminOnly middleware checks if the user is an admin, otherwise reject their request
 func (s *server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -18,9 +94,9 @@ func (s *server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
 
 		if apiKey != "" {
 			var apiKeyErr error
-			userID, apiKeyErr = s.database.ValidateAPIKey(apiKey)
+			userID, apiKeyErr = s.database.ValidateAPIKey(r.Context(), apiKey)
 			if apiKeyErr != nil {
-				log.Println("error validating api key : " + apiKeyErr.Error() + "\n")
+				logging.FromContext(r.Context()).Error("error validating api key", "error", apiKeyErr)
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
@@ -33,7 +109,7 @@ func (s *server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
 			}
 		}
 
-		adminErr := s.database.ConfirmAdmin(userID)
+		adminErr := s.database.ConfirmAdmin(r.Context(), userID)
 		if adminErr != nil {
 			w.WriteHeader(http.StatusForbidden)
 			return
@@ -54,9 +130,9 @@ func (s *server) userOnly(h http.HandlerFunc) http.HandlerFunc {
 
 		if apiKey != "" {
 			var apiKeyErr error
-			UserID, apiKeyErr = s.database.ValidateAPIKey(apiKey)
+			UserID, apiKeyErr = s.database.ValidateAPIKey(r.Context(), apiKey)
 			if apiKeyErr != nil {
-				log.Println("error validating api key : " + apiKeyErr.Error() + "\n")
+				logging.FromContext(r.Context()).Error("error validating api key", "error", apiKeyErr)
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
@@ -67,11 +143,29 @@ func (s *server) userOnly(h http.HandlerFunc) http.HandlerFunc {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+
+			// an admin viewing as a user acts as them for read only requests
+			if Impersonation := s.impersonatedUser(w, r, UserID); Impersonation != nil {
+				if r.Method != http.MethodGet {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), contextKeyUserID, Impersonation.UserID)
+
+				h(w, r.WithContext(ctx))
+				return
+			}
 		}
 
-		_, UserErr := s.database.GetUser(UserID)
+		UserErr := s.database.ConfirmUserActive(r.Context(), UserID)
+		if UserErr == database.ErrUserSuspended {
+			s.clearUserCookies(w)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 		if UserErr != nil {
-			log.Println("error finding user : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user", "error", UserErr)
 			s.clearUserCookies(w)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
@@ -83,6 +177,43 @@ func (s *server) userOnly(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// retrospectiveUserOnly validates that the request was made by a user of the retrospective
+func (s *server) retrospectiveUserOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		UserID := r.Context().Value(contextKeyUserID).(string)
+		RetrospectiveID := vars["id"]
+
+		if UserErr := s.database.ConfirmRetrospectiveUser(r.Context(), RetrospectiveID, UserID); UserErr != nil {
+			logging.FromContext(r.Context()).Warn("user is not a user of retrospective", "user_id", UserID, "retrospective_id", RetrospectiveID, "error", UserErr)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// retrospectiveOpenOnly validates that the retrospective hasn't been force closed by an admin,
+// the REST counterpart of closing the retrospectives websocket sessions
+func (s *server) retrospectiveOpenOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		RetrospectiveID := vars["id"]
+
+		if OpenErr := s.database.ConfirmRetrospectiveOpen(r.Context(), RetrospectiveID); OpenErr != nil {
+			if OpenErr == database.ErrRetrospectiveClosed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
 // orgUserOnly validates that the request was made by a valid user of the organization
 func (s *server) orgUserOnly(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -90,9 +221,9 @@ func (s *server) orgUserOnly(h http.HandlerFunc) http.HandlerFunc {
 		UserID := r.Context().Value(contextKeyUserID).(string)
 		OrgID := vars["orgId"]
 
-		Role, UserErr := s.database.OrganizationUserRole(UserID, OrgID)
+		Role, UserErr := s.database.OrganizationUserRole(r.Context(), UserID, OrgID)
 		if UserErr != nil {
-			log.Println("error finding user in organization : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in organization", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -110,14 +241,14 @@ func (s *server) orgAdminOnly(h http.HandlerFunc) http.HandlerFunc {
 		UserID := r.Context().Value(contextKeyUserID).(string)
 		OrgID := vars["orgId"]
 
-		Role, UserErr := s.database.OrganizationUserRole(UserID, OrgID)
+		Role, UserErr := s.database.OrganizationUserRole(r.Context(), UserID, OrgID)
 		if UserErr != nil {
-			log.Println("error finding user in organization : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in organization", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 		if Role != "ADMIN" {
-			log.Println("user is not an ADMIN of organization")
+			logging.FromContext(r.Context()).Warn("user is not an ADMIN of organization", "user_id", UserID, "organization_id", OrgID)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -136,9 +267,9 @@ func (s *server) orgTeamOnly(h http.HandlerFunc) http.HandlerFunc {
 		OrgID := vars["orgId"]
 		TeamID := vars["teamId"]
 
-		OrgRole, TeamRole, UserErr := s.database.OrganizationTeamUserRole(UserID, OrgID, TeamID)
+		OrgRole, TeamRole, UserErr := s.database.OrganizationTeamUserRole(r.Context(), UserID, OrgID, TeamID)
 		if UserErr != nil {
-			log.Println("error finding user in organization : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in organization", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -158,14 +289,14 @@ func (s *server) orgTeamAdminOnly(h http.HandlerFunc) http.HandlerFunc {
 		OrgID := vars["orgId"]
 		TeamID := vars["teamId"]
 
-		OrgRole, TeamRole, UserErr := s.database.OrganizationTeamUserRole(UserID, OrgID, TeamID)
+		OrgRole, TeamRole, UserErr := s.database.OrganizationTeamUserRole(r.Context(), UserID, OrgID, TeamID)
 		if UserErr != nil {
-			log.Println("error finding user in organization : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in organization", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 		if TeamRole != "ADMIN" && OrgRole != "ADMIN" {
-			log.Println("user is not an ADMIN of organization")
+			logging.FromContext(r.Context()).Warn("user is not an ADMIN of organization", "user_id", UserID, "organization_id", OrgID)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -185,9 +316,9 @@ func (s *server) departmentUserOnly(h http.HandlerFunc) http.HandlerFunc {
 		OrgID := vars["orgId"]
 		DepartmentID := vars["departmentId"]
 
-		OrgRole, DepartmentRole, UserErr := s.database.DepartmentUserRole(UserID, OrgID, DepartmentID)
+		OrgRole, DepartmentRole, UserErr := s.database.DepartmentUserRole(r.Context(), UserID, OrgID, DepartmentID)
 		if UserErr != nil {
-			log.Println("error finding user in organization : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in organization", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -207,14 +338,14 @@ func (s *server) departmentAdminOnly(h http.HandlerFunc) http.HandlerFunc {
 		OrgID := vars["orgId"]
 		DepartmentID := vars["departmentId"]
 
-		OrgRole, DepartmentRole, UserErr := s.database.DepartmentUserRole(UserID, OrgID, DepartmentID)
+		OrgRole, DepartmentRole, UserErr := s.database.DepartmentUserRole(r.Context(), UserID, OrgID, DepartmentID)
 		if UserErr != nil {
-			log.Println("error finding user in organization : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in organization", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 		if DepartmentRole != "ADMIN" && OrgRole != "ADMIN" {
-			log.Println("user is not an ADMIN of department or organization")
+			logging.FromContext(r.Context()).Warn("user is not an ADMIN of department or organization", "user_id", UserID, "department_id", DepartmentID)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -235,9 +366,9 @@ func (s *server) departmentTeamUserOnly(h http.HandlerFunc) http.HandlerFunc {
 		DepartmentID := vars["departmentId"]
 		TeamID := vars["teamId"]
 
-		OrgRole, DepartmentRole, TeamRole, UserErr := s.database.DepartmentTeamUserRole(UserID, OrgID, DepartmentID, TeamID)
+		OrgRole, DepartmentRole, TeamRole, UserErr := s.database.DepartmentTeamUserRole(r.Context(), UserID, OrgID, DepartmentID, TeamID)
 		if UserErr != nil {
-			log.Println("error finding user in department team : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in department team", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -259,15 +390,15 @@ func (s *server) departmentTeamAdminOnly(h http.HandlerFunc) http.HandlerFunc {
 		DepartmentID := vars["departmentId"]
 		TeamID := vars["teamId"]
 
-		OrgRole, DepartmentRole, TeamRole, UserErr := s.database.DepartmentTeamUserRole(UserID, OrgID, DepartmentID, TeamID)
+		OrgRole, DepartmentRole, TeamRole, UserErr := s.database.DepartmentTeamUserRole(r.Context(), UserID, OrgID, DepartmentID, TeamID)
 		if UserErr != nil {
-			log.Println("error finding user in department team : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in department team", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
 		if TeamRole != "ADMIN" && DepartmentRole != "ADMIN" && OrgRole != "ADMIN" {
-			log.Println("user is not an ADMIN of organization")
+			logging.FromContext(r.Context()).Warn("user is not an ADMIN of organization", "user_id", UserID, "organization_id", OrgID)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -287,9 +418,9 @@ func (s *server) teamUserOnly(h http.HandlerFunc) http.HandlerFunc {
 		UserID := r.Context().Value(contextKeyUserID).(string)
 		TeamID := vars["teamId"]
 
-		Role, UserErr := s.database.TeamUserRole(UserID, TeamID)
+		Role, UserErr := s.database.TeamUserRole(r.Context(), UserID, TeamID)
 		if UserErr != nil {
-			log.Println("error finding user in team : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in team", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -307,14 +438,14 @@ func (s *server) teamAdminOnly(h http.HandlerFunc) http.HandlerFunc {
 		UserID := r.Context().Value(contextKeyUserID).(string)
 		TeamID := vars["teamId"]
 
-		Role, UserErr := s.database.TeamUserRole(UserID, TeamID)
+		Role, UserErr := s.database.TeamUserRole(r.Context(), UserID, TeamID)
 		if UserErr != nil {
-			log.Println("error finding user in team : " + UserErr.Error() + "\n")
+			logging.FromContext(r.Context()).Error("error finding user in team", "error", UserErr)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 		if Role != "ADMIN" {
-			log.Println("user is not an ADMIN of team")
+			logging.FromContext(r.Context()).Warn("user is not an ADMIN of team", "user_id", UserID, "team_id", TeamID)
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/gorilla/mux"
+)
+
+func TestRequestLoggerMasksTokens(t *testing.T) {
+	tests := []struct {
+		route string
+		path  string
+		token string
+		want  string
+	}{
+		{
+			route: "/api/unsubscribe/{token}",
+			path:  "/api/unsubscribe/5b1f0c2a9e7d4c3b8a6f",
+			token: "5b1f0c2a9e7d4c3b8a6f",
+			want:  "/api/unsubscribe/{token}",
+		},
+		{
+			route: "/api/calendar/user/{token:[0-9a-f]+}.ics",
+			path:  "/api/calendar/user/0123456789abcdef0123456789abcdef.ics",
+			token: "0123456789abcdef0123456789abcdef",
+			want:  "/api/calendar/user/{token}.ics",
+		},
+		{
+			route: "/api/calendar/team/{token:[0-9a-f]+}.ics",
+			path:  "/api/calendar/team/fedcba9876543210fedcba9876543210.ics",
+			token: "fedcba9876543210fedcba9876543210",
+			want:  "/api/calendar/team/{token}.ics",
+		},
+	}
+
+	var out bytes.Buffer
+	defaultLogger := logging.Default()
+	logging.SetDefault(logging.New(&out, "info", "json"))
+	defer logging.SetDefault(defaultLogger)
+
+	s := &server{router: mux.NewRouter()}
+	s.router.Use(s.requestLogger)
+	for _, tt := range tests {
+		s.router.HandleFunc(tt.route, func(w http.ResponseWriter, r *http.Request) {})
+	}
+
+	for _, tt := range tests {
+		out.Reset()
+		s.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		logged := out.String()
+		if strings.Contains(logged, tt.token) {
+			t.Errorf("request log of %s contains the token: %s", tt.route, logged)
+		}
+		if !strings.Contains(logged, tt.want) {
+			t.Errorf("request log of %s = %s, want the path %s", tt.route, logged, tt.want)
+		}
+	}
+}
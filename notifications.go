@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+)
+
+// retrospectiveFinishedPhase is the last phase of a retrospective, reached once its action items are agreed
+const retrospectiveFinishedPhase = 4
+
+// notifyRetrospectivePhase posts the retrospective's new phase to its team chat integrations,
+// the first time the retrospective finishes its summary is sent instead
+func (s *server) notifyRetrospectivePhase(ctx context.Context, RetrospectiveID string, Phase int) {
+	if Phase == retrospectiveFinishedPhase && s.sendRetrospectiveSummary(ctx, RetrospectiveID) {
+		return
+	}
+
+	Retrospective, err := s.database.GetRetrospective(ctx, RetrospectiveID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting retrospective for phase change", "retrospective_id", RetrospectiveID, "error", err)
+		return
+	}
+
+	s.chat.RetrospectivePhase(ctx, Retrospective)
+}
+
+// sendRetrospectiveSummary posts the retrospective summary to its team chat integrations and emails it to
+// its users and team members who opted in, the summary is only sent the first time the retrospective finishes
+func (s *server) sendRetrospectiveSummary(ctx context.Context, RetrospectiveID string) bool {
+	claimed, err := s.database.RetrospectiveClaimSummary(ctx, RetrospectiveID)
+	if err != nil || !claimed {
+		return false
+	}
+
+	Retrospective, err := s.database.GetRetrospective(ctx, RetrospectiveID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting retrospective for summary", "retrospective_id", RetrospectiveID, "error", err)
+		return true
+	}
+
+	s.chat.RetrospectiveFinished(ctx, Retrospective)
+
+	for _, User := range s.database.GetRetrospectiveSummaryRecipients(ctx, RetrospectiveID) {
+		s.email.SendRetrospectiveSummary(User.UserName, User.UserEmail, User.UnsubscribeToken, Retrospective)
+	}
+
+	return true
+}
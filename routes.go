@@ -3,10 +3,10 @@ package main
 import (
 	"embed"
 	"io/fs"
-	"log"
 	"net/http"
 	"os"
 
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
 	"github.com/spf13/viper"
 )
 
@@ -15,7 +15,7 @@ var f embed.FS
 
 func getFileSystem(useOS bool) (http.FileSystem, fs.FS) {
 	if useOS {
-		log.Print("using live mode")
+		logging.Info("using live mode")
 		return http.FS(os.DirFS("dist")), fs.FS(os.DirFS("dist"))
 	}
 
@@ -58,10 +58,23 @@ func (s *server) routes() {
 	s.router.HandleFunc("/api/user/{id}/apikey/{keyID}", s.userOnly(s.handleUserAPIKeyDelete())).Methods("DELETE")
 	s.router.HandleFunc("/api/user/{id}/apikey", s.userOnly(s.handleAPIKeyGenerate())).Methods("POST")
 	s.router.HandleFunc("/api/user/{id}/apikeys", s.userOnly(s.handleUserAPIKeys())).Methods("GET")
+	s.router.HandleFunc("/api/user/{id}/calendar", s.userOnly(s.handleUserCalendar())).Methods("GET", "POST")
 	s.router.HandleFunc("/api/user/{id}", s.userOnly(s.handleUserProfile())).Methods("GET")
 	s.router.HandleFunc("/api/user/{id}", s.userOnly(s.handleUserProfileUpdate())).Methods("POST")
 	s.router.HandleFunc("/api/user/{id}", s.userOnly(s.handleUserDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/alerts", s.userOnly(s.handleGetUserAlerts())).Methods("GET")
+	s.router.HandleFunc("/api/unsubscribe/{token}", s.handleUnsubscribe()).Methods("GET", "POST")
+	s.router.HandleFunc("/api/tracker/{trackerId}/webhook", s.handleTrackerWebhook()).Methods("POST")
+	s.router.HandleFunc("/api/calendar/user/{token:[0-9a-f]+}.ics", s.handleUserCalendarFeed()).Methods("GET")
+	s.router.HandleFunc("/api/calendar/team/{token:[0-9a-f]+}.ics", s.handleTeamCalendarFeed()).Methods("GET")
 	// retrospective(s)
+	s.router.HandleFunc("/api/retrospective/{id}/items/clusters", s.userOnly(s.handleRetrospectiveItemClusters())).Methods("GET")
+	s.router.HandleFunc("/api/retrospective/{id}/item/{itemId}/history", s.userOnly(s.retrospectiveUserOnly(s.handleRetrospectiveItemHistory()))).Methods("GET")
+	s.router.HandleFunc("/api/retrospective/{id}/item/{itemId}", s.userOnly(s.retrospectiveOpenOnly(s.handleRetrospectiveItemUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/retrospective/{id}/action/{actionId}/history", s.userOnly(s.retrospectiveUserOnly(s.handleRetrospectiveActionHistory()))).Methods("GET")
+	s.router.HandleFunc("/api/retrospective/{id}/action/{actionId}", s.userOnly(s.retrospectiveOpenOnly(s.handleRetrospectiveActionUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/retrospective/{id}/action/{actionId}/ticket", s.userOnly(s.retrospectiveOpenOnly(s.handleRetrospectiveActionTicket()))).Methods("POST")
+	s.router.HandleFunc("/api/retrospective/{id}/trackers", s.userOnly(s.retrospectiveUserOnly(s.handleRetrospectiveTrackers()))).Methods("GET")
 	s.router.HandleFunc("/api/retrospective/{id}", s.handleRetrospectiveGet())
 	s.router.HandleFunc("/api/retrospective", s.userOnly(s.handleRetrospectiveCreate())).Methods("POST")
 	s.router.HandleFunc("/api/retrospectives", s.userOnly(s.handleRetrospectivesGet()))
@@ -78,14 +91,30 @@ func (s *server) routes() {
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/teams/{limit}/{offset}", s.userOnly(s.departmentUserOnly(s.handleGetDepartmentTeams()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/teams", s.userOnly(s.departmentAdminOnly(s.handleCreateDepartmentTeam()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/users/{limit}/{offset}", s.userOnly(s.departmentUserOnly(s.handleGetDepartmentUsers()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/analytics", s.userOnly(s.departmentUserOnly(s.handleGetDepartmentAnalytics()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/users", s.userOnly(s.departmentAdminOnly(s.handleDepartmentAddUser()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/user", s.userOnly(s.departmentAdminOnly(s.handleDepartmentRemoveUser()))).Methods("DELETE")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/retrospectives/{limit}/{offset}", s.userOnly(s.departmentTeamUserOnly(s.handleGetTeamRetrospectives()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/analytics", s.userOnly(s.departmentTeamUserOnly(s.handleGetTeamAnalytics()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/retrospective", s.userOnly(s.departmentTeamUserOnly(s.handleRetrospectiveCreate()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/retrospective", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamRemoveRetrospective()))).Methods("DELETE")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/users/{limit}/{offset}", s.userOnly(s.departmentTeamUserOnly(s.handleGetTeamUsers()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/users", s.userOnly(s.departmentTeamAdminOnly(s.handleDepartmentTeamAddUser()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/user", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamRemoveUser()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/schedules", s.userOnly(s.departmentTeamUserOnly(s.handleGetTeamSchedules()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/schedules", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamScheduleCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/schedule", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamScheduleUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/schedule", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamScheduleDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/integrations", s.userOnly(s.departmentTeamAdminOnly(s.handleGetTeamIntegrations()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/integrations", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamIntegrationCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/integration", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamIntegrationUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/integration", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamIntegrationDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/trackers", s.userOnly(s.departmentTeamAdminOnly(s.handleGetTeamTrackers()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/trackers", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamTrackerCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/tracker", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamTrackerUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/tracker", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamTrackerDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/calendar", s.userOnly(s.departmentTeamUserOnly(s.handleTeamCalendar()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}/calendar", s.userOnly(s.departmentTeamAdminOnly(s.handleTeamCalendar()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team/{teamId}", s.userOnly(s.departmentTeamUserOnly(s.handleDepartmentTeamByUser()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}/team", s.userOnly(s.departmentAdminOnly(s.handleDeleteTeam()))).Methods("DELETE")
 	s.router.HandleFunc("/api/organization/{orgId}/department/{departmentId}", s.userOnly(s.departmentUserOnly(s.handleGetDepartmentByUser()))).Methods("GET")
@@ -93,15 +122,31 @@ func (s *server) routes() {
 	s.router.HandleFunc("/api/organization/{orgId}/teams/{limit}/{offset}", s.userOnly(s.orgUserOnly(s.handleGetOrganizationTeams()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/teams", s.userOnly(s.orgAdminOnly(s.handleCreateOrganizationTeam()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/retrospectives/{limit}/{offset}", s.userOnly(s.orgTeamOnly(s.handleGetTeamRetrospectives()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/analytics", s.userOnly(s.orgTeamOnly(s.handleGetTeamAnalytics()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/retrospective", s.userOnly(s.orgTeamOnly(s.handleRetrospectiveCreate()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/retrospective", s.userOnly(s.orgTeamAdminOnly(s.handleTeamRemoveRetrospective()))).Methods("DELETE")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/users/{limit}/{offset}", s.userOnly(s.orgTeamOnly(s.handleGetTeamUsers()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/users", s.userOnly(s.orgTeamAdminOnly(s.handleOrganizationTeamAddUser()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/user", s.userOnly(s.orgTeamAdminOnly(s.handleTeamRemoveUser()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/schedules", s.userOnly(s.orgTeamOnly(s.handleGetTeamSchedules()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/schedules", s.userOnly(s.orgTeamAdminOnly(s.handleTeamScheduleCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/schedule", s.userOnly(s.orgTeamAdminOnly(s.handleTeamScheduleUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/schedule", s.userOnly(s.orgTeamAdminOnly(s.handleTeamScheduleDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/integrations", s.userOnly(s.orgTeamAdminOnly(s.handleGetTeamIntegrations()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/integrations", s.userOnly(s.orgTeamAdminOnly(s.handleTeamIntegrationCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/integration", s.userOnly(s.orgTeamAdminOnly(s.handleTeamIntegrationUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/integration", s.userOnly(s.orgTeamAdminOnly(s.handleTeamIntegrationDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/trackers", s.userOnly(s.orgTeamAdminOnly(s.handleGetTeamTrackers()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/trackers", s.userOnly(s.orgTeamAdminOnly(s.handleTeamTrackerCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/tracker", s.userOnly(s.orgTeamAdminOnly(s.handleTeamTrackerUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/tracker", s.userOnly(s.orgTeamAdminOnly(s.handleTeamTrackerDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/calendar", s.userOnly(s.orgTeamOnly(s.handleTeamCalendar()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}/calendar", s.userOnly(s.orgTeamAdminOnly(s.handleTeamCalendar()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/team/{teamId}", s.userOnly(s.orgTeamOnly(s.handleGetOrganizationTeamByUser()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/team", s.userOnly(s.orgAdminOnly(s.handleDeleteTeam()))).Methods("DELETE")
 	// org users
 	s.router.HandleFunc("/api/organization/{orgId}/users/{limit}/{offset}", s.userOnly(s.orgUserOnly(s.handleGetOrganizationUsers()))).Methods("GET")
+	s.router.HandleFunc("/api/organization/{orgId}/analytics", s.userOnly(s.orgUserOnly(s.handleGetOrganizationAnalytics()))).Methods("GET")
 	s.router.HandleFunc("/api/organization/{orgId}/users", s.userOnly(s.orgAdminOnly(s.handleOrganizationAddUser()))).Methods("POST")
 	s.router.HandleFunc("/api/organization/{orgId}/user", s.userOnly(s.orgAdminOnly(s.handleOrganizationRemoveUser()))).Methods("DELETE")
 	s.router.HandleFunc("/api/organization/{orgId}", s.userOnly(s.orgUserOnly(s.handleGetOrganizationByUser()))).Methods("GET")
@@ -109,11 +154,26 @@ func (s *server) routes() {
 	s.router.HandleFunc("/api/teams/{limit}/{offset}", s.userOnly(s.handleGetTeamsByUser())).Methods("GET")
 	s.router.HandleFunc("/api/teams", s.userOnly(s.handleCreateTeam())).Methods("POST")
 	s.router.HandleFunc("/api/team/{teamId}/retrospectives/{limit}/{offset}", s.userOnly(s.teamUserOnly(s.handleGetTeamRetrospectives()))).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/analytics", s.userOnly(s.teamUserOnly(s.handleGetTeamAnalytics()))).Methods("GET")
 	s.router.HandleFunc("/api/team/{teamId}/retrospective", s.userOnly(s.teamUserOnly(s.handleRetrospectiveCreate()))).Methods("POST")
 	s.router.HandleFunc("/api/team/{teamId}/retrospective", s.userOnly(s.teamAdminOnly(s.handleTeamRemoveRetrospective()))).Methods("DELETE")
 	s.router.HandleFunc("/api/team/{teamId}/users/{limit}/{offset}", s.userOnly(s.teamUserOnly(s.handleGetTeamUsers()))).Methods("GET")
 	s.router.HandleFunc("/api/team/{teamId}/users", s.userOnly(s.teamAdminOnly(s.handleTeamAddUser()))).Methods("POST")
 	s.router.HandleFunc("/api/team/{teamId}/user", s.userOnly(s.teamAdminOnly(s.handleTeamRemoveUser()))).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/schedules", s.userOnly(s.teamUserOnly(s.handleGetTeamSchedules()))).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/schedules", s.userOnly(s.teamAdminOnly(s.handleTeamScheduleCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/schedule", s.userOnly(s.teamAdminOnly(s.handleTeamScheduleUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/team/{teamId}/schedule", s.userOnly(s.teamAdminOnly(s.handleTeamScheduleDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/integrations", s.userOnly(s.teamAdminOnly(s.handleGetTeamIntegrations()))).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/integrations", s.userOnly(s.teamAdminOnly(s.handleTeamIntegrationCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/integration", s.userOnly(s.teamAdminOnly(s.handleTeamIntegrationUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/team/{teamId}/integration", s.userOnly(s.teamAdminOnly(s.handleTeamIntegrationDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/trackers", s.userOnly(s.teamAdminOnly(s.handleGetTeamTrackers()))).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/trackers", s.userOnly(s.teamAdminOnly(s.handleTeamTrackerCreate()))).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/tracker", s.userOnly(s.teamAdminOnly(s.handleTeamTrackerUpdate()))).Methods("PUT")
+	s.router.HandleFunc("/api/team/{teamId}/tracker", s.userOnly(s.teamAdminOnly(s.handleTeamTrackerDelete()))).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/calendar", s.userOnly(s.teamUserOnly(s.handleTeamCalendar()))).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/calendar", s.userOnly(s.teamAdminOnly(s.handleTeamCalendar()))).Methods("POST")
 	s.router.HandleFunc("/api/team/{teamId}", s.userOnly(s.teamUserOnly(s.handleGetTeamByUser()))).Methods("GET")
 	s.router.HandleFunc("/api/team", s.userOnly(s.teamAdminOnly(s.handleDeleteTeam()))).Methods("DELETE")
 	// admin routes
@@ -122,15 +182,40 @@ func (s *server) routes() {
 	s.router.HandleFunc("/api/admin/user", s.adminOnly(s.handleUserCreate())).Methods("POST")
 	s.router.HandleFunc("/api/admin/promote", s.adminOnly(s.handleUserPromote())).Methods("POST")
 	s.router.HandleFunc("/api/admin/demote", s.adminOnly(s.handleUserDemote())).Methods("POST")
+	s.router.HandleFunc("/api/admin/suspend", s.adminOnly(s.handleUserSuspend())).Methods("POST")
+	s.router.HandleFunc("/api/admin/unsuspend", s.adminOnly(s.handleUserUnsuspend())).Methods("POST")
+	s.router.HandleFunc("/api/admin/user/{id}", s.adminOnly(s.handleAdminUserUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/user/{id}/verification", s.adminOnly(s.handleUserResendVerification())).Methods("POST")
+	s.router.HandleFunc("/api/admin/user/{id}/impersonate", s.adminOnly(s.handleUserImpersonate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/impersonation", s.adminOnly(s.handleImpersonationEnd())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/impersonations/{limit}/{offset}", s.adminOnly(s.handleGetImpersonations())).Methods("GET")
 	s.router.HandleFunc("/api/admin/clean-retrospectives", s.adminOnly(s.handleCleanRetrospectives())).Methods("DELETE")
 	s.router.HandleFunc("/api/admin/clean-guests", s.adminOnly(s.handleCleanGuests())).Methods("DELETE")
 	s.router.HandleFunc("/api/admin/organizations/{limit}/{offset}", s.adminOnly(s.handleGetOrganizations())).Methods("GET")
+	s.router.HandleFunc("/api/admin/organization/{orgId}", s.adminOnly(s.handleAdminOrganizationUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/organization/{orgId}", s.adminOnly(s.handleAdminOrganizationDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/organization/{orgId}/departments/{limit}/{offset}", s.adminOnly(s.handleAdminGetDepartments())).Methods("GET")
+	s.router.HandleFunc("/api/admin/department/{departmentId}", s.adminOnly(s.handleAdminDepartmentUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/department/{departmentId}", s.adminOnly(s.handleAdminDepartmentDelete())).Methods("DELETE")
 	s.router.HandleFunc("/api/admin/teams/{limit}/{offset}", s.adminOnly(s.handleGetTeams())).Methods("GET")
+	s.router.HandleFunc("/api/admin/team/{teamId}", s.adminOnly(s.handleAdminTeamUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/team/{teamId}", s.adminOnly(s.handleAdminTeamDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/retrospectives/{limit}/{offset}", s.adminOnly(s.handleGetRetrospectives())).Methods("GET")
+	s.router.HandleFunc("/api/admin/retrospective/{id}/owner", s.adminOnly(s.handleAdminRetrospectiveOwner())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/retrospective/{id}/close", s.adminOnly(s.handleAdminRetrospectiveClose())).Methods("POST")
+	s.router.HandleFunc("/api/admin/retrospective/{id}/close", s.adminOnly(s.handleAdminRetrospectiveReopen())).Methods("DELETE")
 	s.router.HandleFunc("/api/admin/apikeys/{limit}/{offset}", s.adminOnly(s.handleGetAPIKeys())).Methods("GET")
 	s.router.HandleFunc("/api/admin/alerts/{limit}/{offset}", s.adminOnly(s.handleGetAlerts())).Methods("GET")
 	s.router.HandleFunc("/api/admin/alert/{id}", s.adminOnly(s.handleAlertUpdate())).Methods("PUT")
 	s.router.HandleFunc("/api/admin/alert", s.adminOnly(s.handleAlertCreate())).Methods("POST")
 	s.router.HandleFunc("/api/admin/alert", s.adminOnly(s.handleAlertDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/emails/retry", s.adminOnly(s.handleEmailOutboxRetryFailed())).Methods("POST")
+	s.router.HandleFunc("/api/admin/emails/{limit}/{offset}", s.adminOnly(s.handleGetEmailOutbox())).Methods("GET")
+	s.router.HandleFunc("/api/admin/email/{id}/retry", s.adminOnly(s.handleEmailOutboxRetry())).Methods("POST")
+	// health and build info
+	s.router.HandleFunc("/healthz", s.handleLiveness()).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadiness()).Methods("GET")
+	s.router.HandleFunc("/api/build", s.handleBuildInfo()).Methods("GET")
 	// websocket for retrospective
 	s.router.HandleFunc("/api/arena/{id}", s.serveWs())
 	// handle index.html
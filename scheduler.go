@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/tracker"
+)
+
+// how often the scheduler checks for due team retrospective schedules
+const scheduleCheckPeriod = time.Minute
+
+// runRetrospectiveScheduler periodically creates retrospectives for due team schedules,
+// schedules are claimed in the database so multiple replicas can run the scheduler safely
+func (s *server) runRetrospectiveScheduler() {
+	ticker := time.NewTicker(scheduleCheckPeriod)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for range ticker.C {
+		for {
+			schedule, newRetrospective, err := s.database.TeamScheduleRunDue(ctx, time.Now())
+			if err != nil {
+				logging.FromContext(ctx).Error("error creating scheduled retrospective", "error", err)
+				break
+			}
+			if schedule == nil {
+				break
+			}
+
+			s.announceScheduledRetrospective(ctx, schedule.TeamID, newRetrospective)
+		}
+	}
+}
+
+// announceScheduledRetrospective posts the scheduled team retrospective to the team chat integrations
+// and emails the team members a link to it
+func (s *server) announceScheduledRetrospective(ctx context.Context, TeamID string, newRetrospective *database.Retrospective) {
+	go s.chat.RetrospectiveStarted(ctx, newRetrospective)
+
+	Team, err := s.database.TeamGet(ctx, TeamID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting scheduled retrospective team", "team_id", TeamID, "error", err)
+		return
+	}
+
+	Limit := 100
+	for Offset := 0; ; Offset = Offset + Limit {
+		Users := s.database.TeamUserList(ctx, TeamID, Limit, Offset)
+		for _, User := range Users {
+			if User.Email == "" {
+				continue
+			}
+			s.email.SendRetrospectiveScheduled(User.Name, User.Email, Team.Name, newRetrospective.RetrospectiveName, newRetrospective.RetrospectiveID)
+		}
+		if len(Users) < Limit {
+			break
+		}
+	}
+}
+
+// how often the scheduler checks for due action reminders and notification digests
+const notificationCheckPeriod = time.Minute
+
+// runNotificationScheduler periodically queues action item due reminders and sends the daily or weekly
+// notification digests and weekly team digests, digests are claimed in the database so multiple replicas
+// can run the scheduler safely
+func (s *server) runNotificationScheduler() {
+	ticker := time.NewTicker(notificationCheckPeriod)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for range ticker.C {
+		// remind assignees the day before their action items are due
+		s.database.QueueActionDueReminders(ctx, time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02"))
+
+		for {
+			User, Notifications, err := s.database.NotificationDigestClaimDue(ctx)
+			if err != nil || User == nil {
+				break
+			}
+
+			s.email.SendNotificationDigest(User.UserName, User.UserEmail, User.UnsubscribeToken, Notifications)
+		}
+
+		for {
+			User, Teams, err := s.database.TeamDigestClaimDue(ctx)
+			if err != nil || User == nil {
+				break
+			}
+
+			s.email.SendTeamDigest(User.UserName, User.UserEmail, User.UnsubscribeToken, Teams)
+		}
+	}
+}
+
+// how many action items with tickets are claimed per tracker sync batch
+const trackerSyncBatchSize = 50
+
+// runTrackerSync periodically checks the tickets of open action items, completing the actions whose tickets
+// were closed, actions are claimed in the database so multiple replicas can run the sync safely
+func (s *server) runTrackerSync() {
+	if s.config.TrackerSyncInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.TrackerSyncInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for range ticker.C {
+		for {
+			Actions, err := s.database.TrackerSyncClaimDue(ctx, time.Now().Add(-s.config.TrackerSyncInterval), trackerSyncBatchSize)
+			if err != nil || len(Actions) == 0 {
+				break
+			}
+
+			providers := make(map[string]tracker.Provider)
+			for _, Action := range Actions {
+				provider, ok := providers[Action.TrackerID]
+				if !ok {
+					provider = s.trackerProvider(ctx, Action.TrackerID)
+					providers[Action.TrackerID] = provider
+				}
+				if provider == nil {
+					continue
+				}
+
+				closed, err := provider.TicketClosed(ctx, Action.ExternalKey)
+				if err != nil {
+					logging.FromContext(ctx).Warn("error checking action ticket", "tracker_id", Action.TrackerID, "action_id", Action.ID, "error", err)
+					continue
+				}
+				if closed {
+					s.completeTrackerTicket(ctx, Action.TrackerID, Action.ExternalKey)
+				}
+			}
+
+			if len(Actions) < trackerSyncBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// runClosedArenaCheck periodically closes the connections to retrospectives force closed by an admin
+// on another replica, the replica the admin used closes its own connections right away
+func (s *server) runClosedArenaCheck() {
+	if s.config.ClosedArenaCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.ClosedArenaCheckInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for range ticker.C {
+		ArenaIDs := h.connectedArenas()
+		if len(ArenaIDs) == 0 {
+			continue
+		}
+
+		Closed, err := s.database.GetClosedRetrospectives(ctx, ArenaIDs)
+		if err != nil {
+			continue
+		}
+		for _, RetrospectiveID := range Closed {
+			h.disconnect <- disconnection{arena: RetrospectiveID, closeMessage: closeRetrospectiveClosed}
+		}
+	}
+}
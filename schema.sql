@@ -195,10 +195,182 @@ CREATE TABLE IF NOT EXISTS alert (
     updated_date TIMESTAMP DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS retrospective_item_history (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    item_id UUID NOT NULL,
+    user_id UUID,
+    content TEXT NOT NULL,
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT rih_item_id_fkey FOREIGN KEY (item_id) REFERENCES retrospective_item(id) ON DELETE CASCADE,
+    CONSTRAINT rih_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_action_history (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    action_id UUID NOT NULL,
+    user_id UUID,
+    content TEXT NOT NULL,
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT rah_action_id_fkey FOREIGN KEY (action_id) REFERENCES retrospective_action(id) ON DELETE CASCADE,
+    CONSTRAINT rah_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_item_comment (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    item_id UUID NOT NULL,
+    user_id UUID,
+    parent_id UUID,
+    content TEXT NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT ric_item_id_fkey FOREIGN KEY (item_id) REFERENCES retrospective_item(id) ON DELETE CASCADE,
+    CONSTRAINT ric_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT ric_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES retrospective_item_comment(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_item_reaction (
+    item_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    emoji VARCHAR(32) NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (item_id, user_id, emoji),
+    CONSTRAINT rir_item_id_fkey FOREIGN KEY (item_id) REFERENCES retrospective_item(id) ON DELETE CASCADE,
+    CONSTRAINT rir_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS schema_migration (
+    version VARCHAR(64) NOT NULL PRIMARY KEY,
+    applied_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_group (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    retrospective_id UUID NOT NULL,
+    title VARCHAR(256) NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT rg_retrospective_id_fkey FOREIGN KEY (retrospective_id) REFERENCES retrospective(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team_retrospective_schedule (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    team_id UUID NOT NULL,
+    owner_id UUID NOT NULL,
+    name VARCHAR(256) NOT NULL,
+    interval_weeks SMALLINT NOT NULL DEFAULT 2,
+    next_run_date TIMESTAMP NOT NULL,
+    active BOOL DEFAULT true,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT trs_team_id FOREIGN KEY(team_id) REFERENCES team(id) ON DELETE CASCADE,
+    CONSTRAINT trs_owner_id FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    to_name VARCHAR(64),
+    to_email VARCHAR(320) NOT NULL,
+    subject VARCHAR(256) NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+    attempts SMALLINT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_date TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_date TIMESTAMP,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_notification (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    user_id UUID NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    title VARCHAR(256) NOT NULL,
+    content TEXT,
+    link VARCHAR(256),
+    sent_date TIMESTAMP,
+    created_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT un_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team_integration (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    team_id UUID NOT NULL,
+    webhook_url VARCHAR(1024) NOT NULL,
+    format VARCHAR(16) NOT NULL,
+    active BOOL DEFAULT true,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT ti_team_id_fkey FOREIGN KEY (team_id) REFERENCES team(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team_tracker (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    team_id UUID NOT NULL,
+    provider VARCHAR(16) NOT NULL,
+    base_url VARCHAR(512) NOT NULL DEFAULT '',
+    project VARCHAR(256) NOT NULL,
+    username VARCHAR(320) NOT NULL DEFAULT '',
+    token VARCHAR(512) NOT NULL,
+    webhook_secret UUID NOT NULL DEFAULT uuid_generate_v4(),
+    active BOOL DEFAULT true,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT tt_team_id_fkey FOREIGN KEY (team_id) REFERENCES team(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_impersonation (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    admin_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    reason VARCHAR(512) NOT NULL DEFAULT '',
+    created_date TIMESTAMP DEFAULT NOW(),
+    expire_date TIMESTAMP NOT NULL,
+    ended_date TIMESTAMP,
+    CONSTRAINT ui_admin_id_fkey FOREIGN KEY (admin_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT ui_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 --
 -- Table Alterations
 --
 ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(2);
+ALTER TABLE retrospective_user ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'PARTICIPANT';
+ALTER TABLE retrospective ADD COLUMN IF NOT EXISTS anonymous BOOL NOT NULL DEFAULT false;
+ALTER TABLE retrospective ADD COLUMN IF NOT EXISTS focused_item_id UUID REFERENCES retrospective_item(id) ON DELETE SET NULL;
+ALTER TABLE retrospective_item ADD COLUMN IF NOT EXISTS discussed BOOL NOT NULL DEFAULT false;
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS completed_date TIMESTAMP;
+ALTER TABLE retrospective_item ADD COLUMN IF NOT EXISTS group_id UUID REFERENCES retrospective_group(id) ON DELETE SET NULL;
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS text_body TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_retro_summary BOOL NOT NULL DEFAULT false;
+ALTER TABLE retrospective ADD COLUMN IF NOT EXISTS summary_sent_date TIMESTAMP;
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS assignee_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_invites BOOL NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_action_assigned BOOL NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_action_due BOOL NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_team_digest BOOL NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_frequency VARCHAR(16) NOT NULL DEFAULT 'DAILY';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_sent_date TIMESTAMP NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS team_digest_sent_date TIMESTAMP NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS unsubscribe_token UUID NOT NULL UNIQUE DEFAULT uuid_generate_v4();
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS due_date DATE;
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS due_reminder_date TIMESTAMP;
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS unsubscribe_url VARCHAR(512);
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS tracker_id UUID REFERENCES team_tracker(id) ON DELETE SET NULL;
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS external_key VARCHAR(128);
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS external_url VARCHAR(1024);
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS external_synced_date TIMESTAMP;
+ALTER TABLE retrospective_action ADD COLUMN IF NOT EXISTS ticket_claimed_date TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS calendar_token VARCHAR(64) UNIQUE;
+ALTER TABLE team ADD COLUMN IF NOT EXISTS calendar_token VARCHAR(64) UNIQUE;
+ALTER TABLE team_retrospective_schedule ADD COLUMN IF NOT EXISTS last_retrospective_id UUID REFERENCES retrospective(id) ON DELETE SET NULL;
+ALTER TABLE alert ADD COLUMN IF NOT EXISTS start_date TIMESTAMP;
+ALTER TABLE alert ADD COLUMN IF NOT EXISTS end_date TIMESTAMP;
+ALTER TABLE alert ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organization(id) ON DELETE CASCADE;
+ALTER TABLE alert ADD COLUMN IF NOT EXISTS locale VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE alert ADD COLUMN IF NOT EXISTS user_type VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended BOOL NOT NULL DEFAULT false;
+ALTER TABLE retrospective ADD COLUMN IF NOT EXISTS closed_date TIMESTAMP;
 
 --
 -- Views
@@ -217,14 +389,26 @@ BEGIN
 END;
 $$;
 
--- Set Retrospective Owner --
+-- Set Retrospective Owner, previous owner stays on as a facilitator --
 CREATE OR REPLACE PROCEDURE set_retrospective_owner(retrospectiveId UUID, ownerId UUID)
 LANGUAGE plpgsql AS $$
 BEGIN
+    INSERT INTO retrospective_user (retrospective_id, user_id, role)
+    SELECT r.id, r.owner_id, 'FACILITATOR' FROM retrospective r WHERE r.id = retrospectiveId AND r.owner_id IS NOT NULL
+    ON CONFLICT (retrospective_id, user_id) DO UPDATE SET role = 'FACILITATOR';
     UPDATE retrospective SET updated_date = NOW(), owner_id = ownerId WHERE id = retrospectiveId;
 END;
 $$;
 
+-- Set Retrospective User Role (FACILITATOR, PARTICIPANT, OBSERVER) --
+CREATE OR REPLACE PROCEDURE set_retrospective_user_role(retrospectiveId UUID, userId UUID, userRole VARCHAR(16))
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE retrospective_user SET role = userRole WHERE retrospective_id = retrospectiveId AND user_id = userId;
+    UPDATE retrospective SET updated_date = NOW() WHERE id = retrospectiveId;
+END;
+$$;
+
 -- Set Retrospective Phase --
 CREATE OR REPLACE PROCEDURE set_retrospective_phase(retrospectiveId UUID, nextPhase SMALLINT)
 LANGUAGE plpgsql AS $$
@@ -413,6 +597,51 @@ BEGIN
 END;
 $$;
 
+-- Updates a retrospective items content, keeping the previous content in history --
+CREATE OR REPLACE PROCEDURE retrospective_item_update(
+    retrospectiveId UUID,
+    itemId UUID,
+    userId UUID,
+    itemContent TEXT
+)
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO retrospective_item_history (item_id, user_id, content)
+    SELECT ri.id, userId, ri.content FROM retrospective_item ri WHERE ri.id = itemId AND ri.retrospective_id = retrospectiveId;
+    UPDATE retrospective_item SET content = itemContent, updated_date = NOW() WHERE id = itemId AND retrospective_id = retrospectiveId;
+END;
+$$;
+
+-- Updates a retrospective actions content, keeping the previous content in history --
+CREATE OR REPLACE PROCEDURE retrospective_action_update(
+    retrospectiveId UUID,
+    actionId UUID,
+    userId UUID,
+    actionContent TEXT
+)
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO retrospective_action_history (action_id, user_id, content)
+    SELECT ra.id, userId, ra.content FROM retrospective_action ra WHERE ra.id = actionId AND ra.retrospective_id = retrospectiveId;
+    UPDATE retrospective_action SET content = actionContent, updated_date = NOW() WHERE id = actionId AND retrospective_id = retrospectiveId;
+END;
+$$;
+
+-- Toggles a users emoji reaction on a retrospective item --
+CREATE OR REPLACE PROCEDURE retrospective_item_reaction_toggle(
+    itemId UUID,
+    userId UUID,
+    reactionEmoji VARCHAR(32)
+)
+LANGUAGE plpgsql AS $$
+BEGIN
+    DELETE FROM retrospective_item_reaction WHERE item_id = itemId AND user_id = userId AND emoji = reactionEmoji;
+    IF NOT FOUND THEN
+        INSERT INTO retrospective_item_reaction (item_id, user_id, emoji) VALUES (itemId, userId, reactionEmoji);
+    END IF;
+END;
+$$;
+
 --
 -- Stored Functions
 --
@@ -454,15 +683,53 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+-- Get Retrospective User Role
+-- owners and team, department or organization admins of a team retrospective are implicitly facilitators
+CREATE OR REPLACE FUNCTION retrospective_get_user_role(
+    IN retrospectiveId UUID,
+    IN userId UUID,
+    OUT role VARCHAR(16)
+) AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM retrospective r WHERE r.id = retrospectiveId AND r.owner_id = userId) THEN
+        role := 'FACILITATOR';
+        RETURN;
+    END IF;
+
+    IF EXISTS (
+        SELECT 1
+        FROM team_retrospective tr
+        LEFT JOIN team_user tu ON tu.team_id = tr.team_id AND tu.user_id = userId AND tu.role = 'ADMIN'
+        LEFT JOIN department_team dt ON dt.team_id = tr.team_id
+        LEFT JOIN department_user du ON du.department_id = dt.department_id AND du.user_id = userId AND du.role = 'ADMIN'
+        LEFT JOIN organization_department od ON od.id = dt.department_id
+        LEFT JOIN organization_team ot ON ot.team_id = tr.team_id
+        LEFT JOIN organization_user ou ON ou.organization_id = COALESCE(ot.organization_id, od.organization_id)
+            AND ou.user_id = userId AND ou.role = 'ADMIN'
+        WHERE tr.retrospective_id = retrospectiveId
+            AND (tu.user_id IS NOT NULL OR du.user_id IS NOT NULL OR ou.user_id IS NOT NULL)
+    ) THEN
+        role := 'FACILITATOR';
+        RETURN;
+    END IF;
+
+    SELECT ru.role INTO role
+    FROM retrospective_user ru
+    WHERE ru.retrospective_id = retrospectiveId AND ru.user_id = userId;
+
+    role := COALESCE(role, 'PARTICIPANT');
+END;
+$$ LANGUAGE plpgsql;
+
 -- Get Retrospective Users
 DROP FUNCTION IF EXISTS get_retrospective_users(uuid);
 CREATE FUNCTION get_retrospective_users(retrospectiveId UUID) RETURNS table (
-    id UUID, name VARCHAR(256), active BOOL
+    id UUID, name VARCHAR(256), active BOOL, role VARCHAR(16)
 ) AS $$
 BEGIN
     RETURN QUERY
         SELECT
-			w.id, w.name, su.active
+			w.id, w.name, su.active, (SELECT rr.role FROM retrospective_get_user_role(retrospectiveId, w.id) rr)
 		FROM retrospective_user su
 		LEFT JOIN users w ON su.user_id = w.id
 		WHERE su.retrospective_id = retrospectiveId
@@ -1135,4 +1402,37 @@ AS $$
 BEGIN
     DELETE FROM team WHERE id = teamId;
 END;
-$$ LANGUAGE plpgsql;
\ No newline at end of file
+$$ LANGUAGE plpgsql;
+
+-- Claim a due Team Retrospective Schedule --
+-- advances the schedule to its next future run, SKIP LOCKED keeps multiple replicas from claiming the same run
+CREATE OR REPLACE FUNCTION team_retrospective_schedule_claim() RETURNS table (
+    id UUID, team_id UUID, owner_id UUID, name VARCHAR(256)
+) AS $$
+BEGIN
+    RETURN QUERY
+        UPDATE team_retrospective_schedule trs
+        SET
+            next_run_date = trs.next_run_date + (trs.interval_weeks * interval '1 week') * (
+                FLOOR(
+                    EXTRACT(EPOCH FROM (NOW() - trs.next_run_date)) / EXTRACT(EPOCH FROM (trs.interval_weeks * interval '1 week'))
+                ) + 1
+            ),
+            updated_date = NOW()
+        FROM (
+            SELECT s.id
+            FROM team_retrospective_schedule s
+            WHERE s.active = true AND s.next_run_date <= NOW()
+            ORDER BY s.next_run_date
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        ) due
+        WHERE trs.id = due.id
+        RETURNING trs.id, trs.team_id, trs.owner_id, trs.name;
+END;
+$$ LANGUAGE plpgsql;
+
+--
+-- Schema Version, recorded once the schema above is applied, must match schemaVersion in lib/database/health.go
+--
+INSERT INTO schema_migration (version) VALUES ('2026-10-19.2') ON CONFLICT DO NOTHING;
@@ -0,0 +1,381 @@
+--
+-- SQLite schema, mirrors schema.sql for the sqlite db.driver
+-- the stored procedures and functions of the postgres schema are implemented in Go (lib/database/sqlite_routines.go)
+--
+PRAGMA foreign_keys = ON;
+
+--
+-- Tables
+--
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    name VARCHAR(64),
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_active TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    email VARCHAR(320) UNIQUE,
+    password TEXT,
+    type VARCHAR(128) DEFAULT 'GUEST',
+    verified BOOLEAN DEFAULT false,
+    avatar VARCHAR(128) DEFAULT 'identicon',
+    country VARCHAR(2),
+    company VARCHAR(256),
+    job_title VARCHAR(128),
+    locale VARCHAR(2),
+    notify_retro_summary BOOLEAN NOT NULL DEFAULT false,
+    notify_invites BOOLEAN NOT NULL DEFAULT false,
+    notify_action_assigned BOOLEAN NOT NULL DEFAULT false,
+    notify_action_due BOOLEAN NOT NULL DEFAULT false,
+    notify_team_digest BOOLEAN NOT NULL DEFAULT false,
+    digest_frequency VARCHAR(16) NOT NULL DEFAULT 'DAILY',
+    digest_sent_date TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    team_digest_sent_date TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    unsubscribe_token TEXT NOT NULL UNIQUE DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    calendar_token VARCHAR(64) UNIQUE,
+    suspended BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS retrospective (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    name VARCHAR(256),
+    owner_id TEXT,
+    phase INTEGER NOT NULL DEFAULT 1,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    anonymous BOOLEAN NOT NULL DEFAULT false,
+    focused_item_id TEXT REFERENCES retrospective_item(id) ON DELETE SET NULL,
+    summary_sent_date TIMESTAMP,
+    closed_date TIMESTAMP,
+    CONSTRAINT r_owner_id_fkey FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_user (
+    retrospective_id TEXT,
+    user_id TEXT,
+    active BOOLEAN DEFAULT false,
+    abandoned BOOLEAN DEFAULT false,
+    role VARCHAR(16) NOT NULL DEFAULT 'PARTICIPANT',
+    PRIMARY KEY (retrospective_id, user_id),
+    CONSTRAINT ru_retrospective_id_fkey FOREIGN KEY (retrospective_id) REFERENCES retrospective(id) ON DELETE CASCADE,
+    CONSTRAINT ru_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_group (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    retrospective_id TEXT NOT NULL,
+    title VARCHAR(256) NOT NULL,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT rg_retrospective_id_fkey FOREIGN KEY (retrospective_id) REFERENCES retrospective(id) ON DELETE CASCADE
+);
+
+-- votes holds a postgres array literal of user ids so it scans the same as the postgres UUID[] column
+CREATE TABLE IF NOT EXISTS retrospective_item (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    retrospective_id TEXT,
+    user_id TEXT,
+    parent_id TEXT,
+    content TEXT NOT NULL,
+    votes TEXT DEFAULT '{}',
+    type VARCHAR(16) NOT NULL,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    discussed BOOLEAN NOT NULL DEFAULT false,
+    group_id TEXT REFERENCES retrospective_group(id) ON DELETE SET NULL,
+    CONSTRAINT ri_retrospective_id_fkey FOREIGN KEY (retrospective_id) REFERENCES retrospective(id) ON DELETE CASCADE,
+    CONSTRAINT ri_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT ri_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES retrospective_item(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_action (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    retrospective_id TEXT,
+    content TEXT NOT NULL,
+    completed BOOLEAN DEFAULT false,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_date TIMESTAMP,
+    assignee_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    due_date DATE,
+    due_reminder_date TIMESTAMP,
+    tracker_id TEXT REFERENCES team_tracker(id) ON DELETE SET NULL,
+    external_key VARCHAR(128),
+    external_url VARCHAR(1024),
+    external_synced_date TIMESTAMP,
+    ticket_claimed_date TIMESTAMP,
+    CONSTRAINT ra_retrospective_id_fkey FOREIGN KEY (retrospective_id) REFERENCES retrospective(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_reset (
+    reset_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    user_id TEXT,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expire_date TIMESTAMP DEFAULT (datetime('now', '+1 hour')),
+    CONSTRAINT ur_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_verify (
+    verify_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    user_id TEXT,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expire_date TIMESTAMP DEFAULT (datetime('now', '+24 hour')),
+    CONSTRAINT uv_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT NOT NULL PRIMARY KEY,
+    user_id TEXT,
+    name VARCHAR(256) NOT NULL,
+    active BOOLEAN DEFAULT true,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name),
+    CONSTRAINT apk_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS organization (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    name VARCHAR(256),
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS organization_user (
+    organization_id TEXT,
+    user_id TEXT,
+    role VARCHAR(16) NOT NULL DEFAULT 'MEMBER',
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id),
+    CONSTRAINT ou_organization_id FOREIGN KEY(organization_id) REFERENCES organization(id) ON DELETE CASCADE,
+    CONSTRAINT ou_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS organization_department (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    organization_id TEXT,
+    name VARCHAR(256),
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(organization_id, name),
+    CONSTRAINT od_organization_id FOREIGN KEY(organization_id) REFERENCES organization(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS department_user (
+    department_id TEXT,
+    user_id TEXT,
+    role VARCHAR(16) NOT NULL DEFAULT 'MEMBER',
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (department_id, user_id),
+    CONSTRAINT du_department_id FOREIGN KEY(department_id) REFERENCES organization_department(id) ON DELETE CASCADE,
+    CONSTRAINT du_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    name VARCHAR(256),
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    calendar_token VARCHAR(64) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS team_user (
+    team_id TEXT,
+    user_id TEXT,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    role VARCHAR(16) NOT NULL DEFAULT 'MEMBER',
+    PRIMARY KEY (team_id, user_id),
+    CONSTRAINT tu_team_id FOREIGN KEY(team_id) REFERENCES team(id) ON DELETE CASCADE,
+    CONSTRAINT tu_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS organization_team (
+    organization_id TEXT,
+    team_id TEXT,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, team_id),
+    UNIQUE(team_id),
+    CONSTRAINT ot_organization_id FOREIGN KEY(organization_id) REFERENCES organization(id) ON DELETE CASCADE,
+    CONSTRAINT ot_team_id FOREIGN KEY(team_id) REFERENCES team(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS department_team (
+    department_id TEXT,
+    team_id TEXT,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (department_id, team_id),
+    UNIQUE(team_id),
+    CONSTRAINT dt_department_id FOREIGN KEY(department_id) REFERENCES organization_department(id) ON DELETE CASCADE,
+    CONSTRAINT dt_team_id FOREIGN KEY(team_id) REFERENCES team(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team_retrospective (
+    team_id TEXT,
+    retrospective_id TEXT,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, retrospective_id),
+    CONSTRAINT tb_team_id FOREIGN KEY(team_id) REFERENCES team(id) ON DELETE CASCADE,
+    CONSTRAINT tb_retrospective_id FOREIGN KEY(retrospective_id) REFERENCES retrospective(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS alert (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    type VARCHAR(128) DEFAULT 'NEW',
+    content TEXT NOT NULL,
+    active BOOLEAN DEFAULT true,
+    allow_dismiss BOOLEAN DEFAULT true,
+    registered_only BOOLEAN DEFAULT true,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    start_date TIMESTAMP,
+    end_date TIMESTAMP,
+    organization_id TEXT REFERENCES organization(id) ON DELETE CASCADE,
+    locale VARCHAR(2) NOT NULL DEFAULT '',
+    user_type VARCHAR(16) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_item_history (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    item_id TEXT NOT NULL,
+    user_id TEXT,
+    content TEXT NOT NULL,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT rih_item_id_fkey FOREIGN KEY (item_id) REFERENCES retrospective_item(id) ON DELETE CASCADE,
+    CONSTRAINT rih_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_action_history (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    action_id TEXT NOT NULL,
+    user_id TEXT,
+    content TEXT NOT NULL,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT rah_action_id_fkey FOREIGN KEY (action_id) REFERENCES retrospective_action(id) ON DELETE CASCADE,
+    CONSTRAINT rah_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_item_comment (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    item_id TEXT NOT NULL,
+    user_id TEXT,
+    parent_id TEXT,
+    content TEXT NOT NULL,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ric_item_id_fkey FOREIGN KEY (item_id) REFERENCES retrospective_item(id) ON DELETE CASCADE,
+    CONSTRAINT ric_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT ric_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES retrospective_item_comment(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS retrospective_item_reaction (
+    item_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    emoji VARCHAR(32) NOT NULL,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (item_id, user_id, emoji),
+    CONSTRAINT rir_item_id_fkey FOREIGN KEY (item_id) REFERENCES retrospective_item(id) ON DELETE CASCADE,
+    CONSTRAINT rir_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS schema_migration (
+    version VARCHAR(64) NOT NULL PRIMARY KEY,
+    applied_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS team_retrospective_schedule (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    team_id TEXT NOT NULL,
+    owner_id TEXT NOT NULL,
+    name VARCHAR(256) NOT NULL,
+    interval_weeks INTEGER NOT NULL DEFAULT 2,
+    next_run_date TIMESTAMP NOT NULL,
+    active BOOLEAN DEFAULT true,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_retrospective_id TEXT REFERENCES retrospective(id) ON DELETE SET NULL,
+    CONSTRAINT trs_team_id FOREIGN KEY(team_id) REFERENCES team(id) ON DELETE CASCADE,
+    CONSTRAINT trs_owner_id FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    to_name VARCHAR(64),
+    to_email VARCHAR(320) NOT NULL,
+    subject VARCHAR(256) NOT NULL,
+    body TEXT NOT NULL,
+    text_body TEXT,
+    unsubscribe_url VARCHAR(512),
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_date TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_date TIMESTAMP,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_notification (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    title VARCHAR(256) NOT NULL,
+    content TEXT,
+    link VARCHAR(256),
+    sent_date TIMESTAMP,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT un_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team_integration (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    team_id TEXT NOT NULL,
+    webhook_url VARCHAR(1024) NOT NULL,
+    format VARCHAR(16) NOT NULL,
+    active BOOLEAN DEFAULT true,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ti_team_id_fkey FOREIGN KEY (team_id) REFERENCES team(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS team_tracker (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    team_id TEXT NOT NULL,
+    provider VARCHAR(16) NOT NULL,
+    base_url VARCHAR(512) NOT NULL DEFAULT '',
+    project VARCHAR(256) NOT NULL,
+    username VARCHAR(320) NOT NULL DEFAULT '',
+    token VARCHAR(512) NOT NULL,
+    webhook_secret TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    active BOOLEAN DEFAULT true,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT tt_team_id_fkey FOREIGN KEY (team_id) REFERENCES team(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_impersonation (
+    id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))) PRIMARY KEY,
+    admin_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    reason VARCHAR(512) NOT NULL DEFAULT '',
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expire_date TIMESTAMP NOT NULL,
+    ended_date TIMESTAMP,
+    CONSTRAINT ui_admin_id_fkey FOREIGN KEY (admin_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT ui_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+--
+-- Views
+--
+CREATE VIEW IF NOT EXISTS active_countries AS SELECT DISTINCT country FROM users;
+
+--
+-- Schema Version, recorded once the schema above is applied, must match schemaVersion in lib/database/health.go
+--
+INSERT INTO schema_migration (version) VALUES ('2026-10-19.2') ON CONFLICT DO NOTHING;
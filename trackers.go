@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/StevenWeathers/wakita-retro-tool/lib/database"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/logging"
+	"github.com/StevenWeathers/wakita-retro-tool/lib/tracker"
+)
+
+// the longest ticket title created from an action, longer actions are truncated (the description has them in full)
+const ticketTitleMaxLength = 200
+
+// trackerProvider gets the Provider of an active team tracker, nil when the tracker is missing or paused
+func (s *server) trackerProvider(ctx context.Context, TrackerID string) tracker.Provider {
+	Tracker, err := s.database.TeamTrackerGet(ctx, TrackerID)
+	if err != nil || !Tracker.Active {
+		return nil
+	}
+
+	provider, err := s.tracker.Provider(Tracker)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting tracker provider", "tracker_id", TrackerID, "error", err)
+		return nil
+	}
+
+	return provider
+}
+
+// createActionTicket creates a ticket for the action in one of the retrospective teams trackers and links it to the action,
+// the action is reserved first so it only ever gets one ticket, the reservation is released when the ticket
+// can't be created or linked and expires when the replica creating the ticket stops
+func (s *server) createActionTicket(ctx context.Context, RetrospectiveID string, userID string, ActionID string, TrackerID string) ([]*database.RetrospectiveAction, error) {
+	claimed, err := s.database.RetrospectiveActionClaimTicket(ctx, RetrospectiveID, userID, ActionID, TrackerID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errors.New("action already has a ticket or the tracker is not available")
+	}
+
+	Ticket, err := s.createTicket(ctx, RetrospectiveID, ActionID, TrackerID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error creating action ticket", "retrospective_id", RetrospectiveID, "action_id", ActionID, "tracker_id", TrackerID, "error", err)
+		s.database.RetrospectiveActionReleaseTicket(ctx, RetrospectiveID, ActionID)
+		return nil, err
+	}
+
+	Actions, err := s.database.SetRetrospectiveActionTicket(ctx, RetrospectiveID, ActionID, Ticket.Key, Ticket.URL)
+	if err != nil {
+		logging.FromContext(ctx).Error("error linking action ticket", "retrospective_id", RetrospectiveID, "action_id", ActionID, "tracker_id", TrackerID, "ticket", Ticket.Key, "error", err)
+		s.database.RetrospectiveActionReleaseTicket(ctx, RetrospectiveID, ActionID)
+		return nil, err
+	}
+
+	return Actions, nil
+}
+
+// createTicket creates the ticket of the action, titled with the action and linking back to the retrospective
+func (s *server) createTicket(ctx context.Context, RetrospectiveID string, ActionID string, TrackerID string) (*tracker.Ticket, error) {
+	provider := s.trackerProvider(ctx, TrackerID)
+	if provider == nil {
+		return nil, errors.New("tracker not found")
+	}
+
+	Retrospective, err := s.database.GetRetrospective(ctx, RetrospectiveID)
+	if err != nil {
+		return nil, err
+	}
+
+	var Action *database.RetrospectiveAction
+	for _, a := range Retrospective.ActionItems {
+		if a.ID == ActionID {
+			Action = a
+		}
+	}
+	if Action == nil {
+		return nil, errors.New("action not found")
+	}
+
+	Title := strings.TrimSpace(strings.SplitN(Action.Content, "\n", 2)[0])
+	if runes := []rune(Title); len(runes) > ticketTitleMaxLength {
+		Title = string(runes[:ticketTitleMaxLength-3]) + "..."
+	}
+	Description := Action.Content + "\n\nAction item from the retrospective " + Retrospective.RetrospectiveName + ": " +
+		"https://" + s.config.AppDomain + s.config.PathPrefix + "/retrospective/" + RetrospectiveID
+
+	return provider.CreateTicket(ctx, Title, Description)
+}
+
+// completeTrackerTicket completes the actions linked to a closed ticket and updates their retrospectives open sessions
+func (s *server) completeTrackerTicket(ctx context.Context, TrackerID string, ExternalKey string) {
+	RetrospectiveIDs, err := s.database.TrackerCompleteAction(ctx, TrackerID, ExternalKey)
+	if err != nil {
+		return
+	}
+
+	for _, RetrospectiveID := range RetrospectiveIDs {
+		updatedActions, _ := json.Marshal(s.database.GetRetrospectiveActions(ctx, RetrospectiveID))
+		h.broadcast <- message{CreateSocketEvent("action_updated", string(updatedActions), ""), RetrospectiveID}
+	}
+}